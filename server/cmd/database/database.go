@@ -41,6 +41,13 @@ func Connect() {
 
 	log.Println("Database connected successfully")
 
+	if err := normalizeBarcodes(DB); err != nil {
+		log.Fatal("Failed to prepare variant barcodes: ", err)
+	}
+	if err := numberReturns(DB); err != nil {
+		log.Fatal("Failed to number existing returns: ", err)
+	}
+
 	// Auto-migrate all models
 	err = DB.AutoMigrate(
 		&domain.User{},
@@ -48,24 +55,59 @@ func Connect() {
 		&domain.Category{},
 		&domain.Product{},
 		&domain.ProductVariant{},
+		&domain.ProductOption{},
+		&domain.ProductOptionValue{},
 		&domain.Tag{},
 		&domain.ProductTag{},
+		&domain.ProductTranslation{},
+		&domain.CategoryTranslation{},
+		&domain.TagTranslation{},
+		&domain.WishlistItem{},
+		&domain.StockSubscription{},
 		&domain.Stock{},
+		&domain.StockReservation{},
 		&domain.StockMovement{},
+		&domain.StockTransfer{},
 		&domain.StockAssembly{},
 		&domain.ProductRecipe{},
 		&domain.SalesOrder{},
 		&domain.SalesOrderItem{},
+		&domain.Return{},
+		&domain.Cart{},
+		&domain.CartItem{},
 		&domain.POSSession{},
 		&domain.POSCashMove{},
 		&domain.PurchaseOrder{},
 		&domain.PurchaseOrderItem{},
 		&domain.Supplier{},
 		&domain.Invoice{},
+		&domain.FinancialAccount{},
+		&domain.Payment{},
+		&domain.GiftCard{},
+		&domain.GiftCardTransaction{},
+		&domain.StoreCreditEntry{},
+		&domain.LoyaltyProgram{},
+		&domain.LoyaltyCategoryMultiplier{},
+		&domain.LoyaltyEntry{},
 		&domain.Promotion{},
 		&domain.PromotionUsage{},
 		&domain.SalesOrderPromotion{},
+		&domain.MarketingConsent{},
+		&domain.CartReminder{},
+		&domain.SubscriptionPlan{},
+		&domain.SubscriptionPlanItem{},
+		&domain.Subscription{},
+		&domain.SubscriptionItem{},
+		&domain.TaxRule{},
+		&domain.DocumentSeries{},
+		&domain.DocumentCounter{},
+		&domain.ShippingZone{},
+		&domain.ShippingMethod{},
+		&domain.ShippingRate{},
 		&domain.MediaAsset{},
+		&domain.MediaRendition{},
+		&domain.MediaLink{},
+		&domain.IdempotencyKey{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database: ", err)
@@ -73,3 +115,47 @@ func Connect() {
 
 	log.Println("Database migrated successfully")
 }
+
+// normalizeBarcodes prepares existing variants for the unique index on
+// barcode: empty codes become NULL and duplicates are cleared on all but the
+// oldest variant, which can then be given internal codes.
+func normalizeBarcodes(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&domain.ProductVariant{}) || !m.HasColumn(&domain.ProductVariant{}, "barcode") {
+		return nil
+	}
+	if err := db.Exec("UPDATE product_variants SET barcode = NULL WHERE TRIM(barcode) = ''").Error; err != nil {
+		return err
+	}
+	res := db.Exec(`UPDATE product_variants SET barcode = NULL WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY barcode ORDER BY id) AS n
+			FROM product_variants WHERE barcode IS NOT NULL
+		) dup WHERE n > 1)`)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("Cleared %d duplicate variant barcodes; assign new ones from the admin", res.RowsAffected)
+	}
+	return nil
+}
+
+// numberReturns gives returns recorded before return numbers existed a
+// legacy number (LEGACY-RET-<id>), so the column can be NOT NULL and unique.
+// The gap-free series is left to new returns.
+func numberReturns(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&domain.Return{}) {
+		return nil
+	}
+	if !m.HasColumn(&domain.Return{}, "return_number") {
+		if err := db.Exec("ALTER TABLE returns ADD COLUMN return_number varchar(64)").Error; err != nil {
+			return err
+		}
+	}
+	if err := db.Exec("UPDATE returns SET return_number = 'LEGACY-RET-' || id WHERE return_number IS NULL").Error; err != nil {
+		return err
+	}
+	return db.Exec("ALTER TABLE returns ALTER COLUMN return_number SET NOT NULL").Error
+}
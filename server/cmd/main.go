@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"server/cmd/database"
+	"server/http/middleware"
 	v1 "server/http/v1"
 	"server/http/v1/handlers"
 	"server/internal/core/domain"
+	"server/internal/jobs"
+	"server/internal/notify"
+	"server/internal/payment"
 	"server/internal/repository"
 	"server/internal/service"
+	"server/internal/storage"
+	"server/internal/tax"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -33,6 +42,7 @@ func main() {
 	movementRepo := repository.NewMovementRepository(database.DB)
 	locationRepo := repository.NewGormRepository[domain.InventoryLocation](database.DB)
 	orderRepo := repository.NewOrderRepository(database.DB)
+	cartRepo := repository.NewCartRepository(database.DB)
 	sessionRepo := repository.NewGormRepository[domain.POSSession](database.DB)
 	cashMoveRepo := repository.NewGormRepository[domain.POSCashMove](database.DB)
 	poRepo := repository.NewGormRepository[domain.PurchaseOrder](database.DB)
@@ -41,34 +51,111 @@ func main() {
 	mediaLinkRepo := repository.NewMediaLinkRepository(database.DB)
 	assemblyRepo := repository.NewAssemblyRepository(database.DB)
 	recipeRepo := repository.NewRecipeRepository(database.DB)
+	translationRepo := repository.NewTranslationRepository(database.DB)
+	taxRuleRepo := repository.NewGormRepository[domain.TaxRule](database.DB)
+	idempotencyRepo := repository.NewIdempotencyRepository(database.DB)
+
+	notifier, err := notify.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to create notifier: %v", err)
+	}
+
+	disks, err := storage.NewRegistryFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+	log.Printf("Storage disks: %v (default: %s)", disks.Names(), disks.Default())
+
+	paymentProvider, err := payment.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure payment provider: %v", err)
+	}
+
+	taxConfig, err := tax.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure tax: %v", err)
+	}
 
 	// Services
 	authService := service.NewAuthService(userRepo, os.Getenv("JWT_SECRET"))
-	userService := service.NewUserService(userRepo, addrRepo)
-	catalogService := service.NewCatalogService(productRepo, categoryRepo, variantRepo, tagRepo, database.DB)
+	userService := service.NewUserService(userRepo, addrRepo, notifier, database.DB)
+	mediaService := service.NewMediaService(mediaRepo, mediaLinkRepo, disks)
+	catalogService := service.NewCatalogService(productRepo, categoryRepo, variantRepo, tagRepo, translationRepo, mediaService, database.DB)
 	marketingService := service.NewMarketingService(database.DB)
-	cartService := service.NewCartService(marketingService)
+	taxService := service.NewTaxService(taxRuleRepo, database.DB, taxConfig)
+	shippingService := service.NewShippingService(database.DB)
+	numberingService := service.NewNumberingService(database.DB)
+	cartTTL := 30 * 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("CART_TTL")); err == nil && v > 0 {
+		cartTTL = v
+	}
+	cartService := service.NewCartService(marketingService, taxService, shippingService, cartRepo, database.DB, cartTTL)
 	inventoryService := service.NewInventoryService(stockRepo, movementRepo, locationRepo, database.DB)
-	orderService := service.NewOrderService(orderRepo, inventoryService, database.DB)
-	posService := service.NewPOSService(sessionRepo, cashMoveRepo)
-	assemblyService := service.NewAssemblyService(recipeRepo, assemblyRepo, inventoryService)
-	procurementService := service.NewProcurementService(poRepo, supplierRepo, inventoryService)
+	inventoryService.OnRestock(userService.NotifyRestocked)
+	reservationTTL := 30 * time.Minute
+	if v, err := time.ParseDuration(os.Getenv("STOCK_RESERVATION_TTL")); err == nil && v > 0 {
+		reservationTTL = v
+	}
+	orderService := service.NewOrderService(orderRepo, inventoryService, database.DB, reservationTTL)
+	posService := service.NewPOSService(sessionRepo, cashMoveRepo, variantRepo, stockRepo, taxService, database.DB)
+	assemblyService := service.NewAssemblyService(recipeRepo, assemblyRepo, inventoryService, database.DB)
+	procurementService := service.NewProcurementService(poRepo, supplierRepo, inventoryService, taxService, database.DB)
 	fulfillmentService := service.NewFulfillmentService(orderRepo)
-	financeService := service.NewFinanceService()
-	mediaService, err := service.NewMediaService(mediaRepo, mediaLinkRepo)
-	if err != nil {
-		log.Fatalf("Failed to create media service: %v", err)
+	financeService := service.NewFinanceService(database.DB)
+	paymentService := service.NewPaymentService(paymentProvider, database.DB)
+	backorderService := service.NewBackorderService(database.DB, notifier, paymentService)
+	procurementService.OnReceive(backorderService.AllocateReceipt)
+	storedValueService := service.NewStoredValueService(database.DB, notifier)
+	loyaltyService := service.NewLoyaltyService(database.DB)
+	apiBaseURL := os.Getenv("API_BASE_URL")
+	if apiBaseURL == "" {
+		apiBaseURL = "http://localhost:8080"
 	}
+	recoveryConfig := service.CartRecoveryConfig{
+		IdleAfter:         4 * time.Hour,
+		CouponTTL:         72 * time.Hour,
+		AttributionWindow: 7 * 24 * time.Hour,
+		SigningKey:        []byte(os.Getenv("MARKETING_SIGNING_KEY")),
+		UnsubscribeURL:    apiBaseURL + "/api/v1/store/marketing/unsubscribe",
+	}
+	if v, err := time.ParseDuration(os.Getenv("ABANDONED_CART_AFTER")); err == nil && v > 0 {
+		recoveryConfig.IdleAfter = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ABANDONED_CART_PROMOTION_ID")); err == nil && v > 0 {
+		recoveryConfig.CouponTemplateID = &v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ABANDONED_CART_COUPON_TTL")); err == nil && v > 0 {
+		recoveryConfig.CouponTTL = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ABANDONED_CART_ATTRIBUTION")); err == nil && v > 0 {
+		recoveryConfig.AttributionWindow = v
+	}
+	if len(recoveryConfig.SigningKey) == 0 {
+		recoveryConfig.SigningKey = []byte(os.Getenv("JWT_SECRET"))
+	}
+	recoveryService := service.NewCartRecoveryService(database.DB, notifier, recoveryConfig)
+	subscriptionConfig := service.SubscriptionConfig{RetryAfter: 24 * time.Hour, MaxAttempts: 3}
+	if v, err := time.ParseDuration(os.Getenv("SUBSCRIPTION_RETRY_AFTER")); err == nil && v > 0 {
+		subscriptionConfig.RetryAfter = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_MAX_ATTEMPTS")); err == nil && v > 0 {
+		subscriptionConfig.MaxAttempts = v
+	}
+	subscriptionService := service.NewSubscriptionService(database.DB, cartService, orderService, paymentService, notifier, subscriptionConfig)
+	labelService := service.NewLabelService(catalogService, database.DB)
 
 	// Handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	storeHandler := handlers.NewStoreHandler(catalogService, cartService, orderService)
-	userHandler := handlers.NewUserHandler(userService, orderService, financeService)
-	posHandler := handlers.NewPOSHandler(posService, orderService)
-	opsHandler := handlers.NewOpsHandler(inventoryService, assemblyService, procurementService, fulfillmentService)
-	adminHandler := handlers.NewAdminHandler(catalogService, authService, userService, procurementService, marketingService, mediaService)
+	storeHandler := handlers.NewStoreHandler(catalogService, cartService, orderService, marketingService, paymentService, storedValueService, recoveryService)
+	userHandler := handlers.NewUserHandler(userService, orderService, financeService, storedValueService, loyaltyService, marketingService, paymentService, subscriptionService)
+	posHandler := handlers.NewPOSHandler(posService, orderService, paymentService, storedValueService)
+	opsHandler := handlers.NewOpsHandler(inventoryService, assemblyService, procurementService, fulfillmentService, labelService, backorderService)
+	adminHandler := handlers.NewAdminHandler(catalogService, authService, userService, procurementService, marketingService, mediaService, taxService, shippingService, numberingService, paymentService, storedValueService, loyaltyService, recoveryService, subscriptionService)
+	storageHandler := handlers.NewStorageHandler(disks)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit: 50 * 1024 * 1024, // Media uploads to the local disk go through the API
+	})
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
 		AllowMethods:     "*",
@@ -80,6 +167,70 @@ func main() {
 	module := os.Getenv("APP_MODULE")
 	log.Printf("Starting application with module: %s", module)
 
-	v1.SetupRoutes(app, module, authHandler, storeHandler, userHandler, posHandler, opsHandler, adminHandler)
+	// Background jobs run on the internal (back-office) deployment only
+	if module == "internal" || module == "" {
+		scheduler := jobs.NewScheduler()
+		scheduler.Every("media-processing", 30*time.Second, func(ctx context.Context) error {
+			_, err := mediaService.ProcessPending(ctx, 20)
+			return err
+		})
+		orphanGrace := 48 * time.Hour
+		if v, err := time.ParseDuration(os.Getenv("MEDIA_ORPHAN_GRACE")); err == nil && v > 0 {
+			orphanGrace = v
+		}
+		scheduler.Every("media-orphan-sweep", time.Hour, func(ctx context.Context) error {
+			_, err := mediaService.SweepOrphans(ctx, orphanGrace)
+			return err
+		})
+		scheduler.Every("cart-expiry", time.Hour, func(ctx context.Context) error {
+			_, err := cartService.ExpireCarts(ctx)
+			return err
+		})
+		scheduler.Every("order-expiry", time.Minute, func(ctx context.Context) error {
+			_, err := orderService.ExpireUnpaidOrders(ctx)
+			return err
+		})
+		scheduler.Every("gift-card-delivery", time.Minute, func(ctx context.Context) error {
+			_, err := storedValueService.DeliverGiftCards(ctx)
+			return err
+		})
+		scheduler.Every("loyalty-expiry", time.Hour, func(ctx context.Context) error {
+			_, err := loyaltyService.ExpirePoints(ctx)
+			return err
+		})
+		scheduler.Every("cart-recovery", 10*time.Minute, func(ctx context.Context) error {
+			_, err := recoveryService.SendReminders(ctx)
+			return err
+		})
+		scheduler.Every("subscription-run", 15*time.Minute, func(ctx context.Context) error {
+			_, err := subscriptionService.RunDue(ctx)
+			return err
+		})
+		scheduler.Every("idempotency-key-sweep", time.Hour, func(ctx context.Context) error {
+			_, err := idempotencyRepo.DeleteExpired(ctx, time.Now())
+			return err
+		})
+		scheduler.Start(context.Background())
+	}
+
+	idempotencyTTL := 24 * time.Hour
+	if v, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && v > 0 {
+		idempotencyTTL = v
+	}
+	// Longer than any request runs, so only claims of crashed requests lapse
+	idempotencyLease := 5 * time.Minute
+	if v, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_LEASE")); err == nil && v > 0 {
+		idempotencyLease = v
+	}
+	idempotent := middleware.Idempotency(idempotencyRepo, idempotencyTTL, idempotencyLease)
+
+	// How long a user's saved locale is trusted before it is read again
+	localeTTL := time.Minute
+	if v, err := time.ParseDuration(os.Getenv("LOCALE_CACHE_TTL")); err == nil && v > 0 {
+		localeTTL = v
+	}
+	locale := middleware.Locale(userRepo, localeTTL)
+
+	v1.SetupRoutes(app, module, authHandler, storeHandler, userHandler, posHandler, opsHandler, adminHandler, storageHandler, idempotent, locale)
 	log.Fatal(app.Listen(":8080"))
 }
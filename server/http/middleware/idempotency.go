@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"server/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+
+	cartTokenHeader = "X-Cart-Token"
+)
+
+// 4. Idempotency: Requests sent with an Idempotency-Key header run once per
+// caller and route. A retry with the same body gets the stored response back
+// (marked Idempotent-Replayed); the same key with a different body is
+// rejected. Every response is stored, server errors included, since a failed
+// request may already have written something; retry those with a new key.
+// A request still running after lease is taken to have died with the server,
+// and its key can be claimed again.
+// Must come after Protect/OptionalAuth so the caller is known.
+func Idempotency(repo repository.IdempotencyRepository, ttl, lease time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := strings.TrimSpace(c.Get(IdempotencyHeader))
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		sum := sha256.Sum256(c.Body())
+		fingerprint := hex.EncodeToString(sum[:])
+
+		now := time.Now()
+		rec, created, err := repo.Claim(c.Context(), idempotencyScope(c), key, fingerprint, now.Add(ttl), now.Add(-lease))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !created {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+			case rec.ResponseStatus == 0:
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still in progress"})
+			}
+			c.Set("Idempotent-Replayed", "true")
+			if rec.ContentType != "" {
+				c.Set(fiber.HeaderContentType, rec.ContentType)
+			}
+			return c.Status(rec.ResponseStatus).Send(rec.ResponseBody)
+		}
+
+		if err := c.Next(); err != nil {
+			// Let the app's error handler answer, then store what it sent
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				return herr
+			}
+		}
+		// Bookkeeping outlives the request, hence the background context
+		body := append([]byte(nil), c.Response().Body()...)
+		if err := repo.Complete(context.Background(), rec.ID, c.Response().StatusCode(), body, string(c.Response().Header.ContentType())); err != nil {
+			log.Printf("idempotency: storing response for key %d: %v", rec.ID, err)
+		}
+		return nil
+	}
+}
+
+// idempotencyScope ties keys to the caller and route, so clients cannot
+// collide with or replay each other's keys. Guests are told apart by their
+// cart token (hashed, it is a bearer secret), or else by address.
+func idempotencyScope(c *fiber.Ctx) string {
+	var caller string
+	if uid, ok := c.Locals("userID").(int); ok {
+		caller = fmt.Sprintf("user:%d", uid)
+	} else if token := c.Get(cartTokenHeader); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		caller = "cart:" + hex.EncodeToString(sum[:])
+	} else {
+		caller = "guest:" + c.IP()
+	}
+	return caller + " " + c.Method() + " " + c.Path()
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"server/internal/core/domain"
+	"server/internal/i18n"
+	"server/internal/repository"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 3. Locale: Resolves the content language into c.Locals("locale")
+// Order: ?lang= -> logged-in user's saved locale -> Accept-Language -> default
+// The user's locale is read from their record, not the token, and kept for
+// ttl, so a profile change applies within ttl without a query per request.
+func Locale(users repository.Repository[domain.User], ttl time.Duration) fiber.Handler {
+	cache := &localeCache{ttl: ttl, entries: map[int]localeEntry{}}
+	return func(c *fiber.Ctx) error {
+		c.Locals("locale", resolveLocale(c, users, cache))
+		return c.Next()
+	}
+}
+
+type localeEntry struct {
+	locale    string // "" when the user has none saved
+	expiresAt time.Time
+}
+
+// localeCache holds users' saved locales for a short while.
+type localeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int]localeEntry
+}
+
+func (lc *localeCache) get(ctx context.Context, users repository.Repository[domain.User], userID int) string {
+	now := time.Now()
+	lc.mu.Lock()
+	entry, ok := lc.entries[userID]
+	lc.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.locale
+	}
+
+	user, err := users.FindByID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	entry = localeEntry{expiresAt: now.Add(lc.ttl)}
+	if user.Locale != nil && i18n.IsSupported(*user.Locale) {
+		entry.locale = i18n.Normalize(*user.Locale)
+	}
+	lc.mu.Lock()
+	// Drop expired entries now and then, so the map does not keep every
+	// user seen since startup
+	if len(lc.entries) > 10000 {
+		for id, e := range lc.entries {
+			if now.After(e.expiresAt) {
+				delete(lc.entries, id)
+			}
+		}
+	}
+	lc.entries[userID] = entry
+	lc.mu.Unlock()
+	return entry.locale
+}
+
+func resolveLocale(c *fiber.Ctx, users repository.Repository[domain.User], cache *localeCache) string {
+	if lang := c.Query("lang"); lang != "" && i18n.IsSupported(lang) {
+		return i18n.Normalize(lang)
+	}
+
+	if authHeader := c.Get("Authorization"); authHeader != "" {
+		if claims, err := parseToken(authHeader); err == nil {
+			if sub, ok := claims["sub"].(float64); ok {
+				if l := cache.get(c.Context(), users, int(sub)); l != "" {
+					return l
+				}
+			}
+		}
+	}
+
+	// Default comes first, so an empty or wildcard header resolves to it
+	if l := c.AcceptsLanguages(i18n.Supported()...); l != "" {
+		return l
+	}
+	return i18n.Default()
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"os"
 	"server/internal/core/domain"
 	"strings"
@@ -17,20 +18,9 @@ func Protect() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing authorization header"})
 		}
 
-		// Remove "Bearer " prefix
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
+		claims, err := parseToken(authHeader)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 		}
 
 		// Inject into context for Handlers to use
@@ -47,6 +37,28 @@ func Protect() fiber.Handler {
 	}
 }
 
+// OptionalAuth injects UserID/Role like Protect when a token is sent, but lets
+// anonymous requests through (guest carts). A bad token is still rejected.
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" {
+			return c.Next()
+		}
+
+		claims, err := parseToken(authHeader)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if sub, ok := claims["sub"].(float64); ok {
+			c.Locals("userID", int(sub))
+		}
+		c.Locals("role", claims["role"])
+
+		return c.Next()
+	}
+}
+
 // 2. Authorize: Checks if user has one of the required roles
 func Authorize(allowedRoles ...domain.UserRole) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -67,3 +79,22 @@ func Authorize(allowedRoles ...domain.UserRole) fiber.Handler {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied: Insufficient privileges"})
 	}
 }
+
+func parseToken(authHeader string) (jwt.MapClaims, error) {
+	// Remove "Bearer " prefix
+	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("Invalid token claims")
+	}
+	return claims, nil
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"math"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"server/internal/i18n"
 	"server/internal/service"
 	"strconv"
 	"strings"
@@ -19,9 +22,17 @@ type AdminHandler struct {
 	procurementService service.ProcurementService
 	marketingService   service.MarketingService
 	mediaService       service.MediaService
+	taxService         service.TaxService
+	shippingService    service.ShippingService
+	numberingService   service.NumberingService
+	paymentService     service.PaymentService
+	storedValue        service.StoredValueService
+	loyalty            service.LoyaltyService
+	recovery           service.CartRecoveryService
+	subscriptions      service.SubscriptionService
 }
 
-func NewAdminHandler(catalogS service.CatalogService, authS service.AuthService, userS service.UserService, procurementS service.ProcurementService, marketingS service.MarketingService, mediaS service.MediaService) *AdminHandler {
+func NewAdminHandler(catalogS service.CatalogService, authS service.AuthService, userS service.UserService, procurementS service.ProcurementService, marketingS service.MarketingService, mediaS service.MediaService, taxS service.TaxService, shippingS service.ShippingService, numberingS service.NumberingService, paymentS service.PaymentService, storedValueS service.StoredValueService, loyaltyS service.LoyaltyService, recoveryS service.CartRecoveryService, subscriptionS service.SubscriptionService) *AdminHandler {
 	return &AdminHandler{
 		catalogService:     catalogS,
 		authService:        authS,
@@ -29,6 +40,14 @@ func NewAdminHandler(catalogS service.CatalogService, authS service.AuthService,
 		procurementService: procurementS,
 		marketingService:   marketingS,
 		mediaService:       mediaS,
+		taxService:         taxS,
+		shippingService:    shippingS,
+		numberingService:   numberingS,
+		paymentService:     paymentS,
+		storedValue:        storedValueS,
+		loyalty:            loyaltyS,
+		recovery:           recoveryS,
+		subscriptions:      subscriptionS,
 	}
 }
 
@@ -155,11 +174,127 @@ func (h *AdminHandler) ForceDeleteProduct(c *fiber.Ctx) error {
 
 // Variants
 func (h *AdminHandler) GetVariants(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	variants, err := h.catalogService.GetVariants(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(variants)
 }
 
 func (h *AdminHandler) UpdateVariants(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req []dto.ProductVariantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	variants := make([]domain.ProductVariant, 0, len(req))
+	for i := range req {
+		variants = append(variants, req[i].ToDomain())
+	}
+
+	if err := h.catalogService.UpdateVariants(c.Context(), id, variants); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	updated, err := h.catalogService.GetVariants(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(updated)
+}
+
+func (h *AdminHandler) GetProductOptions(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	options, err := h.catalogService.GetProductOptions(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(options)
+}
+
+func (h *AdminHandler) SetProductOptions(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req []dto.ProductOptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	options := make([]domain.ProductOption, 0, len(req))
+	for _, o := range req {
+		opt := domain.ProductOption{Name: o.Name}
+		for _, v := range o.Values {
+			opt.Values = append(opt.Values, domain.ProductOptionValue{
+				Value:      v.Value,
+				Code:       v.Code,
+				PriceDelta: v.PriceDelta,
+			})
+		}
+		options = append(options, opt)
+	}
+
+	saved, err := h.catalogService.SetProductOptions(c.Context(), id, options)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(saved)
+}
+
+func (h *AdminHandler) GenerateVariants(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.GenerateVariantsRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	result, err := h.catalogService.GenerateVariants(c.Context(), id, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+func (h *AdminHandler) AssignBarcodes(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.AssignBarcodesRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	variants, err := h.catalogService.AssignBarcodes(c.Context(), id, req.Symbology)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(variants)
 }
 
 // Media
@@ -180,6 +315,26 @@ func (h *AdminHandler) UploadMedia(c *fiber.Ctx) error {
 	})
 }
 
+// CompleteMediaUpload is called by the client once the PUT to upload_url has
+// finished; the asset cannot be linked or processed until it succeeds.
+func (h *AdminHandler) CompleteMediaUpload(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.CompleteMediaRequest
+	if err := c.BodyParser(&req); err != nil || req.Checksum == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "checksum is required"})
+	}
+
+	asset, err := h.mediaService.CompleteUpload(c.Context(), id, req.Checksum)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(asset)
+}
+
 func (h *AdminHandler) LinkMedia(c *fiber.Ctx) error {
 	var req dto.LinkMediaRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -206,6 +361,53 @@ func (h *AdminHandler) UnlinkMedia(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Media unlinked successfully"})
 }
 
+func (h *AdminHandler) ReorderMedia(c *fiber.Ctx) error {
+	var req dto.ReorderMediaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.mediaService.ReorderMedia(c.Context(), req.EntityType, req.EntityID, req.Zone, req.MediaIDs); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Media reordered"})
+}
+
+func (h *AdminHandler) SetPrimaryMedia(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.SetPrimaryMediaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.mediaService.SetPrimaryMedia(c.Context(), id, req.EntityType, req.EntityID); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Primary media updated"})
+}
+
+func (h *AdminHandler) EditMedia(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.EditMediaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	asset, err := h.mediaService.UpdateAltText(c.Context(), id, req.AltText)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(asset)
+}
+
 // Users
 func (h *AdminHandler) GetUsers(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNotImplemented)
@@ -475,12 +677,16 @@ func (h *AdminHandler) CreatePromotion(c *fiber.Ctx) error {
 	}
 
 	promo := &domain.Promotion{
-		Name:        req.Name,
-		Code:        &req.Code,
-		IsExclusive: req.IsExclusive,
-		IsActive:    true,
-		Conditions:  req.Conditions,
-		Actions:     req.Actions,
+		Name:            req.Name,
+		Code:            &req.Code,
+		Priority:        req.Priority,
+		IsExclusive:     req.IsExclusive,
+		IsActive:        true,
+		Conditions:      req.Conditions,
+		Actions:         req.Actions,
+		TotalUsageLimit: req.TotalUsageLimit,
+		PerUserLimit:    req.PerUserLimit,
+		IsTemplate:      req.IsTemplate,
 	}
 
 	if req.StartsAt != "" {
@@ -500,6 +706,9 @@ func (h *AdminHandler) CreatePromotion(c *fiber.Ctx) error {
 	}
 
 	err := h.marketingService.CreatePromotion(c.Context(), promo)
+	if errors.Is(err, service.ErrInvalidPromotion) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -519,6 +728,9 @@ func (h *AdminHandler) UpdatePromotion(c *fiber.Ctx) error {
 	}
 
 	err = h.marketingService.UpdatePromotion(c.Context(), id, req)
+	if errors.Is(err, service.ErrInvalidPromotion) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -526,6 +738,23 @@ func (h *AdminHandler) UpdatePromotion(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Promotion updated successfully"})
 }
 
+// SimulatePromotions runs a what-if cart through the promotion engine.
+func (h *AdminHandler) SimulatePromotions(c *fiber.Ctx) error {
+	var req dto.SimulatePromotionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one item is required"})
+	}
+
+	result, err := h.marketingService.SimulatePromotions(c.Context(), req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
 func (h *AdminHandler) DeletePromotion(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -539,14 +768,737 @@ func (h *AdminHandler) DeletePromotion(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "Promotion deleted (soft delete)"})
 }
+
+// Translations
+func (h *AdminHandler) GetProductTranslations(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	translations, err := h.catalogService.GetProductTranslations(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(translations)
+}
+
+func (h *AdminHandler) SaveProductTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.TranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	t := &domain.ProductTranslation{
+		ProductID:   id,
+		Locale:      i18n.Normalize(c.Params("locale")),
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := h.catalogService.SaveProductTranslation(c.Context(), t); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(t)
+}
+
+func (h *AdminHandler) DeleteProductTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if err := h.catalogService.DeleteProductTranslation(c.Context(), id, i18n.Normalize(c.Params("locale"))); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Translation deleted"})
+}
+
+func (h *AdminHandler) GetCategoryTranslations(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	translations, err := h.catalogService.GetCategoryTranslations(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(translations)
+}
+
+func (h *AdminHandler) SaveCategoryTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.TranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	t := &domain.CategoryTranslation{
+		CategoryID:  id,
+		Locale:      i18n.Normalize(c.Params("locale")),
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := h.catalogService.SaveCategoryTranslation(c.Context(), t); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(t)
+}
+
+func (h *AdminHandler) DeleteCategoryTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if err := h.catalogService.DeleteCategoryTranslation(c.Context(), id, i18n.Normalize(c.Params("locale"))); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Translation deleted"})
+}
+
+func (h *AdminHandler) GetTagTranslations(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	translations, err := h.catalogService.GetTagTranslations(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(translations)
+}
+
+func (h *AdminHandler) SaveTagTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.TranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	t := &domain.TagTranslation{
+		TagID:       id,
+		Locale:      i18n.Normalize(c.Params("locale")),
+		DisplayName: req.DisplayName,
+	}
+	if err := h.catalogService.SaveTagTranslation(c.Context(), t); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(t)
+}
+
+func (h *AdminHandler) DeleteTagTranslation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if err := h.catalogService.DeleteTagTranslation(c.Context(), id, i18n.Normalize(c.Params("locale"))); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Translation deleted"})
+}
+
+// Data Import/Export
 func (h *AdminHandler) ExportProducts(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	data, err := h.catalogService.ExportProducts(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "text/csv")
+	c.Set("Content-Disposition", "attachment; filename=products.csv")
+	return c.Send(data)
 }
 
 func (h *AdminHandler) ImportProducts(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "CSV file is required (form field 'file')"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unable to read file"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unable to read file"})
+	}
+
+	created, updated, err := h.catalogService.ImportProducts(c.Context(), data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Products imported",
+		"created": created,
+		"updated": updated,
+	})
 }
 
 func (h *AdminHandler) ImportInventoryAdjustments(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNotImplemented)
 }
+
+// Tax rules
+func (h *AdminHandler) GetTaxRules(c *fiber.Ctx) error {
+	rules, err := h.taxService.GetTaxRules(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rules)
+}
+
+func (h *AdminHandler) CreateTaxRule(c *fiber.Ctx) error {
+	var req dto.CreateTaxRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	rule := &domain.TaxRule{
+		Name:     req.Name,
+		Rate:     req.Rate,
+		Priority: req.Priority,
+		IsActive: true,
+	}
+	if req.TaxClass != "" {
+		rule.TaxClass = &req.TaxClass
+	}
+	if req.CustomerType != "" {
+		ct := domain.CustomerType(strings.ToUpper(req.CustomerType))
+		rule.CustomerType = &ct
+	}
+	if req.Region != "" {
+		rule.Region = &req.Region
+	}
+
+	if err := h.taxService.CreateTaxRule(c.Context(), rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+func (h *AdminHandler) UpdateTaxRule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req dto.UpdateTaxRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	rule, err := h.taxService.UpdateTaxRule(c.Context(), id, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rule)
+}
+
+func (h *AdminHandler) DeleteTaxRule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if err := h.taxService.DeleteTaxRule(c.Context(), id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Tax rule deactivated"})
+}
+
+// Shipping
+func (h *AdminHandler) GetShippingMethods(c *fiber.Ctx) error {
+	methods, err := h.shippingService.GetShippingMethods(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(methods)
+}
+
+func (h *AdminHandler) CreateShippingMethod(c *fiber.Ctx) error {
+	return h.saveShippingMethod(c, 0)
+}
+
+// UpdateShippingMethod replaces the method; rates are updated by id.
+func (h *AdminHandler) UpdateShippingMethod(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	return h.saveShippingMethod(c, id)
+}
+
+func (h *AdminHandler) saveShippingMethod(c *fiber.Ctx, id int) error {
+	var req dto.ShippingMethodRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	method := &domain.ShippingMethod{
+		ID:                id,
+		Code:              req.Code,
+		Name:              req.Name,
+		Carrier:           req.Carrier,
+		FlatPrice:         req.FlatPrice,
+		FreeOver:          req.FreeOver,
+		VolumetricDivisor: req.VolumetricDivisor,
+		AllowsLivePlants:  req.AllowsLivePlants,
+		EtaMinDays:        req.EtaMinDays,
+		EtaMaxDays:        req.EtaMaxDays,
+		Position:          req.Position,
+		IsActive:          req.IsActive == nil || *req.IsActive,
+	}
+	for _, r := range req.Rates {
+		method.Rates = append(method.Rates, domain.ShippingRate{
+			ID:          r.ID,
+			ZoneID:      r.ZoneID,
+			MinWeightKG: r.MinWeightKG,
+			MaxWeightKG: r.MaxWeightKG,
+			BasePrice:   r.BasePrice,
+			PricePerKG:  r.PricePerKG,
+			EtaMinDays:  r.EtaMinDays,
+			EtaMaxDays:  r.EtaMaxDays,
+		})
+	}
+
+	if err := h.shippingService.SaveShippingMethod(c.Context(), method); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if id == 0 {
+		return c.Status(fiber.StatusCreated).JSON(method)
+	}
+	return c.JSON(method)
+}
+
+func (h *AdminHandler) DeleteShippingMethod(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	if err := h.shippingService.DeleteShippingMethod(c.Context(), id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Shipping method deactivated"})
+}
+
+func (h *AdminHandler) GetShippingZones(c *fiber.Ctx) error {
+	zones, err := h.shippingService.GetShippingZones(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(zones)
+}
+
+func (h *AdminHandler) CreateShippingZone(c *fiber.Ctx) error {
+	return h.saveShippingZone(c, 0)
+}
+
+func (h *AdminHandler) UpdateShippingZone(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	return h.saveShippingZone(c, id)
+}
+
+func (h *AdminHandler) saveShippingZone(c *fiber.Ctx, id int) error {
+	var req dto.ShippingZoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	zone := &domain.ShippingZone{
+		ID:             id,
+		Name:           req.Name,
+		PostalPrefixes: req.PostalPrefixes,
+		Cities:         req.Cities,
+		Provinces:      req.Provinces,
+	}
+	if err := h.shippingService.SaveShippingZone(c.Context(), zone); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if id == 0 {
+		return c.Status(fiber.StatusCreated).JSON(zone)
+	}
+	return c.JSON(zone)
+}
+
+func (h *AdminHandler) DeleteShippingZone(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	if err := h.shippingService.DeleteShippingZone(c.Context(), id); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Shipping zone deleted"})
+}
+
+// Document numbering
+func (h *AdminHandler) GetNumberingSeries(c *fiber.Ctx) error {
+	series, err := h.numberingService.GetSeries(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(series)
+}
+
+func (h *AdminHandler) UpdateNumberingSeries(c *fiber.Ctx) error {
+	var req dto.DocumentSeriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	series := &domain.DocumentSeries{
+		DocType:         domain.DocumentType(strings.ToUpper(c.Params("doc_type"))),
+		Prefix:          req.Prefix,
+		IncludeYear:     req.IncludeYear,
+		IncludeLocation: req.IncludeLocation,
+		Padding:         req.Padding,
+		YearlyReset:     req.YearlyReset,
+	}
+	if err := h.numberingService.UpdateSeries(c.Context(), series); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(series)
+}
+
+// Payments
+func (h *AdminHandler) GetOrderPayments(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	payments, err := h.paymentService.GetPayments(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(payments)
+}
+
+func (h *AdminHandler) RefundOrder(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.RefundRequest
+	if err := c.BodyParser(&req); err != nil || req.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A positive amount is required"})
+	}
+
+	refunds, err := h.paymentService.Refund(c.Context(), id, req.Amount, req.ToStoreCredit)
+	if err != nil {
+		if errors.Is(err, service.ErrRefundExceedsPaid) || errors.Is(err, service.ErrNoCustomer) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrRefundFailed) {
+			// Stored-value parts went through; the failed rows show what is left
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error(), "refunds": refunds})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(refunds)
+}
+
+// Gift cards & store credit
+func (h *AdminHandler) GetGiftCards(c *fiber.Ctx) error {
+	cards, err := h.storedValue.GetGiftCards(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(cards)
+}
+
+func (h *AdminHandler) IssueGiftCard(c *fiber.Ctx) error {
+	var req dto.IssueGiftCardRequest
+	if err := c.BodyParser(&req); err != nil || req.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A positive amount is required"})
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	card, err := h.storedValue.IssueGiftCard(c.Context(), req, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(card)
+}
+
+func (h *AdminHandler) GetGiftCard(c *fiber.Ctx) error {
+	card, err := h.storedValue.GetGiftCard(c.Context(), c.Params("code"))
+	if err != nil {
+		if errors.Is(err, service.ErrGiftCardNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(card)
+}
+
+func (h *AdminHandler) UpdateGiftCard(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.UpdateGiftCardRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Status != nil && *req.Status != string(domain.GiftCardActive) && *req.Status != string(domain.GiftCardDisabled) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Status must be ACTIVE or DISABLED"})
+	}
+
+	card, err := h.storedValue.UpdateGiftCard(c.Context(), id, req)
+	if err != nil {
+		if errors.Is(err, service.ErrGiftCardNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(card)
+}
+
+func (h *AdminHandler) GetStoreCredit(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	view, err := h.storedValue.GetStoreCredit(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(view)
+}
+
+func (h *AdminHandler) AdjustStoreCredit(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.StoreCreditAdjustRequest
+	if err := c.BodyParser(&req); err != nil || req.Amount == 0 || req.Note == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A non-zero amount and a note are required"})
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	entry, err := h.storedValue.AdjustStoreCredit(c.Context(), id, req.Amount, req.Note, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrInsufficientBalance) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrNoCustomer) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Customer not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+// Loyalty
+func (h *AdminHandler) GetLoyaltyProgram(c *fiber.Ctx) error {
+	program, err := h.loyalty.GetProgram(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(program)
+}
+
+func (h *AdminHandler) UpdateLoyaltyProgram(c *fiber.Ctx) error {
+	var req dto.UpdateLoyaltyProgramRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	program, err := h.loyalty.UpdateProgram(c.Context(), req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(program)
+}
+
+func (h *AdminHandler) SetLoyaltyMultiplier(c *fiber.Ctx) error {
+	var req dto.LoyaltyMultiplierRequest
+	if err := c.BodyParser(&req); err != nil || req.CategoryID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "category_id and multiplier are required"})
+	}
+	if err := h.loyalty.SetCategoryMultiplier(c.Context(), req.CategoryID, req.Multiplier); err != nil {
+		if errors.Is(err, service.ErrCategoryNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Multiplier saved"})
+}
+
+func (h *AdminHandler) GetCustomerLoyalty(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	view, err := h.loyalty.GetPoints(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(view)
+}
+
+func (h *AdminHandler) AdjustCustomerLoyalty(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.LoyaltyAdjustRequest
+	if err := c.BodyParser(&req); err != nil || req.Points == 0 || req.Note == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Non-zero points and a note are required"})
+	}
+	userID, _ := c.Locals("userID").(int)
+
+	entry, err := h.loyalty.AdjustPoints(c.Context(), id, req.Points, req.Note, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrInsufficientPoints) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrNoCustomer) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Customer not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+// Cart recovery
+
+// GetCartRecoveryStats reports reminders sent between from and to
+// (YYYY-MM-DD, to inclusive) and the orders they won back. The default is
+// the last 30 days.
+func (h *AdminHandler) GetCartRecoveryStats(c *fiber.Ctx) error {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if dateStr := c.Query("from"); dateStr != "" {
+		t, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+		}
+		from = t
+	}
+	if dateStr := c.Query("to"); dateStr != "" {
+		t, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+		}
+		to = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	stats, err := h.recovery.GetStats(c.Context(), from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stats)
+}
+
+func (h *AdminHandler) GetCartReminders(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	reminders, err := h.recovery.GetReminders(c.Context(), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(reminders)
+}
+
+// Subscriptions
+func (h *AdminHandler) GetSubscriptionPlans(c *fiber.Ctx) error {
+	plans, err := h.subscriptions.GetPlans(c.Context(), false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(plans)
+}
+
+func (h *AdminHandler) CreateSubscriptionPlan(c *fiber.Ctx) error {
+	return h.saveSubscriptionPlan(c, 0)
+}
+
+// UpdateSubscriptionPlan replaces the plan and all of its items. Running
+// subscriptions keep the items they have.
+func (h *AdminHandler) UpdateSubscriptionPlan(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	return h.saveSubscriptionPlan(c, id)
+}
+
+func (h *AdminHandler) saveSubscriptionPlan(c *fiber.Ctx, id int) error {
+	var req dto.SubscriptionPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	plan := &domain.SubscriptionPlan{
+		ID:            id,
+		Name:          req.Name,
+		Description:   req.Description,
+		IntervalUnit:  domain.SubscriptionInterval(strings.ToUpper(req.IntervalUnit)),
+		IntervalCount: req.IntervalCount,
+		IsActive:      req.IsActive == nil || *req.IsActive,
+	}
+	for _, item := range req.Items {
+		plan.Items = append(plan.Items, domain.SubscriptionPlanItem{
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			IsDefault: item.IsDefault == nil || *item.IsDefault,
+		})
+	}
+
+	if err := h.subscriptions.SavePlan(c.Context(), plan); err != nil {
+		if errors.Is(err, service.ErrInvalidSubscription) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if id == 0 {
+		return c.Status(fiber.StatusCreated).JSON(plan)
+	}
+	return c.JSON(plan)
+}
+
+func (h *AdminHandler) DeleteSubscriptionPlan(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	if err := h.subscriptions.DeletePlan(c.Context(), id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Subscription plan deactivated"})
+}
+
+// GetSubscriptions lists subscriptions, newest first (?status=&page=&limit=).
+func (h *AdminHandler) GetSubscriptions(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	status := domain.SubscriptionStatus(strings.ToUpper(c.Query("status")))
+	subs, err := h.subscriptions.GetSubscriptions(c.Context(), status, page, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(subs)
+}
@@ -15,14 +15,18 @@ type OpsHandler struct {
 	assemblyService    service.AssemblyService
 	procurementService service.ProcurementService
 	fulfillmentService service.FulfillmentService
+	labelService       service.LabelService
+	backorderService   service.BackorderService
 }
 
-func NewOpsHandler(invS service.InventoryService, asmS service.AssemblyService, procS service.ProcurementService, fulS service.FulfillmentService) *OpsHandler {
+func NewOpsHandler(invS service.InventoryService, asmS service.AssemblyService, procS service.ProcurementService, fulS service.FulfillmentService, lblS service.LabelService, boS service.BackorderService) *OpsHandler {
 	return &OpsHandler{
 		inventoryService:   invS,
 		assemblyService:    asmS,
 		procurementService: procS,
 		fulfillmentService: fulS,
+		labelService:       lblS,
+		backorderService:   boS,
 	}
 }
 
@@ -164,11 +168,12 @@ func (h *OpsHandler) TransferStock(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("userID").(int)
-	if err := h.inventoryService.TransferStock(c.Context(), req.VariantID, req.Quantity, req.FromLocationID, req.ToLocationID, userID); err != nil {
+	transfer, err := h.inventoryService.TransferStock(c.Context(), req.VariantID, req.Quantity, req.FromLocationID, req.ToLocationID, userID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(fiber.Map{"message": "Stock transferred"})
+	return c.JSON(fiber.Map{"message": "Stock transferred", "transfer": transfer})
 }
 
 func (h *OpsHandler) AdjustStock(c *fiber.Ctx) error {
@@ -238,6 +243,31 @@ func (h *OpsHandler) ExportStockSnapshot(c *fiber.Ctx) error {
 	return c.Send(data)
 }
 
+// Labels
+func (h *OpsHandler) PrintLabels(c *fiber.Ctx) error {
+	var req dto.PrintLabelsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if f := c.Query("format"); f != "" {
+		req.Format = f
+	}
+
+	data, err := h.labelService.RenderLabels(c.Context(), req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if req.Format == service.LabelFormatZPL {
+		c.Set("Content-Type", "application/zpl")
+		c.Set("Content-Disposition", "attachment; filename=labels.zpl")
+	} else {
+		c.Set("Content-Type", "application/pdf")
+		c.Set("Content-Disposition", "attachment; filename=labels.pdf")
+	}
+	return c.Send(data)
+}
+
 func (h *OpsHandler) GetRecipes(c *fiber.Ctx) error {
 	recipes, err := h.assemblyService.GetRecipes(c.Context())
 	if err != nil {
@@ -340,24 +370,17 @@ func (h *OpsHandler) CreatePurchaseOrder(c *fiber.Ctx) error {
 		// Parse time, but for simplicity, assume it's handled in service or use time.Parse
 	}
 
-	var subtotal float64
+	// Tax and totals are computed by the procurement service
 	for _, item := range req.Items {
-		lineTotal := float64(item.Quantity) * item.UnitCost
 		po.Items = append(po.Items, domain.PurchaseOrderItem{
 			VariantID:       item.VariantID,
 			QuantityOrdered: item.Quantity,
 			UnitCost:        item.UnitCost,
-			LineTotal:       lineTotal,
+			LineTotal:       float64(item.Quantity) * item.UnitCost,
 		})
-		subtotal += lineTotal
 	}
 
-	po.SubtotalAmount = subtotal
-	po.TotalAmount = subtotal // Add tax/shipping if needed
-
-	// Generate PO number, e.g., PO-2023-001
-	po.PONumber = "PO-2023-001" // TODO: generate properly
-
+	// The PO number is issued by the procurement service
 	if err := h.procurementService.CreatePO(c.Context(), po); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -533,3 +556,30 @@ func (h *OpsHandler) ShipOrder(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"message": "Order shipped"})
 }
+
+// Backorders
+
+// GetBackorders lists order lines waiting on stock, oldest first;
+// ?variant_id= narrows it to one variant.
+func (h *OpsHandler) GetBackorders(c *fiber.Ctx) error {
+	variantID, _ := strconv.Atoi(c.Query("variant_id"))
+	lines, err := h.backorderService.GetBackorders(c.Context(), variantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(lines)
+}
+
+// AllocateBackorders hands stock that arrived outside a PO receipt (a
+// transfer or an adjustment) to waiting lines.
+func (h *OpsHandler) AllocateBackorders(c *fiber.Ctx) error {
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	orders, err := h.backorderService.Allocate(c.Context(), variantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"orders": orders})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"server/internal/core/domain"
 	"server/internal/dto"
 	"server/internal/service"
@@ -10,14 +11,18 @@ import (
 )
 
 type POSHandler struct {
-	posService   service.POSService
-	orderService service.OrderService
+	posService     service.POSService
+	orderService   service.OrderService
+	paymentService service.PaymentService
+	storedValue    service.StoredValueService
 }
 
-func NewPOSHandler(posS service.POSService, orderS service.OrderService) *POSHandler {
+func NewPOSHandler(posS service.POSService, orderS service.OrderService, paymentS service.PaymentService, storedValueS service.StoredValueService) *POSHandler {
 	return &POSHandler{
-		posService:   posS,
-		orderService: orderS,
+		posService:     posS,
+		orderService:   orderS,
+		paymentService: paymentS,
+		storedValue:    storedValueS,
 	}
 }
 
@@ -65,12 +70,12 @@ func (h *POSHandler) GetSessionDetails(c *fiber.Ctx) error {
 
 	sessionID, _ := strconv.Atoi(c.Params("id"))
 
-	session, err := h.posService.GetSessionDetails(c.Context(), sessionID)
+	report, err := h.posService.GetSessionDetails(c.Context(), sessionID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(session)
+	return c.JSON(report)
 }
 
 func (h *POSHandler) CloseSession(c *fiber.Ctx) error {
@@ -183,29 +188,156 @@ func (h *POSHandler) CreateOrder(c *fiber.Ctx) error {
 		}
 	}
 
+	tenders := toTenders(req.Payments)
+	if len(tenders) == 0 && req.PaymentMethod == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "payment_method or payments is required"})
+	}
+	paymentMethod := req.PaymentMethod
+	if len(tenders) > 0 {
+		paymentMethod = tenders[0].Method
+		if len(tenders) > 1 {
+			paymentMethod = "SPLIT"
+		}
+	}
+
+	// Completed once the tenders cover the total (see PaymentService)
 	order := &domain.SalesOrder{
 		POSSessionID:   &req.POSSessionID,
 		CustomerID:     req.CustomerID,
 		Channel:        domain.ChannelPOS,
 		Items:          items,
-		PaymentMethod:  req.PaymentMethod,
-		Status:         domain.OrderCompleted,
-		PaymentStatus:  domain.PaymentPaid,
-		ShipmentStatus: domain.ShipmentDelivered,
+		PaymentMethod:  paymentMethod,
+		Status:         domain.OrderDraft,
+		PointsRedeemed: req.RedeemPoints,
 		CreatedBy:      &userID,
 	}
 
+	if err := h.posService.PriceOrder(c.Context(), order); err != nil {
+		if done, resp := pointsRejected(c, err); done {
+			return resp
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(tenders) == 0 {
+		tenders = []service.Tender{{Method: req.PaymentMethod, Amount: order.TotalAmount}}
+	}
+	if err := h.paymentService.CheckTenders(c.Context(), order, tenders); err != nil {
+		if done, resp := paymentRejected(c, err); done {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	if err := h.orderService.PlaceOrder(c.Context(), order); err != nil {
+		if errors.Is(err, service.ErrInsufficientStock) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if done, resp := pointsRejected(c, err); done {
+			return resp
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	result, err := h.paymentService.RecordTenders(c.Context(), order.ID, &req.POSSessionID, tenders)
+	if err != nil {
+		// The order exists either way and waits for its tenders, so the
+		// answer is never 5xx: a retry goes to AddPayments, not here again
+		status := fiber.StatusConflict
+		if done, _ := paymentRejected(c, err); done {
+			status = fiber.StatusUnprocessableEntity // A balance spent since the check
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":        "Order created, but its payments were not recorded: " + err.Error(),
+			"order_number": order.OrderNumber,
+			"order_id":     order.ID,
+			"total_amount": order.TotalAmount,
+		})
+	}
+
 	return c.Status(201).JSON(fiber.Map{
-		"message":      "Order created",
-		"order_number": order.OrderNumber,
-		"order_id":     order.ID,
+		"message":         "Order created",
+		"order_number":    order.OrderNumber,
+		"order_id":        order.ID,
+		"total_amount":    order.TotalAmount,
+		"deposit":         order.DepositAmount,
+		"points_redeemed": order.PointsRedeemed,
+		"points_discount": order.PointsDiscount,
+		"payment_status":  result.PaymentStatus,
+		"paid_amount":     result.PaidAmount,
+		"outstanding":     result.Outstanding,
+		"change":          result.Change,
+		"payments":        result.Payments,
+		"gift_cards":      result.GiftCards, // Sold on this order, to hand over
 	})
 }
 
+// AddPayments takes further tenders for a partially paid order.
+func (h *POSHandler) AddPayments(c *fiber.Ctx) error {
+	orderID, _ := strconv.Atoi(c.Params("id"))
+	var req dto.AddPOSPaymentsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
+	}
+	if req.POSSessionID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "pos_session_id is required"})
+	}
+
+	result, err := h.paymentService.RecordTenders(c.Context(), orderID, &req.POSSessionID, toTenders(req.Payments))
+	if err != nil {
+		if done, resp := paymentRejected(c, err); done {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// GetGiftCard is the balance enquiry at the till.
+func (h *POSHandler) GetGiftCard(c *fiber.Ctx) error {
+	card, err := h.storedValue.GetGiftCard(c.Context(), c.Params("code"))
+	if err != nil {
+		if errors.Is(err, service.ErrGiftCardNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(card)
+}
+
+// pointsRejected answers with 422 when loyalty points cannot be spent.
+func pointsRejected(c *fiber.Ctx, err error) (bool, error) {
+	if errors.Is(err, service.ErrInsufficientPoints) || errors.Is(err, service.ErrPointsNotRedeemable) {
+		return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return false, nil
+}
+
+// paymentRejected answers with 422 for tenders the customer must change.
+func paymentRejected(c *fiber.Ctx, err error) (bool, error) {
+	for _, target := range []error{
+		service.ErrInvalidTender, service.ErrOrderNotPayable, service.ErrGiftCardNotFound,
+		service.ErrGiftCardUnusable, service.ErrInsufficientBalance, service.ErrNoCustomer,
+	} {
+		if errors.Is(err, target) {
+			return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	return false, nil
+}
+
+func toTenders(reqs []dto.TenderRequest) []service.Tender {
+	out := make([]service.Tender, len(reqs))
+	for i, r := range reqs {
+		out[i] = service.Tender{
+			Method:             r.Method,
+			Amount:             r.Amount,
+			FinancialAccountID: r.FinancialAccountID,
+			Reference:          r.Reference,
+		}
+	}
+	return out
+}
+
 func (h *POSHandler) PrintReceipt(c *fiber.Ctx) error {
 	orderID, _ := strconv.Atoi(c.Params("id"))
 
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"server/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StorageHandler serves presigned URLs issued by the local disk driver, so
+// uploads and downloads work the same way as against S3/MinIO.
+type StorageHandler struct {
+	disks *storage.Registry
+}
+
+func NewStorageHandler(disks *storage.Registry) *StorageHandler {
+	return &StorageHandler{disks: disks}
+}
+
+func (h *StorageHandler) Download(c *fiber.Ctx) error {
+	disk, objectPath, denied := h.authorize(c, fiber.MethodGet)
+	if denied != nil {
+		return c.Status(denied.Code).JSON(fiber.Map{"error": denied.Message})
+	}
+
+	info, err := disk.Stat(c.Context(), objectPath)
+	if err != nil {
+		return h.fail(c, err)
+	}
+	f, err := disk.Open(objectPath)
+	if err != nil {
+		return h.fail(c, err)
+	}
+
+	if info.ContentType != "" {
+		c.Set(fiber.HeaderContentType, info.ContentType)
+	}
+	c.Set(fiber.HeaderETag, `"`+info.ETag+`"`)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.SendStream(f, int(info.Size))
+}
+
+func (h *StorageHandler) Upload(c *fiber.Ctx) error {
+	disk, objectPath, denied := h.authorize(c, fiber.MethodPut)
+	if denied != nil {
+		return c.Status(denied.Code).JSON(fiber.Map{"error": denied.Message})
+	}
+
+	if err := disk.Write(objectPath, bytes.NewReader(c.Body())); err != nil {
+		return h.fail(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (h *StorageHandler) authorize(c *fiber.Ctx, method string) (*storage.LocalDriver, string, *fiber.Error) {
+	driver, err := h.disks.Disk(c.Params("disk"))
+	if err != nil {
+		return nil, "", fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	local, ok := driver.(*storage.LocalDriver)
+	if !ok {
+		return nil, "", fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+
+	objectPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, "Invalid path")
+	}
+
+	if err := local.Verify(method, objectPath, c.Query("expires"), c.Query("sig")); err != nil {
+		return nil, "", fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+	return local, objectPath, nil
+}
+
+func (h *StorageHandler) fail(c *fiber.Ctx, err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
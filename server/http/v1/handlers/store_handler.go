@@ -1,24 +1,37 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"server/internal/payment"
 	"server/internal/service"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type StoreHandler struct {
-	catalogService service.CatalogService
-	cartService    service.CartService
-	orderService   service.OrderService
+	catalogService   service.CatalogService
+	cartService      service.CartService
+	orderService     service.OrderService
+	marketingService service.MarketingService
+	paymentService   service.PaymentService
+	storedValue      service.StoredValueService
+	recovery         service.CartRecoveryService
 }
 
-func NewStoreHandler(catalogS service.CatalogService, cartS service.CartService, orderS service.OrderService) *StoreHandler {
+func NewStoreHandler(catalogS service.CatalogService, cartS service.CartService, orderS service.OrderService, marketingS service.MarketingService, paymentS service.PaymentService, storedValueS service.StoredValueService, recoveryS service.CartRecoveryService) *StoreHandler {
 	return &StoreHandler{
-		catalogService: catalogS,
-		cartService:    cartS,
-		orderService:   orderS,
+		catalogService:   catalogS,
+		cartService:      cartS,
+		orderService:     orderS,
+		marketingService: marketingS,
+		paymentService:   paymentS,
+		storedValue:      storedValueS,
+		recovery:         recoveryS,
 	}
 }
 
@@ -47,6 +60,7 @@ func (h *StoreHandler) GetProducts(c *fiber.Ctx) error {
 		IsActive:     &isActive,
 		Page:         page,
 		Limit:        limit,
+		Locale:       getLocale(c),
 	}
 
 	products, total, err := h.catalogService.GetProducts(c.Context(), filter)
@@ -66,7 +80,7 @@ func (h *StoreHandler) GetProducts(c *fiber.Ctx) error {
 
 func (h *StoreHandler) GetProductDetail(c *fiber.Ctx) error {
 	slug := c.Params("slug")
-	product, err := h.catalogService.GetProductDetail(c.Context(), slug)
+	product, err := h.catalogService.GetProductDetail(c.Context(), slug, getLocale(c))
 	if err != nil {
 
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
@@ -75,52 +89,182 @@ func (h *StoreHandler) GetProductDetail(c *fiber.Ctx) error {
 }
 
 func (h *StoreHandler) GetCategories(c *fiber.Ctx) error {
-	categories, err := h.catalogService.GetCategories(c.Context())
+	categories, err := h.catalogService.GetCategories(c.Context(), getLocale(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(categories)
 }
 
-// Helper to avoid code duplication
-func mapCartItems(reqItems []dto.CartItemRequest) []domain.SalesOrderItem {
-	var items []domain.SalesOrderItem
-	for _, item := range reqItems {
-		items = append(items, domain.SalesOrderItem{
-			VariantID: item.VariantID,
-			Quantity:  item.Quantity,
-		})
+// getLocale reads the language resolved by middleware.Locale()
+func getLocale(c *fiber.Ctx) string {
+	locale, _ := c.Locals("locale").(string)
+	return locale
+}
+
+// cartRef reads the guest cart token and, behind OptionalAuth, the user.
+func cartRef(c *fiber.Ctx) service.CartRef {
+	ref := service.CartRef{Token: c.Get(cartTokenHeader)}
+	if uid, ok := c.Locals("userID").(int); ok {
+		ref.UserID = &uid
 	}
-	return items
+	return ref
 }
 
-func (h *StoreHandler) SyncCart(c *fiber.Ctx) error {
-	var req dto.CartSyncRequest
+const cartTokenHeader = "X-Cart-Token"
+
+func cartResponse(c *fiber.Ctx, cart *dto.CartResponse, err error) error {
+	if err != nil {
+		if done, resp := couponRejected(c, err); done {
+			return resp
+		}
+		if errors.Is(err, service.ErrCartItemNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if cart.Token != "" {
+		c.Set(cartTokenHeader, cart.Token)
+	}
+	return c.JSON(cart)
+}
+
+func (h *StoreHandler) GetCart(c *fiber.Ctx) error {
+	cart, err := h.cartService.GetCart(c.Context(), cartRef(c))
+	return cartResponse(c, cart, err)
+}
+
+func (h *StoreHandler) AddCartItem(c *fiber.Ctx) error {
+	var req dto.CartItemRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Use Helper
-	items := mapCartItems(req.Items)
+	cart, err := h.cartService.AddItem(c.Context(), cartRef(c), req.VariantID, req.Quantity)
+	return cartResponse(c, cart, err)
+}
 
-	result, err := h.cartService.CalculateCart(c.Context(), items, "")
+func (h *StoreHandler) UpdateCartItem(c *fiber.Ctx) error {
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid variant ID"})
 	}
-	return c.JSON(result)
+	var req dto.UpdateCartItemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
+	}
+
+	cart, err := h.cartService.UpdateItem(c.Context(), cartRef(c), variantID, req.Quantity)
+	return cartResponse(c, cart, err)
 }
 
-func (h *StoreHandler) ApplyCoupon(c *fiber.Ctx) error {
-	var req dto.ApplyCouponRequest
+func (h *StoreHandler) RemoveCartItem(c *fiber.Ctx) error {
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid variant ID"})
+	}
+
+	cart, err := h.cartService.RemoveItem(c.Context(), cartRef(c), variantID)
+	return cartResponse(c, cart, err)
+}
+
+// SyncCart replaces the stored cart with the client's list of items.
+func (h *StoreHandler) SyncCart(c *fiber.Ctx) error {
+	var req dto.CartSyncRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	// Usually ApplyCoupon works on a stored cart, but since we are stateless (REST),
-	// this endpoint might just validate the coupon and return details.
-	// OR, the client just uses CheckoutPreview with the code.
-	// For now, let's keep it unimplemented or make it a simple "Check Validity" endpoint.
-	return c.SendStatus(fiber.StatusNotImplemented)
+	cart, err := h.cartService.ReplaceItems(c.Context(), cartRef(c), req.Items)
+	return cartResponse(c, cart, err)
+}
+
+func (h *StoreHandler) ApplyCoupon(c *fiber.Ctx) error {
+	var req dto.ApplyCouponRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Coupon code is required"})
+	}
+
+	cart, err := h.cartService.ApplyCoupon(c.Context(), cartRef(c), req.Code)
+	return cartResponse(c, cart, err)
+}
+
+func (h *StoreHandler) RemoveCoupon(c *fiber.Ctx) error {
+	cart, err := h.cartService.RemoveCoupon(c.Context(), cartRef(c))
+	return cartResponse(c, cart, err)
+}
+
+// shopper identifies the buyer from OptionalAuth, falling back to a guest email.
+func (h *StoreHandler) shopper(c *fiber.Ctx, guestEmail string) (service.Shopper, error) {
+	if uid, ok := c.Locals("userID").(int); ok {
+		shopper, err := h.marketingService.ShopperForUser(c.Context(), uid)
+		shopper.Channel = domain.ChannelWeb
+		return shopper, err
+	}
+	return service.Shopper{Email: guestEmail, Channel: domain.ChannelWeb}, nil
+}
+
+// checkoutAddress resolves a checkout address: logged-in shoppers pick one
+// from their address book, guests enter it inline. Nil when neither is given.
+func (h *StoreHandler) checkoutAddress(c *fiber.Ctx, addressID int, inline *dto.CreateAddressRequest) (*domain.Address, error) {
+	if inline != nil {
+		if strings.TrimSpace(inline.Line1) == "" || strings.TrimSpace(inline.City) == "" || strings.TrimSpace(inline.Country) == "" {
+			return nil, fmt.Errorf("%w: line1, city and country are required", service.ErrInvalidAddress)
+		}
+		return inline.ToDomain(), nil
+	}
+	if addressID == 0 {
+		return nil, nil
+	}
+	uid := userID(c)
+	if uid == nil {
+		return nil, fmt.Errorf("%w: guests enter the address with the order", service.ErrAddressNotFound)
+	}
+	return h.cartService.UserAddress(c.Context(), addressID, *uid)
+}
+
+// checkoutRejected answers with 422 for checkout input the shopper must fix.
+func checkoutRejected(c *fiber.Ctx, err error) (bool, error) {
+	if done, resp := couponRejected(c, err); done {
+		return true, resp
+	}
+	if errors.Is(err, service.ErrItemUnavailable) || errors.Is(err, service.ErrShippingUnavailable) ||
+		errors.Is(err, service.ErrAddressNotFound) || errors.Is(err, service.ErrInvalidAddress) ||
+		errors.Is(err, service.ErrInsufficientPoints) ||
+		errors.Is(err, service.ErrPointsNotRedeemable) {
+		return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return false, nil
+}
+
+// userID is the logged-in user behind OptionalAuth, if any.
+func userID(c *fiber.Ctx) *int {
+	if uid, ok := c.Locals("userID").(int); ok {
+		return &uid
+	}
+	return nil
+}
+
+// couponRejected answers with the coupon rejection reason, if err is one.
+func couponRejected(c *fiber.Ctx, err error) (bool, error) {
+	var couponErr *service.CouponError
+	if !errors.As(err, &couponErr) {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":  couponErr.Message,
+		"reason": couponErr.Reason,
+	})
+}
+
+// price prices the requested lines from the catalog and applies promotions,
+// tax and shipping.
+func (h *StoreHandler) price(c *fiber.Ctx, reqItems []dto.CartItemRequest, couponCode string, shopper service.Shopper) (*service.CartCalculationResult, error) {
+	items, err := h.cartService.PriceItems(c.Context(), reqItems)
+	if err != nil {
+		return nil, err
+	}
+	return h.cartService.CalculateCart(c.Context(), items, couponCode, shopper)
 }
 
 func (h *StoreHandler) CheckoutPreview(c *fiber.Ctx) error {
@@ -129,10 +273,24 @@ func (h *StoreHandler) CheckoutPreview(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	items := mapCartItems(req.Items)
+	shopper, err := h.shopper(c, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if shopper.ShippingAddress, err = h.checkoutAddress(c, req.ShippingAddressID, req.ShippingAddress); err != nil {
+		if done, resp := checkoutRejected(c, err); done {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	shopper.ShippingMethod = req.ShippingMethod
+	shopper.RedeemPoints = req.RedeemPoints
 
-	result, err := h.cartService.CalculateCart(c.Context(), items, req.CouponCode)
+	result, err := h.price(c, req.Items, req.CouponCode, shopper)
 	if err != nil {
+		if done, resp := checkoutRejected(c, err); done {
+			return resp
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(result)
@@ -144,54 +302,184 @@ func (h *StoreHandler) CheckoutPlace(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid body"})
 	}
 
-	var userID *int
-	if uid, ok := c.Locals("user_id").(float64); ok {
-		id := int(uid)
-		userID = &id
+	_, loggedIn := c.Locals("userID").(int)
+	if !loggedIn && req.GuestEmail == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Email is required for guest checkout"})
+	}
+	if (req.ShippingAddressID == 0 && req.ShippingAddress == nil) || req.ShippingMethod == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Shipping address and method are required"})
+	}
+
+	shopper, err := h.shopper(c, req.GuestEmail)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	shopper.ShippingMethod = req.ShippingMethod
+	shopper.RedeemPoints = req.RedeemPoints
 
-	if userID == nil && req.GuestEmail == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Email is required for guest checkout"})
+	if shopper.ShippingAddress, err = h.checkoutAddress(c, req.ShippingAddressID, req.ShippingAddress); err != nil {
+		if done, resp := checkoutRejected(c, err); done {
+			return resp
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	shippingAddress := h.cartService.AddressSnapshot(shopper.ShippingAddress)
+	billingAddress := shippingAddress
+	if req.BillingAddress != nil || (req.BillingAddressID > 0 && req.BillingAddressID != req.ShippingAddressID) {
+		billing, err := h.checkoutAddress(c, req.BillingAddressID, req.BillingAddress)
+		if err != nil {
+			if done, resp := checkoutRejected(c, err); done {
+				return resp
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		billingAddress = h.cartService.AddressSnapshot(billing)
 	}
 
-	items := mapCartItems(req.Items)
-	cartResult, err := h.cartService.CalculateCart(c.Context(), items, req.CouponCode)
+	cartResult, err := h.price(c, req.Items, req.CouponCode, shopper)
 	if err != nil {
+		if done, resp := checkoutRejected(c, err); done {
+			return resp
+		}
 		return c.Status(400).JSON(fiber.Map{"error": "Cart validation failed: " + err.Error()})
 	}
 
+	var guestEmail *string
+	if shopper.CustomerID == nil {
+		guestEmail = &req.GuestEmail
+	}
+
 	order := &domain.SalesOrder{
-		CustomerID: nil,
+		CustomerID: shopper.CustomerID,
 
-		GuestEmail: &req.GuestEmail,
+		GuestEmail: guestEmail,
 		Channel:    domain.ChannelWeb,
 
-		ShippingAddressSnapshot: nil,
+		ShippingAddressSnapshot: shippingAddress,
+		BillingAddressSnapshot:  billingAddress,
 
 		TotalAmount:    cartResult.TotalAmount,
 		SubtotalAmount: cartResult.Subtotal,
 		DiscountAmount: cartResult.DiscountAmount,
 		TaxAmount:      cartResult.TaxAmount,
 		ShippingAmount: cartResult.ShippingAmount,
+		PointsRedeemed: cartResult.PointsRedeemed,
+		PointsDiscount: cartResult.PointsDiscount,
+		DepositAmount:  cartResult.DepositAmount,
+
+		PricesIncludeTax: cartResult.PricesIncludeTax,
+
+		ShippingMethodID: &cartResult.Shipping.MethodID,
+		ShippingRateID:   cartResult.Shipping.RateID,
+		ShippingWeightKG: &cartResult.Shipping.WeightKG,
+		Carrier:          cartResult.Shipping.Carrier,
 
 		Items:         cartResult.Items,
+		Promotions:    cartResult.Promotions,
 		PaymentMethod: req.PaymentMethod,
 		Status:        domain.OrderDraft,
 	}
 
+	splits := toTenders(req.Payments)
+	if len(splits) > 0 {
+		if err := h.paymentService.CheckTenders(c.Context(), order, splits); err != nil {
+			if done, resp := paymentRejected(c, err); done {
+				return resp
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	if err := h.orderService.PlaceOrder(c.Context(), order); err != nil {
+		// The coupon or points may have been used up between preview and placement
+		if done, resp := checkoutRejected(c, err); done {
+			return resp
+		}
+		if errors.Is(err, service.ErrInsufficientStock) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if req.MarketingOptIn && shopper.Email != "" {
+		// The order stands even if the choice could not be saved
+		_ = h.marketingService.SetMarketingConsent(c.Context(), shopper.Email, true, domain.ConsentCheckout)
+	}
+
+	links, err := h.paymentService.StartPayment(c.Context(), order, shopper.Email, splits)
+	if err != nil {
+		// The order exists and stays reserved until it expires unpaid, so a
+		// retry must not place it again: answer 202, never 5xx
+		status := fiber.StatusAccepted
+		if done, _ := paymentRejected(c, err); done {
+			status = fiber.StatusUnprocessableEntity
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":        "Payment could not be started: " + err.Error(),
+			"order_number": order.OrderNumber,
+			"expires_at":   order.ExpiresAt,
+		})
+	}
+
+	paymentURL := ""
+	if len(links) > 0 {
+		paymentURL = links[0].PaymentURL
+	}
 	return c.Status(201).JSON(fiber.Map{
 		"message":      "Order placed",
 		"order_number": order.OrderNumber,
-		"payment_url":  "http:dummy-payment-url.com",
+		"expires_at":   order.ExpiresAt,
+		"deposit":      order.DepositAmount, // Charged now when pre-order lines take a deposit; 0 when the total is
+		"payment_url":  paymentURL,          // First of payments, for single-payment clients
+		"payments":     links,
 	})
 }
 
+// PaymentWebhook takes provider notifications (dto.PaymentWebhookRequest).
+// The raw body is passed on because the signature covers it.
 func (h *StoreHandler) PaymentWebhook(c *fiber.Ctx) error {
+	err := h.paymentService.HandleWebhook(c.Context(), c.Body())
+	switch {
+	case err == nil:
+		return c.JSON(fiber.Map{"message": "OK"})
+	case errors.Is(err, payment.ErrInvalidSignature):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, payment.ErrMalformedNotification):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrPaymentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAmountMismatch):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+}
 
-	return c.SendStatus(fiber.StatusNotImplemented)
+// GetGiftCard is the public balance enquiry; the code is the secret.
+func (h *StoreHandler) GetGiftCard(c *fiber.Ctx) error {
+	card, err := h.storedValue.GetGiftCard(c.Context(), c.Params("code"))
+	if err != nil {
+		if errors.Is(err, service.ErrGiftCardNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(dto.GiftCardBalance{
+		Balance:   card.Balance,
+		Currency:  card.Currency,
+		Status:    string(card.Status),
+		ExpiresAt: card.ExpiresAt,
+	})
+}
 
+// Unsubscribe opts an address out of marketing email; the link comes from
+// a cart reminder, so it works without logging in.
+func (h *StoreHandler) Unsubscribe(c *fiber.Ctx) error {
+	if err := h.recovery.Unsubscribe(c.Context(), c.Query("email"), c.Query("token")); err != nil {
+		if errors.Is(err, service.ErrInvalidUnsubscribeLink) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "You will no longer receive marketing email"})
 }
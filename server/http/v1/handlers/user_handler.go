@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"server/internal/i18n"
 	"server/internal/service"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,13 +17,23 @@ type UserHandler struct {
 	userService    service.UserService
 	orderService   service.OrderService
 	financeService service.FinanceService
+	storedValue    service.StoredValueService
+	loyalty        service.LoyaltyService
+	marketing      service.MarketingService
+	payment        service.PaymentService
+	subscriptions  service.SubscriptionService
 }
 
-func NewUserHandler(userS service.UserService, orderS service.OrderService, financeS service.FinanceService) *UserHandler {
+func NewUserHandler(userS service.UserService, orderS service.OrderService, financeS service.FinanceService, storedValueS service.StoredValueService, loyaltyS service.LoyaltyService, marketingS service.MarketingService, paymentS service.PaymentService, subscriptionS service.SubscriptionService) *UserHandler {
 	return &UserHandler{
 		userService:    userS,
 		orderService:   orderS,
 		financeService: financeS,
+		storedValue:    storedValueS,
+		loyalty:        loyaltyS,
+		marketing:      marketingS,
+		payment:        paymentS,
+		subscriptions:  subscriptionS,
 	}
 }
 
@@ -54,6 +68,37 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 		// Bio: req.Bio, // If User struct has Bio
 	}
 
+	if req.Locale != "" {
+		if !i18n.IsSupported(req.Locale) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported locale"})
+		}
+		locale := i18n.Normalize(req.Locale)
+		user.Locale = &locale
+	}
+
+	if req.BirthDate != "" {
+		birthDate, err := time.Parse(time.DateOnly, req.BirthDate)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Birth date must be YYYY-MM-DD"})
+		}
+		if err := h.userService.SetBirthDate(c.Context(), userID, birthDate); err != nil {
+			if errors.Is(err, service.ErrBirthDateSet) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if req.MarketingOptIn != nil {
+		profile, err := h.userService.GetProfile(c.Context(), userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := h.marketing.SetMarketingConsent(c.Context(), profile.Email, *req.MarketingOptIn, domain.ConsentProfile); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	if err := h.userService.UpdateProfile(c.Context(), user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -86,17 +131,7 @@ func (h *UserHandler) CreateAddress(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	addr := &domain.Address{
-		Line1:      req.Line1,
-		Line2:      &req.Line2,
-		City:       req.City,
-		State:      &req.State,
-		PostalCode: &req.PostalCode,
-		Country:    req.Country,
-		Latitude:   &req.Latitude,
-		Longitude:  &req.Longitude,
-	}
-
+	addr := req.ToDomain()
 	if err := h.userService.AddAddress(c.Context(), userID, addr); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -227,6 +262,42 @@ func (h *UserHandler) CancelOrder(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Order cancelled"})
 }
 
+// PayBalance starts payment of what is owed on an order confirmed by its
+// deposit, typically a pre-order whose stock has arrived.
+func (h *UserHandler) PayBalance(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	var req dto.PayBalanceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	shopper, err := h.marketing.ShopperForUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	order, err := h.orderService.GetOrder(c.Context(), c.Params("number"))
+	if err != nil || order.CustomerID == nil || shopper.CustomerID == nil || *order.CustomerID != *shopper.CustomerID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if order.Status != domain.OrderConfirmed || order.PaymentStatus != domain.PaymentPartiallyPaid {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Nothing is due on this order"})
+	}
+
+	links, err := h.payment.StartPayment(c.Context(), order, shopper.Email, toTenders(req.Payments))
+	if err != nil {
+		if done, resp := paymentRejected(c, err); done {
+			return resp
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Payment could not be started: " + err.Error()})
+	}
+	return c.JSON(fiber.Map{"order_number": order.OrderNumber, "payments": links})
+}
+
 func (h *UserHandler) RequestReturn(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNotImplemented)
 }
@@ -246,9 +317,281 @@ func (h *UserHandler) DownloadInvoicePDF(c *fiber.Ctx) error {
 
 // Wishlist
 func (h *UserHandler) GetWishlist(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	variants, err := h.userService.GetWishlist(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(variants)
 }
 
 func (h *UserHandler) ToggleWishlist(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid variant ID"})
+	}
+
+	added, err := h.userService.ToggleWishlist(c.Context(), userID, variantID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"variant_id": variantID, "in_wishlist": added})
+}
+
+// Back-in-stock Alerts
+func (h *UserHandler) GetStockAlerts(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	subs, err := h.userService.GetStockSubscriptions(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(subs)
+}
+
+func (h *UserHandler) SubscribeStockAlert(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid variant ID"})
+	}
+
+	sub, err := h.userService.SubscribeStock(c.Context(), userID, variantID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(sub)
+}
+
+func (h *UserHandler) UnsubscribeStockAlert(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	variantID, err := strconv.Atoi(c.Params("variant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid variant ID"})
+	}
+
+	if err := h.userService.UnsubscribeStock(c.Context(), userID, variantID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Stock alert removed"})
+}
+
+func (h *UserHandler) GetStoreCredit(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	view, err := h.storedValue.GetStoreCreditForUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(view)
+}
+
+func (h *UserHandler) GetLoyalty(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	view, err := h.loyalty.GetPointsForUser(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(view)
+}
+
+// Subscriptions
+func (h *UserHandler) GetSubscriptionPlans(c *fiber.Ctx) error {
+	plans, err := h.subscriptions.GetPlans(c.Context(), true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(plans)
+}
+
+func (h *UserHandler) GetSubscriptions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	subs, err := h.subscriptions.GetMySubscriptions(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(subs)
+}
+
+func (h *UserHandler) Subscribe(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	var req dto.SubscribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.PlanID == 0 || req.ShippingAddressID == 0 || req.ShippingMethod == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Plan, shipping address and method are required"})
+	}
+
+	sub, err := h.subscriptions.Subscribe(c.Context(), userID, req)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(sub)
+}
+
+func (h *UserHandler) GetSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	sub, err := h.subscriptions.GetMySubscription(c.Context(), userID, id)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.JSON(sub)
+}
+
+// UpdateSubscription changes the delivery, payment method or next order
+// date of a subscription.
+func (h *UserHandler) UpdateSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.UpdateSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	sub, err := h.subscriptions.UpdateSubscription(c.Context(), userID, id, req)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.JSON(sub)
+}
+
+// SwapSubscriptionItems replaces the items of the next orders with others
+// from the plan.
+func (h *UserHandler) SwapSubscriptionItems(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.SwapSubscriptionItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	sub, err := h.subscriptions.SwapItems(c.Context(), userID, id, req.Items)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.JSON(sub)
+}
+
+func (h *UserHandler) PauseSubscription(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	var req dto.PauseSubscriptionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+	var until *time.Time
+	if req.Until != "" {
+		t, err := time.ParseInLocation(time.DateOnly, req.Until, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Until must be YYYY-MM-DD"})
+		}
+		until = &t
+	}
+
+	sub, err := h.subscriptions.Pause(c.Context(), userID, id, until)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.JSON(sub)
+}
+
+func (h *UserHandler) ResumeSubscription(c *fiber.Ctx) error {
+	return h.subscriptionAction(c, h.subscriptions.Resume)
+}
+
+// SkipSubscription skips the next order.
+func (h *UserHandler) SkipSubscription(c *fiber.Ctx) error {
+	return h.subscriptionAction(c, h.subscriptions.Skip)
+}
+
+func (h *UserHandler) CancelSubscription(c *fiber.Ctx) error {
+	return h.subscriptionAction(c, h.subscriptions.Cancel)
+}
+
+// subscriptionAction runs a body-less change on one of the user's subscriptions.
+func (h *UserHandler) subscriptionAction(c *fiber.Ctx, action func(ctx context.Context, userID, id int) (*domain.Subscription, error)) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	sub, err := action(c.Context(), userID, id)
+	if err != nil {
+		return subscriptionRejected(c, err)
+	}
+	return c.JSON(sub)
+}
+
+// subscriptionRejected answers with the status a subscription error calls for.
+func subscriptionRejected(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSubscriptionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Subscription not found"})
+	case errors.Is(err, service.ErrPlanUnavailable), errors.Is(err, service.ErrInvalidSubscription),
+		errors.Is(err, service.ErrAddressNotFound), errors.Is(err, service.ErrShippingUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 }
@@ -1,6 +1,8 @@
 package v1
 
 import (
+	"time"
+
 	"server/http/middleware"
 	"server/http/v1/handlers"
 	"server/internal/core/domain"
@@ -18,6 +20,9 @@ func SetupRoutes(
 	posH *handlers.POSHandler,
 	opsH *handlers.OpsHandler,
 	adminH *handlers.AdminHandler,
+	storageH *handlers.StorageHandler,
+	idempotent fiber.Handler, // middleware.Idempotency for order-creating and stock-moving routes
+	locale fiber.Handler, // middleware.Locale for storefront routes
 ) {
 	api := app.Group("/api/v1")
 
@@ -33,11 +38,16 @@ func SetupRoutes(
 	auth.Post("/password-reset", authH.RequestPasswordReset)
 	auth.Post("/password-reset/confirm", authH.ConfirmPasswordReset)
 
+	// Local storage disk (signed URLs) - Always Available
+	files := api.Group("/storage")
+	files.Get("/:disk/*", storageH.Download)
+	files.Put("/:disk/*", storageH.Upload)
+
 	// =====================================
 	// 2. STOREFRONT (Public / Semi-Public)
 	// =====================================
 	if module == "store" || module == "" {
-		store := api.Group("/store")
+		store := api.Group("/store", locale)
 
 		// Catalog
 		store.Get("/catalog/products", storeH.GetProducts)
@@ -45,10 +55,21 @@ func SetupRoutes(
 		store.Get("/catalog/products/:slug", storeH.GetProductDetail)
 
 		// Cart & Checkout
-		store.Post("/cart/sync", storeH.SyncCart) // Sync Guest Cart
-		store.Post("/cart/coupons", storeH.ApplyCoupon)
-		store.Post("/checkout/preview", storeH.CheckoutPreview)
-		store.Post("/checkout/place", storeH.CheckoutPlace) // Might reserve stock
+		cart := store.Group("/cart", middleware.OptionalAuth()) // Guest (X-Cart-Token) or user
+		cart.Get("/", storeH.GetCart)
+		cart.Post("/items", storeH.AddCartItem)
+		cart.Put("/items/:variant_id", storeH.UpdateCartItem)
+		cart.Delete("/items/:variant_id", storeH.RemoveCartItem)
+		cart.Post("/sync", storeH.SyncCart) // Replace with a client-side cart
+		cart.Post("/coupons", storeH.ApplyCoupon)
+		cart.Delete("/coupons", storeH.RemoveCoupon)
+
+		checkout := store.Group("/checkout", middleware.OptionalAuth())
+		checkout.Post("/preview", storeH.CheckoutPreview)
+		checkout.Post("/place", idempotent, storeH.CheckoutPlace) // Reserves stock until paid or expired
+
+		store.Get("/gift-cards/:code", middleware.RateLimit(10, time.Minute), storeH.GetGiftCard) // Balance enquiry
+		store.Get("/marketing/unsubscribe", storeH.Unsubscribe)                                   // ?email=&token= from reminder emails
 
 		// Webhooks (Third Party)
 		store.Post("/webhooks/payment", storeH.PaymentWebhook)
@@ -73,6 +94,7 @@ func SetupRoutes(
 		me.Get("/orders", userH.GetOrders)
 		me.Get("/orders/:number", userH.GetOrderDetail)
 		me.Post("/orders/:number/cancel", userH.CancelOrder)
+		me.Post("/orders/:number/pay", idempotent, userH.PayBalance) // Balance after a pre-order deposit
 		me.Post("/orders/:number/return", userH.RequestReturn)
 		me.Post("/orders/:number/review", userH.SubmitReview)
 
@@ -83,6 +105,27 @@ func SetupRoutes(
 		// Wishlist
 		me.Get("/wishlist", userH.GetWishlist)
 		me.Post("/wishlist/:variant_id", userH.ToggleWishlist)
+
+		// Back-in-stock Alerts
+		me.Get("/stock-alerts", userH.GetStockAlerts)
+		me.Post("/stock-alerts/:variant_id", userH.SubscribeStockAlert)
+		me.Delete("/stock-alerts/:variant_id", userH.UnsubscribeStockAlert)
+
+		// Store Credit & Loyalty
+		me.Get("/store-credit", userH.GetStoreCredit)
+		me.Get("/loyalty", userH.GetLoyalty)
+
+		// Subscriptions
+		me.Get("/subscription-plans", userH.GetSubscriptionPlans)
+		me.Get("/subscriptions", userH.GetSubscriptions)
+		me.Post("/subscriptions", idempotent, userH.Subscribe)
+		me.Get("/subscriptions/:id", userH.GetSubscription)
+		me.Put("/subscriptions/:id", userH.UpdateSubscription) // Delivery, payment method, next order date
+		me.Put("/subscriptions/:id/items", userH.SwapSubscriptionItems)
+		me.Post("/subscriptions/:id/pause", userH.PauseSubscription)
+		me.Post("/subscriptions/:id/resume", userH.ResumeSubscription)
+		me.Post("/subscriptions/:id/skip", userH.SkipSubscription) // The next order
+		me.Post("/subscriptions/:id/cancel", userH.CancelSubscription)
 	}
 
 	// =====================================
@@ -107,13 +150,15 @@ func SetupRoutes(
 		// Sales Operations
 		pos.Get("/products/scan", posH.ScanProduct)
 		pos.Post("/customers/search", posH.SearchCustomer)
+		pos.Get("/gift-cards/:code", posH.GetGiftCard)
 		pos.Post("/cart/override-price", posH.OverridePrice) // Manager PIN usually needed
-		pos.Post("/orders/create", posH.CreateOrder)
+		pos.Post("/orders/create", idempotent, posH.CreateOrder)
 
 		// Post-Sale Actions
 		pos.Get("/orders/recent", posH.GetRecentOrders)
 		pos.Post("/orders/:id/print", posH.PrintReceipt)
 		pos.Post("/orders/:id/void", posH.VoidOrder)
+		pos.Post("/orders/:id/payments", idempotent, posH.AddPayments) // Settle a partially paid order
 	}
 
 	// =====================================
@@ -131,23 +176,30 @@ func SetupRoutes(
 		ops.Put("/inventory/locations/:id", opsH.UpdateLocation)
 		ops.Delete("/inventory/locations/:id", opsH.DeleteLocation)
 		ops.Get("/inventory/movements", opsH.GetMovements) // The Audit Trail
-		ops.Post("/inventory/transfer", opsH.TransferStock)
-		ops.Post("/inventory/adjust", opsH.AdjustStock)
-		ops.Post("/inventory/bulk-adjust", opsH.BulkAdjustStock)
+		ops.Post("/inventory/transfer", idempotent, opsH.TransferStock)
+		ops.Post("/inventory/adjust", idempotent, opsH.AdjustStock)
+		ops.Post("/inventory/bulk-adjust", idempotent, opsH.BulkAdjustStock)
 		ops.Get("/inventory/snapshot", opsH.ExportStockSnapshot)
 
+		// Labels (PDF / ZPL shelf & plant tags)
+		ops.Post("/labels", opsH.PrintLabels)
+
 		// Manufacturing / Assembly
 		ops.Get("/assembly/recipes", opsH.GetRecipes)
 		ops.Post("/assembly/recipes", opsH.CreateRecipe)
 		ops.Delete("/assembly/recipes/:id", opsH.DeleteRecipe)
 		ops.Get("/assembly/logs", opsH.GetAssemblyLogs)
-		ops.Post("/assembly/execute", opsH.ExecuteAssembly) // The "Make" Button
-		ops.Post("/assembly/disassemble", opsH.DisassembleKit)
+		ops.Post("/assembly/execute", idempotent, opsH.ExecuteAssembly) // The "Make" Button
+		ops.Post("/assembly/disassemble", idempotent, opsH.DisassembleKit)
 
 		// Procurement
 		ops.Get("/procurement/po", opsH.GetPurchaseOrders)
 		ops.Post("/procurement/po", opsH.CreatePurchaseOrder)
-		ops.Post("/procurement/po/:id/receive", opsH.ReceivePurchaseOrder) // Inbound Stock
+		ops.Post("/procurement/po/:id/receive", idempotent, opsH.ReceivePurchaseOrder) // Inbound Stock, allocated to backorders
+
+		// Backorders & Pre-orders
+		ops.Get("/backorders", opsH.GetBackorders)
+		ops.Post("/backorders/:variant_id/allocate", idempotent, opsH.AllocateBackorders)
 
 		// Suppliers (Ops can manage suppliers too)
 		ops.Get("/suppliers", opsH.GetSuppliers)
@@ -182,11 +234,19 @@ func SetupRoutes(
 		// Variants
 		admin.Get("/products/:id/variants", adminH.GetVariants)
 		admin.Put("/products/:id/variants", adminH.UpdateVariants)
+		admin.Post("/products/:id/variants/barcodes", adminH.AssignBarcodes)   // Fill missing internal barcodes
+		admin.Post("/products/:id/variants/generate", adminH.GenerateVariants) // Build matrix from options
+		admin.Get("/products/:id/options", adminH.GetProductOptions)
+		admin.Put("/products/:id/options", adminH.SetProductOptions)
 
 		// Media Pipeline
 		admin.Post("/media/upload", adminH.UploadMedia)
+		admin.Post("/media/:id/complete", adminH.CompleteMediaUpload)
 		admin.Post("/media/link", adminH.LinkMedia)
 		admin.Delete("/media/link", adminH.UnlinkMedia)
+		admin.Put("/media/reorder", adminH.ReorderMedia)
+		admin.Post("/media/:id/primary", adminH.SetPrimaryMedia)
+		admin.Patch("/media/:id", adminH.EditMedia)
 
 		// User Management (HR)
 		admin.Get("/users", adminH.GetUsers)
@@ -210,6 +270,17 @@ func SetupRoutes(
 		admin.Post("/tags", adminH.CreateTag)
 		admin.Put("/products/:id/tags", adminH.UpdateProductTags)
 
+		// Translations (per-locale catalog text)
+		admin.Get("/products/:id/translations", adminH.GetProductTranslations)
+		admin.Put("/products/:id/translations/:locale", adminH.SaveProductTranslation)
+		admin.Delete("/products/:id/translations/:locale", adminH.DeleteProductTranslation)
+		admin.Get("/categories/:id/translations", adminH.GetCategoryTranslations)
+		admin.Put("/categories/:id/translations/:locale", adminH.SaveCategoryTranslation)
+		admin.Delete("/categories/:id/translations/:locale", adminH.DeleteCategoryTranslation)
+		admin.Get("/tags/:id/translations", adminH.GetTagTranslations)
+		admin.Put("/tags/:id/translations/:locale", adminH.SaveTagTranslation)
+		admin.Delete("/tags/:id/translations/:locale", adminH.DeleteTagTranslation)
+
 		// CRM
 		admin.Get("/customers/segments", adminH.GetSegments)
 		admin.Post("/customers/email", adminH.TriggerEmailCampaign)
@@ -217,9 +288,60 @@ func SetupRoutes(
 		// Promotions
 		admin.Get("/promotions", adminH.GetPromotions)
 		admin.Post("/promotions", adminH.CreatePromotion)
+		admin.Post("/promotions/simulate", adminH.SimulatePromotions)
 		admin.Put("/promotions/:id", adminH.UpdatePromotion)
 		admin.Delete("/promotions/:id", adminH.DeletePromotion)
 
+		// Tax rules
+		admin.Get("/tax-rules", adminH.GetTaxRules)
+		admin.Post("/tax-rules", adminH.CreateTaxRule)
+		admin.Put("/tax-rules/:id", adminH.UpdateTaxRule)
+		admin.Delete("/tax-rules/:id", adminH.DeleteTaxRule)
+
+		// Shipping
+		admin.Get("/shipping-methods", adminH.GetShippingMethods)
+		admin.Post("/shipping-methods", adminH.CreateShippingMethod)
+		admin.Put("/shipping-methods/:id", adminH.UpdateShippingMethod)
+		admin.Delete("/shipping-methods/:id", adminH.DeleteShippingMethod)
+		admin.Get("/shipping-zones", adminH.GetShippingZones)
+		admin.Post("/shipping-zones", adminH.CreateShippingZone)
+		admin.Put("/shipping-zones/:id", adminH.UpdateShippingZone)
+		admin.Delete("/shipping-zones/:id", adminH.DeleteShippingZone)
+
+		// Payments
+		admin.Get("/orders/:id/payments", adminH.GetOrderPayments)
+		admin.Post("/orders/:id/refund", idempotent, adminH.RefundOrder)
+
+		// Gift Cards & Store Credit
+		admin.Get("/gift-cards", adminH.GetGiftCards)
+		admin.Post("/gift-cards", idempotent, adminH.IssueGiftCard)
+		admin.Get("/gift-cards/:code", adminH.GetGiftCard)
+		admin.Put("/gift-cards/:id", adminH.UpdateGiftCard)
+		admin.Get("/customers/:id/store-credit", adminH.GetStoreCredit)
+		admin.Post("/customers/:id/store-credit", idempotent, adminH.AdjustStoreCredit)
+
+		// Loyalty
+		admin.Get("/loyalty", adminH.GetLoyaltyProgram)
+		admin.Put("/loyalty", adminH.UpdateLoyaltyProgram)
+		admin.Put("/loyalty/multipliers", adminH.SetLoyaltyMultiplier) // Multiplier 1 removes it
+		admin.Get("/customers/:id/loyalty", adminH.GetCustomerLoyalty)
+		admin.Post("/customers/:id/loyalty", idempotent, adminH.AdjustCustomerLoyalty)
+
+		// Cart Recovery
+		admin.Get("/cart-recovery", adminH.GetCartRecoveryStats) // ?from=&to=
+		admin.Get("/cart-recovery/reminders", adminH.GetCartReminders)
+
+		// Subscriptions
+		admin.Get("/subscription-plans", adminH.GetSubscriptionPlans)
+		admin.Post("/subscription-plans", adminH.CreateSubscriptionPlan)
+		admin.Put("/subscription-plans/:id", adminH.UpdateSubscriptionPlan)
+		admin.Delete("/subscription-plans/:id", adminH.DeleteSubscriptionPlan)
+		admin.Get("/subscriptions", adminH.GetSubscriptions) // ?status=
+
+		// Document Numbering
+		admin.Get("/numbering", adminH.GetNumberingSeries)
+		admin.Put("/numbering/:doc_type", adminH.UpdateNumberingSeries)
+
 		// Data Import/Export
 		admin.Get("/data/products/export", adminH.ExportProducts)
 		admin.Post("/data/products/import", adminH.ImportProducts)
@@ -0,0 +1,110 @@
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"server/internal/core/domain"
+	"strings"
+)
+
+// InternalPrefix is the GS1 "restricted circulation" prefix reserved for
+// in-store numbering, so internal codes never collide with supplier EANs.
+const InternalPrefix = "20"
+
+const maxCode128Length = 48
+
+var (
+	ErrInvalidEAN13   = errors.New("invalid EAN-13: must be 13 digits with a valid check digit")
+	ErrInvalidCode128 = errors.New("invalid Code128: must be 1-48 printable ASCII characters")
+)
+
+// InternalEAN13 builds a deterministic EAN-13 for a variant: the internal
+// prefix, the zero-padded variant ID and the check digit.
+func InternalEAN13(variantID int) (string, error) {
+	body := fmt.Sprintf("%s%010d", InternalPrefix, variantID)
+	if variantID <= 0 || len(body) != 12 {
+		return "", fmt.Errorf("variant id %d cannot be encoded as an internal EAN-13", variantID)
+	}
+	return body + string(rune('0'+CheckDigit(body))), nil
+}
+
+// InternalCode128 derives a Code128 value from the variant SKU, which staff can
+// also key in by hand when a label is damaged.
+func InternalCode128(sku string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(sku))
+	if !ValidCode128(code) {
+		return "", fmt.Errorf("sku %q cannot be encoded as Code128", sku)
+	}
+	return code, nil
+}
+
+// CheckDigit computes the EAN-13 check digit for the first 12 digits.
+func CheckDigit(digits string) int {
+	sum := 0
+	for i, r := range digits {
+		d := int(r - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+func ValidEAN13(code string) bool {
+	if len(code) != 13 || !isDigits(code) {
+		return false
+	}
+	return CheckDigit(code[:12]) == int(code[12]-'0')
+}
+
+func ValidCode128(code string) bool {
+	if code == "" || len(code) > maxCode128Length {
+		return false
+	}
+	for _, r := range code {
+		if r < 32 || r > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// Detect guesses the symbology of a hand-entered barcode.
+func Detect(code string) domain.BarcodeSymbology {
+	if ValidEAN13(code) {
+		return domain.BarcodeEAN13
+	}
+	return domain.BarcodeCode128
+}
+
+// Validate checks a barcode against the requested symbology.
+func Validate(code string, symbology domain.BarcodeSymbology) error {
+	switch symbology {
+	case domain.BarcodeEAN13:
+		if !ValidEAN13(code) {
+			return ErrInvalidEAN13
+		}
+	case domain.BarcodeCode128:
+		if !ValidCode128(code) {
+			return ErrInvalidCode128
+		}
+	default:
+		return fmt.Errorf("unsupported barcode symbology %q", symbology)
+	}
+	return nil
+}
+
+// Normalize strips whitespace that scanners and spreadsheets like to add.
+func Normalize(code string) string {
+	return strings.TrimSpace(code)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -19,17 +19,19 @@ type User struct {
 }
 
 type Customer struct {
-	ID                int        `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID            *int       `gorm:"unique" json:"user_id"`
-	User              *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	CompanyName       *string    `gorm:"size:255" json:"company_name"`
-	BillingAddressID  *int       `json:"billing_address_id"`
-	ShippingAddressID *int       `json:"shipping_address_id"`
-	BillingAddress    *Address   `gorm:"foreignKey:BillingAddressID" json:"billing_address,omitempty"`
-	ShippingAddress   *Address   `gorm:"foreignKey:ShippingAddressID" json:"shipping_address,omitempty"`
-	CreatedAt         time.Time  `json:"created_at"`
-	UpdatedAt         time.Time  `json:"updated_at"`
-	DeletedAt         *time.Time `json:"deleted_at"`
+	ID                int          `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID            *int         `gorm:"unique" json:"user_id"`
+	User              *User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	CompanyName       *string      `gorm:"size:255" json:"company_name"`
+	Type              CustomerType `gorm:"not null;default:'INDIVIDUAL';size:20" json:"type"`
+	BillingAddressID  *int         `json:"billing_address_id"`
+	ShippingAddressID *int         `json:"shipping_address_id"`
+	BirthDate         *time.Time   `gorm:"type:date" json:"birth_date"` // For the loyalty birthday bonus
+	BillingAddress    *Address     `gorm:"foreignKey:BillingAddressID" json:"billing_address,omitempty"`
+	ShippingAddress   *Address     `gorm:"foreignKey:ShippingAddressID" json:"shipping_address,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	DeletedAt         *time.Time   `json:"deleted_at"`
 }
 
 type Supplier struct {
@@ -46,6 +48,7 @@ type Supplier struct {
 
 type Address struct {
 	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     *int      `gorm:"index" json:"user_id"` // Owner in the address book; nil for location addresses
 	Line1      string    `gorm:"not null;size:255" json:"line1"`
 	Line2      *string   `gorm:"size:255" json:"line2"`
 	City       string    `gorm:"not null;size:100" json:"city"`
@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Cart is a server-side shopping cart. Guests are identified by Token (sent as
+// the X-Cart-Token header); logged-in shoppers by UserID. A user has at most
+// one ACTIVE cart.
+type Cart struct {
+	ID         int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Token      string     `gorm:"uniqueIndex;not null;size:64" json:"token"`
+	UserID     *int       `gorm:"uniqueIndex:idx_cart_active_user,where:status = 'ACTIVE'" json:"user_id"`
+	Status     CartStatus `gorm:"not null;default:'ACTIVE';size:20;index" json:"status"`
+	CouponCode *string    `gorm:"size:64" json:"coupon_code"`       // Re-checked on every read
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"` // Pushed back on every change
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Items      []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE" json:"items"`
+}
+
+type CartItem struct {
+	ID        int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	CartID    int             `gorm:"not null;uniqueIndex:idx_cart_item_variant" json:"cart_id"`
+	VariantID int             `gorm:"not null;uniqueIndex:idx_cart_item_variant" json:"variant_id"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  int             `gorm:"not null;default:1" json:"quantity"`
+	UnitPrice float64         `gorm:"not null;type:decimal(12,2);default:0" json:"unit_price"` // Price last shown to the shopper
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
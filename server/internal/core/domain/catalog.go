@@ -14,6 +14,8 @@ type Category struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	DeletedAt   *time.Time `json:"deleted_at"`
+
+	Media []MediaView `gorm:"-" json:"media,omitempty"`
 }
 
 type Product struct {
@@ -35,10 +37,37 @@ type Product struct {
 	HeightCM    *float64         `gorm:"type:decimal(8,3)" json:"height_cm"`
 	WidthCM     *float64         `gorm:"type:decimal(8,3)" json:"width_cm"`
 	DepthCM     *float64         `gorm:"type:decimal(8,3)" json:"depth_cm"`
+	IsLivePlant bool             `gorm:"not null;default:false" json:"is_live_plant"` // Ships only on methods that allow live plants
+	IsGiftCard  bool             `gorm:"not null;default:false" json:"is_gift_card"`  // Paid orders issue a card per unit worth the unit price
 	CreatedAt   time.Time        `json:"created_at"`
 	UpdatedAt   time.Time        `json:"updated_at"`
 	DeletedAt   *time.Time       `json:"deleted_at"`
 	Tags        []Tag            `gorm:"many2many:product_tags;" json:"tags"`
+
+	Variants     []ProductVariant     `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+	Options      []ProductOption      `gorm:"foreignKey:ProductID" json:"options,omitempty"`
+	Translations []ProductTranslation `gorm:"foreignKey:ProductID" json:"translations,omitempty"`
+
+	Media []MediaView `gorm:"-" json:"media,omitempty"`
+}
+
+// ProductOption defines one axis of the variant matrix (e.g. "Pot Size").
+// Variants reference values by name in their Attributes map.
+type ProductOption struct {
+	ID        int                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID int                  `gorm:"not null;index" json:"product_id"`
+	Name      string               `gorm:"not null;size:100" json:"name"`
+	Position  int                  `gorm:"not null;default:0" json:"position"`
+	Values    []ProductOptionValue `gorm:"foreignKey:OptionID;constraint:OnDelete:CASCADE" json:"values"`
+}
+
+type ProductOptionValue struct {
+	ID         int     `gorm:"primaryKey;autoIncrement" json:"id"`
+	OptionID   int     `gorm:"not null;index" json:"option_id"`
+	Value      string  `gorm:"not null;size:100" json:"value"`
+	Code       string  `gorm:"size:20" json:"code"` // SKU fragment, e.g. "15CM"
+	PriceDelta float64 `gorm:"not null;type:decimal(12,2);default:0" json:"price_delta"`
+	Position   int     `gorm:"not null;default:0" json:"position"`
 }
 
 type ProductVariant struct {
@@ -50,12 +79,19 @@ type ProductVariant struct {
 	Attributes     map[string]interface{} `gorm:"type:jsonb;not null;default:'{}'" json:"attributes"`
 	Price          float64                `gorm:"not null;type:decimal(12,2);default:0" json:"price"`
 	CompareAtPrice *float64               `gorm:"type:decimal(12,2)" json:"compare_at_price"`
-	Barcode        *string                `gorm:"size:64" json:"barcode"`
-	StockControl   bool                   `gorm:"not null;default:true" json:"stock_control"`
+	Barcode        *string                `gorm:"size:64;uniqueIndex" json:"barcode"`
+	BarcodeType    *BarcodeSymbology      `gorm:"size:20" json:"barcode_type"`
+	StockControl   bool                   `gorm:"not null" json:"stock_control"`          // No column default, so false is written on create
+	IsActive       bool                   `gorm:"not null;default:true" json:"is_active"` // Deactivated by the matrix generator, never deleted; false needs an update after create
+	Availability   AvailabilityMode       `gorm:"not null;size:20;default:'IN_STOCK'" json:"availability"`
+	ExpectedAt     *time.Time             `gorm:"type:date" json:"expected_at"`                                  // Pre-orders: when stock is due
+	DepositPercent float64                `gorm:"not null;type:decimal(5,2);default:100" json:"deposit_percent"` // Pre-orders: share of the line paid at checkout
 	UsedInRecipes  []ProductRecipe        `gorm:"foreignKey:ChildVariantID" json:"used_in_recipes,omitempty"`
 	CreatedAt      time.Time              `json:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at"`
 	DeletedAt      *time.Time             `json:"deleted_at"`
+
+	Media []MediaView `gorm:"-" json:"media,omitempty"`
 }
 
 type Tag struct {
@@ -64,6 +64,26 @@ const (
 	OrderReturned  OrderStatus = "RETURNED"
 )
 
+type DocumentType string
+
+const (
+	DocSalesOrder    DocumentType = "SALES_ORDER"
+	DocPurchaseOrder DocumentType = "PURCHASE_ORDER"
+	DocAssembly      DocumentType = "ASSEMBLY"
+	DocDisassembly   DocumentType = "DISASSEMBLY"
+	DocInvoice       DocumentType = "INVOICE"
+	DocReturn        DocumentType = "RETURN"
+	DocTransfer      DocumentType = "TRANSFER"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationActive    ReservationStatus = "ACTIVE"
+	ReservationReleased  ReservationStatus = "RELEASED"
+	ReservationConverted ReservationStatus = "CONVERTED"
+)
+
 type ShipmentStatus string
 
 const (
@@ -79,8 +99,40 @@ type PaymentStatus string
 const (
 	PaymentUnpaid            PaymentStatus = "UNPAID"
 	PaymentPaid              PaymentStatus = "PAID"
+	PaymentPartiallyPaid     PaymentStatus = "PARTIALLY_PAID" // Orders only: tenders do not cover the total yet
 	PaymentPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
 	PaymentRefunded          PaymentStatus = "REFUNDED"
+	PaymentFailed            PaymentStatus = "FAILED"         // Payment rows only: declined or expired charge, or failed refund
+	PaymentRefundPending     PaymentStatus = "REFUND_PENDING" // Refund rows only: recorded, the gateway has not confirmed it yet
+)
+
+type GiftCardStatus string
+
+const (
+	GiftCardActive   GiftCardStatus = "ACTIVE"
+	GiftCardDisabled GiftCardStatus = "DISABLED"
+)
+
+// StoredValueTxType classifies gift card and store credit movements.
+type StoredValueTxType string
+
+const (
+	StoredValueIssue  StoredValueTxType = "ISSUE"  // Card sold or issued
+	StoredValueRedeem StoredValueTxType = "REDEEM" // Spent on an order
+	StoredValueRefund StoredValueTxType = "REFUND" // Given back by a refund
+	StoredValueAdjust StoredValueTxType = "ADJUST" // Manual correction
+)
+
+// LoyaltyEntryType classifies points ledger entries.
+type LoyaltyEntryType string
+
+const (
+	LoyaltyEarn     LoyaltyEntryType = "EARN"     // Order paid
+	LoyaltyRedeem   LoyaltyEntryType = "REDEEM"   // Spent as an order discount
+	LoyaltyRestore  LoyaltyEntryType = "RESTORE"  // Redeemed points given back when the order was cancelled
+	LoyaltyClawback LoyaltyEntryType = "CLAWBACK" // Earned points taken back on cancellation or return
+	LoyaltyExpire   LoyaltyEntryType = "EXPIRE"
+	LoyaltyAdjust   LoyaltyEntryType = "ADJUST" // Manual correction
 )
 
 type ProductCondition string
@@ -122,3 +174,76 @@ const (
 	InvoicePaid   InvoiceStatus = "PAID"
 	InvoiceVoid   InvoiceStatus = "VOID"
 )
+
+type BarcodeSymbology string
+
+const (
+	BarcodeEAN13   BarcodeSymbology = "EAN13"
+	BarcodeCode128 BarcodeSymbology = "CODE128"
+)
+
+type StockSubscriptionStatus string
+
+const (
+	SubscriptionPending   StockSubscriptionStatus = "PENDING"
+	SubscriptionNotified  StockSubscriptionStatus = "NOTIFIED"
+	SubscriptionCancelled StockSubscriptionStatus = "CANCELLED"
+)
+
+type MediaStatus string
+
+const (
+	MediaPending MediaStatus = "PENDING"
+	MediaReady   MediaStatus = "READY"
+)
+
+type CustomerType string
+
+const (
+	CustomerIndividual CustomerType = "INDIVIDUAL"
+	CustomerBusiness   CustomerType = "BUSINESS"
+)
+
+type CartStatus string
+
+const (
+	CartActive    CartStatus = "ACTIVE"
+	CartMerged    CartStatus = "MERGED"    // Folded into the user's cart on login
+	CartConverted CartStatus = "CONVERTED" // Checked out
+	CartExpired   CartStatus = "EXPIRED"
+)
+
+// ConsentSource is where a marketing consent was given or withdrawn.
+type ConsentSource string
+
+const (
+	ConsentProfile     ConsentSource = "PROFILE"
+	ConsentCheckout    ConsentSource = "CHECKOUT"
+	ConsentUnsubscribe ConsentSource = "UNSUBSCRIBE" // Link in a marketing message
+)
+
+// AvailabilityMode decides whether a variant sells beyond what is on hand.
+type AvailabilityMode string
+
+const (
+	AvailabilityInStock   AvailabilityMode = "IN_STOCK"  // Only what is on hand
+	AvailabilityBackorder AvailabilityMode = "BACKORDER" // Short lines wait for the next delivery
+	AvailabilityPreorder  AvailabilityMode = "PREORDER"  // Sold ahead of arrival against a deposit
+)
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionActive  SubscriptionStatus = "ACTIVE"
+	SubscriptionPaused  SubscriptionStatus = "PAUSED"
+	SubscriptionPastDue SubscriptionStatus = "PAST_DUE"  // Payment retries ran out
+	SubscriptionEnded   SubscriptionStatus = "CANCELLED" // By the customer (SubscriptionCancelled is a stock alert's)
+)
+
+// SubscriptionInterval is the unit a subscription plan renews in.
+type SubscriptionInterval string
+
+const (
+	IntervalWeek  SubscriptionInterval = "WEEK"
+	IntervalMonth SubscriptionInterval = "MONTH"
+)
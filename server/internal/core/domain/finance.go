@@ -11,6 +11,7 @@ type Invoice struct {
 	PurchaseOrderID *int          `json:"purchase_order_id"`
 	IssuedAt        time.Time     `gorm:"type:date;not null;default:current_date" json:"issued_at"`
 	DueAt           time.Time     `gorm:"type:date;not null" json:"due_at"`
+	TaxAmount       float64       `gorm:"not null;type:decimal(12,2);default:0" json:"tax_amount"`
 	TotalAmount     float64       `gorm:"not null;type:decimal(12,2)" json:"total_amount"`
 	AmountResidual  float64       `gorm:"not null;type:decimal(12,2)" json:"amount_residual"`
 	PDFUrl          *string       `gorm:"size:512" json:"pdf_url"`
@@ -45,13 +46,19 @@ type Payment struct {
 	SalesOrderID         *int            `json:"sales_order_id"`
 	PurchaseOrderID      *int            `json:"purchase_order_id"`
 	FinancialAccountID   int             `gorm:"not null" json:"financial_account_id"`
-	TransactionReference *string         `gorm:"size:255" json:"transaction_reference"`
+	TransactionReference *string         `gorm:"size:255;index" json:"transaction_reference"` // Provider charge or refund ID
 	Type                 TransactionType `gorm:"not null;default:'CREDIT'" json:"type"`
 	InvoiceID            *int            `json:"invoice_id"`
+	RefundOfID           *int            `gorm:"index" json:"refund_of_id"` // DEBIT rows: the charge being refunded
+	POSSessionID         *int            `gorm:"index" json:"pos_session_id"`
+	TenderedAmount       *float64        `gorm:"type:decimal(14,2)" json:"tendered_amount"` // Cash handed over, when more than Amount
+	ChangeAmount         float64         `gorm:"not null;type:decimal(14,2);default:0" json:"change_amount"`
 	Amount               float64         `gorm:"not null;type:decimal(14,2);default:0" json:"amount"`
 	Currency             string          `gorm:"not null;default:'IDR';size:10" json:"currency"`
 	Method               string          `gorm:"not null;size:50" json:"method"`
 	Status               PaymentStatus   `gorm:"not null;default:'UNPAID'" json:"status"`
+	PaymentURL           *string         `gorm:"size:1024" json:"payment_url,omitempty"` // Hosted page of an unpaid gateway charge
+	ExpiresAt            *time.Time      `json:"expires_at,omitempty"`                   // When the hosted page stops taking payment
 	PaidAt               *time.Time      `json:"paid_at"`
 	CreatedAt            time.Time       `json:"created_at"`
 }
@@ -0,0 +1,51 @@
+package domain
+
+import "time"
+
+// GiftCard is a stored-value card identified by its code. Balance always
+// equals the sum of its transactions.
+type GiftCard struct {
+	ID             int                   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code           string                `gorm:"uniqueIndex;not null;size:32" json:"code"`
+	InitialAmount  float64               `gorm:"not null;type:decimal(14,2)" json:"initial_amount"`
+	Balance        float64               `gorm:"not null;type:decimal(14,2)" json:"balance"`
+	Currency       string                `gorm:"not null;default:'IDR';size:10" json:"currency"`
+	Status         GiftCardStatus        `gorm:"not null;default:'ACTIVE';size:20" json:"status"`
+	ExpiresAt      *time.Time            `json:"expires_at"`
+	SalesOrderID   *int                  `gorm:"index" json:"sales_order_id"` // The order that sold it
+	RecipientEmail *string               `gorm:"size:320" json:"recipient_email"`
+	DeliveredAt    *time.Time            `json:"delivered_at"` // Code emailed or handed over
+	Note           *string               `gorm:"size:255" json:"note"`
+	IssuedBy       *int                  `json:"issued_by"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+	Transactions   []GiftCardTransaction `gorm:"foreignKey:GiftCardID" json:"transactions,omitempty"`
+}
+
+type GiftCardTransaction struct {
+	ID           int               `gorm:"primaryKey;autoIncrement" json:"id"`
+	GiftCardID   int               `gorm:"not null;index" json:"gift_card_id"`
+	Type         StoredValueTxType `gorm:"not null;size:20" json:"type"`
+	Amount       float64           `gorm:"not null;type:decimal(14,2)" json:"amount"` // Negative when spent
+	BalanceAfter float64           `gorm:"not null;type:decimal(14,2)" json:"balance_after"`
+	SalesOrderID *int              `gorm:"index" json:"sales_order_id"`
+	PaymentID    *int              `json:"payment_id"`
+	Note         *string           `gorm:"size:255" json:"note"`
+	CreatedBy    *int              `json:"created_by"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// StoreCreditEntry is one line of a customer's store-credit ledger; the
+// balance is BalanceAfter of the latest entry.
+type StoreCreditEntry struct {
+	ID           int               `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID   int               `gorm:"not null;index" json:"customer_id"`
+	Type         StoredValueTxType `gorm:"not null;size:20" json:"type"`
+	Amount       float64           `gorm:"not null;type:decimal(14,2)" json:"amount"` // Negative when spent
+	BalanceAfter float64           `gorm:"not null;type:decimal(14,2)" json:"balance_after"`
+	SalesOrderID *int              `gorm:"index" json:"sales_order_id"`
+	PaymentID    *int              `json:"payment_id"`
+	Note         *string           `gorm:"size:255" json:"note"`
+	CreatedBy    *int              `json:"created_by"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so a retry is answered from here instead of
+// running the request twice.
+type IdempotencyKey struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope          string    `gorm:"not null;size:300;uniqueIndex:idx_idempotency_scope_key" json:"scope"` // Caller and route
+	Key            string    `gorm:"not null;size:255;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	Fingerprint    string    `gorm:"not null;size:64" json:"fingerprint"`       // SHA-256 of the request body
+	ResponseStatus int       `gorm:"not null;default:0" json:"response_status"` // 0 while the first request runs
+	ResponseBody   []byte    `json:"-"`
+	ContentType    string    `gorm:"size:100" json:"content_type"`
+	ExpiresAt      time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
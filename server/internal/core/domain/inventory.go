@@ -18,6 +18,7 @@ type Stock struct {
 	Location    *InventoryLocation `gorm:"foreignKey:LocationID" json:"location"`
 	Variant     *ProductVariant    `gorm:"foreignKey:VariantID" json:"variant"`
 	Quantity    int                `gorm:"not null;default:0" json:"quantity"`
+	Reserved    int                `gorm:"not null;default:0" json:"reserved"` // Held by unpaid orders; available = Quantity - Reserved
 	SafetyStock int                `gorm:"not null;default:0" json:"safety_stock"`
 	UpdatedAt   time.Time          `json:"updated_at"`
 }
@@ -33,3 +34,30 @@ type StockMovement struct {
 	CreatedBy      *int      `json:"created_by"`
 	CreatedAt      time.Time `json:"created_at"`
 }
+
+// StockReservation holds stock for an unpaid order until it is paid
+// (CONVERTED into a SALE movement) or expires (RELEASED).
+type StockReservation struct {
+	ID           int               `gorm:"primaryKey;autoIncrement" json:"id"`
+	SalesOrderID int               `gorm:"not null;index" json:"sales_order_id"`
+	LocationID   int               `gorm:"not null" json:"location_id"`
+	VariantID    int               `gorm:"not null" json:"variant_id"`
+	Quantity     int               `gorm:"not null" json:"quantity"`
+	Status       ReservationStatus `gorm:"not null;default:'ACTIVE';size:20" json:"status"`
+	ExpiresAt    time.Time         `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// StockTransfer documents a move between locations; its two TRANSFER
+// movements reference it.
+type StockTransfer struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TransferNumber string    `gorm:"unique;not null;size:64" json:"transfer_number"`
+	VariantID      int       `gorm:"not null" json:"variant_id"`
+	FromLocationID int       `gorm:"not null" json:"from_location_id"`
+	ToLocationID   int       `gorm:"not null" json:"to_location_id"`
+	Quantity       int       `gorm:"not null" json:"quantity"`
+	CreatedBy      *int      `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// LoyaltyProgram holds the earning and redemption rules. There is a single
+// row; without it the program is off.
+type LoyaltyProgram struct {
+	ID                 int       `gorm:"primaryKey" json:"id"`
+	IsActive           bool      `gorm:"not null" json:"is_active"`
+	SpendPerPoint      float64   `gorm:"not null;type:decimal(12,2)" json:"spend_per_point"` // IDR spent to earn one point
+	PointValue         float64   `gorm:"not null;type:decimal(12,2)" json:"point_value"`     // IDR off per redeemed point
+	MinRedeemPoints    int       `gorm:"not null" json:"min_redeem_points"`
+	MaxRedeemPercent   float64   `gorm:"not null;type:decimal(5,2)" json:"max_redeem_percent"`  // Of the order total
+	ExpiryMonths       int       `gorm:"not null" json:"expiry_months"`                         // 0 keeps points forever
+	BirthdayMultiplier float64   `gorm:"not null;type:decimal(5,2)" json:"birthday_multiplier"` // Orders paid in the birthday month
+	UpdatedAt          time.Time `json:"updated_at"`
+
+	Multipliers []LoyaltyCategoryMultiplier `gorm:"-" json:"category_multipliers,omitempty"`
+}
+
+// LoyaltyCategoryMultiplier earns more (or fewer) points on a category's products.
+type LoyaltyCategoryMultiplier struct {
+	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CategoryID int       `gorm:"uniqueIndex;not null" json:"category_id"`
+	Category   *Category `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Multiplier float64   `gorm:"not null;type:decimal(5,2)" json:"multiplier"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// LoyaltyEntry is one line of a customer's points ledger; the balance is
+// BalanceAfter of the latest entry. Credits are lots that are spent oldest
+// first: Remaining is what is left of a lot to redeem or expire.
+type LoyaltyEntry struct {
+	ID           int              `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID   int              `gorm:"not null;index" json:"customer_id"`
+	Type         LoyaltyEntryType `gorm:"not null;size:20" json:"type"`
+	Points       int              `gorm:"not null" json:"points"` // Negative when spent
+	BalanceAfter int              `gorm:"not null" json:"balance_after"`
+	Remaining    int              `gorm:"not null;default:0" json:"remaining"`
+	ExpiresAt    *time.Time       `gorm:"index" json:"expires_at"`
+	SalesOrderID *int             `gorm:"index" json:"sales_order_id"`
+	Note         *string          `gorm:"size:255" json:"note"`
+	CreatedBy    *int             `json:"created_by"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
@@ -17,15 +17,78 @@ type MediaAsset struct {
 	AITags    map[string]interface{} `gorm:"type:jsonb" json:"ai_tags"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
+
+	// Uploads start PENDING and become READY via the completion handshake.
+	// The column default is READY so rows that predate the handshake stay usable.
+	Status      MediaStatus `gorm:"not null;default:'READY';size:20;index" json:"status"`
+	Checksum    *string     `gorm:"size:64" json:"checksum"` // SHA-256 hex of the stored object
+	CompletedAt *time.Time  `json:"completed_at"`
+
+	// Set by the processing job once the upload has been decoded
+	ProcessedAt     *time.Time       `json:"processed_at"`
+	ProcessingError *string          `gorm:"size:255" json:"processing_error,omitempty"`
+	Renditions      []MediaRendition `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE" json:"renditions,omitempty"`
+}
+
+// MediaRendition is a resized, metadata-free copy of an image asset.
+type MediaRendition struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	MediaID   int       `gorm:"not null;uniqueIndex:idx_rendition_variant" json:"media_id"`
+	Name      string    `gorm:"not null;size:20;uniqueIndex:idx_rendition_variant" json:"name"`   // thumbnail, card, zoom
+	Format    string    `gorm:"not null;size:10;uniqueIndex:idx_rendition_variant" json:"format"` // webp, jpeg
+	Path      string    `gorm:"not null;size:512" json:"path"`
+	Width     int       `gorm:"not null" json:"width"`
+	Height    int       `gorm:"not null" json:"height"`
+	SizeBytes int64     `gorm:"not null" json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Entity types used by MediaLink
+const (
+	MediaEntityProduct  = "products"
+	MediaEntityVariant  = "variants"
+	MediaEntityCategory = "categories"
+)
+
+// Zones group an entity's media; responses list them in this order.
+const (
+	MediaZoneHero      = "hero"
+	MediaZoneGallery   = "gallery"
+	MediaZoneCareGuide = "care-guide"
+)
+
+var MediaZones = []string{MediaZoneHero, MediaZoneGallery, MediaZoneCareGuide}
+
+// MediaView is the read model embedded in catalog responses, with signed URLs.
+type MediaView struct {
+	ID         int             `json:"id"`
+	Zone       string          `json:"zone"`
+	SortOrder  int             `json:"sort_order"`
+	IsPrimary  bool            `json:"is_primary"`
+	AltText    *string         `json:"alt_text"`
+	Width      *int            `json:"width"`
+	Height     *int            `json:"height"`
+	Blurhash   *string         `json:"blurhash"`
+	URL        string          `json:"url"`
+	Renditions []RenditionView `json:"renditions"`
+}
+
+type RenditionView struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
 }
 
 type MediaLink struct {
 	ID         int         `gorm:"primaryKey;autoIncrement" json:"id"`
 	MediaID    int         `gorm:"not null" json:"media_id"`
 	Media      *MediaAsset `gorm:"foreignKey:MediaID" json:"media"`
-	EntityType string      `gorm:"not null;size:50" json:"entity_type"`
-	EntityID   int         `gorm:"not null" json:"entity_id"`
+	EntityType string      `gorm:"not null;size:50;index:idx_media_link_entity" json:"entity_type"`
+	EntityID   int         `gorm:"not null;index:idx_media_link_entity" json:"entity_id"`
 	Zone       string      `gorm:"not null;default:'gallery';size:50" json:"zone"`
 	SortOrder  int         `gorm:"not null;default:0" json:"sort_order"`
+	IsPrimary  bool        `gorm:"not null;default:false" json:"is_primary"` // At most one per entity; used for listing thumbnails
 	CreatedAt  time.Time   `json:"created_at"`
 }
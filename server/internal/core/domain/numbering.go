@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// DocumentSeries configures the numbers of one document type. Types without
+// a row use the built-in defaults.
+type DocumentSeries struct {
+	DocType         DocumentType `gorm:"primaryKey;size:30" json:"doc_type"`
+	Prefix          string       `gorm:"not null;size:20" json:"prefix"`
+	IncludeYear     bool         `gorm:"not null" json:"include_year"`
+	IncludeLocation bool         `gorm:"not null" json:"include_location"`
+	Padding         int          `gorm:"not null" json:"padding"`
+	YearlyReset     bool         `gorm:"not null" json:"yearly_reset"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+// DocumentCounter is the last number issued in one scope (year and/or
+// location) of a series. It is bumped inside the transaction that inserts
+// the document, so a rollback gives the number back and no gaps appear.
+type DocumentCounter struct {
+	DocType   DocumentType `gorm:"primaryKey;size:30" json:"doc_type"`
+	Scope     string       `gorm:"primaryKey;size:64" json:"scope"`
+	LastValue int64        `gorm:"not null;default:0" json:"last_value"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -31,5 +31,7 @@ type PurchaseOrderItem struct {
 	QuoteValidUntil      *time.Time      `gorm:"type:date" json:"quote_valid_until"`
 	VendorQuoteAttachUrl *string         `gorm:"size:512" json:"vendor_quote_attachment_url"`
 	UnitCost             float64         `gorm:"not null;type:decimal(12,2);default:0" json:"unit_cost"`
+	TaxRate              float64         `gorm:"not null;type:decimal(5,4);default:0" json:"tax_rate"`
+	TaxAmount            float64         `gorm:"not null;type:decimal(12,2);default:0" json:"tax_amount"`
 	LineTotal            float64         `gorm:"not null;type:decimal(14,2);default:0" json:"line_total"`
 }
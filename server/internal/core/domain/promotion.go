@@ -17,15 +17,19 @@ type Promotion struct {
 	TotalUsageLimit *int                   `json:"total_usage_limit"`
 	PerUserLimit    *int                   `gorm:"default:1" json:"per_user_limit"`
 	GLAccountCode   *string                `gorm:"default:'SALES_DISC';size:50" json:"gl_account_code"`
+	IsTemplate      bool                   `gorm:"not null;default:false" json:"is_template"` // Copied into one-time coupons; never applied itself
+	TemplateID      *int                   `gorm:"index" json:"template_id"`                  // The template a generated coupon came from
 	CreatedAt       time.Time              `json:"created_at"`
 	UpdatedAt       time.Time              `json:"updated_at"`
 }
 
+// PromotionUsage records one coupon redemption. Guests are counted by email.
 type PromotionUsage struct {
 	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	PromotionID  int       `gorm:"not null" json:"promotion_id"`
-	CustomerID   int       `gorm:"not null" json:"customer_id"`
-	SalesOrderID int       `gorm:"not null" json:"sales_order_id"`
+	PromotionID  int       `gorm:"not null;index" json:"promotion_id"`
+	CustomerID   *int      `gorm:"index" json:"customer_id"`
+	Email        *string   `gorm:"size:320" json:"email"`
+	SalesOrderID int       `gorm:"not null;index" json:"sales_order_id"`
 	UsedAt       time.Time `gorm:"not null;default:current_timestamp" json:"used_at"`
 }
 
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// MarketingConsent records whether an email address agreed to marketing
+// messages. Addresses without a row have not.
+type MarketingConsent struct {
+	ID        int           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email     string        `gorm:"uniqueIndex;not null;size:320" json:"email"` // Lower case
+	OptedIn   bool          `gorm:"not null;default:false" json:"opted_in"`
+	Source    ConsentSource `gorm:"not null;size:20" json:"source"` // Where it was last changed
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// CartReminder is a recovery message sent for an idle cart or an unpaid web
+// order, and the paid order that followed it, if any.
+type CartReminder struct {
+	ID               int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	CartID           *int       `gorm:"uniqueIndex:idx_cart_reminder_activity" json:"cart_id"`
+	SalesOrderID     *int       `gorm:"uniqueIndex" json:"sales_order_id"` // The abandoned order
+	Email            string     `gorm:"not null;size:320;index" json:"email"`
+	ActivityAt       time.Time  `gorm:"not null;uniqueIndex:idx_cart_reminder_activity" json:"activity_at"` // Last change reminded about
+	CartTotal        float64    `gorm:"not null;type:decimal(14,2);default:0" json:"cart_total"`
+	PromotionID      *int       `json:"promotion_id"` // One-time coupon generated for this reminder
+	CouponCode       *string    `gorm:"size:64" json:"coupon_code"`
+	SentAt           time.Time  `gorm:"not null" json:"sent_at"`
+	AttributeUntil   time.Time  `gorm:"not null" json:"attribute_until"` // Orders paid until then count as recovered
+	RecoveredOrderID *int       `gorm:"index" json:"recovered_order_id"`
+	RecoveredAt      *time.Time `json:"recovered_at"`
+	RecoveredTotal   float64    `gorm:"not null;type:decimal(14,2);default:0" json:"recovered_total"`
+}
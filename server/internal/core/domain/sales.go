@@ -16,6 +16,9 @@ type SalesOrder struct {
 	PaymentMethod           string                 `gorm:"size:50" json:"payment_method"`
 	ShipmentStatus          ShipmentStatus         `gorm:"not null;default:'PENDING'" json:"shipment_status"`
 	Carrier                 *string                `gorm:"size:100" json:"carrier"`
+	ShippingMethodID        *int                   `json:"shipping_method_id"`
+	ShippingRateID          *int                   `json:"shipping_rate_id"`
+	ShippingWeightKG        *float64               `gorm:"type:decimal(8,3)" json:"shipping_weight_kg"` // Chargeable weight quoted
 	TrackingNumber          *string                `gorm:"size:150" json:"tracking_number"`
 	POSSessionID            *int                   `json:"pos_session_id"`
 	ShippingAddressSnapshot map[string]interface{} `gorm:"type:jsonb" json:"shipping_address_snapshot"`
@@ -24,28 +27,42 @@ type SalesOrder struct {
 	SubtotalAmount          float64                `gorm:"not null;type:decimal(12,2);default:0" json:"subtotal_amount"`
 	ShippingAmount          float64                `gorm:"not null;type:decimal(12,2);default:0" json:"shipping_amount"`
 	TaxAmount               float64                `gorm:"not null;type:decimal(12,2);default:0" json:"tax_amount"`
+	PricesIncludeTax        bool                   `gorm:"not null;default:false" json:"prices_include_tax"` // TaxAmount is already in the line totals
 	DiscountAmount          float64                `gorm:"not null;type:decimal(12,2);default:0" json:"discount_amount"`
+	PointsRedeemed          int                    `gorm:"not null;default:0" json:"points_redeemed"`
+	PointsDiscount          float64                `gorm:"not null;type:decimal(12,2);default:0" json:"points_discount"` // Taken off the total after tax
 	TotalAmount             float64                `gorm:"not null;type:decimal(14,2);default:0" json:"total_amount"`
+	PaidAmount              float64                `gorm:"not null;type:decimal(14,2);default:0" json:"paid_amount"`    // Sum of settled payments
+	DepositAmount           float64                `gorm:"not null;type:decimal(14,2);default:0" json:"deposit_amount"` // Due at checkout for pre-orders, the rest when stock arrives; 0 when the total is due
+	SubscriptionID          *int                   `gorm:"index" json:"subscription_id"`                                // Placed by a subscription run
 	PlacedAt                time.Time              `gorm:"not null;default:current_timestamp" json:"placed_at"`
 	CreatedBy               *int                   `json:"created_by"`
 	CreatedAt               time.Time              `json:"created_at"`
 	UpdatedAt               time.Time              `json:"updated_at"`
 	DeletedAt               *time.Time             `json:"deleted_at"`
 	Items                   []SalesOrderItem       `gorm:"foreignKey:SalesOrderID" json:"items,omitempty"`
+	Promotions              []SalesOrderPromotion  `gorm:"foreignKey:SalesOrderID" json:"promotions,omitempty"`
 }
 
 type SalesOrderItem struct {
-	ID           int             `gorm:"primaryKey;autoIncrement" json:"id"`
-	SalesOrderID int             `gorm:"not null" json:"sales_order_id"`
-	VariantID    int             `gorm:"not null" json:"variant_id"`
-	Variant      *ProductVariant `gorm:"foreignKey:VariantID" json:"variant"`
-	ProductName  string          `gorm:"not null;size:255" json:"product_name"`
-	SKU          string          `gorm:"not null;size:64" json:"sku"`
-	Quantity     int             `gorm:"not null;default:1" json:"quantity"`
-	UnitPrice    float64         `gorm:"not null;type:decimal(12,2);default:0" json:"unit_price"`
-	TaxRate      float64         `gorm:"not null;type:decimal(5,4);default:0" json:"tax_rate"`
-	TaxAmount    float64         `gorm:"not null;type:decimal(12,2);default:0" json:"tax_amount"`
-	LineTotal    float64         `gorm:"not null;type:decimal(14,2);default:0" json:"line_total"`
+	ID             int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	SalesOrderID   int             `gorm:"not null" json:"sales_order_id"`
+	VariantID      int             `gorm:"not null" json:"variant_id"`
+	Variant        *ProductVariant `gorm:"foreignKey:VariantID" json:"variant"`
+	ProductName    string          `gorm:"not null;size:255" json:"product_name"`
+	SKU            string          `gorm:"not null;size:64" json:"sku"`
+	Quantity       int             `gorm:"not null;default:1" json:"quantity"`
+	UnitPrice      float64         `gorm:"not null;type:decimal(12,2);default:0" json:"unit_price"`
+	DiscountAmount float64         `gorm:"not null;type:decimal(12,2);default:0" json:"discount_amount"`
+	TaxRate        float64         `gorm:"not null;type:decimal(5,4);default:0" json:"tax_rate"`
+	TaxRuleID      *int            `json:"tax_rule_id"`
+	TaxAmount      float64         `gorm:"not null;type:decimal(12,2);default:0" json:"tax_amount"`
+	LineTotal      float64         `gorm:"not null;type:decimal(14,2);default:0" json:"line_total"`
+	// Backordered units are waiting on stock; they are allocated as purchase
+	// orders are received, the linked PO line first
+	Backordered         int        `gorm:"not null;default:0;index" json:"backordered"`
+	ExpectedAt          *time.Time `gorm:"type:date" json:"expected_at"`
+	PurchaseOrderItemID *int       `gorm:"index" json:"purchase_order_item_id"`
 }
 
 type Shipment struct {
@@ -62,6 +79,7 @@ type Shipment struct {
 
 type Return struct {
 	ID           int         `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReturnNumber string      `gorm:"unique;not null;size:64" json:"return_number"`
 	SalesOrderID int         `gorm:"not null" json:"sales_order_id"`
 	SalesOrder   *SalesOrder `gorm:"foreignKey:SalesOrderID" json:"sales_order"`
 	Reason       *string     `gorm:"size:255" json:"reason"`
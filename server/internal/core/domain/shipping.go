@@ -0,0 +1,56 @@
+package domain
+
+import "time"
+
+// ShippingZone groups destinations. A destination belongs to the zone when
+// its postal code starts with one of PostalPrefixes, or its city or
+// province is listed.
+type ShippingZone struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string    `gorm:"not null;size:100" json:"name"`
+	PostalPrefixes []string  `gorm:"type:jsonb;serializer:json;not null;default:'[]'" json:"postal_prefixes"`
+	Cities         []string  `gorm:"type:jsonb;serializer:json;not null;default:'[]'" json:"cities"`
+	Provinces      []string  `gorm:"type:jsonb;serializer:json;not null;default:'[]'" json:"provinces"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ShippingMethod is a delivery service offered at checkout. Without rates it
+// charges FlatPrice everywhere; otherwise only destinations covered by a rate
+// can use it.
+type ShippingMethod struct {
+	ID                int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code              string         `gorm:"unique;not null;size:50" json:"code"` // e.g. "JNE_REG"
+	Name              string         `gorm:"not null;size:100" json:"name"`
+	Carrier           *string        `gorm:"size:100" json:"carrier"`
+	FlatPrice         float64        `gorm:"not null;type:decimal(12,2);default:0" json:"flat_price"`
+	FreeOver          *float64       `gorm:"type:decimal(12,2)" json:"free_over"`              // Order value from which shipping is free
+	VolumetricDivisor int            `gorm:"not null;default:6000" json:"volumetric_divisor"`  // cm³ per kg
+	AllowsLivePlants  bool           `gorm:"not null;default:false" json:"allows_live_plants"` // Fast, climate-safe services only
+	EtaMinDays        int            `gorm:"not null;default:1" json:"eta_min_days"`
+	EtaMaxDays        int            `gorm:"not null;default:3" json:"eta_max_days"`
+	Position          int            `gorm:"not null;default:0" json:"position"`
+	IsActive          bool           `gorm:"not null" json:"is_active"`
+	Rates             []ShippingRate `gorm:"foreignKey:MethodID;constraint:OnDelete:CASCADE" json:"rates,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// ShippingRate prices a method for a zone (nil: any destination not covered
+// by a zone rate) and a chargeable weight bracket: BasePrice plus PricePerKG
+// for every started kilogram above MinWeightKG.
+type ShippingRate struct {
+	ID          int           `gorm:"primaryKey;autoIncrement" json:"id"`
+	MethodID    int           `gorm:"not null;index" json:"method_id"`
+	ZoneID      *int          `gorm:"index" json:"zone_id"`
+	Zone        *ShippingZone `gorm:"foreignKey:ZoneID" json:"zone,omitempty"`
+	MinWeightKG float64       `gorm:"not null;type:decimal(8,3);default:0" json:"min_weight_kg"`
+	MaxWeightKG *float64      `gorm:"type:decimal(8,3)" json:"max_weight_kg"`
+	BasePrice   float64       `gorm:"not null;type:decimal(12,2);default:0" json:"base_price"`
+	PricePerKG  float64       `gorm:"not null;type:decimal(12,2);default:0" json:"price_per_kg"`
+	EtaMinDays  *int          `json:"eta_min_days"` // Overrides the method's ETA
+	EtaMaxDays  *int          `json:"eta_max_days"`
+	// RetiredAt is set when the rate was removed from its method while orders
+	// still refer to it; retired rates are no longer quoted
+	RetiredAt *time.Time `gorm:"index" json:"retired_at,omitempty"`
+}
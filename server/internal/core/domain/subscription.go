@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+// SubscriptionPlan is something sold on repeat, e.g. a plant-of-the-month
+// box or a fertilizer refill. Its default items make up a new
+// subscription; the others are what subscribers may swap to.
+type SubscriptionPlan struct {
+	ID            int                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name          string               `gorm:"not null;size:255" json:"name"`
+	Description   *string              `gorm:"type:text" json:"description"`
+	IntervalUnit  SubscriptionInterval `gorm:"not null;default:'MONTH';size:10" json:"interval_unit"`
+	IntervalCount int                  `gorm:"not null;default:1" json:"interval_count"` // Every 2 WEEKs, every 1 MONTH, ...
+	IsActive      bool                 `gorm:"not null" json:"is_active"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+
+	Items []SubscriptionPlanItem `gorm:"foreignKey:PlanID" json:"items,omitempty"`
+}
+
+type SubscriptionPlanItem struct {
+	ID        int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlanID    int             `gorm:"not null;uniqueIndex:idx_plan_variant" json:"plan_id"`
+	VariantID int             `gorm:"not null;uniqueIndex:idx_plan_variant" json:"variant_id"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  int             `gorm:"not null;default:1" json:"quantity"`
+	IsDefault bool            `gorm:"not null" json:"is_default"` // In a new subscription; otherwise a swap option
+}
+
+// Subscription is a customer's standing order on a plan. Each run places a
+// web order for its items and charges it; an unpaid order is kept in
+// PendingOrderID and its payment retried until it is paid or the attempts
+// run out.
+type Subscription struct {
+	ID                int                `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID        int                `gorm:"not null;index" json:"customer_id"`
+	Customer          *Customer          `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	PlanID            int                `gorm:"not null;index" json:"plan_id"`
+	Plan              *SubscriptionPlan  `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
+	Status            SubscriptionStatus `gorm:"not null;default:'ACTIVE';size:20;index" json:"status"`
+	NextRunAt         time.Time          `gorm:"not null;index" json:"next_run_at"`
+	PausedUntil       *time.Time         `json:"paused_until"` // Resumes by itself then; nil pauses until resumed
+	ShippingAddressID int                `gorm:"not null" json:"shipping_address_id"`
+	ShippingMethod    string             `gorm:"not null;size:50" json:"shipping_method"` // Method code
+	PaymentMethod     string             `gorm:"size:50" json:"payment_method"`
+	PaymentToken      *string            `gorm:"size:255" json:"-"` // Saved with the provider; without it each order is paid by link
+	PendingOrderID    *int               `json:"pending_order_id"`
+	Attempts          int                `gorm:"not null;default:0" json:"attempts"` // Failed payment attempts on the pending order
+	RetryAt           *time.Time         `json:"retry_at"`
+	LastError         *string            `gorm:"size:255" json:"last_error"`
+	LastOrderID       *int               `json:"last_order_id"` // Latest paid order
+	CancelledAt       *time.Time         `json:"cancelled_at"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+
+	Items []SubscriptionItem `gorm:"foreignKey:SubscriptionID" json:"items,omitempty"`
+}
+
+type SubscriptionItem struct {
+	ID             int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubscriptionID int             `gorm:"not null;index" json:"subscription_id"`
+	VariantID      int             `gorm:"not null" json:"variant_id"`
+	Variant        *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity       int             `gorm:"not null" json:"quantity"`
+}
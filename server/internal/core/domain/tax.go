@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// TaxRule sets the rate for a tax class, customer type and region. Empty
+// TaxClass, CustomerType or Region match anything; the most specific active
+// rule wins.
+type TaxRule struct {
+	ID           int           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name         string        `gorm:"not null;size:100" json:"name"` // e.g. "PPN 11%"
+	TaxClass     *string       `gorm:"size:50" json:"tax_class"`
+	CustomerType *CustomerType `gorm:"size:20" json:"customer_type"`
+	Region       *string       `gorm:"size:100" json:"region"` // Province or city
+	Rate         float64       `gorm:"not null;type:decimal(5,4)" json:"rate"`
+	Priority     int           `gorm:"not null;default:0" json:"priority"`
+	IsActive     bool          `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
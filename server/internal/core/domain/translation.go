@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Translations hold per-locale overrides for catalog text.
+// The base columns on Product/Category/Tag are the default locale.
+
+type ProductTranslation struct {
+	ProductID   int       `gorm:"primaryKey" json:"product_id"`
+	Locale      string    `gorm:"primaryKey;size:10" json:"locale"`
+	Name        string    `gorm:"not null;size:255" json:"name"`
+	Description *string   `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CategoryTranslation struct {
+	CategoryID  int       `gorm:"primaryKey" json:"category_id"`
+	Locale      string    `gorm:"primaryKey;size:10" json:"locale"`
+	Name        string    `gorm:"not null;size:150" json:"name"`
+	Description *string   `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type TagTranslation struct {
+	TagID       int       `gorm:"primaryKey" json:"tag_id"`
+	Locale      string    `gorm:"primaryKey;size:10" json:"locale"`
+	DisplayName string    `gorm:"not null;size:150" json:"display_name"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
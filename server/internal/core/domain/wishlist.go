@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+type WishlistItem struct {
+	UserID    int             `gorm:"primaryKey" json:"user_id"`
+	VariantID int             `gorm:"primaryKey" json:"variant_id"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// StockSubscription is a "notify me" request for an out-of-stock variant.
+// It stays PENDING until the stock ledger reports the variant available again.
+type StockSubscription struct {
+	ID         int                     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int                     `gorm:"not null;index" json:"user_id"`
+	User       *User                   `gorm:"foreignKey:UserID" json:"-"`
+	VariantID  int                     `gorm:"not null;index" json:"variant_id"`
+	Variant    *ProductVariant         `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Status     StockSubscriptionStatus `gorm:"not null;default:'PENDING';size:20" json:"status"`
+	NotifiedAt *time.Time              `json:"notified_at"`
+	LastError  *string                 `gorm:"size:255" json:"-"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
@@ -2,6 +2,7 @@ package dto
 
 import (
 	"server/internal/core/domain"
+	"time"
 )
 
 // --- Products ---
@@ -14,17 +15,22 @@ type CreateProductRequest struct {
 	SupplierID  int     `json:"supplier_id"`
 	BasePrice   float64 `json:"base_price" validate:"required,gte=0"`
 	WeightKG    float64 `json:"weight_kg"`
-	// Initial Variant
-	StockControl bool `json:"stock_control"`
+	HeightCM    float64 `json:"height_cm"`
+	WidthCM     float64 `json:"width_cm"`
+	DepthCM     float64 `json:"depth_cm"`
+	IsLivePlant bool    `json:"is_live_plant"`
+	IsGiftCard  bool    `json:"is_gift_card"`
 }
 
 func (r *CreateProductRequest) ToDomain() *domain.Product {
 	p := &domain.Product{
-		Name:      r.Name,
-		SKU:       r.SKU,
-		Slug:      r.Slug,
-		BasePrice: r.BasePrice,
-		IsActive:  true,
+		Name:        r.Name,
+		SKU:         r.SKU,
+		Slug:        r.Slug,
+		BasePrice:   r.BasePrice,
+		IsActive:    true,
+		IsLivePlant: r.IsLivePlant,
+		IsGiftCard:  r.IsGiftCard,
 	}
 
 	if r.Description != "" {
@@ -36,6 +42,10 @@ func (r *CreateProductRequest) ToDomain() *domain.Product {
 		val := r.WeightKG
 		p.WeightKG = &val
 	}
+	if r.HeightCM > 0 && r.WidthCM > 0 && r.DepthCM > 0 {
+		h, w, d := r.HeightCM, r.WidthCM, r.DepthCM
+		p.HeightCM, p.WidthCM, p.DepthCM = &h, &w, &d
+	}
 
 	if r.CategoryID != 0 {
 		id := r.CategoryID
@@ -56,13 +66,100 @@ type UpdateProductRequest struct {
 	CategoryID  *int     `json:"category_id"`
 	IsActive    *bool    `json:"is_active"`
 	WeightKG    *float64 `json:"weight_kg"`
+	HeightCM    *float64 `json:"height_cm"`
+	WidthCM     *float64 `json:"width_cm"`
+	DepthCM     *float64 `json:"depth_cm"`
+	IsLivePlant *bool    `json:"is_live_plant"`
+	IsGiftCard  *bool    `json:"is_gift_card"`
 }
 
 type ProductVariantRequest struct {
-	SKU        string                 `json:"sku" validate:"required"`
-	Name       string                 `json:"name"`
-	Price      float64                `json:"price" validate:"gte=0"`
-	Attributes map[string]interface{} `json:"attributes"`
+	ID             int                      `json:"id"` // 0 = new variant
+	SKU            string                   `json:"sku" validate:"required"`
+	Name           string                   `json:"name"`
+	Price          float64                  `json:"price" validate:"gte=0"`
+	CompareAtPrice *float64                 `json:"compare_at_price"`
+	Attributes     map[string]interface{}   `json:"attributes"`
+	Barcode        string                   `json:"barcode"`      // Empty = generate internal code
+	BarcodeType    *domain.BarcodeSymbology `json:"barcode_type"` // EAN13 (default) or CODE128
+	StockControl   *bool                    `json:"stock_control"`
+	IsActive       *bool                    `json:"is_active"`
+	Availability   domain.AvailabilityMode  `json:"availability"`    // IN_STOCK (default), BACKORDER or PREORDER
+	ExpectedAt     *time.Time               `json:"expected_at"`     // Pre-orders
+	DepositPercent *float64                 `json:"deposit_percent"` // Pre-orders; 100 (default) takes full payment
+}
+
+func (r *ProductVariantRequest) ToDomain() domain.ProductVariant {
+	v := domain.ProductVariant{
+		ID:             r.ID,
+		SKU:            r.SKU,
+		Price:          r.Price,
+		CompareAtPrice: r.CompareAtPrice,
+		Attributes:     r.Attributes,
+		BarcodeType:    r.BarcodeType,
+		StockControl:   true,
+		IsActive:       true,
+		Availability:   r.Availability,
+		ExpectedAt:     r.ExpectedAt,
+		DepositPercent: 100,
+	}
+
+	if r.Name != "" {
+		name := r.Name
+		v.Name = &name
+	}
+	if r.Barcode != "" {
+		code := r.Barcode
+		v.Barcode = &code
+	}
+	if v.Attributes == nil {
+		v.Attributes = map[string]interface{}{}
+	}
+	if r.StockControl != nil {
+		v.StockControl = *r.StockControl
+	}
+	if r.IsActive != nil {
+		v.IsActive = *r.IsActive
+	}
+	if v.Availability == "" {
+		v.Availability = domain.AvailabilityInStock
+	}
+	if r.DepositPercent != nil {
+		v.DepositPercent = *r.DepositPercent
+	}
+
+	return v
+}
+
+// --- Variant Matrix ---
+type ProductOptionRequest struct {
+	Name   string                      `json:"name" validate:"required"`
+	Values []ProductOptionValueRequest `json:"values" validate:"required,min=1,dive"`
+}
+
+type ProductOptionValueRequest struct {
+	Value      string  `json:"value" validate:"required"`
+	Code       string  `json:"code"` // SKU fragment; derived from value when empty
+	PriceDelta float64 `json:"price_delta"`
+}
+
+type GenerateVariantsRequest struct {
+	// Tokens: {sku} and {<option name>}, e.g. "{sku}-{Pot Size}-{Colour}".
+	// Empty = product SKU followed by every option code.
+	SKUPattern string   `json:"sku_pattern"`
+	BasePrice  *float64 `json:"base_price"` // Defaults to the product base price
+	DryRun     bool     `json:"dry_run"`
+}
+
+type VariantMatrixResult struct {
+	Created     []domain.ProductVariant `json:"created"`
+	Reactivated []domain.ProductVariant `json:"reactivated"`
+	Deactivated []domain.ProductVariant `json:"deactivated"`
+	Unchanged   int                     `json:"unchanged"`
+}
+
+type AssignBarcodesRequest struct {
+	Symbology domain.BarcodeSymbology `json:"symbology" validate:"omitempty,oneof=EAN13 CODE128"`
 }
 
 // --- Users (Admin Manage) ---
@@ -102,23 +199,266 @@ type TriggerCampaignRequest struct {
 type CreatePromotionRequest struct {
 	Name        string                 `json:"name" validate:"required"`
 	Code        string                 `json:"code" validate:"alphanum"`
+	Priority    int                    `json:"priority"` // Higher runs first
 	IsExclusive bool                   `json:"is_exclusive"`
-	Conditions  map[string]interface{} `json:"conditions"` // e.g., {"min_cart_total": 50000}
-	Actions     map[string]interface{} `json:"actions"`    // e.g., {"percent_off": 10}
+	Conditions  map[string]interface{} `json:"conditions"` // e.g., {"min_subtotal": 50000, "channels": ["WEB"]}
+	Actions     map[string]interface{} `json:"actions"`    // e.g., {"type": "PERCENT_OFF_CART", "percent": 10, "max_discount": 25000}
 	StartsAt    string                 `json:"starts_at"`
 	EndsAt      string                 `json:"ends_at"`
+
+	TotalUsageLimit *int `json:"total_usage_limit"`
+	PerUserLimit    *int `json:"per_user_limit"` // Defaults to 1 for coupons
+
+	IsTemplate bool `json:"is_template"` // Copied into one-time coupons, e.g. for cart reminders
 }
 
 type UpdatePromotionRequest struct {
 	Name            *string                `json:"name"`
 	Code            *string                `json:"code"`
 	Description     *string                `json:"description"`
+	Priority        *int                   `json:"priority"`
+	IsExclusive     *bool                  `json:"is_exclusive"`
 	IsActive        *bool                  `json:"is_active"`
 	StartsAt        *string                `json:"starts_at"` // ISO8601
 	EndsAt          *string                `json:"ends_at"`   // ISO8601
 	Conditions      map[string]interface{} `json:"conditions"`
 	Actions         map[string]interface{} `json:"actions"`
 	TotalUsageLimit *int                   `json:"total_usage_limit"`
+	PerUserLimit    *int                   `json:"per_user_limit"`
+	IsTemplate      *bool                  `json:"is_template"`
+}
+
+// SimulatePromotionsRequest describes a what-if cart. Saved promotions are
+// evaluated as of At (default now), coupons only when listed in CouponCodes;
+// Draft adds an unsaved promotion to the run.
+type SimulatePromotionsRequest struct {
+	Items       []SimulatedItem     `json:"items" validate:"required,min=1"`
+	CustomerID  *int                `json:"customer_id"`
+	Channel     string              `json:"channel"` // Default WEB
+	At          string              `json:"at"`      // RFC3339
+	CouponCodes []string            `json:"coupon_codes"`
+	Draft       *SimulatedPromotion `json:"draft"`
+}
+
+type SimulatedItem struct {
+	VariantID int      `json:"variant_id" validate:"required"`
+	Quantity  int      `json:"quantity" validate:"required,min=1"`
+	UnitPrice *float64 `json:"unit_price"` // Default catalog price
+}
+
+type SimulatedPromotion struct {
+	Name        string                 `json:"name"`
+	Priority    int                    `json:"priority"`
+	IsExclusive bool                   `json:"is_exclusive"`
+	Conditions  map[string]interface{} `json:"conditions"`
+	Actions     map[string]interface{} `json:"actions"`
+}
+
+type SimulatePromotionsResponse struct {
+	Subtotal       float64               `json:"subtotal"`
+	DiscountAmount float64               `json:"discount_amount"`
+	TotalAmount    float64               `json:"total_amount"`
+	FreeShipping   bool                  `json:"free_shipping"`
+	Lines          []SimulatedLine       `json:"lines"`
+	Applied        []SimulatedDiscount   `json:"applied"`
+	Evaluated      []PromotionEvaluation `json:"evaluated"` // In evaluation order
+}
+
+type SimulatedLine struct {
+	VariantID      int     `json:"variant_id"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      float64 `json:"unit_price"`
+	DiscountAmount float64 `json:"discount_amount"`
+	LineTotal      float64 `json:"line_total"`
+}
+
+type SimulatedDiscount struct {
+	PromotionID    int                  `json:"promotion_id"` // 0 for the draft
+	Name           string               `json:"name"`
+	Code           *string              `json:"code"`
+	DiscountAmount float64              `json:"discount_amount"`
+	FreeShipping   bool                 `json:"free_shipping"`
+	Lines          []SimulatedLineShare `json:"lines"`
+}
+
+type SimulatedLineShare struct {
+	VariantID int     `json:"variant_id"`
+	Amount    float64 `json:"amount"`
+}
+
+// PromotionEvaluation statuses are APPLIED, NOT_MATCHED, NO_DISCOUNT, SKIPPED,
+// ERROR and INVALID (the rule does not parse or compile).
+type PromotionEvaluation struct {
+	PromotionID int     `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Code        *string `json:"code"`
+	Status      string  `json:"status"`
+	Reason      string  `json:"reason,omitempty"`
+}
+
+// --- Tax ---
+type CreateTaxRuleRequest struct {
+	Name         string  `json:"name" validate:"required"`
+	TaxClass     string  `json:"tax_class"`                  // Empty matches every class
+	CustomerType string  `json:"customer_type"`              // INDIVIDUAL, BUSINESS or empty
+	Region       string  `json:"region"`                     // Province or city, empty for everywhere
+	Rate         float64 `json:"rate" validate:"gte=0,lt=1"` // 0.11 for 11%
+	Priority     int     `json:"priority"`
+}
+
+type UpdateTaxRuleRequest struct {
+	Name         *string  `json:"name"`
+	TaxClass     *string  `json:"tax_class"`
+	CustomerType *string  `json:"customer_type"`
+	Region       *string  `json:"region"`
+	Rate         *float64 `json:"rate"`
+	Priority     *int     `json:"priority"`
+	IsActive     *bool    `json:"is_active"`
+}
+
+// --- Shipping ---
+
+// ShippingMethodRequest creates a method or, on update, replaces it together
+// with its rates. Rates sent with an id are updated in place; existing rates
+// left out are removed.
+type ShippingMethodRequest struct {
+	Code              string                `json:"code" validate:"required"`
+	Name              string                `json:"name" validate:"required"`
+	Carrier           *string               `json:"carrier"`
+	FlatPrice         float64               `json:"flat_price" validate:"gte=0"`
+	FreeOver          *float64              `json:"free_over"`
+	VolumetricDivisor int                   `json:"volumetric_divisor"` // Default 6000
+	AllowsLivePlants  bool                  `json:"allows_live_plants"`
+	EtaMinDays        int                   `json:"eta_min_days"`
+	EtaMaxDays        int                   `json:"eta_max_days"`
+	Position          int                   `json:"position"`
+	IsActive          *bool                 `json:"is_active"` // Default true
+	Rates             []ShippingRateRequest `json:"rates"`
+}
+
+type ShippingRateRequest struct {
+	ID          int      `json:"id"`      // Existing rate to update; empty adds one
+	ZoneID      *int     `json:"zone_id"` // Empty: every destination without a zone rate
+	MinWeightKG float64  `json:"min_weight_kg"`
+	MaxWeightKG *float64 `json:"max_weight_kg"`
+	BasePrice   float64  `json:"base_price"`
+	PricePerKG  float64  `json:"price_per_kg"`
+	EtaMinDays  *int     `json:"eta_min_days"`
+	EtaMaxDays  *int     `json:"eta_max_days"`
+}
+
+type ShippingZoneRequest struct {
+	Name           string   `json:"name" validate:"required"`
+	PostalPrefixes []string `json:"postal_prefixes"`
+	Cities         []string `json:"cities"`
+	Provinces      []string `json:"provinces"`
+}
+
+// --- Document Numbering ---
+// DocumentSeriesRequest sets the number format of one document type,
+// e.g. prefix INV with year and padding 6 gives INV-2026-000001.
+type DocumentSeriesRequest struct {
+	Prefix          string `json:"prefix" validate:"required"`
+	IncludeYear     bool   `json:"include_year"`
+	IncludeLocation bool   `json:"include_location"`
+	Padding         int    `json:"padding" validate:"min=1,max=12"`
+	YearlyReset     bool   `json:"yearly_reset"`
+}
+
+// --- Payments ---
+type RefundRequest struct {
+	Amount        float64 `json:"amount" validate:"required,gt=0"`
+	ToStoreCredit bool    `json:"to_store_credit"` // Instead of the original payment methods
+}
+
+// --- Gift Cards & Store Credit ---
+type IssueGiftCardRequest struct {
+	Amount         float64    `json:"amount" validate:"required,gt=0"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	RecipientEmail string     `json:"recipient_email" validate:"omitempty,email"` // The code is emailed when set
+	Note           string     `json:"note"`
+}
+
+type UpdateGiftCardRequest struct {
+	Status      *string    `json:"status" validate:"omitempty,oneof=ACTIVE DISABLED"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	ClearExpiry bool       `json:"clear_expiry"`
+}
+
+// StoreCreditAdjustRequest credits (positive) or debits (negative) a customer.
+type StoreCreditAdjustRequest struct {
+	Amount float64 `json:"amount" validate:"required"`
+	Note   string  `json:"note" validate:"required"`
+}
+
+// StoreCreditView is a customer's balance with its ledger, newest first.
+type StoreCreditView struct {
+	CustomerID int                       `json:"customer_id"`
+	Balance    float64                   `json:"balance"`
+	Entries    []domain.StoreCreditEntry `json:"entries"`
+}
+
+// --- Cart Recovery ---
+// CartRecoveryStats covers reminders sent between From and To.
+type CartRecoveryStats struct {
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	Sent             int64     `json:"sent"`
+	Recovered        int64     `json:"recovered"`
+	ConversionRate   float64   `json:"conversion_rate"` // Recovered / Sent
+	RecoveredRevenue float64   `json:"recovered_revenue"`
+	CouponsSent      int64     `json:"coupons_sent"`
+	CouponsRedeemed  int64     `json:"coupons_redeemed"`
+}
+
+// --- Loyalty ---
+type UpdateLoyaltyProgramRequest struct {
+	IsActive           *bool    `json:"is_active"`
+	SpendPerPoint      *float64 `json:"spend_per_point" validate:"omitempty,gt=0"`
+	PointValue         *float64 `json:"point_value" validate:"omitempty,gt=0"`
+	MinRedeemPoints    *int     `json:"min_redeem_points" validate:"omitempty,gte=0"`
+	MaxRedeemPercent   *float64 `json:"max_redeem_percent" validate:"omitempty,gt=0,lte=100"`
+	ExpiryMonths       *int     `json:"expiry_months" validate:"omitempty,gte=0"`
+	BirthdayMultiplier *float64 `json:"birthday_multiplier" validate:"omitempty,gte=1"`
+}
+
+// LoyaltyMultiplierRequest sets a category's earn multiplier; 1 removes it.
+type LoyaltyMultiplierRequest struct {
+	CategoryID int     `json:"category_id" validate:"required"`
+	Multiplier float64 `json:"multiplier" validate:"gte=0"`
+}
+
+// LoyaltyAdjustRequest credits (positive) or debits (negative) points.
+type LoyaltyAdjustRequest struct {
+	Points int    `json:"points" validate:"required"`
+	Note   string `json:"note" validate:"required"`
+}
+
+// LoyaltyView is a customer's points balance with its ledger, newest first.
+type LoyaltyView struct {
+	CustomerID     int                   `json:"customer_id"`
+	Balance        int                   `json:"balance"`
+	PointValue     float64               `json:"point_value"`     // IDR per point when redeemed
+	NextExpiry     *time.Time            `json:"next_expiry"`     // When the soonest points expire
+	ExpiringPoints int                   `json:"expiring_points"` // How many expire then
+	Entries        []domain.LoyaltyEntry `json:"entries"`
+}
+
+// BackorderLine is an order line with units waiting on stock.
+type BackorderLine struct {
+	ItemID              int                  `json:"item_id"`
+	OrderID             int                  `json:"order_id"`
+	OrderNumber         string               `json:"order_number"`
+	Status              domain.OrderStatus   `json:"status"`
+	PaymentStatus       domain.PaymentStatus `json:"payment_status"`
+	PlacedAt            time.Time            `json:"placed_at"`
+	VariantID           int                  `json:"variant_id"`
+	SKU                 string               `json:"sku"`
+	ProductName         string               `json:"product_name"`
+	Quantity            int                  `json:"quantity"`
+	Backordered         int                  `json:"backordered"` // Of Quantity, still waiting
+	ExpectedAt          *time.Time           `json:"expected_at"`
+	PurchaseOrderItemID *int                 `json:"purchase_order_item_id"`
 }
 
 // --- Media ---
@@ -128,22 +468,38 @@ type UploadMediaRequest struct {
 	SizeBytes int64  `json:"size_bytes" validate:"required,min=1"`
 }
 
+type CompleteMediaRequest struct {
+	Checksum string `json:"checksum" validate:"required,len=64,hexadecimal"` // SHA-256 of the uploaded bytes
+}
+
 type LinkMediaRequest struct {
 	MediaIDs   []int  `json:"media_ids" validate:"required"`
-	EntityType string `json:"entity_type" validate:"required,oneof=products categories"`
+	EntityType string `json:"entity_type" validate:"required,oneof=products variants categories"`
 	EntityID   int    `json:"entity_id" validate:"required"`
-	Zone       string `json:"zone" validate:"required"` // e.g. "gallery"
+	Zone       string `json:"zone" validate:"required,oneof=hero gallery care-guide"`
 }
 
 type UnlinkMediaRequest struct {
 	MediaID    int    `json:"media_id" validate:"required,min=1"`
-	EntityType string `json:"entity_type" validate:"required,oneof=products categories"`
+	EntityType string `json:"entity_type" validate:"required,oneof=products variants categories"`
+	EntityID   int    `json:"entity_id" validate:"required,min=1"`
+}
+
+// ReorderMediaRequest lists every media ID in the zone in its new order.
+type ReorderMediaRequest struct {
+	EntityType string `json:"entity_type" validate:"required,oneof=products variants categories"`
+	EntityID   int    `json:"entity_id" validate:"required,min=1"`
+	Zone       string `json:"zone" validate:"required,oneof=hero gallery care-guide"`
+	MediaIDs   []int  `json:"media_ids" validate:"required"`
+}
+
+type SetPrimaryMediaRequest struct {
+	EntityType string `json:"entity_type" validate:"required,oneof=products variants categories"`
 	EntityID   int    `json:"entity_id" validate:"required,min=1"`
 }
 
 type EditMediaRequest struct {
-	AltText string `json:"alt_text"`
-	Title   string `json:"title"`
+	AltText *string `json:"alt_text"` // Empty string clears it
 }
 
 // --- Data Import/Export ---
@@ -169,3 +525,20 @@ type UpdateSupplierRequest struct {
 	Phone   string `json:"phone"`
 	Address string `json:"address"`
 }
+
+// SubscriptionPlanRequest creates a plan or, on update, replaces it together
+// with its items.
+type SubscriptionPlanRequest struct {
+	Name          string                        `json:"name" validate:"required"`
+	Description   *string                       `json:"description"`
+	IntervalUnit  string                        `json:"interval_unit" validate:"required,oneof=WEEK MONTH"`
+	IntervalCount int                           `json:"interval_count"` // Default 1
+	IsActive      *bool                         `json:"is_active"`      // Default true
+	Items         []SubscriptionPlanItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+type SubscriptionPlanItemRequest struct {
+	VariantID int   `json:"variant_id" validate:"required"`
+	Quantity  int   `json:"quantity"`   // Default 1
+	IsDefault *bool `json:"is_default"` // Default true; false offers it as a swap
+}
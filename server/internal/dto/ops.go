@@ -67,6 +67,17 @@ type BulkAdjustRequest struct {
 	Items  []BulkAdjustItem `json:"items" validate:"required,dive"`
 }
 
+// --- Labels ---
+// Exactly one source selects the labels: explicit variants, a PO receipt
+// (one label per received unit) or a location (one shelf label per stocked variant).
+type PrintLabelsRequest struct {
+	VariantIDs      []int  `json:"variant_ids"`
+	PurchaseOrderID *int   `json:"purchase_order_id"`
+	LocationID      *int   `json:"location_id"`
+	Copies          int    `json:"copies"` // Per variant when selecting by variant_ids
+	Format          string `json:"format" validate:"omitempty,oneof=pdf zpl"`
+}
+
 // --- Assembly ---
 type CreateRecipeRequest struct {
 	ParentVariantID int     `json:"parent_variant_id" validate:"required"`
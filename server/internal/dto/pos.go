@@ -1,5 +1,7 @@
 package dto
 
+import "server/internal/core/domain"
+
 // Sessions
 type OpenSessionRequest struct {
 	OpeningCash float64 `json:"opening_cash" validate:"gte=0"`
@@ -22,8 +24,57 @@ type CreatePOSOrderRequest struct {
 	POSSessionID     int               `json:"pos_session_id" validate:"required"`
 	CustomerID       *int              `json:"customer_id"` // Optional (Walk-in)
 	Items            []CartItemRequest `json:"items" validate:"required,dive"`
-	PaymentMethod    string            `json:"payment_method" validate:"required"` // CASH, EDC, QRIS
+	PaymentMethod    string            `json:"payment_method"`                     // CASH, EDC, QRIS; single tender of the exact total
+	Payments         []TenderRequest   `json:"payments" validate:"omitempty,dive"` // Split tender, overrides PaymentMethod
 	DiscountOverride *float64          `json:"discount_override"`                  // Manager only
+	RedeemPoints     int               `json:"redeem_points"`                      // Loyalty points; needs CustomerID
+}
+
+// TenderRequest is one part of a payment. At the POS, a CASH amount may
+// exceed what is owed and the difference is given back as change.
+type TenderRequest struct {
+	Method             string  `json:"method" validate:"required"` // CASH, EDC, QRIS, TRANSFER, GIFT_CARD, STORE_CREDIT, ...
+	Amount             float64 `json:"amount" validate:"required,gt=0"`
+	FinancialAccountID *int    `json:"financial_account_id"` // Defaults to the method's account
+	Reference          string  `json:"reference"`            // Gift card code, EDC approval code, QRIS reference, ...
+}
+
+// TenderResult is an order's payment position after tenders were taken.
+type TenderResult struct {
+	Payments      []domain.Payment     `json:"payments"` // Recorded by this request
+	PaidAmount    float64              `json:"paid_amount"`
+	Outstanding   float64              `json:"outstanding"`
+	Change        float64              `json:"change"` // Cash to hand back
+	PaymentStatus domain.PaymentStatus `json:"payment_status"`
+	GiftCards     []domain.GiftCard    `json:"gift_cards,omitempty"` // Sold on this order, to hand over
+}
+
+// AddPOSPaymentsRequest settles the rest of a partially paid order.
+type AddPOSPaymentsRequest struct {
+	POSSessionID int             `json:"pos_session_id" validate:"required"`
+	Payments     []TenderRequest `json:"payments" validate:"required,min=1,dive"`
+}
+
+// POSSessionReport is the X/Z report of a session.
+type POSSessionReport struct {
+	SessionID    int           `json:"session_id"`
+	Status       string        `json:"status"`
+	OrderCount   int           `json:"order_count"`
+	SalesTotal   float64       `json:"sales_total"`
+	Tenders      []TenderTotal `json:"tenders"`
+	OpeningCash  float64       `json:"opening_cash"`
+	CashAdded    float64       `json:"cash_added"`
+	CashDropped  float64       `json:"cash_dropped"`
+	ExpectedCash float64       `json:"expected_cash"` // What should be in the drawer
+	ActualCash   *float64      `json:"actual_cash"`   // Counted at close
+}
+
+type TenderTotal struct {
+	Method   string  `json:"method"`
+	Count    int     `json:"count"`
+	Amount   float64 `json:"amount"`   // Applied to orders, net of change
+	Tendered float64 `json:"tendered"` // Handed over, including change
+	Change   float64 `json:"change"`
 }
 
 type OverridePriceRequest struct {
@@ -13,6 +13,7 @@ type ProductFilterParams struct {
 	Limit         int
 	CreatedAfter  *time.Time // gte (Start Date)
 	CreatedBefore *time.Time // lte (End Date)
+	Locale        string     // Translates results and searches translated names
 }
 
 type OrderFilterParams struct {
@@ -34,3 +35,10 @@ type CreateTagRequest struct {
 type UpdateProductTagsRequest struct {
 	TagIDs []int `json:"tag_ids" validate:"required"`
 }
+
+// Translations
+type TranslationRequest struct {
+	Name        string  `json:"name"`         // Products & Categories
+	Description *string `json:"description"`  // Products & Categories
+	DisplayName string  `json:"display_name"` // Tags
+}
@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"server/internal/core/domain"
+	"time"
+)
+
 // --- Catalog ---
 type ProductFilterQuery struct {
 	CategorySlug string  `query:"category"`
@@ -21,6 +26,58 @@ type CartItemRequest struct {
 	Quantity  int `json:"quantity" validate:"required,min=1"`
 }
 
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" validate:"min=0"` // 0 removes the line
+}
+
+// CartResponse is a stored cart after revalidation against current prices and stock.
+type CartResponse struct {
+	Token          string             `json:"token,omitempty"` // Echoed in the X-Cart-Token header
+	Items          []CartLineResponse `json:"items"`
+	Notices        []CartNotice       `json:"notices,omitempty"`
+	CouponCode     *string            `json:"coupon_code"`
+	ItemCount      int                `json:"item_count"`
+	Subtotal       float64            `json:"subtotal"`
+	DiscountAmount float64            `json:"discount_amount"`
+	TaxAmount      float64            `json:"tax_amount"`
+	TaxIncluded    bool               `json:"tax_included"` // TaxAmount is part of the prices
+	TotalAmount    float64            `json:"total_amount"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty"`
+}
+
+type CartLineResponse struct {
+	VariantID      int     `json:"variant_id"`
+	ProductID      int     `json:"product_id"`
+	ProductName    string  `json:"product_name"`
+	ProductSlug    string  `json:"product_slug"`
+	VariantName    *string `json:"variant_name"`
+	SKU            string  `json:"sku"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      float64 `json:"unit_price"`
+	LineTotal      float64 `json:"line_total"`
+	DiscountAmount float64 `json:"discount_amount"`
+	Available      *int    `json:"available"` // nil when the variant is not stock-controlled
+	// Availability is set for backorder and pre-order variants, whose units
+	// beyond Available wait for stock
+	Availability domain.AvailabilityMode `json:"availability,omitempty"`
+	ExpectedAt   *time.Time              `json:"expected_at,omitempty"`
+}
+
+// Cart notice codes, reported once when revalidation changes the cart
+const (
+	CartNoticePriceChanged    = "PRICE_CHANGED"
+	CartNoticeQuantityReduced = "QUANTITY_REDUCED"
+	CartNoticeOutOfStock      = "OUT_OF_STOCK"
+	CartNoticeUnavailable     = "UNAVAILABLE"
+	CartNoticeCouponRemoved   = "COUPON_REMOVED"
+)
+
+type CartNotice struct {
+	VariantID int    `json:"variant_id,omitempty"` // Empty for cart-level notices
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
 type ApplyCouponRequest struct {
 	Code string `json:"code" validate:"required"`
 }
@@ -28,16 +85,49 @@ type ApplyCouponRequest struct {
 type CheckoutPreviewRequest struct {
 	Items             []CartItemRequest `json:"items" validate:"required,dive"`
 	CouponCode        string            `json:"coupon_code"`
-	ShippingAddressID int               `json:"shipping_address_id" validate:"required"`
+	ShippingAddressID int               `json:"shipping_address_id"` // Address-book entry; logged-in shoppers only
+	// ShippingAddress is entered inline by guests instead of an address ID
+	ShippingAddress *CreateAddressRequest `json:"shipping_address" validate:"omitempty"`
+	ShippingMethod  string                `json:"shipping_method"` // Optional; all options are returned
+	RedeemPoints    int                   `json:"redeem_points"`   // Loyalty points to spend; logged-in shoppers only
 }
 
 type CheckoutPlaceRequest struct {
 	Items             []CartItemRequest `json:"items" validate:"required,dive"`
 	CouponCode        string            `json:"coupon_code"`
-	ShippingAddressID int               `json:"shipping_address_id" validate:"required"`
-	BillingAddressID  int               `json:"billing_address_id"` // Optional, defaults to shipping
-	PaymentMethod     string            `json:"payment_method" validate:"required,oneof=STRIPE MIDTRANS"`
-	GuestEmail        string            `json:"guest_email" validate:"omitempty,email"`
+	ShippingAddressID int               `json:"shipping_address_id"` // Address-book entry; logged-in shoppers only
+	// ShippingAddress is entered inline by guests instead of an address ID
+	ShippingAddress  *CreateAddressRequest `json:"shipping_address" validate:"omitempty"`
+	ShippingMethod   string                `json:"shipping_method" validate:"required"` // Code from the preview options
+	BillingAddressID int                   `json:"billing_address_id"`                  // Optional, defaults to shipping
+	BillingAddress   *CreateAddressRequest `json:"billing_address" validate:"omitempty"`
+	PaymentMethod    string                `json:"payment_method" validate:"required,oneof=STRIPE MIDTRANS"`
+	Payments         []TenderRequest       `json:"payments" validate:"omitempty,dive"` // Split across methods; amounts must sum to the total
+	GuestEmail       string                `json:"guest_email" validate:"omitempty,email"`
+	RedeemPoints     int                   `json:"redeem_points" validate:"gte=0"` // Loyalty points to spend; logged-in shoppers only
+	MarketingOptIn   bool                  `json:"marketing_opt_in"`               // Ticked box; leaving it unticked keeps the previous choice
+}
+
+// PaymentLink is where the shopper pays one part of an order.
+type PaymentLink struct {
+	Method     string  `json:"method"`
+	Amount     float64 `json:"amount"`
+	PaymentURL string  `json:"payment_url"`
+}
+
+// ShippingOption is a delivery method quoted for the checkout's destination.
+type ShippingOption struct {
+	MethodID   int     `json:"method_id"`
+	Code       string  `json:"code"`
+	Name       string  `json:"name"`
+	Carrier    *string `json:"carrier"`
+	Price      float64 `json:"price"`
+	WeightKG   float64 `json:"weight_kg"` // Chargeable, incl. volumetric
+	EtaMinDays int     `json:"eta_min_days"`
+	EtaMaxDays int     `json:"eta_max_days"`
+	Available  bool    `json:"available"`
+	Reason     string  `json:"reason,omitempty"` // Why it is unavailable
+	RateID     *int    `json:"-"`
 }
 
 // Response
@@ -49,3 +139,11 @@ type CheckoutPreviewResponse struct {
 	TotalAmount           float64 `json:"total_amount"`
 	EstimatedDeliveryDate string  `json:"estimated_delivery_date"`
 }
+
+// GiftCardBalance is what the public balance enquiry reveals about a card.
+type GiftCardBalance struct {
+	Balance   float64    `json:"balance"`
+	Currency  string     `json:"currency"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
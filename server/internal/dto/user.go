@@ -1,11 +1,17 @@
 package dto
 
+import "server/internal/core/domain"
+
 // Profile
 type UpdateProfileRequest struct {
 	FirstName string `json:"first_name" validate:"omitempty,min=2"`
 	LastName  string `json:"last_name" validate:"omitempty,min=2"`
 	Phone     string `json:"phone" validate:"omitempty,e164"` // +62812...
 	Bio       string `json:"bio"`
+	Locale    string `json:"locale"`     // e.g. "id", drives storefront language
+	BirthDate string `json:"birth_date"` // YYYY-MM-DD; can only be set once
+	// MarketingOptIn records consent to marketing email when given
+	MarketingOptIn *bool `json:"marketing_opt_in"`
 }
 
 // Addresses
@@ -20,6 +26,19 @@ type CreateAddressRequest struct {
 	Longitude  float64 `json:"longitude"`
 }
 
+func (r *CreateAddressRequest) ToDomain() *domain.Address {
+	return &domain.Address{
+		Line1:      r.Line1,
+		Line2:      &r.Line2,
+		City:       r.City,
+		State:      &r.State,
+		PostalCode: &r.PostalCode,
+		Country:    r.Country,
+		Latitude:   &r.Latitude,
+		Longitude:  &r.Longitude,
+	}
+}
+
 type UpdateAddressRequest struct {
 	Line1      string  `json:"line1"`
 	Line2      string  `json:"line2"`
@@ -46,3 +65,45 @@ type RequestReturnRequest struct {
 	Reason string   `json:"reason" validate:"required"`
 	Images []string `json:"images"` // URLs
 }
+
+// PayBalanceRequest pays what is left on an order after its deposit. Without
+// payments it is charged to the order's payment method.
+type PayBalanceRequest struct {
+	Payments []TenderRequest `json:"payments" validate:"omitempty,dive"`
+}
+
+// Subscriptions
+type SubscribeRequest struct {
+	PlanID            int    `json:"plan_id" validate:"required"`
+	ShippingAddressID int    `json:"shipping_address_id" validate:"required"`
+	ShippingMethod    string `json:"shipping_method" validate:"required"`
+	PaymentMethod     string `json:"payment_method"`
+	PaymentToken      string `json:"payment_token"` // Saved with the provider; without it each order is paid by link
+	StartOn           string `json:"start_on"`      // YYYY-MM-DD of the first order; default today
+	// Items default to the plan's default items
+	Items []SubscriptionItemRequest `json:"items" validate:"omitempty,dive"`
+}
+
+type SubscriptionItemRequest struct {
+	VariantID int `json:"variant_id" validate:"required"`
+	Quantity  int `json:"quantity" validate:"required,min=1"`
+}
+
+// UpdateSubscriptionRequest changes where and how the next orders are sent
+// and paid; empty fields are kept.
+type UpdateSubscriptionRequest struct {
+	ShippingAddressID int     `json:"shipping_address_id"`
+	ShippingMethod    string  `json:"shipping_method"`
+	PaymentMethod     string  `json:"payment_method"`
+	PaymentToken      *string `json:"payment_token"` // "" forgets the saved payment method
+	NextRunOn         string  `json:"next_run_on"`   // YYYY-MM-DD
+}
+
+type PauseSubscriptionRequest struct {
+	Until string `json:"until"` // YYYY-MM-DD; empty pauses until resumed
+}
+
+// SwapSubscriptionItemsRequest replaces the items with others from the plan.
+type SwapSubscriptionItemsRequest struct {
+	Items []SubscriptionItemRequest `json:"items" validate:"required,min=1,dive"`
+}
@@ -1,10 +1,14 @@
 package dto
 
+// PaymentWebhookRequest is the notification payment providers post. Signature
+// is payment.Sign over order_id, provider_ref, payment_status and amount.
 type PaymentWebhookRequest struct {
-	OrderID       string `json:"order_id"`
-	PaymentStatus string `json:"payment_status"`
-	Signature     string `json:"signature"`
-	ProviderRef   string `json:"provider_ref"`
+	OrderID       string  `json:"order_id"` // Order number
+	PaymentStatus string  `json:"payment_status"`
+	Amount        float64 `json:"amount"`
+	Method        string  `json:"method"`
+	Signature     string  `json:"signature"`
+	ProviderRef   string  `json:"provider_ref"`
 }
 
 type LogisticsWebhookRequest struct {
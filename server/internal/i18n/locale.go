@@ -0,0 +1,58 @@
+package i18n
+
+import (
+	"os"
+	"strings"
+)
+
+// Default returns the locale stored in the base catalog columns.
+// Translations are overlays on top of it.
+func Default() string {
+	if l := os.Getenv("DEFAULT_LOCALE"); l != "" {
+		return Normalize(l)
+	}
+	return "en"
+}
+
+// Supported returns the configured locales with the default locale first.
+func Supported() []string {
+	def := Default()
+	locales := []string{def}
+
+	raw := os.Getenv("SUPPORTED_LOCALES")
+	if raw == "" {
+		raw = "en,id"
+	}
+	for _, l := range strings.Split(raw, ",") {
+		l = Normalize(l)
+		if l == "" || l == def {
+			continue
+		}
+		locales = append(locales, l)
+	}
+	return locales
+}
+
+// Translatable returns the supported locales except the default one.
+func Translatable() []string {
+	return Supported()[1:]
+}
+
+func IsSupported(locale string) bool {
+	locale = Normalize(locale)
+	for _, l := range Supported() {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize turns "id-ID" or " ID " into "id".
+func Normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
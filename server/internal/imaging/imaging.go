@@ -0,0 +1,157 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/buckket/go-blurhash"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+
+	jpegQuality = 82
+
+	// MaxPixels caps width*height so a small file cannot expand into a huge
+	// bitmap on decode
+	MaxPixels = 50_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	ErrTooLarge    = errors.New("imaging: image dimensions too large")
+)
+
+// Decoded is an upright image plus a copy of the original bytes with
+// metadata (EXIF/XMP) removed.
+type Decoded struct {
+	Image  image.Image
+	Format string // "jpeg", "png", "gif", "webp"
+	Width  int
+	Height int
+	// Clean is the original re-packaged without EXIF, or nil when the source
+	// carried nothing to strip.
+	Clean []byte
+}
+
+// Decode reads an image, applies its EXIF orientation and strips metadata
+// from the original bytes. The header is checked against MaxPixels before
+// any pixels are allocated.
+func Decode(data []byte) (*Decoded, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+
+	d := &Decoded{Image: img, Format: format}
+
+	switch format {
+	case "jpeg":
+		stripped, orientation, changed := stripJPEG(data)
+		if orientation > 1 {
+			// Stripping EXIF would lose the rotation, so bake it into the pixels
+			d.Image = orient(img, orientation)
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, d.Image, &jpeg.Options{Quality: 92}); err != nil {
+				return nil, err
+			}
+			d.Clean = buf.Bytes()
+		} else if changed {
+			d.Clean = stripped
+		}
+	case "png":
+		if stripped, changed := stripPNG(data); changed {
+			d.Clean = stripped
+		}
+	}
+
+	b := d.Image.Bounds()
+	d.Width, d.Height = b.Dx(), b.Dy()
+	return d, nil
+}
+
+// Fit scales img down so neither side exceeds maxSide; it never upscales.
+func Fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// Blurhash encodes a 4x3 component placeholder from a small downscale.
+func Blurhash(img image.Image) (string, error) {
+	return blurhash.Encode(4, 3, Fit(img, 64))
+}
+
+// Encode writes img as JPEG (flattened on white) or lossless WebP.
+func Encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		if err := nativewebp.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+	return buf.Bytes(), nil
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatWebP:
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+func flatten(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
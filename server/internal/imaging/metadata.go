@@ -0,0 +1,167 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/")
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// stripJPEG removes EXIF and XMP APP1 segments, keeping everything else
+// (JFIF, ICC profile, tables, scan data). It also returns the EXIF
+// orientation (1 when absent).
+func stripJPEG(data []byte) ([]byte, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 1, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 1
+	changed := false
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, 1, false
+		}
+		marker := data[i+1]
+
+		// Start of scan: the rest is entropy-coded data, copy it verbatim
+		if marker == 0xDA {
+			out = append(out, data[i:]...)
+			return out, orientation, changed
+		}
+		// Standalone markers carry no length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 1, false
+		}
+		payload := data[i+4 : end]
+
+		if marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+			orientation = exifOrientation(payload[len(exifHeader):])
+			changed = true
+		} else if marker == 0xE1 && bytes.HasPrefix(payload, xmpHeader) {
+			changed = true
+		} else {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return nil, 1, false
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of a TIFF block.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < count; n++ {
+		off := ifd + 2 + n*12
+		if off+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[off:off+2]) == 0x0112 {
+			v := int(order.Uint16(tiff[off+8 : off+10]))
+			if v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// stripPNG drops eXIf chunks.
+func stripPNG(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, pngMagic) {
+		return nil, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngMagic...)
+	changed := false
+
+	i := len(pngMagic)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		end := i + 12 + length
+		if end > len(data) {
+			return nil, false
+		}
+		if string(data[i+4:i+8]) == "eXIf" {
+			changed = true
+		} else {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, changed
+}
+
+// orient applies an EXIF orientation (2-8) so the image is upright.
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 CCW
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is one unit of background work. Returning an error only logs it; the
+// job runs again on the next tick.
+type Job func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Scheduler runs registered jobs on fixed intervals. Each job has its own
+// goroutine, so a slow job never overlaps with itself or delays the others.
+type Scheduler struct {
+	mu      sync.Mutex
+	entries []entry
+	wg      sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry{name: name, interval: interval, job: job})
+}
+
+// Start launches every job (running each once immediately) until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	entries := append([]entry(nil), s.entries...)
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		s.wg.Add(1)
+		go func(e entry) {
+			defer s.wg.Done()
+			ticker := time.NewTicker(e.interval)
+			defer ticker.Stop()
+
+			for {
+				s.run(ctx, e)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(e)
+	}
+	log.Printf("Scheduler started with %d job(s)", len(entries))
+}
+
+// Wait blocks until all jobs have stopped after ctx cancellation.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, e entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[job %s] panic: %v", e.name, r)
+		}
+	}()
+
+	if err := e.job(ctx); err != nil {
+		log.Printf("[job %s] %v", e.name, err)
+	}
+}
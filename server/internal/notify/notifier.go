@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text
+}
+
+// Notifier delivers customer-facing messages. Implementations must be safe
+// for concurrent use; they are called from background listeners.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv picks the notifier from NOTIFIER ("smtp" or "log", default "log").
+func NewFromEnv() (Notifier, error) {
+	switch strings.ToLower(os.Getenv("NOTIFIER")) {
+	case "smtp":
+		return NewSMTPNotifier(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("SMTP_FROM"),
+		)
+	case "", "log":
+		return &LogNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", os.Getenv("NOTIFIER"))
+	}
+}
+
+// LogNotifier writes messages to the application log; used in development.
+type LogNotifier struct{}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	log.Printf("[notify] to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPNotifier(host, port, username, password, from string) (*SMTPNotifier, error) {
+	if host == "" || from == "" {
+		return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM are required for the smtp notifier")
+	}
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPNotifier{addr: host + ":" + port, auth: auth, from: from}, nil
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", headerSafe(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe(msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(b.String()))
+}
+
+// headerSafe stops product names or addresses from injecting extra headers.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
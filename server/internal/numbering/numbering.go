@@ -0,0 +1,60 @@
+// Package numbering formats document numbers such as SO-2026-000042 or
+// TRF-2026-WH1-0007 from a per-type series definition.
+package numbering
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Series describes the numbers of one document type. Segments are joined
+// with "-": prefix, year, location code, then the zero-padded counter.
+type Series struct {
+	Prefix          string
+	IncludeYear     bool
+	IncludeLocation bool
+	Padding         int
+	YearlyReset     bool // Counter restarts at 1 every January
+}
+
+// Validate rejects series that could repeat a number.
+func (s Series) Validate() error {
+	if s.Prefix == "" || strings.Contains(s.Prefix, "-") {
+		return errors.New("prefix is required and cannot contain '-'")
+	}
+	if s.Padding < 1 || s.Padding > 12 {
+		return errors.New("padding must be between 1 and 12")
+	}
+	if s.YearlyReset && !s.IncludeYear {
+		return errors.New("a yearly reset requires the year in the number")
+	}
+	return nil
+}
+
+// Scope names the counter a number is drawn from: one per year when the
+// series resets yearly, and one per location when numbers carry its code.
+func (s Series) Scope(year int, location string) string {
+	var parts []string
+	if s.YearlyReset {
+		parts = append(parts, strconv.Itoa(year))
+	}
+	if s.IncludeLocation && location != "" {
+		parts = append(parts, strings.ToUpper(location))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Format renders the seq-th number of the scope.
+func (s Series) Format(seq int64, year int, location string) string {
+	parts := []string{s.Prefix}
+	if s.IncludeYear {
+		parts = append(parts, strconv.Itoa(year))
+	}
+	if s.IncludeLocation && location != "" {
+		parts = append(parts, strings.ToUpper(location))
+	}
+	parts = append(parts, fmt.Sprintf("%0*d", s.Padding, seq))
+	return strings.Join(parts, "-")
+}
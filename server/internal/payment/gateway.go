@@ -0,0 +1,109 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type GatewayConfig struct {
+	BaseURL       string // e.g. https://api.sandbox.gateway.example
+	ServerKey     string // Basic-auth username, as Midtrans and Xendit use
+	WebhookSecret string
+	ReturnURL     string // Where the hosted page sends the shopper back
+}
+
+// Gateway is a Midtrans/Xendit-style REST adapter: charges are created with
+// POST /charges and answered with a hosted payment page URL.
+type Gateway struct {
+	cfg    GatewayConfig
+	client *http.Client
+}
+
+func NewGateway(cfg GatewayConfig) (*Gateway, error) {
+	if cfg.BaseURL == "" || cfg.ServerKey == "" || cfg.WebhookSecret == "" {
+		return nil, errors.New("PAYMENT_GATEWAY_URL, PAYMENT_SERVER_KEY and PAYMENT_WEBHOOK_SECRET are required for the gateway provider")
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Gateway{cfg: cfg, client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+func (g *Gateway) Name() string { return "gateway" }
+
+func (g *Gateway) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	var resp struct {
+		ID          string     `json:"id"`
+		RedirectURL string     `json:"redirect_url"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		Status      string     `json:"status"`
+	}
+	payload := map[string]interface{}{
+		"order_id":       req.OrderNumber,
+		"amount":         req.Amount,
+		"currency":       req.Currency,
+		"customer_email": req.Email,
+		"payment_method": req.Method,
+		"return_url":     g.cfg.ReturnURL,
+	}
+	if req.SavedToken != "" {
+		payload["saved_token_id"] = req.SavedToken
+	}
+	if err := g.call(ctx, "/charges", payload, &resp); err != nil {
+		return nil, err
+	}
+	return &Charge{ProviderRef: resp.ID, RedirectURL: resp.RedirectURL, ExpiresAt: resp.ExpiresAt, Status: Status(strings.ToUpper(resp.Status))}, nil
+}
+
+func (g *Gateway) ParseWebhook(body []byte) (*Event, error) {
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNotification, err)
+	}
+	return verify(g.cfg.WebhookSecret, n)
+}
+
+func (g *Gateway) Refund(ctx context.Context, chargeRef string, amount float64) (*Refund, error) {
+	var resp struct {
+		ID     string  `json:"id"`
+		Amount float64 `json:"amount"`
+	}
+	if err := g.call(ctx, "/charges/"+url.PathEscape(chargeRef)+"/refunds", map[string]interface{}{"amount": amount}, &resp); err != nil {
+		return nil, err
+	}
+	return &Refund{ProviderRef: resp.ID, Amount: resp.Amount}, nil
+}
+
+func (g *Gateway) call(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.cfg.ServerKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payment gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("payment gateway: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
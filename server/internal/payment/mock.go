@@ -0,0 +1,84 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MockTokenPrefix marks the saved-payment tokens the mock settles, e.g.
+// "mock_ok" or "mock_decline".
+const MockTokenPrefix = "mock_"
+
+// Mock accepts every charge without contacting anyone. Payments are completed
+// by posting a notification signed with Sign and the same secret, which is
+// how local development and tests drive the webhook. Saved-token charges to
+// a MockTokenPrefix token are paid at once, unless it continues with
+// "decline"; any other token is declined, so a real customer's token is
+// never taken as paid. It is only built with PAYMENT_MOCK_ENABLED=true.
+type Mock struct {
+	returnURL string
+	secret    string
+}
+
+func NewMock(returnURL, secret string) (*Mock, error) {
+	if enabled, _ := strconv.ParseBool(os.Getenv("PAYMENT_MOCK_ENABLED")); !enabled {
+		return nil, errors.New("the mock payment provider is for development only; set PAYMENT_MOCK_ENABLED=true to use it")
+	}
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET is required")
+	}
+	if returnURL == "" {
+		returnURL = "/checkout/return"
+	}
+	return &Mock{returnURL: returnURL, secret: secret}, nil
+}
+
+func (m *Mock) Name() string { return "mock" }
+
+func (m *Mock) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	ref, err := mockRef("chg")
+	if err != nil {
+		return nil, err
+	}
+	if req.SavedToken != "" {
+		status := StatusPaid
+		if token, ok := strings.CutPrefix(req.SavedToken, MockTokenPrefix); !ok || strings.HasPrefix(token, "decline") {
+			status = StatusFailed
+		}
+		return &Charge{ProviderRef: ref, Status: status}, nil
+	}
+	redirect := fmt.Sprintf("%s?order=%s&ref=%s", m.returnURL, url.QueryEscape(req.OrderNumber), ref)
+	return &Charge{ProviderRef: ref, RedirectURL: redirect}, nil
+}
+
+func (m *Mock) ParseWebhook(body []byte) (*Event, error) {
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNotification, err)
+	}
+	return verify(m.secret, n)
+}
+
+func (m *Mock) Refund(ctx context.Context, chargeRef string, amount float64) (*Refund, error) {
+	ref, err := mockRef("rfd")
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ProviderRef: ref, Amount: amount}, nil
+}
+
+func mockRef(prefix string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + "_mock_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,135 @@
+// Package payment talks to payment gateways: it starts charges the shopper
+// completes on a hosted page (or that a saved payment method settles without
+// them), verifies signed webhook notifications and issues refunds.
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature      = errors.New("payment: invalid webhook signature")
+	ErrMalformedNotification = errors.New("payment: malformed webhook notification")
+)
+
+type ChargeRequest struct {
+	OrderNumber string
+	Amount      float64
+	Currency    string
+	Email       string
+	Method      string // Requested channel, e.g. QRIS or VA
+	// SavedToken charges a payment method the shopper saved with the
+	// gateway, without a hosted page, as recurring orders need
+	SavedToken string
+}
+
+// Charge is a started payment; the shopper pays at RedirectURL. Charges to
+// a saved token have no page and report their outcome in Status instead
+// (PENDING until a webhook follows).
+type Charge struct {
+	ProviderRef string
+	RedirectURL string
+	ExpiresAt   *time.Time
+	Status      Status
+}
+
+type Status string
+
+const (
+	StatusPaid     Status = "PAID"
+	StatusPending  Status = "PENDING"
+	StatusFailed   Status = "FAILED"
+	StatusExpired  Status = "EXPIRED"
+	StatusRefunded Status = "REFUNDED"
+)
+
+// Event is a verified webhook notification about one charge.
+type Event struct {
+	OrderNumber string
+	ProviderRef string
+	Status      Status
+	Amount      float64
+	Method      string
+}
+
+type Refund struct {
+	ProviderRef string // Of the refund itself
+	Amount      float64
+}
+
+// Provider is one payment gateway.
+type Provider interface {
+	Name() string
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// ParseWebhook verifies and decodes a notification body
+	ParseWebhook(body []byte) (*Event, error)
+	Refund(ctx context.Context, chargeRef string, amount float64) (*Refund, error)
+}
+
+// NewFromEnv picks the provider from PAYMENT_PROVIDER ("gateway" or "mock").
+// There is no default: a missing setting fails startup rather than taking
+// orders nobody is charged for. The mock also needs PAYMENT_MOCK_ENABLED=true,
+// for development only. Both sign webhooks with PAYMENT_WEBHOOK_SECRET.
+func NewFromEnv() (Provider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	switch strings.ToLower(os.Getenv("PAYMENT_PROVIDER")) {
+	case "gateway":
+		return NewGateway(GatewayConfig{
+			BaseURL:       os.Getenv("PAYMENT_GATEWAY_URL"),
+			ServerKey:     os.Getenv("PAYMENT_SERVER_KEY"),
+			WebhookSecret: secret,
+			ReturnURL:     os.Getenv("PAYMENT_RETURN_URL"),
+		})
+	case "mock":
+		return NewMock(os.Getenv("PAYMENT_RETURN_URL"), secret)
+	case "":
+		return nil, errors.New("PAYMENT_PROVIDER is required")
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", os.Getenv("PAYMENT_PROVIDER"))
+	}
+}
+
+// Sign is the webhook signature: hex HMAC-SHA256 over
+// order_id|provider_ref|payment_status|amount, the amount with two decimals.
+func Sign(secret, orderNumber, providerRef string, status Status, amount float64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s|%s|%s|%s", orderNumber, providerRef, status, strconv.FormatFloat(amount, 'f', 2, 64))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verify(secret string, n notification) (*Event, error) {
+	want := Sign(secret, n.OrderID, n.ProviderRef, Status(strings.ToUpper(n.PaymentStatus)), n.Amount)
+	if !hmac.Equal([]byte(want), []byte(strings.ToLower(n.Signature))) {
+		return nil, ErrInvalidSignature
+	}
+	if n.OrderID == "" || n.ProviderRef == "" {
+		return nil, fmt.Errorf("%w: missing order_id or provider_ref", ErrMalformedNotification)
+	}
+	return &Event{
+		OrderNumber: n.OrderID,
+		ProviderRef: n.ProviderRef,
+		Status:      Status(strings.ToUpper(n.PaymentStatus)),
+		Amount:      n.Amount,
+		Method:      n.Method,
+	}, nil
+}
+
+// notification is the webhook body both providers send
+// (see dto.PaymentWebhookRequest).
+type notification struct {
+	OrderID       string  `json:"order_id"`
+	PaymentStatus string  `json:"payment_status"`
+	Amount        float64 `json:"amount"`
+	Method        string  `json:"method"`
+	Signature     string  `json:"signature"`
+	ProviderRef   string  `json:"provider_ref"`
+}
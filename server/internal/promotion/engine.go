@@ -0,0 +1,419 @@
+package promotion
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+)
+
+// Line is one cart line with the catalog data rules can target.
+type Line struct {
+	VariantID  int
+	ProductID  int
+	CategoryID *int
+	TagIDs     []int
+	Quantity   int
+	UnitPrice  float64
+}
+
+type Cart struct {
+	Lines      []Line
+	Channel    string
+	CustomerID *int
+	Now        time.Time
+}
+
+func (c *Cart) subtotal() float64 {
+	total := 0.0
+	for _, l := range c.Lines {
+		total += l.UnitPrice * float64(l.Quantity)
+	}
+	return total
+}
+
+// Outcome statuses
+const (
+	StatusApplied    = "APPLIED"
+	StatusNotMatched = "NOT_MATCHED"
+	StatusNoDiscount = "NO_DISCOUNT"
+	StatusSkipped    = "SKIPPED" // Blocked by exclusivity
+	StatusError      = "ERROR"
+)
+
+// Outcome explains what happened to one rule.
+type Outcome struct {
+	PromotionID int     `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Code        *string `json:"code,omitempty"`
+	Status      string  `json:"status"`
+	Reason      string  `json:"reason,omitempty"`
+}
+
+type Applied struct {
+	PromotionID  int
+	Name         string
+	Code         *string
+	Discount     float64
+	FreeShipping bool
+	// LineDiscounts is indexed like Cart.Lines
+	LineDiscounts []float64
+}
+
+type Result struct {
+	Applied       []Applied
+	Outcomes      []Outcome
+	LineDiscounts []float64
+	Discount      float64
+	FreeShipping  bool
+}
+
+// Evaluate runs rules from highest priority down. Non-exclusive rules stack,
+// each working on what earlier rules left of every line. An exclusive rule only
+// applies when nothing else has, and stops evaluation once it does.
+func Evaluate(rules []*Rule, cart Cart) *Result {
+	if cart.Now.IsZero() {
+		cart.Now = time.Now()
+	}
+
+	ordered := slices.Clone(rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority > ordered[j].Priority
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	res := &Result{LineDiscounts: make([]float64, len(cart.Lines))}
+	remaining := make([]float64, len(cart.Lines))
+	for i, l := range cart.Lines {
+		remaining[i] = l.UnitPrice * float64(l.Quantity)
+	}
+	env := buildEnv(cart)
+	var exclusive string
+
+	for _, r := range ordered {
+		out := Outcome{PromotionID: r.ID, Name: r.Name, Code: r.Code}
+
+		if exclusive != "" {
+			out.Status, out.Reason = StatusSkipped, fmt.Sprintf("exclusive promotion %q already applied", exclusive)
+			res.Outcomes = append(res.Outcomes, out)
+			continue
+		}
+
+		ok, reason, err := r.matches(cart, env)
+		switch {
+		case err != nil:
+			out.Status, out.Reason = StatusError, err.Error()
+		case !ok:
+			out.Status, out.Reason = StatusNotMatched, reason
+		case r.Exclusive && len(res.Applied) > 0:
+			out.Status, out.Reason = StatusSkipped, "exclusive promotion cannot be combined with "+appliedNames(res.Applied)
+		}
+		if out.Status != "" {
+			res.Outcomes = append(res.Outcomes, out)
+			continue
+		}
+
+		lines, free, err := r.apply(cart, remaining, env)
+		if err != nil {
+			out.Status, out.Reason = StatusError, err.Error()
+			res.Outcomes = append(res.Outcomes, out)
+			continue
+		}
+		total := 0.0
+		for _, d := range lines {
+			total += d
+		}
+		if total <= 0 && !free {
+			out.Status, out.Reason = StatusNoDiscount, "conditions met but nothing to discount"
+			res.Outcomes = append(res.Outcomes, out)
+			continue
+		}
+
+		for i, d := range lines {
+			remaining[i] -= d
+			res.LineDiscounts[i] = round2(res.LineDiscounts[i] + d)
+		}
+		res.Discount = round2(res.Discount + total)
+		res.FreeShipping = res.FreeShipping || free
+		res.Applied = append(res.Applied, Applied{
+			PromotionID:   r.ID,
+			Name:          r.Name,
+			Code:          r.Code,
+			Discount:      round2(total),
+			FreeShipping:  free,
+			LineDiscounts: lines,
+		})
+		out.Status = StatusApplied
+		res.Outcomes = append(res.Outcomes, out)
+
+		if r.Exclusive {
+			exclusive = r.Name
+		}
+	}
+	return res
+}
+
+func (r *Rule) matches(cart Cart, env map[string]interface{}) (bool, string, error) {
+	if !r.Active {
+		return false, "promotion is inactive", nil
+	}
+	if r.StartsAt != nil && cart.Now.Before(*r.StartsAt) {
+		return false, "starts " + r.StartsAt.Format(time.RFC3339), nil
+	}
+	if r.EndsAt != nil && cart.Now.After(*r.EndsAt) {
+		return false, "ended " + r.EndsAt.Format(time.RFC3339), nil
+	}
+
+	c := r.Conditions
+	if subtotal := cart.subtotal(); c.MinSubtotal > 0 && subtotal < c.MinSubtotal {
+		return false, fmt.Sprintf("subtotal %.2f is below the minimum %.2f", subtotal, c.MinSubtotal), nil
+	}
+	if c.MinQuantity > 0 {
+		qty := 0
+		for _, l := range cart.Lines {
+			qty += l.Quantity
+		}
+		if qty < c.MinQuantity {
+			return false, fmt.Sprintf("cart has %d items, needs %d", qty, c.MinQuantity), nil
+		}
+	}
+	if !c.Requires.empty() && !slices.ContainsFunc(cart.Lines, c.Requires.Matches) {
+		return false, "cart has no qualifying product", nil
+	}
+	if len(c.Channels) > 0 && !slices.Contains(c.Channels, cart.Channel) {
+		return false, fmt.Sprintf("not available on channel %s", cart.Channel), nil
+	}
+	if r.condition != nil {
+		out, err := expr.Run(r.condition, env)
+		if err != nil {
+			return false, "", fmt.Errorf("condition expression: %w", err)
+		}
+		if met, _ := out.(bool); !met {
+			return false, "condition expression is false", nil
+		}
+	}
+	return true, "", nil
+}
+
+// apply returns the discount per line (bounded by what is left of each line)
+// and whether shipping becomes free.
+func (r *Rule) apply(cart Cart, remaining []float64, env map[string]interface{}) ([]float64, bool, error) {
+	a := r.Action
+	lines := make([]float64, len(remaining))
+
+	switch a.Type {
+	case PercentOffCart:
+		return allocate(capped(sum(remaining)*a.Percent/100, a.MaxDiscount), remaining, nil), false, nil
+
+	case FixedOffCart:
+		return allocate(a.Amount, remaining, nil), false, nil
+
+	case PercentOffItems:
+		eligible := matching(cart, a.Target)
+		base := 0.0
+		for i := range remaining {
+			if eligible[i] {
+				base += remaining[i]
+			}
+		}
+		return allocate(capped(base*a.Percent/100, a.MaxDiscount), remaining, eligible), false, nil
+
+	case BuyXGetY:
+		return buyXGetY(cart, remaining, a), false, nil
+
+	case TieredSpend:
+		eligible := matching(cart, a.Target)
+		base := 0.0
+		for i := range remaining {
+			if eligible[i] {
+				base += remaining[i]
+			}
+		}
+		var tier *Tier
+		for i := range a.Tiers {
+			if base >= a.Tiers[i].MinSubtotal && (tier == nil || a.Tiers[i].MinSubtotal > tier.MinSubtotal) {
+				tier = &a.Tiers[i]
+			}
+		}
+		if tier == nil {
+			return lines, false, nil
+		}
+		amount := tier.Amount
+		if tier.Percent > 0 {
+			amount = base * tier.Percent / 100
+		}
+		return allocate(capped(amount, a.MaxDiscount), remaining, eligible), false, nil
+
+	case FreeShipping:
+		return lines, true, nil
+
+	case ExpressionAmount:
+		out, err := expr.Run(r.amount, env)
+		if err != nil {
+			return nil, false, fmt.Errorf("action expression: %w", err)
+		}
+		amount, _ := out.(float64)
+		return allocate(capped(amount, a.MaxDiscount), remaining, nil), false, nil
+	}
+	return nil, false, fmt.Errorf("unknown action type %q", a.Type)
+}
+
+// buyXGetY discounts the cheapest GetQuantity units in every group of
+// BuyQuantity+GetQuantity matching units.
+func buyXGetY(cart Cart, remaining []float64, a Action) []float64 {
+	type unit struct {
+		line  int
+		price float64
+	}
+	eligible := matching(cart, a.Target)
+	var units []unit
+	for i, l := range cart.Lines {
+		if !eligible[i] || l.Quantity == 0 {
+			continue
+		}
+		per := remaining[i] / float64(l.Quantity)
+		for range l.Quantity {
+			units = append(units, unit{line: i, price: per})
+		}
+	}
+
+	lines := make([]float64, len(remaining))
+	free := len(units) / (a.BuyQuantity + a.GetQuantity) * a.GetQuantity
+	if free == 0 {
+		return lines
+	}
+	sort.SliceStable(units, func(i, j int) bool { return units[i].price < units[j].price })
+
+	pct := 100.0
+	if a.GetPercent > 0 {
+		pct = a.GetPercent
+	}
+	total := 0.0
+	for _, u := range units[:free] {
+		d := u.price * pct / 100
+		lines[u.line] += d
+		total += d
+	}
+	if a.MaxDiscount != nil && total > *a.MaxDiscount {
+		return allocate(*a.MaxDiscount, lines, nil)
+	}
+	for i := range lines {
+		lines[i] = round2(lines[i])
+	}
+	return lines
+}
+
+// allocate spreads amount over the selected lines in proportion to what is
+// left of each, rounding to cents and never exceeding a line.
+func allocate(amount float64, remaining []float64, selected []bool) []float64 {
+	lines := make([]float64, len(remaining))
+	base := 0.0
+	largest := -1
+	for i, r := range remaining {
+		if (selected == nil || selected[i]) && r > 0 {
+			base += r
+			if largest < 0 || r > remaining[largest] {
+				largest = i
+			}
+		}
+	}
+	if base <= 0 || amount <= 0 {
+		return lines
+	}
+	amount = round2(math.Min(amount, base))
+
+	given := 0.0
+	for i, r := range remaining {
+		if (selected == nil || selected[i]) && r > 0 {
+			lines[i] = round2(amount * r / base)
+			given += lines[i]
+		}
+	}
+	// Put the rounding difference on the largest line
+	lines[largest] = round2(math.Min(remaining[largest], lines[largest]+amount-given))
+	return lines
+}
+
+func matching(cart Cart, t *Target) []bool {
+	out := make([]bool, len(cart.Lines))
+	for i, l := range cart.Lines {
+		out[i] = t.Matches(l)
+	}
+	return out
+}
+
+func capped(amount float64, max *float64) float64 {
+	if max != nil && amount > *max {
+		return *max
+	}
+	return amount
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func appliedNames(applied []Applied) string {
+	names := make([]string, len(applied))
+	for i, a := range applied {
+		names[i] = fmt.Sprintf("%q", a.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// buildEnv is what condition and action expressions can see:
+//
+//	cart.total, cart.quantity, cart.items[i].{variant_id, product_id, category_id, tag_ids, quantity, unit_price}
+//	channel, customer_id (0 for guests), now
+func buildEnv(cart Cart) map[string]interface{} {
+	items := make([]interface{}, len(cart.Lines))
+	qty := 0
+	for i, l := range cart.Lines {
+		categoryID := 0
+		if l.CategoryID != nil {
+			categoryID = *l.CategoryID
+		}
+		items[i] = map[string]interface{}{
+			"variant_id":  l.VariantID,
+			"product_id":  l.ProductID,
+			"category_id": categoryID,
+			"tag_ids":     l.TagIDs,
+			"quantity":    l.Quantity,
+			"unit_price":  l.UnitPrice,
+		}
+		qty += l.Quantity
+	}
+
+	customerID := 0
+	if cart.CustomerID != nil {
+		customerID = *cart.CustomerID
+	}
+	return map[string]interface{}{
+		"cart": map[string]interface{}{
+			"total":    cart.subtotal(),
+			"quantity": qty,
+			"items":    items,
+		},
+		"channel":     cart.Channel,
+		"customer_id": customerID,
+		"now":         cart.Now,
+	}
+}
+
+func sampleEnv() map[string]interface{} {
+	return buildEnv(Cart{Now: time.Now()})
+}
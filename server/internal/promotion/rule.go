@@ -0,0 +1,207 @@
+package promotion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"server/internal/core/domain"
+	"slices"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+type ActionType string
+
+const (
+	PercentOffCart  ActionType = "PERCENT_OFF_CART"
+	FixedOffCart    ActionType = "FIXED_OFF_CART"
+	PercentOffItems ActionType = "PERCENT_OFF_ITEMS" // Lines matching Target
+	BuyXGetY        ActionType = "BUY_X_GET_Y"       // Cheapest matching units are discounted
+	FreeShipping    ActionType = "FREE_SHIPPING"
+	TieredSpend     ActionType = "TIERED_SPEND"
+	// ExpressionAmount is the legacy form: Actions["expression"] evaluates to
+	// a cart-level discount amount.
+	ExpressionAmount ActionType = "EXPRESSION"
+)
+
+// Target selects cart lines. An empty target matches every line; otherwise a
+// line matches when it hits any of the listed IDs.
+type Target struct {
+	VariantIDs  []int `json:"variant_ids,omitempty"`
+	ProductIDs  []int `json:"product_ids,omitempty"`
+	CategoryIDs []int `json:"category_ids,omitempty"`
+	TagIDs      []int `json:"tag_ids,omitempty"`
+}
+
+func (t *Target) empty() bool {
+	return t == nil || len(t.VariantIDs)+len(t.ProductIDs)+len(t.CategoryIDs)+len(t.TagIDs) == 0
+}
+
+func (t *Target) Matches(l Line) bool {
+	if t.empty() {
+		return true
+	}
+	if slices.Contains(t.VariantIDs, l.VariantID) || slices.Contains(t.ProductIDs, l.ProductID) {
+		return true
+	}
+	if l.CategoryID != nil && slices.Contains(t.CategoryIDs, *l.CategoryID) {
+		return true
+	}
+	for _, tag := range l.TagIDs {
+		if slices.Contains(t.TagIDs, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tier is one step of a TIERED_SPEND action; the highest reached tier wins.
+type Tier struct {
+	MinSubtotal float64 `json:"min_subtotal"`
+	Percent     float64 `json:"percent,omitempty"`
+	Amount      float64 `json:"amount,omitempty"`
+}
+
+// Action is the typed form of Promotion.Actions.
+type Action struct {
+	Type        ActionType `json:"type"`
+	Percent     float64    `json:"percent,omitempty"`
+	Amount      float64    `json:"amount,omitempty"`
+	MaxDiscount *float64   `json:"max_discount,omitempty"`
+	Target      *Target    `json:"target,omitempty"` // PERCENT_OFF_ITEMS, BUY_X_GET_Y, TIERED_SPEND
+
+	BuyQuantity int     `json:"buy_quantity,omitempty"`
+	GetQuantity int     `json:"get_quantity,omitempty"`
+	GetPercent  float64 `json:"get_percent,omitempty"` // Discount on the "get" units; 0 means free
+
+	Tiers []Tier `json:"tiers,omitempty"`
+
+	Expression string `json:"expression,omitempty"`
+}
+
+// Conditions is the typed form of Promotion.Conditions. All set fields must hold.
+type Conditions struct {
+	MinSubtotal float64  `json:"min_subtotal,omitempty"`
+	MinQuantity int      `json:"min_quantity,omitempty"`
+	Requires    *Target  `json:"requires,omitempty"` // Cart must contain a matching line
+	Channels    []string `json:"channels,omitempty"` // WEB, POS, ...
+	Expression  string   `json:"expression,omitempty"`
+}
+
+// Rule is a promotion ready for evaluation.
+type Rule struct {
+	ID         int
+	Name       string
+	Code       *string
+	Priority   int
+	Exclusive  bool
+	Active     bool
+	StartsAt   *time.Time
+	EndsAt     *time.Time
+	Conditions Conditions
+	Action     Action
+
+	condition *vm.Program
+	amount    *vm.Program
+}
+
+// Parse decodes and validates a promotion's conditions and actions, compiling
+// any expressions against the evaluation environment.
+func Parse(p *domain.Promotion) (*Rule, error) {
+	r := &Rule{
+		ID:        p.ID,
+		Name:      p.Name,
+		Code:      p.Code,
+		Priority:  p.Priority,
+		Exclusive: p.IsExclusive,
+		Active:    p.IsActive,
+		StartsAt:  p.StartsAt,
+		EndsAt:    p.EndsAt,
+	}
+	if err := decode(p.Conditions, &r.Conditions); err != nil {
+		return nil, fmt.Errorf("conditions: %w", err)
+	}
+	if err := decode(p.Actions, &r.Action); err != nil {
+		return nil, fmt.Errorf("actions: %w", err)
+	}
+	if r.Action.Type == "" && r.Action.Expression != "" {
+		r.Action.Type = ExpressionAmount
+	}
+
+	if err := r.Action.validate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.Conditions.Expression != "" {
+		if r.condition, err = expr.Compile(r.Conditions.Expression, expr.Env(sampleEnv()), expr.AsBool()); err != nil {
+			return nil, fmt.Errorf("condition expression: %w", err)
+		}
+	}
+	if r.Action.Type == ExpressionAmount {
+		if r.amount, err = expr.Compile(r.Action.Expression, expr.Env(sampleEnv()), expr.AsFloat64()); err != nil {
+			return nil, fmt.Errorf("action expression: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (a *Action) validate() error {
+	switch a.Type {
+	case PercentOffCart, PercentOffItems:
+		if a.Percent <= 0 || a.Percent > 100 {
+			return errors.New("percent must be between 0 and 100")
+		}
+	case FixedOffCart:
+		if a.Amount <= 0 {
+			return errors.New("amount must be positive")
+		}
+	case BuyXGetY:
+		if a.BuyQuantity < 1 || a.GetQuantity < 1 {
+			return errors.New("buy_quantity and get_quantity must be at least 1")
+		}
+		if a.GetPercent < 0 || a.GetPercent > 100 {
+			return errors.New("get_percent must be between 0 and 100")
+		}
+	case TieredSpend:
+		if len(a.Tiers) == 0 {
+			return errors.New("tiered spend needs at least one tier")
+		}
+		for _, t := range a.Tiers {
+			if t.Percent < 0 || t.Percent > 100 || t.Amount < 0 || (t.Percent == 0) == (t.Amount == 0) {
+				return errors.New("each tier needs either a percent or an amount")
+			}
+		}
+	case FreeShipping:
+	case ExpressionAmount:
+		if a.Expression == "" {
+			return errors.New("expression is required")
+		}
+	case "":
+		return errors.New("action type is required")
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+	if a.MaxDiscount != nil && *a.MaxDiscount <= 0 {
+		return errors.New("max_discount must be positive")
+	}
+	return nil
+}
+
+// decode converts a jsonb map into its typed struct, rejecting unknown keys so
+// typos do not silently disable a rule.
+func decode(m map[string]interface{}, v any) error {
+	if len(m) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"server/internal/core/domain"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type cartRepository struct {
+	*GormRepository[domain.Cart]
+}
+
+func NewCartRepository(db *gorm.DB) CartRepository {
+	return &cartRepository{NewGormRepository[domain.Cart](db)}
+}
+
+func (r *cartRepository) FindActiveByToken(ctx context.Context, token string) (*domain.Cart, error) {
+	return r.findActive(ctx, "token = ?", token)
+}
+
+func (r *cartRepository) FindActiveByUser(ctx context.Context, userID int) (*domain.Cart, error) {
+	return r.findActive(ctx, "user_id = ?", userID)
+}
+
+func (r *cartRepository) findActive(ctx context.Context, condition string, arg any) (*domain.Cart, error) {
+	var cart domain.Cart
+	err := r.DB.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC, id ASC") }).
+		Preload("Items.Variant").
+		Preload("Items.Variant.Product").
+		Where(condition, arg).
+		Where("status = ? AND expires_at > ?", domain.CartActive, time.Now()).
+		First(&cart).Error
+	return &cart, err
+}
+
+func (r *cartRepository) ExpireStale(ctx context.Context, now time.Time) (int64, error) {
+	res := r.DB.WithContext(ctx).Model(&domain.Cart{}).
+		Where("status = ? AND expires_at <= ?", domain.CartActive, now).
+		Updates(map[string]interface{}{"status": domain.CartExpired, "updated_at": now})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"server/internal/core/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type idempotencyRepository struct {
+	*GormRepository[domain.IdempotencyKey]
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{NewGormRepository[domain.IdempotencyKey](db)}
+}
+
+func (r *idempotencyRepository) Claim(ctx context.Context, scope, key, fingerprint string, expiresAt, staleBefore time.Time) (*domain.IdempotencyKey, bool, error) {
+	db := r.DB.WithContext(ctx)
+
+	// A lapsed key may be reused as if new, and so may one whose request
+	// never finished (the server died while running it)
+	if err := db.Where("scope = ? AND key = ?", scope, key).
+		Where(db.Where("expires_at <= ?", time.Now()).Or("response_status = 0 AND created_at <= ?", staleBefore)).
+		Delete(&domain.IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	rec := &domain.IdempotencyKey{Scope: scope, Key: key, Fingerprint: fingerprint, ExpiresAt: expiresAt}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return rec, true, nil
+	}
+
+	var existing domain.IdempotencyKey
+	if err := db.Where("scope = ? AND key = ?", scope, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, id, status int, body []byte, contentType string) error {
+	return r.DB.WithContext(ctx).Model(&domain.IdempotencyKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"response_status": status, "response_body": body, "content_type": contentType}).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := r.DB.WithContext(ctx).Where("expires_at <= ?", now).Delete(&domain.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"time"
 )
 
 // 1. Base Generic Interface
@@ -61,6 +62,22 @@ type CategoryRepository interface {
 	ForceDelete(ctx context.Context, id int) error
 }
 
+// TranslationRepository stores per-locale catalog text.
+// An empty locale in the Find* methods returns every locale.
+type TranslationRepository interface {
+	FindProductTranslations(ctx context.Context, locale string, productIDs []int) ([]domain.ProductTranslation, error)
+	FindCategoryTranslations(ctx context.Context, locale string, categoryIDs []int) ([]domain.CategoryTranslation, error)
+	FindTagTranslations(ctx context.Context, locale string, tagIDs []int) ([]domain.TagTranslation, error)
+
+	SaveProductTranslation(ctx context.Context, t *domain.ProductTranslation) error
+	SaveCategoryTranslation(ctx context.Context, t *domain.CategoryTranslation) error
+	SaveTagTranslation(ctx context.Context, t *domain.TagTranslation) error
+
+	DeleteProductTranslation(ctx context.Context, productID int, locale string) error
+	DeleteCategoryTranslation(ctx context.Context, categoryID int, locale string) error
+	DeleteTagTranslation(ctx context.Context, tagID int, locale string) error
+}
+
 // 4. Sales & POS
 type OrderRepository interface {
 	Repository[domain.SalesOrder]
@@ -74,6 +91,15 @@ type OrderRepository interface {
 	ForceDelete(ctx context.Context, id int) error
 }
 
+type CartRepository interface {
+	Repository[domain.Cart]
+	// FindActiveByToken / FindActiveByUser load an unexpired ACTIVE cart with items, variants and products
+	FindActiveByToken(ctx context.Context, token string) (*domain.Cart, error)
+	FindActiveByUser(ctx context.Context, userID int) (*domain.Cart, error)
+	// ExpireStale marks ACTIVE carts past their expiry as EXPIRED
+	ExpireStale(ctx context.Context, now time.Time) (int64, error)
+}
+
 type POSSessionRepository interface {
 	Repository[domain.POSSession]
 	FindActiveSession(ctx context.Context, userID int) (*domain.POSSession, error)
@@ -129,4 +155,17 @@ type InvoiceRepository interface {
 type PromotionRepository interface {
 	Repository[domain.Promotion]
 	GetActivePromotions(ctx context.Context) ([]domain.Promotion, error)
+	// FindByCode looks up a coupon, ignoring case
+	FindByCode(ctx context.Context, code string) (*domain.Promotion, error)
+}
+
+// 8. Request Safety
+type IdempotencyRepository interface {
+	Repository[domain.IdempotencyKey]
+	// Claim inserts the key, or returns the live record already holding it (created=false).
+	// A claim still without a response from before staleBefore is taken over.
+	Claim(ctx context.Context, scope, key, fingerprint string, expiresAt, staleBefore time.Time) (rec *domain.IdempotencyKey, created bool, err error)
+	// Complete stores the response replayed to retries
+	Complete(ctx context.Context, id, status int, body []byte, contentType string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
 }
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"server/internal/core/domain"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -10,12 +13,30 @@ import (
 type MediaRepository interface {
 	Repository[domain.MediaAsset]
 	GetByUUID(ctx context.Context, uuid string) (*domain.MediaAsset, error)
+	// FindUnprocessed returns assets the processing job has not handled yet, oldest first
+	FindUnprocessed(ctx context.Context, limit int) ([]domain.MediaAsset, error)
+	// FindOrphans returns assets older than the cutoff that are still PENDING,
+	// or READY but never linked to anything
+	FindOrphans(ctx context.Context, before time.Time, limit int) ([]domain.MediaAsset, error)
+	// KnownPaths returns which of the given object paths on a disk belong to an asset
+	KnownPaths(ctx context.Context, disk string, paths []string) (map[string]bool, error)
+	// DeleteAsset removes the asset row and its renditions
+	DeleteAsset(ctx context.Context, id int) error
+	// ReplaceRenditions swaps the rendition rows of an asset and saves the asset itself
+	ReplaceRenditions(ctx context.Context, asset *domain.MediaAsset, renditions []domain.MediaRendition) error
 }
 
 type MediaLinkRepository interface {
 	Repository[domain.MediaLink]
 	GetByEntity(ctx context.Context, entityType string, entityID int, zone string) ([]domain.MediaLink, error)
 	DeleteByEntity(ctx context.Context, entityType string, entityID int, zone string) error
+	// FindByEntities loads links (with media and renditions) for many entities at once,
+	// ordered by zone (hero, gallery, care-guide), primary first, then sort order
+	FindByEntities(ctx context.Context, entityType string, entityIDs []int) ([]domain.MediaLink, error)
+	// Reorder rewrites sort_order for a zone; mediaIDs must match the zone's links exactly
+	Reorder(ctx context.Context, entityType string, entityID int, zone string, mediaIDs []int) error
+	// SetPrimary marks one linked media as the entity's primary and clears the rest
+	SetPrimary(ctx context.Context, entityType string, entityID int, mediaID int) error
 }
 
 type mediaRepository struct {
@@ -32,6 +53,68 @@ func (r *mediaRepository) GetByUUID(ctx context.Context, uuid string) (*domain.M
 	return &asset, err
 }
 
+func (r *mediaRepository) FindUnprocessed(ctx context.Context, limit int) ([]domain.MediaAsset, error) {
+	var assets []domain.MediaAsset
+	err := r.DB.WithContext(ctx).
+		Where("status = ? AND processed_at IS NULL AND processing_error IS NULL", domain.MediaReady).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&assets).Error
+	return assets, err
+}
+
+func (r *mediaRepository) FindOrphans(ctx context.Context, before time.Time, limit int) ([]domain.MediaAsset, error) {
+	var assets []domain.MediaAsset
+	err := r.DB.WithContext(ctx).
+		Preload("Renditions").
+		Where("created_at < ?", before).
+		Where(r.DB.Where("status = ?", domain.MediaPending).
+			Or("status = ? AND NOT EXISTS (SELECT 1 FROM media_links ml WHERE ml.media_id = media_assets.id)", domain.MediaReady)).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&assets).Error
+	return assets, err
+}
+
+func (r *mediaRepository) KnownPaths(ctx context.Context, disk string, paths []string) (map[string]bool, error) {
+	var found []string
+	err := r.DB.WithContext(ctx).Model(&domain.MediaAsset{}).
+		Where("disk = ? AND path IN ?", disk, paths).
+		Pluck("path", &found).Error
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(found))
+	for _, p := range found {
+		known[p] = true
+	}
+	return known, nil
+}
+
+func (r *mediaRepository) DeleteAsset(ctx context.Context, id int) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", id).Delete(&domain.MediaRendition{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.MediaAsset{}, id).Error
+	})
+}
+
+func (r *mediaRepository) ReplaceRenditions(ctx context.Context, asset *domain.MediaAsset, renditions []domain.MediaRendition) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", asset.ID).Delete(&domain.MediaRendition{}).Error; err != nil {
+			return err
+		}
+		if len(renditions) > 0 {
+			if err := tx.Create(&renditions).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Renditions").Save(asset).Error
+	})
+}
+
 type mediaLinkRepository struct {
 	*GormRepository[domain.MediaLink]
 }
@@ -49,3 +132,78 @@ func (r *mediaLinkRepository) GetByEntity(ctx context.Context, entityType string
 func (r *mediaLinkRepository) DeleteByEntity(ctx context.Context, entityType string, entityID int, zone string) error {
 	return r.DB.WithContext(ctx).Where("entity_type = ? AND entity_id = ? AND zone = ?", entityType, entityID, zone).Delete(&domain.MediaLink{}).Error
 }
+
+func (r *mediaLinkRepository) FindByEntities(ctx context.Context, entityType string, entityIDs []int) ([]domain.MediaLink, error) {
+	var links []domain.MediaLink
+	if len(entityIDs) == 0 {
+		return links, nil
+	}
+	err := r.DB.WithContext(ctx).
+		Preload("Media").
+		Preload("Media.Renditions").
+		Where("entity_type = ? AND entity_id IN ?", entityType, entityIDs).
+		Order("entity_id").
+		Order(zoneOrder).
+		Order("is_primary DESC, sort_order ASC, id ASC").
+		Find(&links).Error
+	return links, err
+}
+
+// zoneOrder sorts known zones first, in display order; unknown zones go last.
+var zoneOrder = func() string {
+	var b strings.Builder
+	b.WriteString("CASE zone")
+	for i, z := range domain.MediaZones {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", z, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(domain.MediaZones))
+	return b.String()
+}()
+
+func (r *mediaLinkRepository) Reorder(ctx context.Context, entityType string, entityID int, zone string, mediaIDs []int) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var links []domain.MediaLink
+		if err := tx.Where("entity_type = ? AND entity_id = ? AND zone = ?", entityType, entityID, zone).
+			Find(&links).Error; err != nil {
+			return err
+		}
+
+		byMedia := make(map[int]int, len(links))
+		for _, l := range links {
+			byMedia[l.MediaID] = l.ID
+		}
+		if len(mediaIDs) != len(links) {
+			return fmt.Errorf("zone %s has %d media, got %d IDs", zone, len(links), len(mediaIDs))
+		}
+
+		for i, mediaID := range mediaIDs {
+			linkID, ok := byMedia[mediaID]
+			if !ok {
+				return fmt.Errorf("media %d is not linked to zone %s", mediaID, zone)
+			}
+			delete(byMedia, mediaID) // rejects duplicate IDs
+			if err := tx.Model(&domain.MediaLink{}).Where("id = ?", linkID).
+				Update("sort_order", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *mediaLinkRepository) SetPrimary(ctx context.Context, entityType string, entityID int, mediaID int) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.MediaLink{}).
+			Where("entity_type = ? AND entity_id = ? AND media_id = ?", entityType, entityID, mediaID).
+			Update("is_primary", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&domain.MediaLink{}).
+			Where("entity_type = ? AND entity_id = ? AND media_id <> ?", entityType, entityID, mediaID).
+			Update("is_primary", false).Error
+	})
+}
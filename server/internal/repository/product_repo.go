@@ -23,6 +23,9 @@ func (r *productRepository) GetFullProduct(ctx context.Context, slug string) (*d
 		Preload("Category").
 		Preload("Supplier").
 		Preload("Tags").
+		Preload("Variants", "is_active = ? AND deleted_at IS NULL", true).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Options.Values", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
 		Where("slug = ?", slug).
 		First(&product).Error
 	return &product, err
@@ -38,7 +41,14 @@ func (r *productRepository) Search(ctx context.Context, filter dto.ProductFilter
 		Preload("Tags")
 
 	if filter.Search != "" {
-		query = query.Where("name ILIKE ? OR sku ILIKE ?", "%"+filter.Search+"%", "%"+filter.Search+"%")
+		search := "%" + filter.Search + "%"
+		if filter.Locale != "" {
+			// Also match the translated name so shoppers can search in their own language
+			query = query.Where("products.name ILIKE ? OR products.sku ILIKE ? OR EXISTS (SELECT 1 FROM product_translations pt WHERE pt.product_id = products.id AND pt.locale = ? AND pt.name ILIKE ?)",
+				search, search, filter.Locale, search)
+		} else {
+			query = query.Where("products.name ILIKE ? OR products.sku ILIKE ?", search, search)
+		}
 	}
 
 	if filter.CategorySlug != "" {
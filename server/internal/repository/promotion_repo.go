@@ -22,7 +22,13 @@ func (r *promotionRepository) GetActivePromotions(ctx context.Context) ([]domain
 	var promotions []domain.Promotion
 	now := time.Now()
 	err := r.DB.WithContext(ctx).
-		Where("is_active = ? AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at >= ?)", true, now, now).
+		Where("is_active = ? AND NOT is_template AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at >= ?)", true, now, now).
 		Find(&promotions).Error
 	return promotions, err
 }
+
+func (r *promotionRepository) FindByCode(ctx context.Context, code string) (*domain.Promotion, error) {
+	var promo domain.Promotion
+	err := r.DB.WithContext(ctx).Where("UPPER(code) = UPPER(?) AND NOT is_template", code).First(&promo).Error
+	return &promo, err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"server/internal/core/domain"
+
+	"gorm.io/gorm"
+)
+
+type translationRepository struct {
+	DB *gorm.DB
+}
+
+func NewTranslationRepository(db *gorm.DB) TranslationRepository {
+	return &translationRepository{DB: db}
+}
+
+func (r *translationRepository) scope(ctx context.Context, column, locale string, ids []int) *gorm.DB {
+	query := r.DB.WithContext(ctx).Where(column+" IN ?", ids)
+	if locale != "" {
+		query = query.Where("locale = ?", locale)
+	}
+	return query.Order("locale ASC")
+}
+
+func (r *translationRepository) FindProductTranslations(ctx context.Context, locale string, productIDs []int) ([]domain.ProductTranslation, error) {
+	var translations []domain.ProductTranslation
+	if len(productIDs) == 0 {
+		return translations, nil
+	}
+	err := r.scope(ctx, "product_id", locale, productIDs).Find(&translations).Error
+	return translations, err
+}
+
+func (r *translationRepository) FindCategoryTranslations(ctx context.Context, locale string, categoryIDs []int) ([]domain.CategoryTranslation, error) {
+	var translations []domain.CategoryTranslation
+	if len(categoryIDs) == 0 {
+		return translations, nil
+	}
+	err := r.scope(ctx, "category_id", locale, categoryIDs).Find(&translations).Error
+	return translations, err
+}
+
+func (r *translationRepository) FindTagTranslations(ctx context.Context, locale string, tagIDs []int) ([]domain.TagTranslation, error) {
+	var translations []domain.TagTranslation
+	if len(tagIDs) == 0 {
+		return translations, nil
+	}
+	err := r.scope(ctx, "tag_id", locale, tagIDs).Find(&translations).Error
+	return translations, err
+}
+
+// Save* upsert on the (entity, locale) primary key.
+func (r *translationRepository) SaveProductTranslation(ctx context.Context, t *domain.ProductTranslation) error {
+	return r.DB.WithContext(ctx).Save(t).Error
+}
+
+func (r *translationRepository) SaveCategoryTranslation(ctx context.Context, t *domain.CategoryTranslation) error {
+	return r.DB.WithContext(ctx).Save(t).Error
+}
+
+func (r *translationRepository) SaveTagTranslation(ctx context.Context, t *domain.TagTranslation) error {
+	return r.DB.WithContext(ctx).Save(t).Error
+}
+
+func (r *translationRepository) DeleteProductTranslation(ctx context.Context, productID int, locale string) error {
+	return r.DB.WithContext(ctx).Where("product_id = ? AND locale = ?", productID, locale).Delete(&domain.ProductTranslation{}).Error
+}
+
+func (r *translationRepository) DeleteCategoryTranslation(ctx context.Context, categoryID int, locale string) error {
+	return r.DB.WithContext(ctx).Where("category_id = ? AND locale = ?", categoryID, locale).Delete(&domain.CategoryTranslation{}).Error
+}
+
+func (r *translationRepository) DeleteTagTranslation(ctx context.Context, tagID int, locale string) error {
+	return r.DB.WithContext(ctx).Where("tag_id = ? AND locale = ?", tagID, locale).Delete(&domain.TagTranslation{}).Error
+}
@@ -6,19 +6,23 @@ import (
 	"server/internal/core/domain"
 	"server/internal/repository"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type AssemblyServiceImpl struct {
 	recipeRepo       repository.RecipeRepository
 	assemblyRepo     repository.AssemblyRepository
 	inventoryService InventoryService
+	db               *gorm.DB
 }
 
-func NewAssemblyService(recipeRepo repository.RecipeRepository, assemblyRepo repository.AssemblyRepository, inventoryService InventoryService) AssemblyService {
+func NewAssemblyService(recipeRepo repository.RecipeRepository, assemblyRepo repository.AssemblyRepository, inventoryService InventoryService, db *gorm.DB) AssemblyService {
 	return &AssemblyServiceImpl{
 		recipeRepo:       recipeRepo,
 		assemblyRepo:     assemblyRepo,
 		inventoryService: inventoryService,
+		db:               db,
 	}
 }
 
@@ -85,14 +89,13 @@ func (s *AssemblyServiceImpl) AssembleKit(ctx context.Context, variantID, qty in
 
 	// Log assembly
 	assembly := &domain.StockAssembly{
-		AssemblyNumber:   "ASM-" + time.Now().Format("20060102-150405"), // TODO: Generate properly
 		VariantID:        variantID,
 		QuantityProduced: qty,
 		TotalCost:        0, // TODO: Calculate
 		CreatedBy:        &userID,
 		CreatedAt:        time.Now(),
 	}
-	return s.assemblyRepo.Create(ctx, assembly)
+	return s.logAssembly(ctx, domain.DocAssembly, assembly)
 }
 
 func (s *AssemblyServiceImpl) Disassemble(ctx context.Context, variantID, qty int, userID int) error {
@@ -143,14 +146,30 @@ func (s *AssemblyServiceImpl) Disassemble(ctx context.Context, variantID, qty in
 
 	// Log disassembly (similar to assembly)
 	assembly := &domain.StockAssembly{
-		AssemblyNumber:   "DIS-" + time.Now().Format("20060102-150405"),
 		VariantID:        variantID,
 		QuantityProduced: -qty, // Negative for disassembly
 		TotalCost:        0,
 		CreatedBy:        &userID,
 		CreatedAt:        time.Now(),
 	}
-	return s.assemblyRepo.Create(ctx, assembly)
+	return s.logAssembly(ctx, domain.DocDisassembly, assembly)
+}
+
+// logAssembly numbers and saves an assembly log. Assemblies run at
+// location 1, whose code goes into location-scoped numbers.
+func (s *AssemblyServiceImpl) logAssembly(ctx context.Context, docType domain.DocumentType, assembly *domain.StockAssembly) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		code, err := locationCode(tx, 1)
+		if err != nil {
+			return err
+		}
+		number, err := nextDocumentNumber(tx, docType, code)
+		if err != nil {
+			return err
+		}
+		assembly.AssemblyNumber = number
+		return tx.Create(assembly).Error
+	})
 }
 
 func (s *AssemblyServiceImpl) GetAssemblyLogs(ctx context.Context, page, limit int) ([]domain.StockAssembly, error) {
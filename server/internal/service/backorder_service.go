@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/notify"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BackorderServiceImpl struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+	payments PaymentService
+}
+
+func NewBackorderService(db *gorm.DB, notifier notify.Notifier, payments PaymentService) BackorderService {
+	return &BackorderServiceImpl{db: db, notifier: notifier, payments: payments}
+}
+
+// allocation is what one order received from an allocation run.
+type allocation struct {
+	orderID int
+	lines   []string // "2 x Monstera Thai Constellation"
+}
+
+// AllocateReceipt is the procurement receipt listener: it allocates the
+// received variants, lines linked to the purchase order first.
+func (s *BackorderServiceImpl) AllocateReceipt(ctx context.Context, poID int, variantIDs []int) {
+	for _, variantID := range variantIDs {
+		if _, err := s.allocate(ctx, variantID, poID); err != nil {
+			log.Printf("backorder allocation of variant %d from PO %d: %v", variantID, poID, err)
+		}
+	}
+}
+
+func (s *BackorderServiceImpl) Allocate(ctx context.Context, variantID int) (int, error) {
+	return s.allocate(ctx, variantID, 0)
+}
+
+func (s *BackorderServiceImpl) allocate(ctx context.Context, variantID, poID int) (int, error) {
+	var allocated []allocation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		allocated, err = allocateTx(tx, variantID, poID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range allocated {
+		if err := s.notifyAllocated(ctx, a); err != nil {
+			log.Printf("backorder notice for order %d: %v", a.orderID, err)
+		}
+	}
+	return len(allocated), nil
+}
+
+// allocateTx hands the variant's available stock to waiting lines of
+// confirmed orders: lines linked to poID first, then oldest orders first.
+// The units leave stock as SALE movements, as if the order had been paid
+// with the stock on hand.
+func allocateTx(tx *gorm.DB, variantID, poID int) ([]allocation, error) {
+	var stocks []domain.Stock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND quantity > reserved", variantID).
+		Order("quantity - reserved DESC, location_id").
+		Find(&stocks).Error; err != nil || len(stocks) == 0 {
+		return nil, err
+	}
+
+	var lines []domain.SalesOrderItem
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "sales_order_items"}}).
+		Joins("JOIN sales_orders ON sales_orders.id = sales_order_items.sales_order_id").
+		Joins("LEFT JOIN purchase_order_items ON purchase_order_items.id = sales_order_items.purchase_order_item_id").
+		Where("sales_order_items.variant_id = ? AND sales_order_items.backordered > 0 AND sales_orders.status = ?", variantID, domain.OrderConfirmed).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "CASE WHEN purchase_order_items.purchase_order_id = ? THEN 0 ELSE 1 END, sales_orders.placed_at, sales_order_items.id",
+			Vars: []interface{}{poID},
+		}}).
+		Find(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	refType := "sales_orders"
+	byOrder := map[int]int{} // Order ID to its index in out
+	var out []allocation
+	for _, line := range lines {
+		got := 0
+		for i := range stocks {
+			st := &stocks[i]
+			take := min(line.Backordered-got, st.Quantity-st.Reserved)
+			if take <= 0 {
+				continue
+			}
+			if err := tx.Model(&domain.Stock{}).
+				Where("location_id = ? AND variant_id = ?", st.LocationID, variantID).
+				Updates(map[string]interface{}{"quantity": gorm.Expr("quantity - ?", take), "updated_at": time.Now()}).Error; err != nil {
+				return nil, err
+			}
+			orderID := line.SalesOrderID
+			if err := tx.Create(&domain.StockMovement{
+				LocationID:     st.LocationID,
+				VariantID:      variantID,
+				QuantityChange: -take,
+				Reason:         string(domain.ReasonSale),
+				ReferenceType:  &refType,
+				ReferenceID:    &orderID,
+				CreatedAt:      time.Now(),
+			}).Error; err != nil {
+				return nil, err
+			}
+			st.Quantity -= take
+			got += take
+		}
+		if got == 0 {
+			break // Out of stock
+		}
+		if err := tx.Model(&domain.SalesOrderItem{}).Where("id = ?", line.ID).
+			Update("backordered", line.Backordered-got).Error; err != nil {
+			return nil, err
+		}
+
+		idx, ok := byOrder[line.SalesOrderID]
+		if !ok {
+			idx = len(out)
+			byOrder[line.SalesOrderID] = idx
+			out = append(out, allocation{orderID: line.SalesOrderID})
+		}
+		out[idx].lines = append(out[idx].lines, fmt.Sprintf("%d x %s", got, line.ProductName))
+	}
+	return out, nil
+}
+
+// notifyAllocated tells the customer what arrived for their order. Once
+// nothing is left waiting, a balance still owed on a deposit is charged
+// with a fresh payment link.
+func (s *BackorderServiceImpl) notifyAllocated(ctx context.Context, a allocation) error {
+	db := s.db.WithContext(ctx)
+	var order domain.SalesOrder
+	if err := db.First(&order, a.orderID).Error; err != nil {
+		return err
+	}
+	email, err := orderEmail(db, &order)
+	if err != nil || email == "" {
+		return err
+	}
+	var waiting int64
+	if err := db.Model(&domain.SalesOrderItem{}).
+		Where("sales_order_id = ? AND backordered > 0", order.ID).Count(&waiting).Error; err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Good news: stock has arrived for your order %s.\n\n", order.OrderNumber)
+	for _, line := range a.lines {
+		fmt.Fprintf(&b, "  - %s\n", line)
+	}
+	b.WriteString("\n")
+	if waiting > 0 {
+		b.WriteString("Some items are still on their way; we will let you know when they arrive.\n")
+	} else if balance := roundMoney(order.TotalAmount - order.PaidAmount); balance > 0 {
+		fmt.Fprintf(&b, "The remaining balance of %s is now due.\n", formatRupiah(balance))
+		links, err := s.payments.StartPayment(ctx, &order, email, nil)
+		if err != nil {
+			log.Printf("balance payment for order %d: %v", order.ID, err)
+		}
+		for _, link := range links {
+			if link.PaymentURL != "" {
+				fmt.Fprintf(&b, "Pay here: %s\n", link.PaymentURL)
+			}
+		}
+		b.WriteString("We will ship your order once it is paid.\n")
+	} else {
+		b.WriteString("Everything is here, and we will ship your order shortly.\n")
+	}
+	return s.notifier.Send(ctx, notify.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Your order %s: items have arrived", order.OrderNumber),
+		Body:    b.String(),
+	})
+}
+
+func (s *BackorderServiceImpl) GetBackorders(ctx context.Context, variantID int) ([]dto.BackorderLine, error) {
+	var lines []dto.BackorderLine
+	q := s.db.WithContext(ctx).Model(&domain.SalesOrderItem{}).
+		Select(`sales_order_items.id AS item_id, sales_orders.id AS order_id, sales_orders.order_number, sales_orders.status,
+			sales_orders.payment_status, sales_orders.placed_at, sales_order_items.variant_id, sales_order_items.sku,
+			sales_order_items.product_name, sales_order_items.quantity, sales_order_items.backordered,
+			sales_order_items.expected_at, sales_order_items.purchase_order_item_id`).
+		Joins("JOIN sales_orders ON sales_orders.id = sales_order_items.sales_order_id").
+		Where("sales_order_items.backordered > 0 AND sales_orders.status IN ?", []domain.OrderStatus{domain.OrderDraft, domain.OrderConfirmed})
+	if variantID > 0 {
+		q = q.Where("sales_order_items.variant_id = ?", variantID)
+	}
+	err := q.Order("sales_orders.placed_at, sales_order_items.id").Scan(&lines).Error
+	return lines, err
+}
+
+// orderDeposit is what an order with pre-order lines takes at checkout: the
+// total less the unpaid share of the units waiting on stock. Units there is
+// stock for are charged in full, as they ship right away. Quotes estimate the
+// waiting units from available stock; placed orders are settled with
+// settleDepositTx once reserveStockTx has recorded them. It is 0 when the
+// total is due.
+func orderDeposit(db *gorm.DB, items []domain.SalesOrderItem, total float64, pricesIncludeTax bool) (float64, error) {
+	percent, err := depositPercents(db, items)
+	if err != nil || len(percent) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int, 0, len(percent))
+	for id := range percent {
+		ids = append(ids, id)
+	}
+	// Variants without stock control are never waited on
+	var controlled []int
+	if err := db.Model(&domain.ProductVariant{}).Where("id IN ? AND stock_control = ?", ids, true).Pluck("id", &controlled).Error; err != nil || len(controlled) == 0 {
+		return 0, err
+	}
+	var available []struct {
+		VariantID int
+		Available int
+	}
+	if err := db.Model(&domain.Stock{}).
+		Select("variant_id, SUM(quantity - reserved) AS available").
+		Where("variant_id IN ? AND quantity > reserved", controlled).
+		Group("variant_id").
+		Scan(&available).Error; err != nil {
+		return 0, err
+	}
+	short := make(map[int]int, len(controlled))
+	for _, id := range controlled {
+		short[id] = 0
+	}
+	for _, item := range items {
+		if _, ok := short[item.VariantID]; ok {
+			short[item.VariantID] += item.Quantity
+		}
+	}
+	for _, a := range available {
+		short[a.VariantID] = max(short[a.VariantID]-a.Available, 0)
+	}
+
+	// Like backorderTx, the latest lines of a variant are the ones waiting
+	waiting := make([]int, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		n := min(short[items[i].VariantID], items[i].Quantity)
+		waiting[i] = n
+		short[items[i].VariantID] -= n
+	}
+	return depositFor(items, waiting, percent, total, pricesIncludeTax), nil
+}
+
+// settleDepositTx recomputes a placed order's deposit from the units
+// reserveStockTx left waiting on stock. With none waiting the total is due
+// now, as nothing would ask for the balance later.
+func settleDepositTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.DepositAmount <= 0 {
+		return nil
+	}
+	percent, err := depositPercents(tx, order.Items)
+	if err != nil {
+		return err
+	}
+	waiting := make([]int, len(order.Items))
+	for i, item := range order.Items {
+		waiting[i] = item.Backordered
+	}
+	deposit := depositFor(order.Items, waiting, percent, order.TotalAmount, order.PricesIncludeTax)
+	if deposit == order.DepositAmount {
+		return nil
+	}
+	order.DepositAmount = deposit
+	return tx.Model(&domain.SalesOrder{}).Where("id = ?", order.ID).Update("deposit_amount", deposit).Error
+}
+
+// depositPercents maps the order's pre-order variants to the share of their
+// price taken up front, leaving out those paid in full.
+func depositPercents(db *gorm.DB, items []domain.SalesOrderItem) (map[int]float64, error) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.VariantID)
+	}
+	var variants []domain.ProductVariant
+	if err := db.Select("id", "deposit_percent").
+		Where("id IN ? AND availability = ? AND deposit_percent < 100", ids, domain.AvailabilityPreorder).
+		Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	percent := make(map[int]float64, len(variants))
+	for _, v := range variants {
+		percent[v.ID] = v.DepositPercent
+	}
+	return percent, nil
+}
+
+// depositFor defers the unpaid share of the waiting units of each pre-order
+// line; waiting is indexed like items.
+func depositFor(items []domain.SalesOrderItem, waiting []int, percent map[int]float64, total float64, pricesIncludeTax bool) float64 {
+	deferred := 0.0
+	for i, item := range items {
+		p, ok := percent[item.VariantID]
+		if !ok || waiting[i] == 0 || item.Quantity == 0 {
+			continue
+		}
+		line := item.LineTotal
+		if !pricesIncludeTax {
+			line += item.TaxAmount
+		}
+		deferred += line * float64(waiting[i]) / float64(item.Quantity) * (100 - p) / 100
+	}
+	deposit := roundMoney(total - deferred)
+	if deposit <= 0 || deposit >= roundMoney(total) {
+		return 0
+	}
+	return deposit
+}
+
+// backorderTx records short units of a backorder or pre-order variant as
+// waiting on stock, latest lines first. They are linked to the open
+// purchase order line due soonest that still has room for them.
+func backorderTx(tx *gorm.DB, order *domain.SalesOrder, v domain.ProductVariant, short int) error {
+	poItemID, expectedAt, err := incomingLine(tx, v.ID, short)
+	if err != nil {
+		return err
+	}
+	if expectedAt == nil {
+		expectedAt = v.ExpectedAt
+	}
+
+	for i := len(order.Items) - 1; i >= 0 && short > 0; i-- {
+		item := &order.Items[i]
+		if item.VariantID != v.ID {
+			continue
+		}
+		item.Backordered = min(short, item.Quantity)
+		item.ExpectedAt = expectedAt
+		item.PurchaseOrderItemID = poItemID
+		if err := tx.Model(&domain.SalesOrderItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"backordered":            item.Backordered,
+			"expected_at":            item.ExpectedAt,
+			"purchase_order_item_id": item.PurchaseOrderItemID,
+		}).Error; err != nil {
+			return err
+		}
+		short -= item.Backordered
+	}
+	return nil
+}
+
+// incomingLine finds the open purchase order line for a variant, due
+// soonest, with at least need units not yet promised to other orders.
+func incomingLine(tx *gorm.DB, variantID, need int) (*int, *time.Time, error) {
+	var lines []struct {
+		ID         int
+		Open       int
+		ExpectedAt *time.Time
+	}
+	if err := tx.Table("purchase_order_items").
+		Select(`purchase_order_items.id, purchase_orders.expected_at,
+			purchase_order_items.quantity_ordered - purchase_order_items.quantity_received - COALESCE((
+				SELECT SUM(sales_order_items.backordered) FROM sales_order_items
+				JOIN sales_orders ON sales_orders.id = sales_order_items.sales_order_id
+				WHERE sales_order_items.purchase_order_item_id = purchase_order_items.id AND sales_orders.status <> ?), 0) AS open`, domain.OrderCancelled).
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_items.purchase_order_id").
+		Where("purchase_order_items.variant_id = ? AND purchase_orders.status IN ?", variantID, []domain.PurchaseOrderStatus{domain.POSent, domain.POPartiallyReceived}).
+		Order("purchase_orders.expected_at NULLS LAST, purchase_orders.id").
+		Scan(&lines).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, line := range lines {
+		if line.Open >= need {
+			return &line.ID, line.ExpectedAt, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// hasBackordersTx reports whether any line of the order is waiting on stock.
+func hasBackordersTx(tx *gorm.DB, orderID int) (bool, error) {
+	var n int64
+	err := tx.Model(&domain.SalesOrderItem{}).Where("sales_order_id = ? AND backordered > 0", orderID).Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/i18n"
+	"server/internal/notify"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidUnsubscribeLink = errors.New("unsubscribe link is invalid")
+
+const (
+	// reminderMaxAge skips carts and orders abandoned longer ago than this
+	reminderMaxAge = 7 * 24 * time.Hour
+	// reminderCooldown is the least time between two reminders to one address
+	reminderCooldown = 24 * time.Hour
+	reminderBatch    = 100
+)
+
+// CartRecoveryConfig tunes abandoned-cart reminders.
+type CartRecoveryConfig struct {
+	IdleAfter         time.Duration // A cart or unpaid order idle this long is abandoned
+	CouponTemplateID  *int          // Promotion template for a one-time coupon; none when nil
+	CouponTTL         time.Duration // How long a generated coupon stays valid
+	AttributionWindow time.Duration // Orders paid within it after a reminder count as recovered
+	SigningKey        []byte        // Signs unsubscribe links
+	UnsubscribeURL    string        // The email and token are added as query parameters
+}
+
+type CartRecoveryServiceImpl struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+	cfg      CartRecoveryConfig
+}
+
+func NewCartRecoveryService(db *gorm.DB, notifier notify.Notifier, cfg CartRecoveryConfig) CartRecoveryService {
+	return &CartRecoveryServiceImpl{db: db, notifier: notifier, cfg: cfg}
+}
+
+// abandoned is a cart or unpaid order worth a reminder.
+type abandoned struct {
+	reminder domain.CartReminder
+	name     string
+	locale   string
+	items    []reminderItem
+	link     string
+}
+
+type reminderItem struct {
+	Name     string
+	Quantity int
+}
+
+func (s *CartRecoveryServiceImpl) SendReminders(ctx context.Context) (int, error) {
+	now := time.Now()
+	carts, err := s.abandonedCarts(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	orders, err := s.abandonedOrders(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, a := range append(carts, orders...) {
+		ok, err := s.remind(ctx, a, now)
+		if err != nil {
+			log.Printf("cart reminder to %s: %v", a.reminder.Email, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// abandonedCarts are active carts of logged-in shoppers that went idle with
+// items in them and were not followed by an order.
+func (s *CartRecoveryServiceImpl) abandonedCarts(ctx context.Context, now time.Time) ([]abandoned, error) {
+	var carts []domain.Cart
+	if err := s.db.WithContext(ctx).
+		Preload("Items.Variant.Product").
+		Where("status = ? AND user_id IS NOT NULL AND updated_at BETWEEN ? AND ?", domain.CartActive, now.Add(-reminderMaxAge), now.Add(-s.cfg.IdleAfter)).
+		Where("EXISTS (SELECT 1 FROM cart_items WHERE cart_items.cart_id = carts.id)").
+		Where("NOT EXISTS (SELECT 1 FROM cart_reminders WHERE cart_reminders.cart_id = carts.id AND cart_reminders.activity_at = carts.updated_at)").
+		Where(`NOT EXISTS (SELECT 1 FROM sales_orders JOIN customers ON customers.id = sales_orders.customer_id
+			WHERE customers.user_id = carts.user_id AND sales_orders.placed_at >= carts.updated_at)`).
+		Order("updated_at").Limit(reminderBatch).Find(&carts).Error; err != nil {
+		return nil, err
+	}
+
+	var out []abandoned
+	for _, cart := range carts {
+		var user domain.User
+		if err := s.db.WithContext(ctx).First(&user, *cart.UserID).Error; err != nil {
+			return nil, err
+		}
+		if !user.IsActive {
+			continue
+		}
+		cartID := cart.ID
+		a := abandoned{
+			reminder: domain.CartReminder{CartID: &cartID, Email: user.Email, ActivityAt: cart.UpdatedAt},
+			name:     derefString(user.FirstName),
+			locale:   derefString(user.Locale),
+			link:     storefrontURL("/cart"),
+		}
+		for _, item := range cart.Items {
+			name := fmt.Sprintf("#%d", item.VariantID)
+			if item.Variant != nil && item.Variant.Product != nil {
+				name = item.Variant.Product.Name
+				if item.Variant.Name != nil && *item.Variant.Name != "" {
+					name += " - " + *item.Variant.Name
+				}
+			}
+			a.items = append(a.items, reminderItem{Name: name, Quantity: item.Quantity})
+			a.reminder.CartTotal += item.UnitPrice * float64(item.Quantity)
+		}
+		a.reminder.CartTotal = roundMoney(a.reminder.CartTotal)
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// abandonedOrders are web orders left unpaid: still waiting for payment, or
+// cancelled when their reservation lapsed (a shopper's own cancellation
+// happens before that). Orders followed by a later one are skipped.
+func (s *CartRecoveryServiceImpl) abandonedOrders(ctx context.Context, now time.Time) ([]abandoned, error) {
+	var orders []domain.SalesOrder
+	if err := s.db.WithContext(ctx).
+		Preload("Items").
+		Preload("Customer.User").
+		Where("channel = ? AND payment_status = ? AND placed_at BETWEEN ? AND ?", domain.ChannelWeb, domain.PaymentUnpaid, now.Add(-reminderMaxAge), now.Add(-s.cfg.IdleAfter)).
+		Where("subscription_id IS NULL"). // Subscription runs chase their own payment
+		Where("status = ? OR (status = ? AND expires_at IS NOT NULL AND updated_at >= expires_at)", domain.OrderDraft, domain.OrderCancelled).
+		Where("NOT EXISTS (SELECT 1 FROM cart_reminders WHERE cart_reminders.sales_order_id = sales_orders.id)").
+		Where(`NOT EXISTS (SELECT 1 FROM sales_orders later WHERE later.id <> sales_orders.id AND later.placed_at > sales_orders.placed_at
+			AND (later.customer_id = sales_orders.customer_id OR LOWER(later.guest_email) = LOWER(sales_orders.guest_email)))`).
+		Order("placed_at").Limit(reminderBatch).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	var out []abandoned
+	for _, order := range orders {
+		orderID := order.ID
+		a := abandoned{
+			reminder: domain.CartReminder{SalesOrderID: &orderID, Email: derefString(order.GuestEmail), ActivityAt: order.PlacedAt, CartTotal: order.TotalAmount},
+			link:     storefrontURL("/cart"),
+		}
+		if order.Customer != nil && order.Customer.User != nil {
+			user := order.Customer.User
+			if !user.IsActive {
+				continue
+			}
+			a.reminder.Email = user.Email
+			a.name = derefString(user.FirstName)
+			a.locale = derefString(user.Locale)
+		}
+		if a.reminder.Email == "" {
+			continue
+		}
+		for _, item := range order.Items {
+			a.items = append(a.items, reminderItem{Name: item.ProductName, Quantity: item.Quantity})
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// remind sends one reminder if the address consented and was not reminded
+// recently. The reminder row is claimed before sending so parallel runs
+// cannot both send; it is removed again, with its coupon, if sending fails.
+func (s *CartRecoveryServiceImpl) remind(ctx context.Context, a abandoned, now time.Time) (bool, error) {
+	db := s.db.WithContext(ctx)
+	consented, err := hasMarketingConsent(db, a.reminder.Email)
+	if err != nil || !consented {
+		return false, err
+	}
+	var recent int64
+	if err := db.Model(&domain.CartReminder{}).
+		Where("LOWER(email) = LOWER(?) AND sent_at > ?", a.reminder.Email, now.Add(-reminderCooldown)).
+		Count(&recent).Error; err != nil || recent > 0 {
+		return false, err
+	}
+
+	reminder := a.reminder
+	reminder.SentAt = now
+	reminder.AttributeUntil = now.Add(s.cfg.AttributionWindow)
+	var coupon *domain.Promotion
+	err = db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if s.cfg.CouponTemplateID == nil {
+			return nil
+		}
+		// A savepoint, so a failed coupon leaves the reminder intact
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			var err error
+			coupon, err = generateCouponTx(tx, *s.cfg.CouponTemplateID, now.Add(s.cfg.CouponTTL))
+			return err
+		})
+		if err != nil {
+			coupon = nil
+			// The reminder is still worth sending without a coupon
+			log.Printf("cart reminder coupon from promotion %d: %v", *s.cfg.CouponTemplateID, err)
+			return nil
+		}
+		reminder.PromotionID = &coupon.ID
+		reminder.CouponCode = coupon.Code
+		return tx.Model(&reminder).Updates(map[string]interface{}{"promotion_id": coupon.ID, "coupon_code": *coupon.Code}).Error
+	})
+	if err != nil || reminder.ID == 0 {
+		return false, err
+	}
+
+	msg, err := s.reminderMessage(a, coupon)
+	if err == nil {
+		err = s.notifier.Send(ctx, msg)
+	}
+	if err != nil {
+		db.Delete(&domain.CartReminder{}, reminder.ID)
+		if coupon != nil {
+			db.Delete(&domain.Promotion{}, coupon.ID)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// generateCouponTx copies a promotion template into a single-use coupon.
+func generateCouponTx(tx *gorm.DB, templateID int, endsAt time.Time) (*domain.Promotion, error) {
+	var tmpl domain.Promotion
+	if err := tx.First(&tmpl, templateID).Error; err != nil {
+		return nil, err
+	}
+	if !tmpl.IsTemplate || !tmpl.IsActive {
+		return nil, errors.New("promotion is not an active template")
+	}
+	if tmpl.EndsAt != nil && tmpl.EndsAt.Before(endsAt) {
+		endsAt = *tmpl.EndsAt
+	}
+	code, err := newCouponCode()
+	if err != nil {
+		return nil, err
+	}
+
+	once := 1
+	coupon := &domain.Promotion{
+		Name:            tmpl.Name + " " + code,
+		Code:            &code,
+		Description:     tmpl.Description,
+		Priority:        tmpl.Priority,
+		IsExclusive:     tmpl.IsExclusive,
+		IsActive:        true,
+		Conditions:      tmpl.Conditions,
+		Actions:         tmpl.Actions,
+		EndsAt:          &endsAt,
+		TotalUsageLimit: &once,
+		PerUserLimit:    &once,
+		GLAccountCode:   tmpl.GLAccountCode,
+		TemplateID:      &tmpl.ID,
+	}
+	return coupon, tx.Create(coupon).Error
+}
+
+// newCouponCode returns a code like "BACK-7QH3MXPZ".
+func newCouponCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i, v := range b {
+		b[i] = giftCardAlphabet[int(v)%len(giftCardAlphabet)]
+	}
+	return "BACK-" + string(b), nil
+}
+
+type reminderTemplate struct {
+	subject string
+	body    *template.Template
+}
+
+// reminderTemplates are keyed by locale; the default locale's is the fallback.
+var reminderTemplates = map[string]reminderTemplate{
+	"en": {
+		subject: "You left something in your cart",
+		body: template.Must(template.New("en").Parse(`Hi{{if .Name}} {{.Name}}{{end}},
+
+You left these in your cart:
+{{range .Items}}  - {{.Quantity}} x {{.Name}}
+{{end}}
+Total: {{.Total}}
+{{if .CouponCode}}
+Use code {{.CouponCode}} at checkout for a little extra{{if .CouponExpires}}, valid until {{.CouponExpires}}{{end}}.
+{{end}}
+Pick up where you left off: {{.Link}}
+
+Don't want these emails? Unsubscribe: {{.UnsubscribeURL}}
+`)),
+	},
+	"id": {
+		subject: "Keranjang Anda masih menunggu",
+		body: template.Must(template.New("id").Parse(`Halo{{if .Name}} {{.Name}}{{end}},
+
+Barang-barang ini masih ada di keranjang Anda:
+{{range .Items}}  - {{.Quantity}} x {{.Name}}
+{{end}}
+Total: {{.Total}}
+{{if .CouponCode}}
+Gunakan kode {{.CouponCode}} saat checkout untuk potongan tambahan{{if .CouponExpires}}, berlaku sampai {{.CouponExpires}}{{end}}.
+{{end}}
+Lanjutkan belanja Anda: {{.Link}}
+
+Tidak ingin menerima email ini? Berhenti berlangganan: {{.UnsubscribeURL}}
+`)),
+	},
+}
+
+func (s *CartRecoveryServiceImpl) reminderMessage(a abandoned, coupon *domain.Promotion) (notify.Message, error) {
+	tmpl, ok := reminderTemplates[i18n.Normalize(a.locale)]
+	if !ok {
+		if tmpl, ok = reminderTemplates[i18n.Default()]; !ok {
+			tmpl = reminderTemplates["en"]
+		}
+	}
+
+	data := map[string]interface{}{
+		"Name":           a.name,
+		"Items":          a.items,
+		"Total":          formatRupiah(a.reminder.CartTotal),
+		"Link":           a.link,
+		"UnsubscribeURL": s.unsubscribeURL(a.reminder.Email),
+	}
+	if coupon != nil {
+		data["CouponCode"] = *coupon.Code
+		if coupon.EndsAt != nil {
+			data["CouponExpires"] = coupon.EndsAt.Format("2 January 2006")
+		}
+	}
+	var body strings.Builder
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return notify.Message{}, err
+	}
+	return notify.Message{To: a.reminder.Email, Subject: tmpl.subject, Body: body.String()}, nil
+}
+
+func (s *CartRecoveryServiceImpl) unsubscribeURL(email string) string {
+	q := url.Values{"email": {strings.ToLower(email)}, "token": {s.unsubscribeToken(email)}}
+	return s.cfg.UnsubscribeURL + "?" + q.Encode()
+}
+
+func (s *CartRecoveryServiceImpl) unsubscribeToken(email string) string {
+	mac := hmac.New(sha256.New, s.cfg.SigningKey)
+	mac.Write([]byte("unsubscribe:" + strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *CartRecoveryServiceImpl) Unsubscribe(ctx context.Context, email, token string) error {
+	if email == "" || !hmac.Equal([]byte(token), []byte(s.unsubscribeToken(email))) {
+		return ErrInvalidUnsubscribeLink
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"opted_in", "source", "updated_at"}),
+	}).Create(&domain.MarketingConsent{
+		Email:  strings.ToLower(strings.TrimSpace(email)),
+		Source: domain.ConsentUnsubscribe,
+	}).Error
+}
+
+func (s *CartRecoveryServiceImpl) GetReminders(ctx context.Context, limit int) ([]domain.CartReminder, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var reminders []domain.CartReminder
+	err := s.db.WithContext(ctx).Order("sent_at DESC").Limit(limit).Find(&reminders).Error
+	return reminders, err
+}
+
+func (s *CartRecoveryServiceImpl) GetStats(ctx context.Context, from, to time.Time) (*dto.CartRecoveryStats, error) {
+	stats := &dto.CartRecoveryStats{From: from, To: to}
+	q := func() *gorm.DB {
+		return s.db.WithContext(ctx).Model(&domain.CartReminder{}).Where("sent_at BETWEEN ? AND ?", from, to)
+	}
+	if err := q().Count(&stats.Sent).Error; err != nil {
+		return nil, err
+	}
+	if err := q().Where("recovered_order_id IS NOT NULL").Count(&stats.Recovered).Error; err != nil {
+		return nil, err
+	}
+	if err := q().Select("COALESCE(SUM(recovered_total), 0)").Scan(&stats.RecoveredRevenue).Error; err != nil {
+		return nil, err
+	}
+	if err := q().Where("promotion_id IS NOT NULL").Count(&stats.CouponsSent).Error; err != nil {
+		return nil, err
+	}
+	if err := q().Where("EXISTS (SELECT 1 FROM promotion_usages WHERE promotion_usages.promotion_id = cart_reminders.promotion_id)").
+		Count(&stats.CouponsRedeemed).Error; err != nil {
+		return nil, err
+	}
+	if stats.Sent > 0 {
+		stats.ConversionRate = float64(stats.Recovered) / float64(stats.Sent)
+	}
+	return stats, nil
+}
+
+// markRecoveredTx attributes a paid web order to the latest open reminder
+// for it or its shopper's address.
+func markRecoveredTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.Channel != domain.ChannelWeb {
+		return nil
+	}
+	email, err := orderEmail(tx, order)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	q := tx.Where("recovered_order_id IS NULL AND attribute_until >= ?", now)
+	if email != "" {
+		q = q.Where("sales_order_id = ? OR LOWER(email) = LOWER(?)", order.ID, email)
+	} else {
+		q = q.Where("sales_order_id = ?", order.ID)
+	}
+	var reminder domain.CartReminder
+	if err := q.Order("sent_at DESC").Limit(1).Find(&reminder).Error; err != nil || reminder.ID == 0 {
+		return err
+	}
+	return tx.Model(&reminder).Updates(map[string]interface{}{
+		"recovered_order_id": order.ID,
+		"recovered_at":       now,
+		"recovered_total":    order.TotalAmount,
+	}).Error
+}
@@ -2,68 +2,901 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
 	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/promotion"
+	"server/internal/repository"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCartLineQuantity = 999
+
+var ErrCartItemNotFound = errors.New("item is not in the cart")
+
+var (
+	// ErrItemUnavailable is returned at checkout for missing, inactive or
+	// deleted variants.
+	ErrItemUnavailable = errors.New("item is not available")
+	ErrAddressNotFound = errors.New("address not found")
+	ErrInvalidAddress  = errors.New("invalid address")
 )
 
 type CartServiceImpl struct {
 	marketingService MarketingService
+	taxService       TaxService
+	shippingService  ShippingService
+	cartRepo         repository.CartRepository
+	db               *gorm.DB
+	ttl              time.Duration
 }
 
-func NewCartService(marketingS MarketingService) CartService {
+// NewCartService stores carts for ttl after their last change.
+func NewCartService(marketingS MarketingService, taxS TaxService, shippingS ShippingService, cartRepo repository.CartRepository, db *gorm.DB, ttl time.Duration) CartService {
 	return &CartServiceImpl{
 		marketingService: marketingS,
+		taxService:       taxS,
+		shippingService:  shippingS,
+		cartRepo:         cartRepo,
+		db:               db,
+		ttl:              ttl,
 	}
 }
 
-func (s *CartServiceImpl) CalculateCart(ctx context.Context, items []domain.SalesOrderItem, couponCode string) (*CartCalculationResult, error) {
-	// Calculate subtotal
+func (s *CartServiceImpl) CalculateCart(ctx context.Context, items []domain.SalesOrderItem, couponCode string, shopper Shopper) (*CartCalculationResult, error) {
+	if shopper.Channel == "" {
+		return nil, errors.New("cart calculation needs the order channel")
+	}
+	items = slices.Clone(items)
 	subtotal := 0.0
 	for _, item := range items {
 		subtotal += item.UnitPrice * float64(item.Quantity)
 	}
 
-	// Prepare data for promotion evaluation
-	data := map[string]interface{}{
-		"cart": map[string]interface{}{
-			"total": subtotal,
-			"items": items,
-		},
-		"discount": 0.0,
+	lines, err := promotionLines(s.db.WithContext(ctx), items)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get active promotions
-	promos, err := s.marketingService.GetPromotions(ctx)
+	// Coupons only take part when their code is entered
+	promos, err := s.marketingService.GetActivePromotions(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	// Apply promotions (simplified: apply all that match, no exclusivity yet)
-	totalDiscount := 0.0
-	for _, promo := range promos {
-		err := s.marketingService.ApplyPromotion(ctx, &promo, data)
+	var rules []*promotion.Rule
+	for i := range promos {
+		if promos[i].Code != nil {
+			continue
+		}
+		rule, err := promotion.Parse(&promos[i])
 		if err != nil {
-			// Log error but continue
+			log.Printf("promotion %d skipped: %v", promos[i].ID, err)
 			continue
 		}
-		if disc, ok := data["discount"].(float64); ok {
-			totalDiscount += disc
+		rules = append(rules, rule)
+	}
+
+	var coupon *domain.Promotion
+	if couponCode != "" {
+		if coupon, err = s.marketingService.CheckCoupon(ctx, couponCode, shopper); err != nil {
+			return nil, err
+		}
+		rule, err := promotion.Parse(coupon)
+		if err != nil {
+			log.Printf("coupon promotion %d is invalid: %v", coupon.ID, err)
+			return nil, &CouponError{Reason: CouponNoDiscount, Message: "This coupon cannot be applied"}
+		}
+		rules = append(rules, rule)
+	}
+
+	res := promotion.Evaluate(rules, promotion.Cart{
+		Lines:      lines,
+		Channel:    string(shopper.Channel),
+		CustomerID: shopper.CustomerID,
+		Now:        time.Now(),
+	})
+	if coupon != nil {
+		if err := couponOutcome(res, coupon.ID); err != nil {
+			return nil, err
 		}
 	}
 
-	// For now, assume no tax or shipping
+	for i := range items {
+		items[i].DiscountAmount = res.LineDiscounts[i]
+		items[i].LineTotal = roundMoney(items[i].UnitPrice*float64(items[i].Quantity) - res.LineDiscounts[i])
+	}
+
+	taxAmount, err := s.taxService.ApplyToItems(ctx, items, shopper.CustomerID, shopper.ShippingAddress)
+	if err != nil {
+		return nil, err
+	}
+
 	result := &CartCalculationResult{
-		Subtotal:       subtotal,
-		DiscountAmount: totalDiscount,
-		TaxAmount:      0,
-		ShippingAmount: 0,
-		TotalAmount:    subtotal - totalDiscount,
-		Items:          items,
+		Subtotal:         subtotal,
+		DiscountAmount:   res.Discount,
+		TaxAmount:        taxAmount,
+		ShippingAmount:   0,
+		TotalAmount:      roundMoney(subtotal - res.Discount),
+		FreeShipping:     res.FreeShipping,
+		PricesIncludeTax: s.taxService.PricesIncludeTax(),
+		Items:            items,
+	}
+	if !result.PricesIncludeTax {
+		result.TotalAmount = roundMoney(result.TotalAmount + taxAmount)
 	}
 
-	if couponCode != "" {
-		result.CouponApplied = &couponCode
-		// TODO: Apply coupon discount
+	if shopper.ShippingAddress != nil {
+		if err := s.quoteShipping(ctx, result, shopper.ShippingAddress, shopper.ShippingMethod); err != nil {
+			return nil, err
+		}
+	}
+	for _, applied := range res.Applied {
+		result.Promotions = append(result.Promotions, orderPromotion(applied, items))
+		if applied.Code != nil {
+			result.CouponApplied = applied.Code
+		}
 	}
 
+	// Points come off the final total, like a voucher; tax is not reduced
+	if shopper.RedeemPoints > 0 {
+		points, discount, err := pointsDiscount(s.db.WithContext(ctx), shopper.CustomerID, shopper.RedeemPoints, result.TotalAmount)
+		if err != nil {
+			return nil, err
+		}
+		result.PointsRedeemed = points
+		result.PointsDiscount = discount
+		result.TotalAmount = roundMoney(result.TotalAmount - discount)
+	}
+
+	if result.DepositAmount, err = orderDeposit(s.db.WithContext(ctx), items, result.TotalAmount, result.PricesIncludeTax); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
+
+// PriceItems builds order lines from the catalog. Repeated variants are
+// merged; tax and discounts are filled in by CalculateCart.
+func (s *CartServiceImpl) PriceItems(ctx context.Context, items []dto.CartItemRequest) ([]domain.SalesOrderItem, error) {
+	if len(items) == 0 {
+		return nil, errors.New("cart is empty")
+	}
+	var order []int
+	quantities := make(map[int]int, len(items))
+	for _, it := range items {
+		if it.Quantity < 1 {
+			return nil, fmt.Errorf("quantity of variant %d must be at least 1", it.VariantID)
+		}
+		if _, seen := quantities[it.VariantID]; !seen {
+			order = append(order, it.VariantID)
+		}
+		quantities[it.VariantID] += it.Quantity
+	}
+
+	var variants []domain.ProductVariant
+	if err := s.db.WithContext(ctx).Preload("Product").Where("id IN ?", order).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	lines := make([]domain.SalesOrderItem, 0, len(order))
+	for _, id := range order {
+		v := byID[id]
+		if v == nil || !sellable(v) {
+			return nil, fmt.Errorf("%w: variant %d", ErrItemUnavailable, id)
+		}
+		qty := quantities[id]
+		if qty > maxCartLineQuantity {
+			return nil, fmt.Errorf("quantity of %s cannot exceed %d", v.SKU, maxCartLineQuantity)
+		}
+		price := variantPrice(v)
+		lines = append(lines, domain.SalesOrderItem{
+			VariantID:   v.ID,
+			ProductName: v.Product.Name,
+			SKU:         v.SKU,
+			Quantity:    qty,
+			UnitPrice:   price,
+			LineTotal:   roundMoney(price * float64(qty)),
+		})
+	}
+	return lines, nil
+}
+
+// UserAddress loads an address the user owns. Addresses without an owner
+// belong to locations and suppliers and are never offered to shoppers.
+func (s *CartServiceImpl) UserAddress(ctx context.Context, addressID, userID int) (*domain.Address, error) {
+	var addr domain.Address
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", addressID, userID).First(&addr).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAddressNotFound
+		}
+		return nil, err
+	}
+	return &addr, nil
+}
+
+// AddressSnapshot copies an address for an order, so later edits to the
+// address book do not rewrite history. Inline guest addresses have no ID.
+func (s *CartServiceImpl) AddressSnapshot(addr *domain.Address) map[string]interface{} {
+	snapshot := map[string]interface{}{
+		"line1":       addr.Line1,
+		"line2":       derefString(addr.Line2),
+		"city":        addr.City,
+		"state":       derefString(addr.State),
+		"postal_code": derefString(addr.PostalCode),
+		"country":     addr.Country,
+		"latitude":    addr.Latitude,
+		"longitude":   addr.Longitude,
+	}
+	if addr.ID != 0 {
+		snapshot["address_id"] = addr.ID
+	}
+	return snapshot
+}
+
+// quoteShipping lists the shipping options and prices the chosen method.
+// A free-shipping promotion zeroes the chosen method's price.
+func (s *CartServiceImpl) quoteShipping(ctx context.Context, result *CartCalculationResult, address *domain.Address, method string) error {
+	opts, err := s.shippingService.Options(ctx, result.Items, address, result.Subtotal-result.DiscountAmount)
+	if err != nil {
+		return err
+	}
+	result.ShippingOptions = opts
+	if method == "" {
+		return nil
+	}
+
+	for i := range opts {
+		if !strings.EqualFold(opts[i].Code, method) {
+			continue
+		}
+		if !opts[i].Available {
+			return fmt.Errorf("%w: %s", ErrShippingUnavailable, opts[i].Reason)
+		}
+		chosen := opts[i]
+		if result.FreeShipping {
+			chosen.Price = 0
+		}
+		result.Shipping = &chosen
+		result.ShippingAmount = chosen.Price
+		result.TotalAmount = roundMoney(result.TotalAmount + chosen.Price)
+		return nil
+	}
+	return fmt.Errorf("%w: unknown method %s", ErrShippingUnavailable, method)
+}
+
+// promotionLines attaches the catalog data promotion targets match on.
+func promotionLines(db *gorm.DB, items []domain.SalesOrderItem) ([]promotion.Line, error) {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.VariantID
+	}
+	var variants []domain.ProductVariant
+	if len(ids) > 0 {
+		if err := db.Preload("Product.Tags").Where("id IN ?", ids).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	lines := make([]promotion.Line, len(items))
+	for i, item := range items {
+		lines[i] = promotion.Line{VariantID: item.VariantID, Quantity: item.Quantity, UnitPrice: item.UnitPrice}
+		if v := byID[item.VariantID]; v != nil && v.Product != nil {
+			lines[i].ProductID = v.ProductID
+			lines[i].CategoryID = v.Product.CategoryID
+			for _, tag := range v.Product.Tags {
+				lines[i].TagIDs = append(lines[i].TagIDs, tag.ID)
+			}
+		}
+	}
+	return lines, nil
+}
+
+// couponOutcome turns an entered coupon that did not apply into a CouponError.
+func couponOutcome(res *promotion.Result, promotionID int) error {
+	for _, out := range res.Outcomes {
+		if out.PromotionID != promotionID {
+			continue
+		}
+		switch out.Status {
+		case promotion.StatusApplied:
+			return nil
+		case promotion.StatusNotMatched:
+			return &CouponError{Reason: CouponConditionsUnmet, Message: "Your cart does not meet the requirements for this coupon: " + out.Reason}
+		case promotion.StatusSkipped:
+			return &CouponError{Reason: CouponNotCombinable, Message: "This coupon cannot be combined with the promotions in your cart"}
+		case promotion.StatusError:
+			log.Printf("coupon promotion %d: %s", promotionID, out.Reason)
+		}
+		return &CouponError{Reason: CouponNoDiscount, Message: "This coupon gives no discount on your cart"}
+	}
+	return nil
+}
+
+// orderPromotion records an applied promotion with its per-line allocation.
+func orderPromotion(applied promotion.Applied, items []domain.SalesOrderItem) domain.SalesOrderPromotion {
+	var lines []map[string]interface{}
+	for i, amount := range applied.LineDiscounts {
+		if amount > 0 {
+			lines = append(lines, map[string]interface{}{"variant_id": items[i].VariantID, "amount": amount})
+		}
+	}
+	meta := map[string]interface{}{"name": applied.Name, "lines": lines}
+	if applied.FreeShipping {
+		meta["free_shipping"] = true
+	}
+	if applied.Code != nil {
+		meta["code"] = *applied.Code
+	}
+	return domain.SalesOrderPromotion{
+		PromotionID:    applied.PromotionID,
+		DiscountAmount: applied.Discount,
+		MetaData:       meta,
+	}
+}
+
+func (s *CartServiceImpl) GetCart(ctx context.Context, ref CartRef) (*dto.CartResponse, error) {
+	cart, err := s.resolveCart(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return &dto.CartResponse{Items: []dto.CartLineResponse{}}, nil
+	}
+	return s.revalidate(ctx, cart)
+}
+
+func (s *CartServiceImpl) AddItem(ctx context.Context, ref CartRef, variantID, quantity int) (*dto.CartResponse, error) {
+	if quantity < 1 || quantity > maxCartLineQuantity {
+		return nil, fmt.Errorf("quantity must be between 1 and %d", maxCartLineQuantity)
+	}
+
+	var variant domain.ProductVariant
+	if err := s.db.WithContext(ctx).Preload("Product").First(&variant, variantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("variant not found")
+		}
+		return nil, err
+	}
+	if !sellable(&variant) {
+		return nil, errors.New("variant is not available for sale")
+	}
+
+	cart, err := s.resolveCart(ctx, ref, true)
+	if err != nil {
+		return nil, err
+	}
+
+	item := domain.CartItem{
+		CartID:    cart.ID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		UnitPrice: variantPrice(&variant),
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(addQuantityOnConflict()).Create(&item).Error; err != nil {
+			return err
+		}
+		return s.touch(tx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+// UpdateItem sets the quantity of a line; zero removes it.
+func (s *CartServiceImpl) UpdateItem(ctx context.Context, ref CartRef, variantID, quantity int) (*dto.CartResponse, error) {
+	if quantity == 0 {
+		return s.RemoveItem(ctx, ref, variantID)
+	}
+	if quantity < 0 || quantity > maxCartLineQuantity {
+		return nil, fmt.Errorf("quantity must be between 0 and %d", maxCartLineQuantity)
+	}
+
+	cart, err := s.resolveCart(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, ErrCartItemNotFound
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.CartItem{}).
+			Where("cart_id = ? AND variant_id = ?", cart.ID, variantID).
+			Updates(map[string]interface{}{"quantity": quantity, "updated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrCartItemNotFound
+		}
+		return s.touch(tx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+func (s *CartServiceImpl) RemoveItem(ctx context.Context, ref CartRef, variantID int) (*dto.CartResponse, error) {
+	cart, err := s.resolveCart(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, ErrCartItemNotFound
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("cart_id = ? AND variant_id = ?", cart.ID, variantID).Delete(&domain.CartItem{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrCartItemNotFound
+		}
+		return s.touch(tx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+// ReplaceItems overwrites the cart with a client-side list (e.g. a cart kept
+// in local storage before this API existed). Unknown variants are dropped.
+func (s *CartServiceImpl) ReplaceItems(ctx context.Context, ref CartRef, items []dto.CartItemRequest) (*dto.CartResponse, error) {
+	quantities := make(map[int]int, len(items))
+	var ids []int
+	for _, it := range items {
+		if it.Quantity < 1 {
+			continue
+		}
+		if _, seen := quantities[it.VariantID]; !seen {
+			ids = append(ids, it.VariantID)
+		}
+		quantities[it.VariantID] = min(quantities[it.VariantID]+it.Quantity, maxCartLineQuantity)
+	}
+
+	var variants []domain.ProductVariant
+	if len(ids) > 0 {
+		if err := s.db.WithContext(ctx).Preload("Product").Where("id IN ?", ids).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	cart, err := s.resolveCart(ctx, ref, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&domain.CartItem{}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			v, ok := byID[id]
+			if !ok {
+				continue
+			}
+			item := domain.CartItem{CartID: cart.ID, VariantID: id, Quantity: quantities[id], UnitPrice: variantPrice(v)}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		return s.touch(tx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+// ApplyCoupon validates the code against the current cart and stores it.
+func (s *CartServiceImpl) ApplyCoupon(ctx context.Context, ref CartRef, code string) (*dto.CartResponse, error) {
+	cart, err := s.resolveCart(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return nil, errors.New("add items to your cart before applying a coupon")
+	}
+
+	shopper, err := s.cartShopper(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	var items []domain.SalesOrderItem
+	for _, it := range cart.Items {
+		items = append(items, domain.SalesOrderItem{VariantID: it.VariantID, Quantity: it.Quantity, UnitPrice: it.UnitPrice})
+	}
+	totals, err := s.CalculateCart(ctx, items, code, shopper)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Cart{}).Where("id = ?", cart.ID).
+			Update("coupon_code", *totals.CouponApplied).Error; err != nil {
+			return err
+		}
+		return s.touch(tx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+func (s *CartServiceImpl) RemoveCoupon(ctx context.Context, ref CartRef) (*dto.CartResponse, error) {
+	cart, err := s.resolveCart(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return &dto.CartResponse{Items: []dto.CartLineResponse{}}, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&domain.Cart{}).Where("id = ?", cart.ID).
+		Update("coupon_code", nil).Error; err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+// cartShopper identifies the owner of a user cart; guest carts stay anonymous
+// until checkout asks for an email.
+func (s *CartServiceImpl) cartShopper(ctx context.Context, cart *domain.Cart) (Shopper, error) {
+	if cart.UserID == nil {
+		return Shopper{Channel: domain.ChannelWeb}, nil
+	}
+	shopper, err := s.marketingService.ShopperForUser(ctx, *cart.UserID)
+	shopper.Channel = domain.ChannelWeb
+	return shopper, err
+}
+
+// ExpireCarts marks carts untouched for longer than the TTL as EXPIRED. They
+// are kept for abandoned-cart reporting.
+func (s *CartServiceImpl) ExpireCarts(ctx context.Context) (int, error) {
+	n, err := s.cartRepo.ExpireStale(ctx, time.Now())
+	return int(n), err
+}
+
+// resolveCart finds the cart for a request. A token alone only reaches guest
+// carts. When a logged-in shopper still sends a guest token, the guest cart is
+// claimed (no user cart yet) or merged into the user's cart.
+func (s *CartServiceImpl) resolveCart(ctx context.Context, ref CartRef, create bool) (*domain.Cart, error) {
+	var guest *domain.Cart
+	if ref.Token != "" {
+		c, err := s.cartRepo.FindActiveByToken(ctx, ref.Token)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && (c.UserID == nil || (ref.UserID != nil && *c.UserID == *ref.UserID)) {
+			guest = c
+		}
+	}
+
+	if ref.UserID == nil {
+		if guest == nil && create {
+			return s.createCart(ctx, nil)
+		}
+		return guest, nil
+	}
+	if guest != nil && guest.UserID != nil {
+		return guest, nil
+	}
+
+	owned, err := s.cartRepo.FindActiveByUser(ctx, *ref.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		owned = nil
+	}
+
+	switch {
+	case guest == nil && owned == nil:
+		if create {
+			return s.createCart(ctx, ref.UserID)
+		}
+		return nil, nil
+	case guest == nil:
+		return owned, nil
+	case owned == nil:
+		guest.UserID = ref.UserID
+		if err := s.db.WithContext(ctx).Model(&domain.Cart{}).Where("id = ?", guest.ID).
+			Update("user_id", *ref.UserID).Error; err != nil {
+			return nil, err
+		}
+		return guest, nil
+	default:
+		if err := s.mergeCarts(ctx, guest, owned); err != nil {
+			return nil, err
+		}
+		return s.cartRepo.FindActiveByUser(ctx, *ref.UserID)
+	}
+}
+
+// mergeCarts adds the guest lines to the user's cart (quantities summed) and
+// retires the guest cart.
+func (s *CartServiceImpl) mergeCarts(ctx context.Context, guest, owned *domain.Cart) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, it := range guest.Items {
+			item := domain.CartItem{CartID: owned.ID, VariantID: it.VariantID, Quantity: it.Quantity, UnitPrice: it.UnitPrice}
+			if err := tx.Clauses(addQuantityOnConflict()).Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&domain.Cart{}).Where("id = ?", guest.ID).
+			Updates(map[string]interface{}{"status": domain.CartMerged, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return s.touch(tx, owned.ID)
+	})
+}
+
+func (s *CartServiceImpl) createCart(ctx context.Context, userID *int) (*domain.Cart, error) {
+	token, err := newCartToken()
+	if err != nil {
+		return nil, err
+	}
+	cart := &domain.Cart{
+		Token:     token,
+		UserID:    userID,
+		Status:    domain.CartActive,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := s.cartRepo.Create(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+func (s *CartServiceImpl) touch(tx *gorm.DB, cartID int) error {
+	now := time.Now()
+	return tx.Model(&domain.Cart{}).Where("id = ?", cartID).
+		Updates(map[string]interface{}{"expires_at": now.Add(s.ttl), "updated_at": now}).Error
+}
+
+func (s *CartServiceImpl) reload(ctx context.Context, cart *domain.Cart) (*dto.CartResponse, error) {
+	fresh, err := s.cartRepo.FindActiveByToken(ctx, cart.Token)
+	if err != nil {
+		return nil, err
+	}
+	return s.revalidate(ctx, fresh)
+}
+
+// revalidate checks every line against the current catalog price and stock,
+// saves any correction and reports it once as a notice.
+func (s *CartServiceImpl) revalidate(ctx context.Context, cart *domain.Cart) (*dto.CartResponse, error) {
+	var ids []int
+	for _, it := range cart.Items {
+		ids = append(ids, it.VariantID)
+	}
+	stock, err := stockLevels(s.db.WithContext(ctx), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.CartResponse{
+		Token:     cart.Token,
+		Items:     []dto.CartLineResponse{},
+		ExpiresAt: &cart.ExpiresAt,
+	}
+	var priced []domain.SalesOrderItem
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, it := range cart.Items {
+			v := it.Variant
+			if v == nil || !sellable(v) {
+				resp.Notices = append(resp.Notices, dto.CartNotice{
+					VariantID: it.VariantID,
+					Code:      dto.CartNoticeUnavailable,
+					Message:   "This item is no longer available and was removed from your cart",
+				})
+				if err := tx.Delete(&domain.CartItem{}, it.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			changed := false
+			var available *int
+			if v.StockControl && v.Availability != domain.AvailabilityInStock && v.Availability != "" {
+				// Short units wait for stock at checkout
+				left := max(stock[v.ID], 0)
+				available = &left
+			} else if v.StockControl {
+				left := stock[v.ID]
+				available = &left
+				if left <= 0 {
+					resp.Notices = append(resp.Notices, dto.CartNotice{
+						VariantID: v.ID,
+						Code:      dto.CartNoticeOutOfStock,
+						Message:   fmt.Sprintf("%s is out of stock and was removed from your cart", v.SKU),
+					})
+					if err := tx.Delete(&domain.CartItem{}, it.ID).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				if it.Quantity > left {
+					resp.Notices = append(resp.Notices, dto.CartNotice{
+						VariantID: v.ID,
+						Code:      dto.CartNoticeQuantityReduced,
+						Message:   fmt.Sprintf("Only %d of %s left; quantity reduced from %d", left, v.SKU, it.Quantity),
+					})
+					it.Quantity = left
+					changed = true
+				}
+			}
+
+			if price := variantPrice(v); price != it.UnitPrice {
+				resp.Notices = append(resp.Notices, dto.CartNotice{
+					VariantID: v.ID,
+					Code:      dto.CartNoticePriceChanged,
+					Message:   fmt.Sprintf("Price of %s changed from %s to %s", v.SKU, formatRupiah(it.UnitPrice), formatRupiah(price)),
+				})
+				it.UnitPrice = price
+				changed = true
+			}
+
+			if changed {
+				if err := tx.Model(&domain.CartItem{}).Where("id = ?", it.ID).
+					Updates(map[string]interface{}{"quantity": it.Quantity, "unit_price": it.UnitPrice, "updated_at": time.Now()}).Error; err != nil {
+					return err
+				}
+			}
+
+			line := dto.CartLineResponse{
+				VariantID:   v.ID,
+				ProductID:   v.ProductID,
+				ProductName: v.Product.Name,
+				ProductSlug: v.Product.Slug,
+				VariantName: v.Name,
+				SKU:         v.SKU,
+				Quantity:    it.Quantity,
+				UnitPrice:   it.UnitPrice,
+				LineTotal:   it.UnitPrice * float64(it.Quantity),
+				Available:   available,
+			}
+			if v.Availability != domain.AvailabilityInStock && v.Availability != "" {
+				line.Availability = v.Availability
+				line.ExpectedAt = v.ExpectedAt
+			}
+			resp.Items = append(resp.Items, line)
+			resp.ItemCount += it.Quantity
+			priced = append(priced, domain.SalesOrderItem{
+				VariantID:   v.ID,
+				ProductName: v.Product.Name,
+				SKU:         v.SKU,
+				Quantity:    it.Quantity,
+				UnitPrice:   it.UnitPrice,
+				LineTotal:   line.LineTotal,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.cartTotals(ctx, cart, priced, resp)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.Items {
+		resp.Items[i].DiscountAmount = totals.Items[i].DiscountAmount
+	}
+	resp.Subtotal = totals.Subtotal
+	resp.DiscountAmount = totals.DiscountAmount
+	resp.TaxAmount = totals.TaxAmount
+	resp.TaxIncluded = totals.PricesIncludeTax
+	resp.TotalAmount = totals.TotalAmount
+	return resp, nil
+}
+
+// cartTotals prices the cart with its stored coupon. A coupon that no longer
+// applies (expired, used up, cart changed) is dropped with a notice.
+func (s *CartServiceImpl) cartTotals(ctx context.Context, cart *domain.Cart, priced []domain.SalesOrderItem, resp *dto.CartResponse) (*CartCalculationResult, error) {
+	if cart.CouponCode == nil {
+		return s.CalculateCart(ctx, priced, "", Shopper{Channel: domain.ChannelWeb})
+	}
+
+	shopper, err := s.cartShopper(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := s.CalculateCart(ctx, priced, *cart.CouponCode, shopper)
+	var couponErr *CouponError
+	if !errors.As(err, &couponErr) {
+		if err == nil {
+			resp.CouponCode = totals.CouponApplied
+		}
+		return totals, err
+	}
+
+	resp.Notices = append(resp.Notices, dto.CartNotice{
+		Code:    dto.CartNoticeCouponRemoved,
+		Message: fmt.Sprintf("Coupon %s was removed: %s", *cart.CouponCode, couponErr.Message),
+	})
+	if err := s.db.WithContext(ctx).Model(&domain.Cart{}).Where("id = ?", cart.ID).
+		Update("coupon_code", nil).Error; err != nil {
+		return nil, err
+	}
+	return s.CalculateCart(ctx, priced, "", Shopper{Channel: domain.ChannelWeb})
+}
+
+// sellable reports whether a variant and its product are live in the catalog.
+func sellable(v *domain.ProductVariant) bool {
+	return v.IsActive && v.DeletedAt == nil &&
+		v.Product != nil && v.Product.IsActive && v.Product.DeletedAt == nil
+}
+
+// stockLevels sums available-to-sell (on hand minus reserved) across
+// locations for each variant.
+func stockLevels(db *gorm.DB, variantIDs []int) (map[int]int, error) {
+	levels := make(map[int]int, len(variantIDs))
+	if len(variantIDs) == 0 {
+		return levels, nil
+	}
+
+	var rows []struct {
+		VariantID int
+		Total     int
+	}
+	err := db.Model(&domain.Stock{}).
+		Select("variant_id, COALESCE(SUM(quantity - reserved), 0) AS total").
+		Where("variant_id IN ?", variantIDs).
+		Group("variant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		levels[r.VariantID] = r.Total
+	}
+	return levels, nil
+}
+
+// addQuantityOnConflict turns a duplicate (cart, variant) insert into a
+// quantity increment, capped at maxCartLineQuantity.
+func addQuantityOnConflict() clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "cart_id"}, {Name: "variant_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("LEAST(cart_items.quantity + excluded.quantity, ?)", maxCartLineQuantity),
+			"updated_at": time.Now(),
+		}),
+	}
+}
+
+func newCartToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
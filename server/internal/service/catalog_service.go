@@ -1,22 +1,32 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/csv"
 	"errors"
+	"fmt"
+	"regexp"
+	"server/internal/barcode"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"server/internal/i18n"
 	"server/internal/repository"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type CatalogServiceImpl struct {
-	productRepo  repository.ProductRepository
-	categoryRepo repository.CategoryRepository
-	variantRepo  repository.VariantRepository
-	tagRepo      repository.TagRepository
-	db           *gorm.DB
+	productRepo     repository.ProductRepository
+	categoryRepo    repository.CategoryRepository
+	variantRepo     repository.VariantRepository
+	tagRepo         repository.TagRepository
+	translationRepo repository.TranslationRepository
+	mediaService    MediaService
+	db              *gorm.DB
 }
 
 func NewCatalogService(
@@ -24,32 +34,143 @@ func NewCatalogService(
 	categoryRepo repository.CategoryRepository,
 	variantRepo repository.VariantRepository,
 	tagRepo repository.TagRepository,
+	translationRepo repository.TranslationRepository,
+	mediaService MediaService,
 	db *gorm.DB,
 
 ) CatalogService {
 	return &CatalogServiceImpl{
-		productRepo:  productRepo,
-		categoryRepo: categoryRepo,
-		variantRepo:  variantRepo,
-		tagRepo:      tagRepo,
-		db:           db,
+		productRepo:     productRepo,
+		categoryRepo:    categoryRepo,
+		variantRepo:     variantRepo,
+		tagRepo:         tagRepo,
+		translationRepo: translationRepo,
+		mediaService:    mediaService,
+		db:              db,
 	}
 }
 
 func (s *CatalogServiceImpl) GetProducts(ctx context.Context, filter dto.ProductFilterParams) ([]domain.Product, int64, error) {
-	return s.productRepo.Search(ctx, filter)
+	products, total, err := s.productRepo.Search(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.translateProducts(ctx, filter.Locale, products); err != nil {
+		return nil, 0, err
+	}
+	if err := s.attachProductMedia(ctx, products); err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+func (s *CatalogServiceImpl) GetProductDetail(ctx context.Context, slug string, locale string) (*domain.Product, error) {
+	product, err := s.productRepo.GetFullProduct(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	products := []domain.Product{*product}
+	if err := s.translateProducts(ctx, locale, products); err != nil {
+		return nil, err
+	}
+	if err := s.attachProductMedia(ctx, products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// attachProductMedia fills Product.Media, and the media of any loaded variants,
+// with linked images and their rendition URLs.
+func (s *CatalogServiceImpl) attachProductMedia(ctx context.Context, products []domain.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+
+	media, err := s.mediaService.GetEntityMedia(ctx, domain.MediaEntityProduct, ids)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		products[i].Media = media[products[i].ID]
+		if err := s.attachVariantMedia(ctx, products[i].Variants); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *CatalogServiceImpl) GetProductDetail(ctx context.Context, slug string) (*domain.Product, error) {
-	return s.productRepo.FindOne(ctx, "slug = ?", slug)
+func (s *CatalogServiceImpl) attachVariantMedia(ctx context.Context, variants []domain.ProductVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(variants))
+	for i, v := range variants {
+		ids[i] = v.ID
+	}
+
+	media, err := s.mediaService.GetEntityMedia(ctx, domain.MediaEntityVariant, ids)
+	if err != nil {
+		return err
+	}
+	for i := range variants {
+		variants[i].Media = media[variants[i].ID]
+	}
+	return nil
 }
 
-func (s *CatalogServiceImpl) GetCategories(ctx context.Context) ([]domain.Category, error) {
-	return s.categoryRepo.FindAll(ctx)
+func (s *CatalogServiceImpl) attachCategoryMedia(ctx context.Context, categories []domain.Category) error {
+	if len(categories) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(categories))
+	for i, c := range categories {
+		ids[i] = c.ID
+	}
+
+	media, err := s.mediaService.GetEntityMedia(ctx, domain.MediaEntityCategory, ids)
+	if err != nil {
+		return err
+	}
+	for i := range categories {
+		categories[i].Media = media[categories[i].ID]
+	}
+	return nil
+}
+
+func (s *CatalogServiceImpl) GetCategories(ctx context.Context, locale string) ([]domain.Category, error) {
+	categories, err := s.categoryRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*domain.Category, len(categories))
+	for i := range categories {
+		refs[i] = &categories[i]
+	}
+	if err := s.translateCategories(ctx, locale, refs); err != nil {
+		return nil, err
+	}
+	if err := s.attachCategoryMedia(ctx, categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
 }
 
 func (s *CatalogServiceImpl) GetVariants(ctx context.Context, productID int) ([]domain.ProductVariant, error) {
-	return s.variantRepo.Find(ctx, "product_id = ?", productID)
+	variants, err := s.variantRepo.Find(ctx, "product_id = ?", productID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachVariantMedia(ctx, variants); err != nil {
+		return nil, err
+	}
+	return variants, nil
 }
 
 func (s *CatalogServiceImpl) CreateProduct(ctx context.Context, product *domain.Product) error {
@@ -81,6 +202,21 @@ func (s *CatalogServiceImpl) UpdateProduct(ctx context.Context, id int, req dto.
 	if req.WeightKG != nil {
 		product.WeightKG = req.WeightKG
 	}
+	if req.HeightCM != nil {
+		product.HeightCM = req.HeightCM
+	}
+	if req.WidthCM != nil {
+		product.WidthCM = req.WidthCM
+	}
+	if req.DepthCM != nil {
+		product.DepthCM = req.DepthCM
+	}
+	if req.IsLivePlant != nil {
+		product.IsLivePlant = *req.IsLivePlant
+	}
+	if req.IsGiftCard != nil {
+		product.IsGiftCard = *req.IsGiftCard
+	}
 
 	if req.CategoryID != nil {
 		product.CategoryID = req.CategoryID
@@ -120,6 +256,22 @@ func (s *CatalogServiceImpl) UpdateVariants(ctx context.Context, productID int,
 
 	for _, v := range variants {
 		v.ProductID = productID
+		if err := checkAvailability(&v); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Hand-entered barcodes (supplier EANs) are validated up front; blank ones
+		// get an internal code once the variant has an ID.
+		manual := v.Barcode != nil && barcode.Normalize(*v.Barcode) != ""
+		if manual {
+			if err := s.validateVariantBarcode(tx, &v); err != nil {
+				tx.Rollback()
+				return err
+			}
+		} else {
+			v.Barcode = nil
+		}
 
 		if v.ID != 0 {
 
@@ -128,16 +280,424 @@ func (s *CatalogServiceImpl) UpdateVariants(ctx context.Context, productID int,
 				return err
 			}
 		} else {
+			// GORM writes the is_active column default in place of false
+			active := v.IsActive
 			if err := tx.Create(&v).Error; err != nil {
 				tx.Rollback()
 				return err
 			}
+			if !active {
+				if err := tx.Model(&v).Update("is_active", false).Error; err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+		}
+
+		if !manual {
+			symbology := domain.BarcodeEAN13
+			if v.BarcodeType != nil {
+				symbology = *v.BarcodeType
+			}
+			if err := s.assignInternalBarcode(tx, &v, symbology); err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
 	}
 
 	return tx.Commit().Error
 }
 
+// checkAvailability validates a variant's availability mode. Only pre-orders
+// take a deposit; other modes are paid in full.
+func checkAvailability(v *domain.ProductVariant) error {
+	switch v.Availability {
+	case domain.AvailabilityInStock, domain.AvailabilityBackorder:
+		v.DepositPercent = 100
+	case domain.AvailabilityPreorder:
+		if v.DepositPercent <= 0 || v.DepositPercent > 100 {
+			return fmt.Errorf("deposit percent of %s must be above 0 and at most 100", v.SKU)
+		}
+	default:
+		return fmt.Errorf("unknown availability %q for %s", v.Availability, v.SKU)
+	}
+	if v.Availability != domain.AvailabilityInStock && !v.StockControl {
+		return fmt.Errorf("%s is not stock-controlled, so it cannot be backordered or pre-ordered", v.SKU)
+	}
+	return nil
+}
+
+func (s *CatalogServiceImpl) AssignBarcodes(ctx context.Context, productID int, symbology domain.BarcodeSymbology) ([]domain.ProductVariant, error) {
+	if symbology == "" {
+		symbology = domain.BarcodeEAN13
+	}
+
+	var variants []domain.ProductVariant
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ? AND (barcode IS NULL OR barcode = '')", productID).
+			Find(&variants).Error; err != nil {
+			return err
+		}
+
+		for i := range variants {
+			if err := s.assignInternalBarcode(tx, &variants[i], symbology); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (s *CatalogServiceImpl) validateVariantBarcode(tx *gorm.DB, v *domain.ProductVariant) error {
+	code := barcode.Normalize(*v.Barcode)
+	symbology := barcode.Detect(code)
+	if v.BarcodeType != nil && *v.BarcodeType != "" {
+		symbology = *v.BarcodeType
+	}
+	if err := barcode.Validate(code, symbology); err != nil {
+		return fmt.Errorf("variant %s: %w", v.SKU, err)
+	}
+
+	// Internal EANs encode a variant ID; reject one pointing at a different variant
+	if symbology == domain.BarcodeEAN13 && strings.HasPrefix(code, barcode.InternalPrefix) && v.ID != 0 {
+		if expected, _ := barcode.InternalEAN13(v.ID); expected != code {
+			return fmt.Errorf("variant %s: barcode %s is in the internal range reserved for generated codes", v.SKU, code)
+		}
+	}
+
+	if err := s.ensureBarcodeUnique(tx, code, v.ID); err != nil {
+		return err
+	}
+
+	v.Barcode = &code
+	v.BarcodeType = &symbology
+	return nil
+}
+
+func (s *CatalogServiceImpl) assignInternalBarcode(tx *gorm.DB, v *domain.ProductVariant, symbology domain.BarcodeSymbology) error {
+	var code string
+	var err error
+	switch symbology {
+	case domain.BarcodeEAN13:
+		code, err = barcode.InternalEAN13(v.ID)
+	case domain.BarcodeCode128:
+		code, err = barcode.InternalCode128(v.SKU)
+	default:
+		err = fmt.Errorf("unsupported barcode symbology %q", symbology)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensureBarcodeUnique(tx, code, v.ID); err != nil {
+		return err
+	}
+
+	v.Barcode = &code
+	v.BarcodeType = &symbology
+	return tx.Model(&domain.ProductVariant{}).Where("id = ?", v.ID).
+		Updates(map[string]interface{}{"barcode": code, "barcode_type": symbology}).Error
+}
+
+func (s *CatalogServiceImpl) ensureBarcodeUnique(tx *gorm.DB, code string, variantID int) error {
+	var count int64
+	if err := tx.Model(&domain.ProductVariant{}).
+		Where("barcode = ? AND id <> ?", code, variantID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("barcode %s is already assigned to another variant", code)
+	}
+	return nil
+}
+
+func (s *CatalogServiceImpl) GetProductOptions(ctx context.Context, productID int) ([]domain.ProductOption, error) {
+	var options []domain.ProductOption
+	err := s.db.WithContext(ctx).
+		Preload("Values", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Where("product_id = ?", productID).
+		Order("position, id").
+		Find(&options).Error
+	return options, err
+}
+
+func (s *CatalogServiceImpl) SetProductOptions(ctx context.Context, productID int, options []domain.ProductOption) ([]domain.ProductOption, error) {
+	seen := make(map[string]bool)
+	for i := range options {
+		opt := &options[i]
+		opt.Name = strings.TrimSpace(opt.Name)
+		if opt.Name == "" {
+			return nil, errors.New("option name is required")
+		}
+		if seen[strings.ToLower(opt.Name)] {
+			return nil, fmt.Errorf("duplicate option %q", opt.Name)
+		}
+		seen[strings.ToLower(opt.Name)] = true
+
+		if len(opt.Values) == 0 {
+			return nil, fmt.Errorf("option %q needs at least one value", opt.Name)
+		}
+		values := make(map[string]bool)
+		for j := range opt.Values {
+			val := &opt.Values[j]
+			val.Value = strings.TrimSpace(val.Value)
+			if val.Value == "" || values[strings.ToLower(val.Value)] {
+				return nil, fmt.Errorf("option %q has an empty or duplicate value", opt.Name)
+			}
+			values[strings.ToLower(val.Value)] = true
+			if val.Code == "" {
+				val.Code = optionCode(val.Value)
+			}
+			val.ID = 0
+			val.Position = j
+		}
+		opt.ID = 0
+		opt.ProductID = productID
+		opt.Position = i
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.productRepo.FindByID(ctx, productID); err != nil {
+			return err
+		}
+		// Definitions only; variants keep their attributes so stock history is untouched
+		if err := tx.Where("option_id IN (?)", tx.Model(&domain.ProductOption{}).
+			Select("id").Where("product_id = ?", productID)).
+			Delete(&domain.ProductOptionValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", productID).Delete(&domain.ProductOption{}).Error; err != nil {
+			return err
+		}
+		if len(options) == 0 {
+			return nil
+		}
+		return tx.Create(&options).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// matrixCombo is one cell of the variant matrix.
+type matrixCombo struct {
+	key    string
+	values []domain.ProductOptionValue
+}
+
+func (s *CatalogServiceImpl) GenerateVariants(ctx context.Context, productID int, req dto.GenerateVariantsRequest) (*dto.VariantMatrixResult, error) {
+	product, err := s.productRepo.FindByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := s.GetProductOptions(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return nil, errors.New("product has no options defined")
+	}
+
+	basePrice := product.BasePrice
+	if req.BasePrice != nil {
+		if *req.BasePrice < 0 {
+			return nil, errors.New("price cannot be negative")
+		}
+		basePrice = *req.BasePrice
+	}
+
+	pattern := req.SKUPattern
+	if pattern == "" {
+		pattern = "{sku}"
+		for _, opt := range options {
+			pattern += "-{" + opt.Name + "}"
+		}
+	}
+
+	combos := buildMatrix(options)
+	result := &dto.VariantMatrixResult{
+		Created:     []domain.ProductVariant{},
+		Reactivated: []domain.ProductVariant{},
+		Deactivated: []domain.ProductVariant{},
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []domain.ProductVariant
+		if err := tx.Where("product_id = ? AND deleted_at IS NULL", productID).
+			Order("id").Find(&existing).Error; err != nil {
+			return err
+		}
+
+		byKey := make(map[string]*domain.ProductVariant)
+		skus := make(map[string]bool)
+		for i := range existing {
+			skus[existing[i].SKU] = true
+			if key, ok := variantKey(existing[i], options); ok {
+				if _, dup := byKey[key]; !dup {
+					byKey[key] = &existing[i]
+				}
+			}
+		}
+
+		wanted := make(map[string]bool, len(combos))
+		for _, combo := range combos {
+			wanted[combo.key] = true
+
+			if v, ok := byKey[combo.key]; ok {
+				if v.IsActive {
+					result.Unchanged++
+					continue
+				}
+				v.IsActive = true
+				result.Reactivated = append(result.Reactivated, *v)
+				if req.DryRun {
+					continue
+				}
+				if err := tx.Model(v).Update("is_active", true).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			v := newMatrixVariant(product, options, combo, pattern, basePrice)
+			if skus[v.SKU] {
+				return fmt.Errorf("generated SKU %s is already used by another variant; adjust sku_pattern or option codes", v.SKU)
+			}
+			skus[v.SKU] = true
+
+			if !req.DryRun {
+				if err := tx.Create(&v).Error; err != nil {
+					return err
+				}
+				if err := s.assignInternalBarcode(tx, &v, domain.BarcodeEAN13); err != nil {
+					return err
+				}
+			}
+			result.Created = append(result.Created, v)
+		}
+
+		for i := range existing {
+			v := &existing[i]
+			key, ok := variantKey(*v, options)
+			if (ok && wanted[key] && byKey[key] == v) || !v.IsActive {
+				continue
+			}
+			v.IsActive = false
+			result.Deactivated = append(result.Deactivated, *v)
+			if req.DryRun {
+				continue
+			}
+			if err := tx.Model(v).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// buildMatrix returns the cartesian product of all option values in option order.
+func buildMatrix(options []domain.ProductOption) []matrixCombo {
+	combos := []matrixCombo{{}}
+	for _, opt := range options {
+		var next []matrixCombo
+		for _, combo := range combos {
+			for _, val := range opt.Values {
+				values := append(append([]domain.ProductOptionValue{}, combo.values...), val)
+				next = append(next, matrixCombo{values: values})
+			}
+		}
+		combos = next
+	}
+
+	for i := range combos {
+		parts := make([]string, len(combos[i].values))
+		for j, val := range combos[i].values {
+			parts[j] = strings.ToLower(val.Value)
+		}
+		combos[i].key = strings.Join(parts, "\x1f")
+	}
+	return combos
+}
+
+// variantKey reads a variant's attributes back into a matrix key; ok is false
+// when the variant lacks one of the current options.
+func variantKey(v domain.ProductVariant, options []domain.ProductOption) (string, bool) {
+	parts := make([]string, len(options))
+	for i, opt := range options {
+		var raw interface{}
+		found := false
+		for k, val := range v.Attributes {
+			if strings.EqualFold(k, opt.Name) {
+				raw, found = val, true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+		parts[i] = strings.ToLower(strings.TrimSpace(fmt.Sprint(raw)))
+	}
+	return strings.Join(parts, "\x1f"), true
+}
+
+func newMatrixVariant(product *domain.Product, options []domain.ProductOption, combo matrixCombo, pattern string, basePrice float64) domain.ProductVariant {
+	attrs := make(map[string]interface{}, len(options))
+	names := make([]string, len(options))
+	price := basePrice
+	sku := strings.ReplaceAll(pattern, "{sku}", product.SKU)
+
+	for i, opt := range options {
+		val := combo.values[i]
+		attrs[opt.Name] = val.Value
+		names[i] = val.Value
+		price += val.PriceDelta
+		sku = replaceToken(sku, opt.Name, val.Code)
+	}
+	if price < 0 {
+		price = 0
+	}
+
+	name := strings.Join(names, " / ")
+	return domain.ProductVariant{
+		ProductID:    product.ID,
+		SKU:          strings.ToUpper(sku),
+		Name:         &name,
+		Attributes:   attrs,
+		Price:        price,
+		StockControl: true,
+		IsActive:     true,
+	}
+}
+
+// replaceToken substitutes {name} case-insensitively.
+func replaceToken(pattern, name, value string) string {
+	re := regexp.MustCompile(`(?i)\{` + regexp.QuoteMeta(name) + `\}`)
+	return re.ReplaceAllLiteralString(pattern, value)
+}
+
+var nonCodeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// optionCode derives a short SKU fragment from an option value ("15 cm" -> "15CM").
+func optionCode(value string) string {
+	code := strings.ToUpper(nonCodeChars.ReplaceAllString(value, ""))
+	if len(code) > 10 {
+		code = code[:10]
+	}
+	return code
+}
+
 func (s *CatalogServiceImpl) SoftDeleteProduct(ctx context.Context, id int) error {
 	return s.productRepo.SoftDelete(ctx, id)
 }
@@ -162,26 +722,207 @@ func (s *CatalogServiceImpl) ForceDeleteVariant(ctx context.Context, id int) err
 	return s.variantRepo.ForceDelete(ctx, id)
 }
 
-func (s *CatalogServiceImpl) ImportProducts(ctx context.Context, data []byte) error {
-	var products []domain.Product
-	if err := json.Unmarshal(data, &products); err != nil {
-		return err
+var localeColumn = regexp.MustCompile(`^(name|description)\[([a-z]{2,3})\]$`)
+
+var productCSVColumns = []string{"sku", "slug", "name", "description", "category_id", "supplier_id", "base_price", "tax_class", "weight_kg", "is_active"}
+
+// ImportProducts upserts products by SKU from a CSV export.
+// Empty cells leave the existing value untouched.
+func (s *CatalogServiceImpl) ImportProducts(ctx context.Context, data []byte) (int, int, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid csv: %w", err)
+	}
+	if len(rows) < 2 {
+		return 0, 0, errors.New("csv has no data rows")
 	}
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&products).Error; err != nil {
-			return err
+	header := make(map[string]int)
+	for i, col := range rows[0] {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if m := localeColumn.FindStringSubmatch(col); m != nil && !i18n.IsSupported(m[2]) {
+			return 0, 0, fmt.Errorf("column %q: unsupported locale %q", col, m[2])
+		}
+		header[col] = i
+	}
+	if _, ok := header["sku"]; !ok {
+		return 0, 0, errors.New("csv must contain a sku column")
+	}
+
+	created, updated := 0, 0
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for n, row := range rows[1:] {
+			line := n + 2
+			cell := func(col string) string {
+				if i, ok := header[col]; ok && i < len(row) {
+					return strings.TrimSpace(row[i])
+				}
+				return ""
+			}
+
+			sku := cell("sku")
+			if sku == "" {
+				return fmt.Errorf("line %d: sku is required", line)
+			}
+
+			var product domain.Product
+			err := tx.Where("sku = ?", sku).First(&product).Error
+			isNew := errors.Is(err, gorm.ErrRecordNotFound)
+			if err != nil && !isNew {
+				return err
+			}
+			if isNew {
+				product = domain.Product{SKU: sku, IsActive: true}
+			}
+
+			if err := applyProductCSVRow(&product, cell); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if product.Name == "" || product.Slug == "" {
+				return fmt.Errorf("line %d: name and slug are required for new products", line)
+			}
+
+			if err := tx.Save(&product).Error; err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if isNew {
+				created++
+			} else {
+				updated++
+			}
+
+			for _, locale := range i18n.Translatable() {
+				name := cell("name[" + locale + "]")
+				desc := cell("description[" + locale + "]")
+				if name == "" && desc == "" {
+					continue
+				}
+				t := domain.ProductTranslation{ProductID: product.ID, Locale: locale}
+				if err := tx.Where(&t).Limit(1).Find(&t).Error; err != nil {
+					return err
+				}
+				if name != "" {
+					t.Name = name
+				}
+				if desc != "" {
+					t.Description = &desc
+				}
+				if t.Name == "" {
+					return fmt.Errorf("line %d: name[%s] is required for a new translation", line, locale)
+				}
+				t.UpdatedAt = time.Now()
+				if err := tx.Save(&t).Error; err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+func applyProductCSVRow(p *domain.Product, cell func(string) string) error {
+	if v := cell("name"); v != "" {
+		p.Name = v
+	}
+	if v := cell("slug"); v != "" {
+		p.Slug = v
+	}
+	if v := cell("description"); v != "" {
+		p.Description = &v
+	}
+	if v := cell("tax_class"); v != "" {
+		p.TaxClass = &v
+	}
+	if v := cell("category_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid category_id %q", v)
+		}
+		p.CategoryID = &id
+	}
+	if v := cell("supplier_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid supplier_id %q", v)
+		}
+		p.SupplierID = &id
+	}
+	if v := cell("base_price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			return fmt.Errorf("invalid base_price %q", v)
+		}
+		p.BasePrice = price
+	}
+	if v := cell("weight_kg"); v != "" {
+		weight, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid weight_kg %q", v)
+		}
+		p.WeightKG = &weight
+	}
+	if v := cell("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid is_active %q", v)
+		}
+		p.IsActive = active
+	}
+	return nil
 }
 
 func (s *CatalogServiceImpl) ExportProducts(ctx context.Context) ([]byte, error) {
-	products, err := s.productRepo.FindAll(ctx)
-	if err != nil {
+	var products []domain.Product
+	if err := s.db.WithContext(ctx).Preload("Translations").Order("id ASC").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	locales := i18n.Translatable()
+	header := append([]string{}, productCSVColumns...)
+	for _, l := range locales {
+		header = append(header, "name["+l+"]", "description["+l+"]")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
 		return nil, err
 	}
-	return json.Marshal(products)
+
+	for _, p := range products {
+		row := []string{
+			p.SKU,
+			p.Slug,
+			p.Name,
+			derefString(p.Description),
+			formatIntPtr(p.CategoryID),
+			formatIntPtr(p.SupplierID),
+			strconv.FormatFloat(p.BasePrice, 'f', 2, 64),
+			derefString(p.TaxClass),
+			formatFloatPtr(p.WeightKG),
+			strconv.FormatBool(p.IsActive),
+		}
+		byLocale := make(map[string]domain.ProductTranslation, len(p.Translations))
+		for _, t := range p.Translations {
+			byLocale[t.Locale] = t
+		}
+		for _, l := range locales {
+			t := byLocale[l]
+			row = append(row, t.Name, derefString(t.Description))
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
 }
 
 // Tags
@@ -219,3 +960,177 @@ func (s *CatalogServiceImpl) UpdateProductTags(ctx context.Context, productID in
 		return nil
 	})
 }
+
+// Translations
+func (s *CatalogServiceImpl) GetProductTranslations(ctx context.Context, productID int) ([]domain.ProductTranslation, error) {
+	return s.translationRepo.FindProductTranslations(ctx, "", []int{productID})
+}
+
+func (s *CatalogServiceImpl) SaveProductTranslation(ctx context.Context, t *domain.ProductTranslation) error {
+	if err := validateTranslationLocale(t.Locale); err != nil {
+		return err
+	}
+	if t.Name == "" {
+		return errors.New("translated name is required")
+	}
+	if _, err := s.productRepo.FindByID(ctx, t.ProductID); err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+	return s.translationRepo.SaveProductTranslation(ctx, t)
+}
+
+func (s *CatalogServiceImpl) DeleteProductTranslation(ctx context.Context, productID int, locale string) error {
+	return s.translationRepo.DeleteProductTranslation(ctx, productID, locale)
+}
+
+func (s *CatalogServiceImpl) GetCategoryTranslations(ctx context.Context, categoryID int) ([]domain.CategoryTranslation, error) {
+	return s.translationRepo.FindCategoryTranslations(ctx, "", []int{categoryID})
+}
+
+func (s *CatalogServiceImpl) SaveCategoryTranslation(ctx context.Context, t *domain.CategoryTranslation) error {
+	if err := validateTranslationLocale(t.Locale); err != nil {
+		return err
+	}
+	if t.Name == "" {
+		return errors.New("translated name is required")
+	}
+	if _, err := s.categoryRepo.FindByID(ctx, t.CategoryID); err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+	return s.translationRepo.SaveCategoryTranslation(ctx, t)
+}
+
+func (s *CatalogServiceImpl) DeleteCategoryTranslation(ctx context.Context, categoryID int, locale string) error {
+	return s.translationRepo.DeleteCategoryTranslation(ctx, categoryID, locale)
+}
+
+func (s *CatalogServiceImpl) GetTagTranslations(ctx context.Context, tagID int) ([]domain.TagTranslation, error) {
+	return s.translationRepo.FindTagTranslations(ctx, "", []int{tagID})
+}
+
+func (s *CatalogServiceImpl) SaveTagTranslation(ctx context.Context, t *domain.TagTranslation) error {
+	if err := validateTranslationLocale(t.Locale); err != nil {
+		return err
+	}
+	if t.DisplayName == "" {
+		return errors.New("translated display name is required")
+	}
+	if _, err := s.tagRepo.FindByID(ctx, t.TagID); err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+	return s.translationRepo.SaveTagTranslation(ctx, t)
+}
+
+func (s *CatalogServiceImpl) DeleteTagTranslation(ctx context.Context, tagID int, locale string) error {
+	return s.translationRepo.DeleteTagTranslation(ctx, tagID, locale)
+}
+
+func validateTranslationLocale(locale string) error {
+	if !i18n.IsSupported(locale) {
+		return fmt.Errorf("unsupported locale %q", locale)
+	}
+	if locale == i18n.Default() {
+		return errors.New("the default locale is edited on the entity itself")
+	}
+	return nil
+}
+
+// translateProducts overlays the locale's text on products and their category and tags.
+// Untranslated fields keep the default-locale value.
+func (s *CatalogServiceImpl) translateProducts(ctx context.Context, locale string, products []domain.Product) error {
+	if locale == "" || locale == i18n.Default() || len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(products))
+	var categories []*domain.Category
+	var tags []*domain.Tag
+	for i := range products {
+		ids[i] = products[i].ID
+		if products[i].Category != nil {
+			categories = append(categories, products[i].Category)
+		}
+		for j := range products[i].Tags {
+			tags = append(tags, &products[i].Tags[j])
+		}
+	}
+
+	translations, err := s.translationRepo.FindProductTranslations(ctx, locale, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]domain.ProductTranslation, len(translations))
+	for _, t := range translations {
+		byID[t.ProductID] = t
+	}
+	for i := range products {
+		if t, ok := byID[products[i].ID]; ok {
+			products[i].Name = t.Name
+			if t.Description != nil {
+				products[i].Description = t.Description
+			}
+		}
+	}
+
+	if err := s.translateCategories(ctx, locale, categories); err != nil {
+		return err
+	}
+	return s.translateTags(ctx, locale, tags)
+}
+
+func (s *CatalogServiceImpl) translateCategories(ctx context.Context, locale string, categories []*domain.Category) error {
+	if locale == "" || locale == i18n.Default() || len(categories) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(categories))
+	for i, c := range categories {
+		ids[i] = c.ID
+	}
+	translations, err := s.translationRepo.FindCategoryTranslations(ctx, locale, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]domain.CategoryTranslation, len(translations))
+	for _, t := range translations {
+		byID[t.CategoryID] = t
+	}
+	for _, c := range categories {
+		if t, ok := byID[c.ID]; ok {
+			c.Name = t.Name
+			if t.Description != nil {
+				c.Description = t.Description
+			}
+		}
+	}
+	return nil
+}
+
+func (s *CatalogServiceImpl) translateTags(ctx context.Context, locale string, tags []*domain.Tag) error {
+	if locale == "" || locale == i18n.Default() || len(tags) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(tags))
+	for i, t := range tags {
+		ids[i] = t.ID
+	}
+	translations, err := s.translationRepo.FindTagTranslations(ctx, locale, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]domain.TagTranslation, len(translations))
+	for _, t := range translations {
+		byID[t.TagID] = t
+	}
+	for _, tag := range tags {
+		if t, ok := byID[tag.ID]; ok {
+			name := t.DisplayName
+			tag.DisplayName = &name
+		}
+	}
+	return nil
+}
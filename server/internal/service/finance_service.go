@@ -2,20 +2,68 @@ package service
 
 import (
 	"context"
+	"errors"
 	"server/internal/core/domain"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FinanceServiceImpl struct {
-	// Dependencies
+	db *gorm.DB
 }
 
-func NewFinanceService() FinanceService {
-	return &FinanceServiceImpl{}
+func NewFinanceService(db *gorm.DB) FinanceService {
+	return &FinanceServiceImpl{db: db}
 }
 
+// GenerateInvoice issues the customer invoice of an order, copying the tax
+// computed on its lines. Calling it again returns the existing invoice. The
+// order row is locked while checking, so concurrent calls issue one invoice
+// and take one number from the series.
 func (s *FinanceServiceImpl) GenerateInvoice(ctx context.Context, orderID int) (*domain.Invoice, error) {
-	// TODO: Implement logic
-	return nil, nil
+	var invoice domain.Invoice
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order domain.SalesOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("sales_order_id = ? AND type = ?", orderID, domain.InvoiceCustomer).First(&invoice).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		now := time.Now()
+		invoice = domain.Invoice{
+			Type:           domain.InvoiceCustomer,
+			SalesOrderID:   &order.ID,
+			IssuedAt:       now,
+			DueAt:          now,
+			TaxAmount:      order.TaxAmount,
+			TotalAmount:    order.TotalAmount,
+			AmountResidual: order.TotalAmount,
+			Status:         domain.InvoicePosted,
+		}
+		if order.PaymentStatus == domain.PaymentPaid {
+			invoice.AmountResidual = 0
+			invoice.Status = domain.InvoicePaid
+		}
+		number, err := nextDocumentNumber(tx, domain.DocInvoice, "")
+		if err != nil {
+			return err
+		}
+		invoice.InvoiceNumber = &number
+		return tx.Create(&invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
 }
 
 func (s *FinanceServiceImpl) RecordPayment(ctx context.Context, invoiceID int, amount float64, method string) error {
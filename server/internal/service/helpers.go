@@ -0,0 +1,70 @@
+package service
+
+import (
+	"math"
+	"os"
+	"server/internal/core/domain"
+	"strconv"
+	"strings"
+)
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatIntPtr(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatFloatPtr(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// roundMoney rounds an amount to cents.
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// formatRupiah renders an IDR amount the way it is printed on tags: "Rp 125.000".
+func formatRupiah(amount float64) string {
+	digits := strconv.FormatInt(int64(math.Round(math.Abs(amount))), 10)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, '.')
+		}
+		out = append(out, digits[i])
+	}
+	if amount < 0 {
+		return "-Rp " + string(out)
+	}
+	return "Rp " + string(out)
+}
+
+// productURL links to a product page on the storefront.
+func productURL(slug string) string {
+	return storefrontURL("/products/" + slug)
+}
+
+// storefrontURL links to a storefront page (STOREFRONT_URL).
+func storefrontURL(path string) string {
+	return strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/") + path
+}
+
+// variantPrice is the selling price of a variant; zero falls back to the
+// product's base price.
+func variantPrice(v *domain.ProductVariant) float64 {
+	if v.Price == 0 && v.Product != nil {
+		return v.Product.BasePrice
+	}
+	return v.Price
+}
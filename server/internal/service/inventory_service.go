@@ -8,18 +8,31 @@ import (
 	"server/internal/dto"
 	"server/internal/repository"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrInsufficientStock is returned when a movement or reservation needs more
+// than is available.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type InventoryServiceImpl struct {
 	stockRepo    repository.Repository[domain.Stock]
 	movementRepo repository.Repository[domain.StockMovement]
 	locationRepo repository.Repository[domain.InventoryLocation]
 	db           *gorm.DB // Needed for transaction
+
+	mu               sync.RWMutex
+	restockListeners []RestockListener
 }
 
+// stockBaseline remembers each variant's total on hand before a ledger
+// transaction first touched it, so restock listeners fire once after commit.
+type stockBaseline map[int]int
+
 func NewInventoryService(stockRepo repository.Repository[domain.Stock], movementRepo repository.Repository[domain.StockMovement], locationRepo repository.Repository[domain.InventoryLocation], db *gorm.DB) InventoryService {
 	return &InventoryServiceImpl{
 		stockRepo:    stockRepo,
@@ -29,18 +42,48 @@ func NewInventoryService(stockRepo repository.Repository[domain.Stock], movement
 	}
 }
 
-func (s *InventoryServiceImpl) TransferStock(ctx context.Context, variantID, qty, fromLocID, toLocID, userID int) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+func (s *InventoryServiceImpl) OnRestock(listener RestockListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restockListeners = append(s.restockListeners, listener)
+}
+
+// TransferStock moves stock between locations under a numbered transfer
+// document, numbered by the source location.
+func (s *InventoryServiceImpl) TransferStock(ctx context.Context, variantID, qty, fromLocID, toLocID, userID int) (*domain.StockTransfer, error) {
+	baseline := stockBaseline{}
+	defer s.fireRestocked(baseline)
+
+	transfer := &domain.StockTransfer{
+		VariantID:      variantID,
+		FromLocationID: fromLocID,
+		ToLocationID:   toLocID,
+		Quantity:       qty,
+		CreatedBy:      &userID,
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		code, err := locationCode(tx, fromLocID)
+		if err != nil {
+			return err
+		}
+		if transfer.TransferNumber, err = nextDocumentNumber(tx, domain.DocTransfer, code); err != nil {
+			return err
+		}
+		if err := tx.Create(transfer).Error; err != nil {
+			return err
+		}
+
 		// 1. Deduct from Source
 		deductCmd := StockMoveCmd{
 			LocationID:    fromLocID,
 			VariantID:     variantID,
 			QtyChange:     -qty,
 			Reason:        domain.ReasonTransfer,
+			ReferenceID:   transfer.ID,
 			ReferenceType: "TRANSFER",
 			UserID:        userID,
 		}
-		if err := s.executeMovementTx(tx, deductCmd); err != nil {
+		if err := s.executeMovementTx(tx, deductCmd, baseline); err != nil {
 			return err
 		}
 
@@ -50,15 +93,20 @@ func (s *InventoryServiceImpl) TransferStock(ctx context.Context, variantID, qty
 			VariantID:     variantID,
 			QtyChange:     qty,
 			Reason:        domain.ReasonTransfer,
+			ReferenceID:   transfer.ID,
 			ReferenceType: "TRANSFER",
 			UserID:        userID,
 		}
-		if err := s.executeMovementTx(tx, addCmd); err != nil {
+		if err := s.executeMovementTx(tx, addCmd, baseline); err != nil {
 			return err
 		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
 }
 
 func (s *InventoryServiceImpl) GetStockLevel(ctx context.Context, variantID, locationID int) (int, error) {
@@ -66,13 +114,16 @@ func (s *InventoryServiceImpl) GetStockLevel(ctx context.Context, variantID, loc
 	if err != nil {
 		return 0, err
 	}
-	return stock.Quantity, nil
+	return stock.Quantity - stock.Reserved, nil
 }
 
 func (s *InventoryServiceImpl) BulkAdjustStock(ctx context.Context, cmds []StockMoveCmd) error {
+	baseline := stockBaseline{}
+	defer s.fireRestocked(baseline)
+
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		for _, cmd := range cmds {
-			if err := s.executeMovementTx(tx, cmd); err != nil {
+			if err := s.executeMovementTx(tx, cmd, baseline); err != nil {
 				return err
 			}
 		}
@@ -81,7 +132,15 @@ func (s *InventoryServiceImpl) BulkAdjustStock(ctx context.Context, cmds []Stock
 }
 
 // Helper to execute movement within a transaction
-func (s *InventoryServiceImpl) executeMovementTx(tx *gorm.DB, cmd StockMoveCmd) error {
+func (s *InventoryServiceImpl) executeMovementTx(tx *gorm.DB, cmd StockMoveCmd, baseline stockBaseline) error {
+	if _, seen := baseline[cmd.VariantID]; !seen {
+		total, err := totalAvailable(tx, cmd.VariantID)
+		if err != nil {
+			return err
+		}
+		baseline[cmd.VariantID] = total
+	}
+
 	// 1. Create Movement
 	movement := &domain.StockMovement{
 		LocationID:     cmd.LocationID,
@@ -97,13 +156,14 @@ func (s *InventoryServiceImpl) executeMovementTx(tx *gorm.DB, cmd StockMoveCmd)
 		return err
 	}
 
-	// 2. Update Stock
+	// 2. Update Stock; the row lock keeps concurrent reservations intact
 	var stock domain.Stock
-	err := tx.Where("location_id = ? AND variant_id = ?", cmd.LocationID, cmd.VariantID).First(&stock).Error
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("location_id = ? AND variant_id = ?", cmd.LocationID, cmd.VariantID).First(&stock).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			if cmd.QtyChange < 0 {
-				return errors.New("insufficient stock")
+				return ErrInsufficientStock
 			}
 			stock = domain.Stock{
 				LocationID: cmd.LocationID,
@@ -119,26 +179,64 @@ func (s *InventoryServiceImpl) executeMovementTx(tx *gorm.DB, cmd StockMoveCmd)
 		return err
 	}
 
-	newQty := stock.Quantity + cmd.QtyChange
-	if newQty < 0 {
-		return errors.New("insufficient stock")
-	}
-
-	stock.Quantity = newQty
-	stock.UpdatedAt = time.Now()
-	if err := tx.Save(&stock).Error; err != nil {
-		return err
+	// Outgoing movements may not take units that are reserved for orders
+	if cmd.QtyChange < 0 && stock.Quantity+cmd.QtyChange < stock.Reserved {
+		return ErrInsufficientStock
 	}
 
-	return nil
+	return tx.Model(&domain.Stock{}).
+		Where("location_id = ? AND variant_id = ?", cmd.LocationID, cmd.VariantID).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", cmd.QtyChange),
+			"updated_at": time.Now(),
+		}).Error
 }
 
 func (s *InventoryServiceImpl) ExecuteMovement(ctx context.Context, cmd StockMoveCmd) error {
+	baseline := stockBaseline{}
+	defer s.fireRestocked(baseline)
+
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		return s.executeMovementTx(tx, cmd)
+		return s.executeMovementTx(tx, cmd, baseline)
 	})
 }
 
+// fireRestocked runs after the ledger transaction has finished. Variants that
+// went from nothing available to available are handed to the listeners in the
+// background; a rolled-back transaction leaves totals unchanged and fires nothing.
+func (s *InventoryServiceImpl) fireRestocked(baseline stockBaseline) {
+	s.mu.RLock()
+	listeners := s.restockListeners
+	s.mu.RUnlock()
+	if len(listeners) == 0 {
+		return
+	}
+
+	for variantID, before := range baseline {
+		if before > 0 {
+			continue
+		}
+		after, err := totalAvailable(s.db, variantID)
+		if err != nil || after <= 0 {
+			continue
+		}
+		for _, listener := range listeners {
+			go listener(context.Background(), variantID, after)
+		}
+	}
+}
+
+// totalAvailable is the variant's available-to-sell quantity across
+// locations: on hand minus reserved.
+func totalAvailable(db *gorm.DB, variantID int) (int, error) {
+	var total int
+	err := db.Model(&domain.Stock{}).
+		Select("COALESCE(SUM(quantity - reserved), 0)").
+		Where("variant_id = ?", variantID).
+		Scan(&total).Error
+	return total, err
+}
+
 func (s *InventoryServiceImpl) GetMovements(ctx context.Context, variantID, locationID, page, limit int) ([]domain.StockMovement, error) {
 	offset := (page - 1) * limit
 	query := s.db.Model(&domain.StockMovement{}).Order("created_at DESC").Limit(limit).Offset(offset)
@@ -229,14 +327,207 @@ func (s *InventoryServiceImpl) ExportStockSnapshot(ctx context.Context) ([]byte,
 
 	// Generate CSV
 	var csvData strings.Builder
-	csvData.WriteString("Location ID,Location Name,Variant ID,Variant Name,Quantity,Safety Stock\n")
+	csvData.WriteString("Location ID,Location Name,Variant ID,Variant Name,Quantity,Reserved,Available,Safety Stock\n")
 
 	for _, stock := range stocks {
 		locationName := stock.Location.Name
-		variantName := stock.Variant.Name
-		csvData.WriteString(fmt.Sprintf("%d,%s,%d,%s,%d,%d\n",
-			stock.LocationID, locationName, stock.VariantID, variantName, stock.Quantity, stock.SafetyStock))
+		variantName := derefString(stock.Variant.Name)
+		csvData.WriteString(fmt.Sprintf("%d,%s,%d,%s,%d,%d,%d,%d\n",
+			stock.LocationID, locationName, stock.VariantID, variantName,
+			stock.Quantity, stock.Reserved, stock.Quantity-stock.Reserved, stock.SafetyStock))
 	}
 
 	return []byte(csvData.String()), nil
 }
+
+// reserveStockTx holds stock for every stock-controlled line of order, taking
+// from the locations with the most available first. Stock rows are locked and
+// variants visited in ID order, so concurrent checkouts cannot both take the
+// last unit and cannot deadlock. Backorder and pre-order variants hold what
+// there is and leave the rest of the line waiting on stock.
+func reserveStockTx(tx *gorm.DB, order *domain.SalesOrder, expiresAt time.Time) error {
+	quantities := make(map[int]int, len(order.Items))
+	for _, item := range order.Items {
+		quantities[item.VariantID] += item.Quantity
+	}
+	ids := make([]int, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var controlled []domain.ProductVariant
+	if err := tx.Select("id", "availability", "expected_at").
+		Where("id IN ? AND stock_control = ?", ids, true).
+		Order("id").
+		Find(&controlled).Error; err != nil {
+		return err
+	}
+
+	for _, v := range controlled {
+		variantID := v.ID
+		need := quantities[variantID]
+
+		var stocks []domain.Stock
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("variant_id = ? AND quantity > reserved", variantID).
+			Order("quantity - reserved DESC, location_id").
+			Find(&stocks).Error; err != nil {
+			return err
+		}
+
+		for _, st := range stocks {
+			if need == 0 {
+				break
+			}
+			take := min(need, st.Quantity-st.Reserved)
+			if err := tx.Model(&domain.Stock{}).
+				Where("location_id = ? AND variant_id = ?", st.LocationID, variantID).
+				Updates(map[string]interface{}{"reserved": gorm.Expr("reserved + ?", take), "updated_at": time.Now()}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&domain.StockReservation{
+				SalesOrderID: order.ID,
+				LocationID:   st.LocationID,
+				VariantID:    variantID,
+				Quantity:     take,
+				Status:       domain.ReservationActive,
+				ExpiresAt:    expiresAt,
+			}).Error; err != nil {
+				return err
+			}
+			need -= take
+		}
+		if need > 0 {
+			if v.Availability == domain.AvailabilityInStock || v.Availability == "" {
+				return fmt.Errorf("%w: only %d of variant %d available", ErrInsufficientStock, quantities[variantID]-need, variantID)
+			}
+			if err := backorderTx(tx, order, v, need); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseReservationsTx gives an order's active reservations back to
+// available stock.
+func releaseReservationsTx(tx *gorm.DB, orderID int) error {
+	reservations, err := activeReservations(tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reservations {
+		if err := tx.Model(&domain.Stock{}).
+			Where("location_id = ? AND variant_id = ?", r.LocationID, r.VariantID).
+			Updates(map[string]interface{}{"reserved": gorm.Expr("GREATEST(reserved - ?, 0)", r.Quantity), "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+	}
+	return markReservations(tx, reservations, domain.ReservationReleased)
+}
+
+// convertReservationsTx turns an order's active reservations into SALE
+// movements, taking the units off hand.
+func convertReservationsTx(tx *gorm.DB, orderID int, userID *int) error {
+	reservations, err := activeReservations(tx, orderID)
+	if err != nil {
+		return err
+	}
+	refType := "sales_orders"
+	for _, r := range reservations {
+		res := tx.Model(&domain.Stock{}).
+			Where("location_id = ? AND variant_id = ? AND quantity >= ?", r.LocationID, r.VariantID, r.Quantity).
+			Updates(map[string]interface{}{
+				"quantity":   gorm.Expr("quantity - ?", r.Quantity),
+				"reserved":   gorm.Expr("GREATEST(reserved - ?, 0)", r.Quantity),
+				"updated_at": time.Now(),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Stock was adjusted below the reservation in the meantime
+			return fmt.Errorf("%w: variant %d at location %d", ErrInsufficientStock, r.VariantID, r.LocationID)
+		}
+		if err := tx.Create(&domain.StockMovement{
+			LocationID:     r.LocationID,
+			VariantID:      r.VariantID,
+			QuantityChange: -r.Quantity,
+			Reason:         string(domain.ReasonSale),
+			ReferenceType:  &refType,
+			ReferenceID:    &orderID,
+			CreatedBy:      userID,
+			CreatedAt:      time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return markReservations(tx, reservations, domain.ReservationConverted)
+}
+
+// restockOrderTx puts back what an order took off hand, at the locations its
+// SALE movements (converted reservations and backorder allocations) came
+// from. Earlier RETURN movements of the order are netted out.
+func restockOrderTx(tx *gorm.DB, orderID int, userID *int) error {
+	refType := "sales_orders"
+	var sold []struct {
+		LocationID int
+		VariantID  int
+		Quantity   int
+	}
+	if err := tx.Model(&domain.StockMovement{}).
+		Select("location_id, variant_id, -SUM(quantity_change) AS quantity").
+		Where("reference_type = ? AND reference_id = ? AND reason IN ?", refType, orderID,
+			[]string{string(domain.ReasonSale), string(domain.ReasonReturn)}).
+		Group("location_id, variant_id").
+		Having("SUM(quantity_change) < 0").
+		Order("variant_id, location_id").
+		Scan(&sold).Error; err != nil {
+		return err
+	}
+
+	for _, r := range sold {
+		if err := tx.Model(&domain.Stock{}).
+			Where("location_id = ? AND variant_id = ?", r.LocationID, r.VariantID).
+			Updates(map[string]interface{}{"quantity": gorm.Expr("quantity + ?", r.Quantity), "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&domain.StockMovement{
+			LocationID:     r.LocationID,
+			VariantID:      r.VariantID,
+			QuantityChange: r.Quantity,
+			Reason:         string(domain.ReasonReturn),
+			ReferenceType:  &refType,
+			ReferenceID:    &orderID,
+			CreatedBy:      userID,
+			CreatedAt:      time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func activeReservations(tx *gorm.DB, orderID int) ([]domain.StockReservation, error) {
+	var reservations []domain.StockReservation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("sales_order_id = ? AND status = ?", orderID, domain.ReservationActive).
+		Order("variant_id, location_id").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+func markReservations(tx *gorm.DB, reservations []domain.StockReservation, status domain.ReservationStatus) error {
+	if len(reservations) == 0 {
+		return nil
+	}
+	ids := make([]int, len(reservations))
+	for i, r := range reservations {
+		ids[i] = r.ID
+	}
+	return tx.Model(&domain.StockReservation{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()}).Error
+}
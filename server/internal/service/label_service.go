@@ -0,0 +1,358 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"strings"
+
+	bc "github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"github.com/go-pdf/fpdf"
+	"gorm.io/gorm"
+)
+
+const (
+	LabelFormatPDF = "pdf"
+	LabelFormatZPL = "zpl"
+
+	maxLabelsPerBatch = 2000
+
+	// Plant tag stock: 62 x 40 mm, printed at 203 dpi on the ZPL printers
+	labelWidthMM    = 62.0
+	labelHeightMM   = 40.0
+	labelWidthDots  = 496
+	labelHeightDots = 320
+)
+
+// Label is one printable tag; Copies repeats it without re-rendering.
+type Label struct {
+	VariantID   int
+	SKU         string
+	Name        string
+	Price       float64
+	Barcode     string
+	BarcodeType domain.BarcodeSymbology
+	CareURL     string
+	Copies      int
+}
+
+type LabelServiceImpl struct {
+	catalogService CatalogService
+	db             *gorm.DB
+}
+
+func NewLabelService(catalogService CatalogService, db *gorm.DB) LabelService {
+	if os.Getenv("STOREFRONT_URL") == "" {
+		log.Println("STOREFRONT_URL is not set: labels are printed without care QR codes")
+	}
+	return &LabelServiceImpl{
+		catalogService: catalogService,
+		db:             db,
+	}
+}
+
+func (s *LabelServiceImpl) RenderLabels(ctx context.Context, req dto.PrintLabelsRequest) ([]byte, error) {
+	labels, err := s.BuildLabels(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Format {
+	case LabelFormatZPL:
+		return renderZPL(labels), nil
+	case LabelFormatPDF, "":
+		return renderPDF(labels)
+	default:
+		return nil, fmt.Errorf("unsupported label format %q", req.Format)
+	}
+}
+
+func (s *LabelServiceImpl) BuildLabels(ctx context.Context, req dto.PrintLabelsRequest) ([]Label, error) {
+	sources := 0
+	if len(req.VariantIDs) > 0 {
+		sources++
+	}
+	if req.PurchaseOrderID != nil {
+		sources++
+	}
+	if req.LocationID != nil {
+		sources++
+	}
+	if sources != 1 {
+		return nil, errors.New("select labels by exactly one of variant_ids, purchase_order_id or location_id")
+	}
+
+	// variant ID -> number of copies, in print order
+	var order []int
+	copies := make(map[int]int)
+	add := func(variantID, qty int) {
+		if qty <= 0 {
+			return
+		}
+		if _, ok := copies[variantID]; !ok {
+			order = append(order, variantID)
+		}
+		copies[variantID] += qty
+	}
+
+	db := s.db.WithContext(ctx)
+	switch {
+	case len(req.VariantIDs) > 0:
+		perVariant := req.Copies
+		if perVariant <= 0 {
+			perVariant = 1
+		}
+		for _, id := range req.VariantIDs {
+			add(id, perVariant)
+		}
+
+	case req.PurchaseOrderID != nil:
+		var items []domain.PurchaseOrderItem
+		if err := db.Where("purchase_order_id = ?", *req.PurchaseOrderID).
+			Order("id").Find(&items).Error; err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			add(item.VariantID, item.QuantityReceived)
+		}
+		if len(order) == 0 {
+			return nil, errors.New("purchase order has no received items to label")
+		}
+
+	case req.LocationID != nil:
+		var stocks []domain.Stock
+		if err := db.Where("location_id = ? AND quantity > 0", *req.LocationID).
+			Order("variant_id").Find(&stocks).Error; err != nil {
+			return nil, err
+		}
+		for _, st := range stocks {
+			add(st.VariantID, 1)
+		}
+		if len(order) == 0 {
+			return nil, errors.New("location has no stocked variants to label")
+		}
+	}
+
+	total := 0
+	for _, n := range copies {
+		total += n
+	}
+	if total > maxLabelsPerBatch {
+		return nil, fmt.Errorf("batch of %d labels exceeds the limit of %d", total, maxLabelsPerBatch)
+	}
+
+	variants, err := s.loadVariants(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]Label, 0, len(order))
+	for _, id := range order {
+		v, ok := variants[id]
+		if !ok {
+			return nil, fmt.Errorf("variant %d not found", id)
+		}
+		labels = append(labels, newLabel(v, copies[id]))
+	}
+	return labels, nil
+}
+
+// loadVariants fetches the variants with their product, generating internal
+// barcodes for any that were never assigned one.
+func (s *LabelServiceImpl) loadVariants(ctx context.Context, ids []int) (map[int]domain.ProductVariant, error) {
+	var variants []domain.ProductVariant
+	if err := s.db.WithContext(ctx).Preload("Product").
+		Where("id IN ?", ids).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+
+	missing := make(map[int]bool)
+	for _, v := range variants {
+		if v.Barcode == nil || *v.Barcode == "" {
+			missing[v.ProductID] = true
+		}
+	}
+	if len(missing) > 0 {
+		for productID := range missing {
+			if _, err := s.catalogService.AssignBarcodes(ctx, productID, domain.BarcodeEAN13); err != nil {
+				return nil, err
+			}
+		}
+		variants = nil
+		if err := s.db.WithContext(ctx).Preload("Product").
+			Where("id IN ?", ids).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[int]domain.ProductVariant, len(variants))
+	for _, v := range variants {
+		byID[v.ID] = v
+	}
+	return byID, nil
+}
+
+func newLabel(v domain.ProductVariant, copies int) Label {
+	l := Label{
+		VariantID:   v.ID,
+		SKU:         v.SKU,
+		Price:       variantPrice(&v),
+		BarcodeType: domain.BarcodeEAN13,
+		Copies:      copies,
+	}
+	if v.Barcode != nil {
+		l.Barcode = *v.Barcode
+	}
+	if v.BarcodeType != nil {
+		l.BarcodeType = *v.BarcodeType
+	}
+
+	var parts []string
+	if v.Product != nil {
+		parts = append(parts, v.Product.Name)
+		l.CareURL = careURL(v.Product.Slug)
+	}
+	if v.Name != nil && *v.Name != "" {
+		parts = append(parts, *v.Name)
+	}
+	l.Name = strings.Join(parts, " - ")
+	return l
+}
+
+// careURL is where a label's QR code points; labels print without one when
+// STOREFRONT_URL is unset, as a relative link cannot be scanned.
+func careURL(slug string) string {
+	if os.Getenv("STOREFRONT_URL") == "" {
+		return ""
+	}
+	return productURL(slug) + "/care"
+}
+
+func renderPDF(labels []Label) ([]byte, error) {
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		UnitStr: "mm",
+		Size:    fpdf.SizeType{Wd: labelWidthMM, Ht: labelHeightMM},
+	})
+	pdf.SetMargins(2, 2, 2)
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	for i, l := range labels {
+		barcodeImg := fmt.Sprintf("barcode-%d", i)
+		qrImg := fmt.Sprintf("qr-%d", i)
+
+		code, err := encodeBarcode(l)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", l.SKU, err)
+		}
+		if err := registerPNG(pdf, barcodeImg, code, 400, 120); err != nil {
+			return nil, err
+		}
+
+		hasQR := l.CareURL != ""
+		if hasQR {
+			qrCode, err := qr.Encode(l.CareURL, qr.M, qr.Auto)
+			if err != nil {
+				return nil, err
+			}
+			if err := registerPNG(pdf, qrImg, qrCode, 200, 200); err != nil {
+				return nil, err
+			}
+		}
+
+		for n := 0; n < l.Copies; n++ {
+			pdf.AddPage()
+
+			pdf.SetFont("Helvetica", "B", 8)
+			pdf.SetXY(2, 2)
+			pdf.MultiCell(40, 3.5, tr(l.Name), "", "L", false)
+
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.SetXY(2, 11)
+			pdf.CellFormat(40, 6, formatRupiah(l.Price), "", 0, "L", false, 0, "")
+
+			pdf.ImageOptions(barcodeImg, 2, 19, 40, 14, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.SetFont("Helvetica", "", 7)
+			pdf.SetXY(2, 33.5)
+			pdf.CellFormat(40, 3, l.Barcode, "", 0, "C", false, 0, "")
+
+			if hasQR {
+				pdf.ImageOptions(qrImg, 44, 4, 16, 16, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+				pdf.SetFont("Helvetica", "", 5)
+				pdf.SetXY(43, 21)
+				pdf.CellFormat(18, 3, "Care guide", "", 0, "C", false, 0, "")
+			}
+			pdf.SetFont("Helvetica", "", 6)
+			pdf.SetXY(43, 33.5)
+			pdf.CellFormat(18, 3, tr(l.SKU), "", 0, "C", false, 0, "")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeBarcode(l Label) (bc.Barcode, error) {
+	if l.Barcode == "" {
+		return nil, errors.New("variant has no barcode")
+	}
+	if l.BarcodeType == domain.BarcodeCode128 {
+		return code128.Encode(l.Barcode)
+	}
+	return ean.Encode(l.Barcode)
+}
+
+func registerPNG(pdf *fpdf.Fpdf, name string, code bc.Barcode, width, height int) error {
+	scaled, err := bc.Scale(code, width, height)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaled); err != nil {
+		return err
+	}
+	pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, &buf)
+	return pdf.Error()
+}
+
+func renderZPL(labels []Label) []byte {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(&b, "^PW%d\n^LL%d\n", labelWidthDots, labelHeightDots)
+		fmt.Fprintf(&b, "^FO16,16^A0N,26,26^FB320,2,0,L^FD%s^FS\n", zplText(l.Name))
+		fmt.Fprintf(&b, "^FO16,84^A0N,40,40^FD%s^FS\n", zplText(formatRupiah(l.Price)))
+
+		if l.BarcodeType == domain.BarcodeCode128 {
+			fmt.Fprintf(&b, "^FO16,150^BY2^BCN,110,Y,N,N^FD%s^FS\n", zplText(l.Barcode))
+		} else if len(l.Barcode) == 13 {
+			// ^BE takes the first 12 digits and prints its own check digit
+			fmt.Fprintf(&b, "^FO16,150^BY2^BEN,110,Y,N^FD%s^FS\n", l.Barcode[:12])
+		}
+
+		if l.CareURL != "" {
+			fmt.Fprintf(&b, "^FO350,16^BQN,2,4^FDMA,%s^FS\n", zplText(l.CareURL))
+			b.WriteString("^FO350,176^A0N,18,18^FDCare guide^FS\n")
+		}
+		fmt.Fprintf(&b, "^FO350,280^A0N,20,20^FD%s^FS\n", zplText(l.SKU))
+		fmt.Fprintf(&b, "^PQ%d\n^XZ\n", l.Copies)
+	}
+	return []byte(b.String())
+}
+
+// zplText drops the ZPL command prefixes so product text cannot break the label.
+func zplText(s string) string {
+	return strings.NewReplacer("^", " ", "~", " ").Replace(s)
+}
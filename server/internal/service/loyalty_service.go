@@ -0,0 +1,574 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientPoints  = errors.New("not enough loyalty points")
+	ErrPointsNotRedeemable = errors.New("loyalty points cannot be redeemed")
+	ErrCategoryNotFound    = errors.New("category not found")
+)
+
+// loyaltyProgramID is the single LoyaltyProgram row.
+const loyaltyProgramID = 1
+
+type LoyaltyServiceImpl struct {
+	db *gorm.DB
+}
+
+func NewLoyaltyService(db *gorm.DB) LoyaltyService {
+	return &LoyaltyServiceImpl{db: db}
+}
+
+func (s *LoyaltyServiceImpl) GetProgram(ctx context.Context) (*domain.LoyaltyProgram, error) {
+	db := s.db.WithContext(ctx)
+	program, err := loyaltyProgram(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Preload("Category").Order("category_id").Find(&program.Multipliers).Error; err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func (s *LoyaltyServiceImpl) UpdateProgram(ctx context.Context, req dto.UpdateLoyaltyProgramRequest) (*domain.LoyaltyProgram, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		program, err := loyaltyProgram(tx.Clauses(clause.Locking{Strength: "UPDATE"}))
+		if err != nil {
+			return err
+		}
+		if req.IsActive != nil {
+			program.IsActive = *req.IsActive
+		}
+		if req.SpendPerPoint != nil {
+			program.SpendPerPoint = *req.SpendPerPoint
+		}
+		if req.PointValue != nil {
+			program.PointValue = *req.PointValue
+		}
+		if req.MinRedeemPoints != nil {
+			program.MinRedeemPoints = *req.MinRedeemPoints
+		}
+		if req.MaxRedeemPercent != nil {
+			program.MaxRedeemPercent = *req.MaxRedeemPercent
+		}
+		if req.ExpiryMonths != nil {
+			program.ExpiryMonths = *req.ExpiryMonths
+		}
+		if req.BirthdayMultiplier != nil {
+			program.BirthdayMultiplier = *req.BirthdayMultiplier
+		}
+		if program.SpendPerPoint <= 0 || program.PointValue <= 0 {
+			return errors.New("spend per point and point value must be positive")
+		}
+		if program.MaxRedeemPercent <= 0 || program.MaxRedeemPercent > 100 {
+			return errors.New("max redeem percent must be between 0 and 100")
+		}
+		if program.MinRedeemPoints < 0 || program.ExpiryMonths < 0 || program.BirthdayMultiplier < 1 {
+			return errors.New("minimum, expiry and birthday multiplier must not be negative or below 1")
+		}
+		program.UpdatedAt = time.Now()
+		return tx.Save(program).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetProgram(ctx)
+}
+
+func (s *LoyaltyServiceImpl) SetCategoryMultiplier(ctx context.Context, categoryID int, multiplier float64) error {
+	db := s.db.WithContext(ctx)
+	if multiplier < 0 {
+		return errors.New("multiplier must not be negative")
+	}
+	if multiplier == 1 {
+		return db.Where("category_id = ?", categoryID).Delete(&domain.LoyaltyCategoryMultiplier{}).Error
+	}
+	err := db.First(&domain.Category{}, categoryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "category_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"multiplier", "updated_at"}),
+	}).Create(&domain.LoyaltyCategoryMultiplier{CategoryID: categoryID, Multiplier: multiplier}).Error
+}
+
+func (s *LoyaltyServiceImpl) GetPoints(ctx context.Context, customerID int) (*dto.LoyaltyView, error) {
+	db := s.db.WithContext(ctx)
+	program, err := loyaltyProgram(db)
+	if err != nil {
+		return nil, err
+	}
+	view := &dto.LoyaltyView{CustomerID: customerID, PointValue: program.PointValue}
+	if err := db.Where("customer_id = ?", customerID).Order("id DESC").Find(&view.Entries).Error; err != nil {
+		return nil, err
+	}
+	if len(view.Entries) > 0 {
+		view.Balance = view.Entries[0].BalanceAfter
+	}
+
+	var next domain.LoyaltyEntry
+	if err := db.Where("customer_id = ? AND remaining > 0 AND expires_at IS NOT NULL", customerID).
+		Order("expires_at, id").Limit(1).Find(&next).Error; err != nil {
+		return nil, err
+	}
+	if next.ID != 0 {
+		view.NextExpiry = next.ExpiresAt
+		if err := db.Model(&domain.LoyaltyEntry{}).
+			Where("customer_id = ? AND remaining > 0 AND expires_at = ?", customerID, next.ExpiresAt).
+			Select("COALESCE(SUM(remaining), 0)").Scan(&view.ExpiringPoints).Error; err != nil {
+			return nil, err
+		}
+	}
+	return view, nil
+}
+
+func (s *LoyaltyServiceImpl) GetPointsForUser(ctx context.Context, userID int) (*dto.LoyaltyView, error) {
+	var customer domain.Customer
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&customer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Never shopped, so nothing was ever earned
+		program, err := loyaltyProgram(s.db.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return &dto.LoyaltyView{PointValue: program.PointValue, Entries: []domain.LoyaltyEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPoints(ctx, customer.ID)
+}
+
+func (s *LoyaltyServiceImpl) AdjustPoints(ctx context.Context, customerID, points int, note string, userID int) (*domain.LoyaltyEntry, error) {
+	var entry *domain.LoyaltyEntry
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		program, err := loyaltyProgram(tx)
+		if err != nil {
+			return err
+		}
+		entry, err = movePointsTx(tx, customerID, points, domain.LoyaltyAdjust, loyaltyRef{
+			UserID:    &userID,
+			Note:      note,
+			ExpiresAt: pointsExpiry(program, time.Now()),
+		})
+		return err
+	})
+	return entry, err
+}
+
+// ExpirePoints writes off lapsed points of every customer holding some.
+func (s *LoyaltyServiceImpl) ExpirePoints(ctx context.Context) (int, error) {
+	now := time.Now()
+	var customerIDs []int
+	if err := s.db.WithContext(ctx).Model(&domain.LoyaltyEntry{}).
+		Where("remaining > 0 AND expires_at <= ?", now).
+		Distinct().Pluck("customer_id", &customerIDs).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, customerID := range customerIDs {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := lockCustomerTx(tx, customerID); err != nil {
+				return err
+			}
+			n, err := expirePointsTx(tx, customerID, now)
+			expired += n
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// loyaltyProgram returns the settings row, or the defaults (switched off)
+// before an admin saved any.
+func loyaltyProgram(db *gorm.DB) (*domain.LoyaltyProgram, error) {
+	var program domain.LoyaltyProgram
+	err := db.First(&program, loyaltyProgramID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &domain.LoyaltyProgram{
+			ID:                 loyaltyProgramID,
+			SpendPerPoint:      10000,
+			PointValue:         100,
+			MaxRedeemPercent:   100,
+			ExpiryMonths:       12,
+			BirthdayMultiplier: 1,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+// loyaltyRef links a points movement to what caused it.
+type loyaltyRef struct {
+	OrderID   *int
+	UserID    *int
+	Note      string
+	ExpiresAt *time.Time // Credits only
+}
+
+// movePointsTx appends a ledger entry for the customer. The customer row is
+// locked so concurrent entries see each other's balance, and lapsed points
+// are expired first so they cannot be spent. Debits draw on the oldest lots;
+// a clawback draws on its order's lot first and may leave the balance
+// negative, which later credits pay off.
+func movePointsTx(tx *gorm.DB, customerID, delta int, txType domain.LoyaltyEntryType, ref loyaltyRef) (*domain.LoyaltyEntry, error) {
+	if delta == 0 {
+		return nil, errors.New("points must not be zero")
+	}
+	if err := lockCustomerTx(tx, customerID); err != nil {
+		return nil, err
+	}
+	if _, err := expirePointsTx(tx, customerID, time.Now()); err != nil {
+		return nil, err
+	}
+	balance, err := loyaltyBalance(tx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &domain.LoyaltyEntry{
+		CustomerID:   customerID,
+		Type:         txType,
+		Points:       delta,
+		BalanceAfter: balance + delta,
+		SalesOrderID: ref.OrderID,
+		CreatedBy:    ref.UserID,
+	}
+	if ref.Note != "" {
+		entry.Note = &ref.Note
+	}
+	if delta > 0 {
+		entry.Remaining = min(delta, max(0, balance+delta))
+		entry.ExpiresAt = ref.ExpiresAt
+	} else {
+		if txType != domain.LoyaltyClawback && -delta > balance {
+			return nil, fmt.Errorf("%w: %d points available", ErrInsufficientPoints, max(0, balance))
+		}
+		var firstOrder *int
+		if txType == domain.LoyaltyClawback {
+			firstOrder = ref.OrderID
+		}
+		if err := drawPointsTx(tx, customerID, -delta, firstOrder); err != nil {
+			return nil, err
+		}
+	}
+	return entry, tx.Create(entry).Error
+}
+
+func lockCustomerTx(tx *gorm.DB, customerID int) error {
+	var customer domain.Customer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&customer, customerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoCustomer
+	}
+	return err
+}
+
+// drawPointsTx takes points out of the customer's lots, soonest to expire
+// first. Lots earned on orderID, when given, go before all others.
+func drawPointsTx(tx *gorm.DB, customerID, points int, orderID *int) error {
+	var lots []domain.LoyaltyEntry
+	if orderID != nil {
+		if err := tx.Where("customer_id = ? AND remaining > 0 AND sales_order_id = ?", customerID, *orderID).
+			Order("id").Find(&lots).Error; err != nil {
+			return err
+		}
+	}
+	var rest []domain.LoyaltyEntry
+	q := tx.Where("customer_id = ? AND remaining > 0", customerID)
+	if orderID != nil {
+		q = q.Where("sales_order_id IS NULL OR sales_order_id <> ?", *orderID)
+	}
+	if err := q.Order("expires_at ASC NULLS LAST, id").Find(&rest).Error; err != nil {
+		return err
+	}
+
+	for _, lot := range append(lots, rest...) {
+		if points == 0 {
+			break
+		}
+		take := min(points, lot.Remaining)
+		if err := tx.Model(&domain.LoyaltyEntry{}).Where("id = ?", lot.ID).
+			Update("remaining", lot.Remaining-take).Error; err != nil {
+			return err
+		}
+		points -= take
+	}
+	return nil
+}
+
+// expirePointsTx writes off what is left of the customer's lapsed lots. The
+// caller holds the customer lock.
+func expirePointsTx(tx *gorm.DB, customerID int, now time.Time) (int, error) {
+	var lots []domain.LoyaltyEntry
+	if err := tx.Where("customer_id = ? AND remaining > 0 AND expires_at <= ?", customerID, now).
+		Order("id").Find(&lots).Error; err != nil {
+		return 0, err
+	}
+	if len(lots) == 0 {
+		return 0, nil
+	}
+	balance, err := loyaltyBalance(tx, customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, lot := range lots {
+		if err := tx.Model(&domain.LoyaltyEntry{}).Where("id = ?", lot.ID).Update("remaining", 0).Error; err != nil {
+			return expired, err
+		}
+		balance -= lot.Remaining
+		note := fmt.Sprintf("Earned %s", lot.CreatedAt.Format("2006-01-02"))
+		if err := tx.Create(&domain.LoyaltyEntry{
+			CustomerID:   customerID,
+			Type:         domain.LoyaltyExpire,
+			Points:       -lot.Remaining,
+			BalanceAfter: balance,
+			SalesOrderID: lot.SalesOrderID,
+			Note:         &note,
+		}).Error; err != nil {
+			return expired, err
+		}
+		expired += lot.Remaining
+	}
+	return expired, nil
+}
+
+func loyaltyBalance(db *gorm.DB, customerID int) (int, error) {
+	var last domain.LoyaltyEntry
+	err := db.Where("customer_id = ?", customerID).Order("id DESC").Limit(1).Find(&last).Error
+	return last.BalanceAfter, err
+}
+
+// availablePoints is the balance less lapsed points not yet written off.
+func availablePoints(db *gorm.DB, customerID int, now time.Time) (int, error) {
+	balance, err := loyaltyBalance(db, customerID)
+	if err != nil {
+		return 0, err
+	}
+	var lapsed int
+	err = db.Model(&domain.LoyaltyEntry{}).
+		Where("customer_id = ? AND remaining > 0 AND expires_at <= ?", customerID, now).
+		Select("COALESCE(SUM(remaining), 0)").Scan(&lapsed).Error
+	return balance - lapsed, err
+}
+
+// pointsExpiry is when points credited at t lapse; nil when they never do.
+func pointsExpiry(program *domain.LoyaltyProgram, t time.Time) *time.Time {
+	if program.ExpiryMonths <= 0 {
+		return nil
+	}
+	at := t.AddDate(0, program.ExpiryMonths, 0)
+	return &at
+}
+
+// pointsDiscount prices redeeming points against an order total. Points
+// beyond the program's share of the total are not used.
+func pointsDiscount(db *gorm.DB, customerID *int, points int, total float64) (int, float64, error) {
+	if points <= 0 {
+		return 0, 0, nil
+	}
+	if customerID == nil {
+		return 0, 0, fmt.Errorf("%w: log in to use points", ErrPointsNotRedeemable)
+	}
+	program, err := loyaltyProgram(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !program.IsActive {
+		return 0, 0, fmt.Errorf("%w: the loyalty program is not active", ErrPointsNotRedeemable)
+	}
+	available, err := availablePoints(db, *customerID, time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	if points > available {
+		return 0, 0, fmt.Errorf("%w: %d points available", ErrInsufficientPoints, max(0, available))
+	}
+
+	maxDiscount := roundMoney(total * program.MaxRedeemPercent / 100)
+	if float64(points)*program.PointValue > maxDiscount {
+		points = int(math.Floor(maxDiscount/program.PointValue + 1e-9))
+	}
+	if points <= 0 || points < program.MinRedeemPoints {
+		return 0, 0, fmt.Errorf("%w: at least %d points are needed and the order must cover them", ErrPointsNotRedeemable, program.MinRedeemPoints)
+	}
+	return points, roundMoney(math.Min(float64(points)*program.PointValue, total)), nil
+}
+
+// redeemOrderPointsTx spends the points priced into an order when it is placed.
+func redeemOrderPointsTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.PointsRedeemed <= 0 {
+		return nil
+	}
+	if order.CustomerID == nil {
+		return fmt.Errorf("%w: the order has no customer", ErrPointsNotRedeemable)
+	}
+	_, err := movePointsTx(tx, *order.CustomerID, -order.PointsRedeemed, domain.LoyaltyRedeem, loyaltyRef{
+		OrderID: &order.ID,
+		UserID:  order.CreatedBy,
+	})
+	return err
+}
+
+// earnLine is an order line as the earning rules see it.
+type earnLine struct {
+	LineTotal  float64
+	CategoryID *int
+	IsGiftCard bool
+}
+
+// earnOrderPointsTx credits the points of a paid order, once. Gift cards
+// earn nothing, as their spending later does; the points discount reduces
+// what every line earns.
+func earnOrderPointsTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.CustomerID == nil {
+		return nil
+	}
+	program, err := loyaltyProgram(tx)
+	if err != nil || !program.IsActive {
+		return err
+	}
+	var earned int64
+	if err := tx.Model(&domain.LoyaltyEntry{}).
+		Where("sales_order_id = ? AND type = ?", order.ID, domain.LoyaltyEarn).Count(&earned).Error; err != nil {
+		return err
+	}
+	if earned > 0 {
+		return nil
+	}
+
+	var lines []earnLine
+	if err := tx.Table("sales_order_items").
+		Select("sales_order_items.line_total, products.category_id, products.is_gift_card").
+		Joins("JOIN product_variants ON product_variants.id = sales_order_items.variant_id").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Where("sales_order_items.sales_order_id = ?", order.ID).
+		Scan(&lines).Error; err != nil {
+		return err
+	}
+	var multipliers []domain.LoyaltyCategoryMultiplier
+	if err := tx.Find(&multipliers).Error; err != nil {
+		return err
+	}
+	byCategory := make(map[int]float64, len(multipliers))
+	for _, m := range multipliers {
+		byCategory[m.CategoryID] = m.Multiplier
+	}
+
+	linesTotal, weighted := 0.0, 0.0
+	for _, line := range lines {
+		linesTotal += line.LineTotal
+		if line.IsGiftCard {
+			continue
+		}
+		multiplier := 1.0
+		if line.CategoryID != nil {
+			if m, ok := byCategory[*line.CategoryID]; ok {
+				multiplier = m
+			}
+		}
+		weighted += line.LineTotal * multiplier
+	}
+	if linesTotal <= 0 {
+		return nil
+	}
+	weighted *= math.Max(0, 1-order.PointsDiscount/linesTotal)
+
+	now := time.Now()
+	var note string
+	var customer domain.Customer
+	if err := tx.Select("id", "birth_date").First(&customer, *order.CustomerID).Error; err != nil {
+		return err
+	}
+	if customer.BirthDate != nil && customer.BirthDate.Month() == now.Month() && program.BirthdayMultiplier > 1 {
+		weighted *= program.BirthdayMultiplier
+		note = fmt.Sprintf("Birthday month x%g", program.BirthdayMultiplier)
+	}
+
+	points := int(math.Floor(weighted/program.SpendPerPoint + 1e-9))
+	if points <= 0 {
+		return nil
+	}
+	_, err = movePointsTx(tx, *order.CustomerID, points, domain.LoyaltyEarn, loyaltyRef{
+		OrderID:   &order.ID,
+		Note:      note,
+		ExpiresAt: pointsExpiry(program, now),
+	})
+	return err
+}
+
+// orderPoints sums an order's ledger entries of the given types.
+func orderPoints(tx *gorm.DB, orderID int, types ...domain.LoyaltyEntryType) (int, error) {
+	var sum int
+	err := tx.Model(&domain.LoyaltyEntry{}).
+		Where("sales_order_id = ? AND type IN ?", orderID, types).
+		Select("COALESCE(SUM(points), 0)").Scan(&sum).Error
+	return sum, err
+}
+
+// restoreOrderPointsTx gives back the points spent on an order that did not
+// go ahead. They count as newly credited for expiry.
+func restoreOrderPointsTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.CustomerID == nil || order.PointsRedeemed == 0 {
+		return nil
+	}
+	spent, err := orderPoints(tx, order.ID, domain.LoyaltyRedeem, domain.LoyaltyRestore)
+	if err != nil || spent >= 0 {
+		return err
+	}
+	program, err := loyaltyProgram(tx)
+	if err != nil {
+		return err
+	}
+	_, err = movePointsTx(tx, *order.CustomerID, -spent, domain.LoyaltyRestore, loyaltyRef{
+		OrderID:   &order.ID,
+		ExpiresAt: pointsExpiry(program, time.Now()),
+	})
+	return err
+}
+
+// clawbackOrderPointsTx takes back share (0-1] of the points an order earned,
+// less what was already taken back.
+func clawbackOrderPointsTx(tx *gorm.DB, order *domain.SalesOrder, share float64) error {
+	if order.CustomerID == nil {
+		return nil
+	}
+	earned, err := orderPoints(tx, order.ID, domain.LoyaltyEarn)
+	if err != nil || earned <= 0 {
+		return err
+	}
+	clawedBack, err := orderPoints(tx, order.ID, domain.LoyaltyClawback)
+	if err != nil {
+		return err
+	}
+	points := min(int(math.Round(float64(earned)*math.Min(share, 1))), earned+clawedBack)
+	if points <= 0 {
+		return nil
+	}
+	_, err = movePointsTx(tx, *order.CustomerID, -points, domain.LoyaltyClawback, loyaltyRef{OrderID: &order.ID})
+	return err
+}
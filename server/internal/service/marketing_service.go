@@ -3,22 +3,31 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"server/internal/promotion"
 	"server/internal/repository"
+	"strings"
 	"time"
 
-	"github.com/expr-lang/expr"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrInvalidPromotion wraps conditions or actions the promotion engine
+// cannot parse or compile.
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
 type marketingService struct {
 	promoRepo repository.PromotionRepository
+	db        *gorm.DB
 }
 
 func NewMarketingService(db *gorm.DB) MarketingService {
 	return &marketingService{
 		promoRepo: repository.NewPromotionRepository(db),
+		db:        db,
 	}
 }
 
@@ -37,6 +46,10 @@ func (s *marketingService) CreatePromotion(ctx context.Context, promo *domain.Pr
 	if promo.Actions == nil {
 		promo.Actions = map[string]interface{}{}
 	}
+	promo.Code = normalizeCouponCode(promo.Code)
+	if err := validatePromotion(promo); err != nil {
+		return err
+	}
 	return s.promoRepo.Create(ctx, promo)
 }
 
@@ -45,17 +58,24 @@ func (s *marketingService) UpdatePromotion(ctx context.Context, id int, req dto.
 	if err != nil {
 		return err
 	}
+	wasActive := promo.IsActive
 
 	// Update fields if provided
 	if req.Name != nil {
 		promo.Name = *req.Name
 	}
 	if req.Code != nil {
-		promo.Code = req.Code
+		promo.Code = normalizeCouponCode(req.Code)
 	}
 	if req.Description != nil {
 		promo.Description = req.Description
 	}
+	if req.Priority != nil {
+		promo.Priority = *req.Priority
+	}
+	if req.IsExclusive != nil {
+		promo.IsExclusive = *req.IsExclusive
+	}
 	if req.IsActive != nil {
 		promo.IsActive = *req.IsActive
 	}
@@ -82,7 +102,23 @@ func (s *marketingService) UpdatePromotion(ctx context.Context, id int, req dto.
 	if req.TotalUsageLimit != nil {
 		promo.TotalUsageLimit = req.TotalUsageLimit
 	}
+	if req.PerUserLimit != nil {
+		promo.PerUserLimit = req.PerUserLimit
+	}
+	if req.IsTemplate != nil {
+		promo.IsTemplate = *req.IsTemplate
+	}
 
+	// Legacy promotions whose rules no longer parse can still be edited and
+	// switched off; the rules are checked when they change or go live again
+	activating := promo.IsActive && !wasActive
+	if req.Conditions != nil || req.Actions != nil || activating {
+		if err := validatePromotion(promo); err != nil {
+			return err
+		}
+	} else if err := validateSchedule(promo); err != nil {
+		return err
+	}
 	return s.promoRepo.Update(ctx, promo)
 }
 
@@ -100,43 +136,311 @@ func (s *marketingService) DeletePromotion(ctx context.Context, id int) error {
 	return s.promoRepo.Update(ctx, promo)
 }
 
-// EvaluatePromotion checks if a promotion's conditions are met for given data
-func (s *marketingService) EvaluatePromotion(ctx context.Context, promo *domain.Promotion, data map[string]interface{}) (bool, error) {
-	// Assume Conditions has "expression" key with expr string
-	if exprStr, ok := promo.Conditions["expression"].(string); ok {
-		program, err := expr.Compile(exprStr, expr.Env(data))
+// validatePromotion compiles the rule now so a bad expression is rejected
+// when saved rather than skipped at checkout.
+func validatePromotion(promo *domain.Promotion) error {
+	if _, err := promotion.Parse(promo); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPromotion, err)
+	}
+	return validateSchedule(promo)
+}
+
+func validateSchedule(promo *domain.Promotion) error {
+	if promo.StartsAt != nil && promo.EndsAt != nil && promo.EndsAt.Before(*promo.StartsAt) {
+		return fmt.Errorf("%w: ends_at is before starts_at", ErrInvalidPromotion)
+	}
+	return nil
+}
+
+func (s *marketingService) SimulatePromotions(ctx context.Context, req dto.SimulatePromotionsRequest) (*dto.SimulatePromotionsResponse, error) {
+	at := time.Now()
+	if req.At != "" {
+		t, err := time.Parse(time.RFC3339, req.At)
 		if err != nil {
-			return false, err
+			return nil, errors.New("invalid at format")
 		}
-		result, err := expr.Run(program, data)
+		at = t
+	}
+	channel := req.Channel
+	if channel == "" {
+		channel = string(domain.ChannelWeb)
+	}
+
+	items, err := s.simulatedItems(ctx, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := promotionLines(s.db.WithContext(ctx), items)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := map[string]bool{}
+	for _, c := range req.CouponCodes {
+		if code := normalizeCouponCode(&c); code != nil {
+			codes[*code] = true
+		}
+	}
+
+	// Inactive and out-of-date promotions are kept so the report says why
+	promos, err := s.promoRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Draft != nil {
+		name := req.Draft.Name
+		if name == "" {
+			name = "Draft"
+		}
+		promos = append(promos, domain.Promotion{
+			Name:        name,
+			Priority:    req.Draft.Priority,
+			IsExclusive: req.Draft.IsExclusive,
+			IsActive:    true,
+			Conditions:  req.Draft.Conditions,
+			Actions:     req.Draft.Actions,
+		})
+	}
+
+	resp := &dto.SimulatePromotionsResponse{}
+	var rules []*promotion.Rule
+	for i := range promos {
+		p := &promos[i]
+		if p.Code != nil && !codes[strings.ToUpper(*p.Code)] {
+			continue
+		}
+		rule, err := promotion.Parse(p)
 		if err != nil {
-			return false, err
+			resp.Evaluated = append(resp.Evaluated, dto.PromotionEvaluation{
+				PromotionID: p.ID, Name: p.Name, Code: p.Code, Status: "INVALID", Reason: err.Error(),
+			})
+			continue
 		}
-		if met, ok := result.(bool); ok {
-			return met, nil
+		rules = append(rules, rule)
+	}
+
+	res := promotion.Evaluate(rules, promotion.Cart{
+		Lines:      lines,
+		Channel:    channel,
+		CustomerID: req.CustomerID,
+		Now:        at,
+	})
+
+	for i, item := range items {
+		gross := item.UnitPrice * float64(item.Quantity)
+		resp.Subtotal += gross
+		resp.Lines = append(resp.Lines, dto.SimulatedLine{
+			VariantID:      item.VariantID,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.UnitPrice,
+			DiscountAmount: res.LineDiscounts[i],
+			LineTotal:      roundMoney(gross - res.LineDiscounts[i]),
+		})
+	}
+	resp.Subtotal = roundMoney(resp.Subtotal)
+	resp.DiscountAmount = res.Discount
+	resp.TotalAmount = roundMoney(resp.Subtotal - res.Discount)
+	resp.FreeShipping = res.FreeShipping
+
+	resp.Applied = []dto.SimulatedDiscount{}
+	for _, a := range res.Applied {
+		d := dto.SimulatedDiscount{
+			PromotionID:    a.PromotionID,
+			Name:           a.Name,
+			Code:           a.Code,
+			DiscountAmount: a.Discount,
+			FreeShipping:   a.FreeShipping,
+			Lines:          []dto.SimulatedLineShare{},
+		}
+		for i, amount := range a.LineDiscounts {
+			if amount > 0 {
+				d.Lines = append(d.Lines, dto.SimulatedLineShare{VariantID: items[i].VariantID, Amount: amount})
+			}
 		}
+		resp.Applied = append(resp.Applied, d)
+	}
+	for _, out := range res.Outcomes {
+		resp.Evaluated = append(resp.Evaluated, dto.PromotionEvaluation{
+			PromotionID: out.PromotionID,
+			Name:        out.Name,
+			Code:        out.Code,
+			Status:      out.Status,
+			Reason:      out.Reason,
+		})
 	}
-	return false, nil
+	return resp, nil
 }
 
-// ApplyPromotion applies the actions if conditions met
-func (s *marketingService) ApplyPromotion(ctx context.Context, promo *domain.Promotion, data map[string]interface{}) error {
-	met, err := s.EvaluatePromotion(ctx, promo, data)
-	if err != nil || !met {
-		return err
+// simulatedItems prices what-if lines at the catalog price unless overridden.
+func (s *marketingService) simulatedItems(ctx context.Context, reqItems []dto.SimulatedItem) ([]domain.SalesOrderItem, error) {
+	ids := make([]int, len(reqItems))
+	for i, it := range reqItems {
+		ids[i] = it.VariantID
 	}
-	// Assume Actions has "expression" key with actions to execute
-	if exprStr, ok := promo.Actions["expression"].(string); ok {
-		program, err := expr.Compile(exprStr, expr.Env(data))
-		if err != nil {
+	var variants []domain.ProductVariant
+	if err := s.db.WithContext(ctx).Preload("Product").Where("id IN ?", ids).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	items := make([]domain.SalesOrderItem, len(reqItems))
+	for i, it := range reqItems {
+		v := byID[it.VariantID]
+		if v == nil {
+			return nil, fmt.Errorf("variant %d not found", it.VariantID)
+		}
+		if it.Quantity < 1 {
+			return nil, fmt.Errorf("quantity for variant %d must be at least 1", it.VariantID)
+		}
+		items[i] = domain.SalesOrderItem{VariantID: v.ID, SKU: v.SKU, Quantity: it.Quantity, UnitPrice: variantPrice(v)}
+		if it.UnitPrice != nil {
+			items[i].UnitPrice = *it.UnitPrice
+		}
+	}
+	return items, nil
+}
+
+func (s *marketingService) GetActivePromotions(ctx context.Context) ([]domain.Promotion, error) {
+	return s.promoRepo.GetActivePromotions(ctx)
+}
+
+func (s *marketingService) CheckCoupon(ctx context.Context, code string, shopper Shopper) (*domain.Promotion, error) {
+	promo, err := s.promoRepo.FindByCode(ctx, strings.TrimSpace(code))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &CouponError{Reason: CouponNotFound, Message: "Coupon code not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := couponUsable(promo, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkCouponLimits(s.db.WithContext(ctx), promo, shopper); err != nil {
+		return nil, err
+	}
+	return promo, nil
+}
+
+func (s *marketingService) ShopperForUser(ctx context.Context, userID int) (Shopper, error) {
+	var user domain.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return Shopper{}, err
+	}
+
+	customer := domain.Customer{UserID: &userID}
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).FirstOrCreate(&customer).Error; err != nil {
+		return Shopper{}, err
+	}
+	return Shopper{CustomerID: &customer.ID, Email: user.Email}, nil
+}
+
+// SetMarketingConsent records the latest choice of an email address.
+func (s *marketingService) SetMarketingConsent(ctx context.Context, email string, optedIn bool, source domain.ConsentSource) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return errors.New("email is required")
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"opted_in", "source", "updated_at"}),
+	}).Create(&domain.MarketingConsent{Email: email, OptedIn: optedIn, Source: source}).Error
+}
+
+// hasMarketingConsent reports whether email opted in to marketing messages.
+func hasMarketingConsent(db *gorm.DB, email string) (bool, error) {
+	var consent domain.MarketingConsent
+	err := db.Where("email = ?", strings.ToLower(strings.TrimSpace(email))).Limit(1).Find(&consent).Error
+	return consent.OptedIn, err
+}
+
+func couponUsable(promo *domain.Promotion, now time.Time) error {
+	switch {
+	case !promo.IsActive:
+		return &CouponError{Reason: CouponInactive, Message: "This coupon is no longer active"}
+	case promo.StartsAt != nil && now.Before(*promo.StartsAt):
+		return &CouponError{Reason: CouponNotStarted, Message: "This coupon is not valid yet"}
+	case promo.EndsAt != nil && now.After(*promo.EndsAt):
+		return &CouponError{Reason: CouponExpired, Message: "This coupon has expired"}
+	}
+	return nil
+}
+
+// checkCouponLimits counts past redemptions. An unidentified shopper skips the
+// per-customer check; checkout always identifies one.
+func checkCouponLimits(db *gorm.DB, promo *domain.Promotion, shopper Shopper) error {
+	if promo.TotalUsageLimit != nil {
+		var used int64
+		if err := db.Model(&domain.PromotionUsage{}).Where("promotion_id = ?", promo.ID).Count(&used).Error; err != nil {
 			return err
 		}
-		_, err = expr.Run(program, data)
-		return err
+		if used >= int64(*promo.TotalUsageLimit) {
+			return &CouponError{Reason: CouponUsedUp, Message: "This coupon has reached its usage limit"}
+		}
+	}
+
+	if promo.PerUserLimit != nil && *promo.PerUserLimit > 0 && (shopper.CustomerID != nil || shopper.Email != "") {
+		q := db.Model(&domain.PromotionUsage{}).Where("promotion_id = ?", promo.ID)
+		switch {
+		case shopper.CustomerID != nil && shopper.Email != "":
+			q = q.Where("customer_id = ? OR LOWER(email) = LOWER(?)", *shopper.CustomerID, shopper.Email)
+		case shopper.CustomerID != nil:
+			q = q.Where("customer_id = ?", *shopper.CustomerID)
+		default:
+			q = q.Where("LOWER(email) = LOWER(?)", shopper.Email)
+		}
+
+		var used int64
+		if err := q.Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(*promo.PerUserLimit) {
+			return &CouponError{Reason: CouponCustomerLimit, Message: "You have already used this coupon the maximum number of times"}
+		}
 	}
 	return nil
 }
 
+// redeemCouponTx re-checks a coupon with its promotion row locked, so
+// concurrent checkouts cannot exceed the limits, then records the usage.
+func redeemCouponTx(tx *gorm.DB, promotionID int, shopper Shopper, orderID int) error {
+	var promo domain.Promotion
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promo, promotionID).Error; err != nil {
+		return err
+	}
+	if err := couponUsable(&promo, time.Now()); err != nil {
+		return err
+	}
+	if err := checkCouponLimits(tx, &promo, shopper); err != nil {
+		return err
+	}
+
+	usage := &domain.PromotionUsage{
+		PromotionID:  promo.ID,
+		CustomerID:   shopper.CustomerID,
+		SalesOrderID: orderID,
+		UsedAt:       time.Now(),
+	}
+	if shopper.Email != "" {
+		usage.Email = &shopper.Email
+	}
+	return tx.Create(usage).Error
+}
+
+func normalizeCouponCode(code *string) *string {
+	if code == nil {
+		return nil
+	}
+	c := strings.ToUpper(strings.TrimSpace(*code))
+	if c == "" {
+		return nil
+	}
+	return &c
+}
+
 func (s *marketingService) GetSegments(ctx context.Context) ([]string, error) {
 	// TODO: Implement customer segmentation
 	return []string{"all"}, nil
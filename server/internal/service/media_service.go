@@ -1,66 +1,81 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"net/http"
 	"path/filepath"
 	"server/internal/core/domain"
+	"server/internal/imaging"
 	"server/internal/repository"
+	"server/internal/storage"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"gorm.io/gorm"
 )
 
+const (
+	signedURLExpiry = 24 * time.Hour
+
+	// uploadPrefix holds every original; SweepOrphans lists it for strays
+	uploadPrefix = "uploads/"
+
+	// Originals larger than this are left unprocessed
+	maxProcessBytes = 50 * 1024 * 1024
+)
+
+// renditionSpecs are generated for every image, each as WebP and JPEG.
+var renditionSpecs = []struct {
+	Name    string
+	MaxSide int
+}{
+	{"thumbnail", 200},
+	{"card", 600},
+	{"zoom", 1600},
+}
+
 type MediaServiceImpl struct {
 	mediaRepo     repository.MediaRepository
 	mediaLinkRepo repository.MediaLinkRepository
-	minioClient   *minio.Client
-	bucketName    string
+	disks         *storage.Registry
 }
 
-func NewMediaService(mediaRepo repository.MediaRepository, mediaLinkRepo repository.MediaLinkRepository) (MediaService, error) {
-	endpoint := os.Getenv("MINIO_ENDPOINT")
-	accessKey := os.Getenv("MINIO_ACCESS_KEY")
-	secretKey := os.Getenv("MINIO_SECRET_KEY")
-	bucketName := os.Getenv("MINIO_BUCKET")
-	if bucketName == "" {
-		bucketName = "media-assets"
-	}
-	secure := os.Getenv("MINIO_SECURE") == "true"
-
-	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
-	}
-
+func NewMediaService(mediaRepo repository.MediaRepository, mediaLinkRepo repository.MediaLinkRepository, disks *storage.Registry) MediaService {
 	return &MediaServiceImpl{
 		mediaRepo:     mediaRepo,
 		mediaLinkRepo: mediaLinkRepo,
-		minioClient:   minioClient,
-		bucketName:    bucketName,
-	}, nil
+		disks:         disks,
+	}
 }
 
 func (s *MediaServiceImpl) InitiateUpload(ctx context.Context, filename string, mimeType string, sizeBytes int64) (*domain.MediaAsset, string, error) {
 	// Generate UUID for unique path
 	fileUUID := uuid.New().String()
 	ext := filepath.Ext(filename)
-	path := fmt.Sprintf("uploads/%s/%s%s", time.Now().Format("2006/01/02"), fileUUID, ext)
+	path := fmt.Sprintf("%s%s/%s%s", uploadPrefix, time.Now().Format("2006/01/02"), fileUUID, ext)
+
+	disk, err := s.disks.Disk(s.disks.Default())
+	if err != nil {
+		return nil, "", err
+	}
 
 	// Create MediaAsset record
 	asset := &domain.MediaAsset{
 		UUID:      fileUUID,
-		Disk:      "s3_main",
+		Disk:      s.disks.Default(),
 		Path:      path,
 		Filename:  filename,
 		MimeType:  mimeType,
 		SizeBytes: sizeBytes,
+		Status:    domain.MediaPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -70,31 +85,267 @@ func (s *MediaServiceImpl) InitiateUpload(ctx context.Context, filename string,
 	}
 
 	// Generate signed PUT URL
-	signedURL, err := s.minioClient.PresignedPutObject(ctx, s.bucketName, path, time.Hour*24) // 24 hours expiry
+	signedURL, err := disk.PresignPut(ctx, path, mimeType, signedURLExpiry)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return asset, signedURL, nil
+}
+
+func (s *MediaServiceImpl) CompleteUpload(ctx context.Context, mediaID int, checksum string) (*domain.MediaAsset, error) {
+	asset, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find media asset: %w", err)
+	}
+	if asset.Status == domain.MediaReady {
+		return asset, nil
+	}
+
+	disk, err := s.disks.Disk(asset.Disk)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := disk.Stat(ctx, asset.Path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, errors.New("upload not found in storage")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Size != asset.SizeBytes {
+		return nil, fmt.Errorf("size mismatch: declared %d bytes, stored %d", asset.SizeBytes, info.Size)
+	}
+
+	r, err := disk.Get(ctx, asset.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Hash the whole object while keeping the head for content sniffing
+	hash := sha256.New()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	hash.Write(head)
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, checksum) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	sniffed := baseMimeType(http.DetectContentType(head))
+	if declared := baseMimeType(asset.MimeType); sniffed != declared && !compatibleMimeType(declared, sniffed) {
+		return nil, fmt.Errorf("content type mismatch: declared %s, detected %s", declared, sniffed)
+	}
+
+	now := time.Now()
+	asset.Status = domain.MediaReady
+	asset.Checksum = &sum
+	asset.CompletedAt = &now
+	asset.UpdatedAt = now
+	if err := s.mediaRepo.Update(ctx, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// SweepOrphans deletes uploads that never completed and ready assets nobody
+// linked, once they are older than the grace period. It then removes objects
+// under the upload prefix that have no asset row at all (e.g. the row was
+// deleted but the object delete failed).
+func (s *MediaServiceImpl) SweepOrphans(ctx context.Context, grace time.Duration) (int, error) {
+	assets, err := s.mediaRepo.FindOrphans(ctx, time.Now().Add(-grace), 100)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, asset := range assets {
+		disk, err := s.disks.Disk(asset.Disk)
+		if err != nil {
+			return deleted, err
+		}
+
+		paths := []string{asset.Path}
+		for _, r := range asset.Renditions {
+			paths = append(paths, r.Path)
+		}
+		for _, p := range paths {
+			if err := disk.Delete(ctx, p); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return deleted, fmt.Errorf("media %d: %w", asset.ID, err)
+			}
+		}
+
+		if err := s.mediaRepo.DeleteAsset(ctx, asset.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	for _, name := range s.disks.Names() {
+		n, err := s.sweepOrphanObjects(ctx, name, time.Now().Add(-grace))
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// sweepOrphanObjects deletes upload objects older than the cutoff that no
+// asset row points to.
+func (s *MediaServiceImpl) sweepOrphanObjects(ctx context.Context, diskName string, before time.Time) (int, error) {
+	disk, err := s.disks.Disk(diskName)
+	if err != nil {
+		return 0, err
+	}
+	objects, err := disk.List(ctx, uploadPrefix)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate signed URL: %w", err)
+		return 0, fmt.Errorf("list %s: %w", diskName, err)
 	}
 
-	return asset, signedURL.String(), nil
+	deleted := 0
+	for batch := range slices.Chunk(objects, 500) {
+		var paths []string
+		for _, obj := range batch {
+			if obj.LastModified.Before(before) {
+				paths = append(paths, obj.Path)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		known, err := s.mediaRepo.KnownPaths(ctx, diskName, paths)
+		if err != nil {
+			return deleted, err
+		}
+		for _, p := range paths {
+			if known[p] {
+				continue
+			}
+			if err := disk.Delete(ctx, p); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return deleted, fmt.Errorf("%s/%s: %w", diskName, p, err)
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func baseMimeType(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// compatibleMimeType covers types http.DetectContentType reports generically.
+func compatibleMimeType(declared, sniffed string) bool {
+	switch {
+	case declared == "image/jpg" && sniffed == "image/jpeg":
+		return true
+	case sniffed == "text/plain":
+		// SVG, CSV and similar text formats sniff as plain text or XML
+		return strings.HasPrefix(declared, "text/") || declared == "image/svg+xml"
+	case sniffed == "text/xml":
+		return declared == "image/svg+xml" || strings.HasSuffix(declared, "+xml")
+	case sniffed == "application/octet-stream":
+		// Formats the sniffer does not know (e.g. HEIC, AVIF) cannot be verified
+		return !strings.HasPrefix(declared, "text/")
+	}
+	return false
 }
 
 func (s *MediaServiceImpl) LinkMedia(ctx context.Context, mediaIDs []int, entityType string, entityID int, zone string) error {
-	for i, mediaID := range mediaIDs {
+	if !slices.Contains(domain.MediaZones, zone) {
+		return fmt.Errorf("unknown media zone %q", zone)
+	}
+
+	existing, err := s.mediaLinkRepo.GetByEntity(ctx, entityType, entityID, zone)
+	if err != nil {
+		return fmt.Errorf("failed to load media links: %w", err)
+	}
+	linked := make(map[int]bool, len(existing))
+	next := 0
+	for _, l := range existing {
+		linked[l.MediaID] = true
+		next = max(next, l.SortOrder+1)
+	}
+
+	// New media go to the end of the zone; relinking is a no-op
+	for _, mediaID := range mediaIDs {
+		if linked[mediaID] {
+			continue
+		}
+
+		asset, err := s.mediaRepo.FindByID(ctx, mediaID)
+		if err != nil {
+			return fmt.Errorf("failed to find media %d: %w", mediaID, err)
+		}
+		if asset.Status != domain.MediaReady {
+			return fmt.Errorf("media %d upload has not been completed", mediaID)
+		}
+
 		link := &domain.MediaLink{
 			MediaID:    mediaID,
 			EntityType: entityType,
 			EntityID:   entityID,
 			Zone:       zone,
-			SortOrder:  i,
+			SortOrder:  next,
 			CreatedAt:  time.Now(),
 		}
 		if err := s.mediaLinkRepo.Create(ctx, link); err != nil {
 			return fmt.Errorf("failed to link media %d: %w", mediaID, err)
 		}
+		linked[mediaID] = true
+		next++
 	}
 	return nil
 }
 
+func (s *MediaServiceImpl) ReorderMedia(ctx context.Context, entityType string, entityID int, zone string, mediaIDs []int) error {
+	return s.mediaLinkRepo.Reorder(ctx, entityType, entityID, zone, mediaIDs)
+}
+
+func (s *MediaServiceImpl) SetPrimaryMedia(ctx context.Context, mediaID int, entityType string, entityID int) error {
+	if err := s.mediaLinkRepo.SetPrimary(ctx, entityType, entityID, mediaID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("media %d is not linked to %s %d", mediaID, entityType, entityID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MediaServiceImpl) UpdateAltText(ctx context.Context, mediaID int, altText *string) (*domain.MediaAsset, error) {
+	asset, err := s.mediaRepo.FindByID(ctx, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find media asset: %w", err)
+	}
+
+	asset.AltText = nil
+	if altText != nil {
+		if text := strings.TrimSpace(*altText); text != "" {
+			asset.AltText = &text
+		}
+	}
+	asset.UpdatedAt = time.Now()
+	if err := s.mediaRepo.Update(ctx, asset); err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
 func (s *MediaServiceImpl) UnlinkMedia(ctx context.Context, mediaID int, entityType string, entityID int) error {
 	// Find and delete the specific link
 	links, err := s.mediaLinkRepo.Find(ctx, "media_id = ? AND entity_type = ? AND entity_id = ?", mediaID, entityType, entityID)
@@ -114,11 +365,206 @@ func (s *MediaServiceImpl) GetSignedURL(ctx context.Context, mediaID int) (strin
 		return "", fmt.Errorf("failed to find media asset: %w", err)
 	}
 
+	disk, err := s.disks.Disk(asset.Disk)
+	if err != nil {
+		return "", err
+	}
+
 	// Generate signed GET URL
-	signedURL, err := s.minioClient.PresignedGetObject(ctx, s.bucketName, asset.Path, time.Hour*24, nil)
+	return disk.PresignGet(ctx, asset.Path, signedURLExpiry)
+}
+
+func (s *MediaServiceImpl) ProcessPending(ctx context.Context, limit int) (int, error) {
+	assets, err := s.mediaRepo.FindUnprocessed(ctx, limit)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate signed GET URL: %w", err)
+		return 0, err
 	}
 
-	return signedURL.String(), nil
+	processed := 0
+	for i := range assets {
+		done, err := s.processAsset(ctx, &assets[i])
+		if err != nil {
+			return processed, fmt.Errorf("media %d: %w", assets[i].ID, err)
+		}
+		if done {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// processAsset returns false while the object has not landed in storage yet.
+// Storage errors are returned for a retry; bad images are marked failed.
+func (s *MediaServiceImpl) processAsset(ctx context.Context, asset *domain.MediaAsset) (bool, error) {
+	disk, err := s.disks.Disk(asset.Disk)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := disk.Stat(ctx, asset.Path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if !strings.HasPrefix(asset.MimeType, "image/") {
+		asset.ProcessedAt = &now
+		return true, s.mediaRepo.ReplaceRenditions(ctx, asset, nil)
+	}
+	if info.Size > maxProcessBytes {
+		return true, s.failAsset(ctx, asset, fmt.Sprintf("file too large to process (%d bytes)", info.Size))
+	}
+
+	r, err := disk.Get(ctx, asset.Path)
+	if err != nil {
+		return false, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return false, err
+	}
+
+	decoded, err := imaging.Decode(data)
+	if err != nil {
+		return true, s.failAsset(ctx, asset, "decode failed: "+err.Error())
+	}
+
+	// Replace the original with the EXIF-free copy (location, camera serials)
+	asset.SizeBytes = info.Size
+	if decoded.Clean != nil {
+		if err := disk.Put(ctx, asset.Path, bytes.NewReader(decoded.Clean), int64(len(decoded.Clean)), asset.MimeType); err != nil {
+			return false, err
+		}
+		sum := sha256.Sum256(decoded.Clean)
+		checksum := hex.EncodeToString(sum[:])
+		asset.SizeBytes = int64(len(decoded.Clean))
+		asset.Checksum = &checksum
+	}
+
+	var renditions []domain.MediaRendition
+	for _, spec := range renditionSpecs {
+		resized := imaging.Fit(decoded.Image, spec.MaxSide)
+		b := resized.Bounds()
+
+		for _, format := range []string{imaging.FormatWebP, imaging.FormatJPEG} {
+			encoded, err := imaging.Encode(resized, format)
+			if err != nil {
+				return true, s.failAsset(ctx, asset, "encode failed: "+err.Error())
+			}
+
+			ext := "jpg"
+			if format == imaging.FormatWebP {
+				ext = "webp"
+			}
+			path := fmt.Sprintf("renditions/%s/%s.%s", asset.UUID, spec.Name, ext)
+			if err := disk.Put(ctx, path, bytes.NewReader(encoded), int64(len(encoded)), imaging.ContentType(format)); err != nil {
+				return false, err
+			}
+
+			renditions = append(renditions, domain.MediaRendition{
+				MediaID:   asset.ID,
+				Name:      spec.Name,
+				Format:    format,
+				Path:      path,
+				Width:     b.Dx(),
+				Height:    b.Dy(),
+				SizeBytes: int64(len(encoded)),
+				CreatedAt: now,
+			})
+		}
+	}
+
+	width, height := decoded.Width, decoded.Height
+	asset.Width = &width
+	asset.Height = &height
+	if hash, err := imaging.Blurhash(decoded.Image); err == nil {
+		asset.Blurhash = &hash
+	}
+	asset.ProcessedAt = &now
+	asset.UpdatedAt = now
+
+	return true, s.mediaRepo.ReplaceRenditions(ctx, asset, renditions)
+}
+
+func (s *MediaServiceImpl) failAsset(ctx context.Context, asset *domain.MediaAsset, reason string) error {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	asset.ProcessingError = &reason
+	asset.UpdatedAt = time.Now()
+	return s.mediaRepo.Update(ctx, asset)
+}
+
+func (s *MediaServiceImpl) GetEntityMedia(ctx context.Context, entityType string, entityIDs []int) (map[int][]domain.MediaView, error) {
+	links, err := s.mediaLinkRepo.FindByEntities(ctx, entityType, entityIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make(map[int][]domain.MediaView, len(entityIDs))
+	for _, link := range links {
+		if link.Media == nil {
+			continue
+		}
+		view, err := s.mediaView(ctx, link)
+		if err != nil {
+			return nil, err
+		}
+		views[link.EntityID] = append(views[link.EntityID], *view)
+	}
+	return views, nil
+}
+
+func (s *MediaServiceImpl) mediaView(ctx context.Context, link domain.MediaLink) (*domain.MediaView, error) {
+	asset := link.Media
+	disk, err := s.disks.Disk(asset.Disk)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := objectURL(ctx, disk, asset.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &domain.MediaView{
+		ID:         asset.ID,
+		Zone:       link.Zone,
+		SortOrder:  link.SortOrder,
+		IsPrimary:  link.IsPrimary,
+		AltText:    asset.AltText,
+		Width:      asset.Width,
+		Height:     asset.Height,
+		Blurhash:   asset.Blurhash,
+		URL:        url,
+		Renditions: []domain.RenditionView{},
+	}
+	for _, r := range asset.Renditions {
+		rurl, err := objectURL(ctx, disk, r.Path)
+		if err != nil {
+			return nil, err
+		}
+		view.Renditions = append(view.Renditions, domain.RenditionView{
+			Name:   r.Name,
+			Format: r.Format,
+			Width:  r.Width,
+			Height: r.Height,
+			URL:    rurl,
+		})
+	}
+	return view, nil
+}
+
+// objectURL prefers the disk's public URL and falls back to a signed one.
+func objectURL(ctx context.Context, disk storage.Driver, path string) (string, error) {
+	if pub, ok := disk.(storage.PublicURLer); ok {
+		if u, ok := pub.PublicURL(path); ok {
+			return u, nil
+		}
+	}
+	return disk.PresignGet(ctx, path, signedURLExpiry)
 }
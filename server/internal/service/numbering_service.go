@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"server/internal/core/domain"
+	"server/internal/numbering"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultSeries applies to document types without a DocumentSeries row.
+var defaultSeries = map[domain.DocumentType]numbering.Series{
+	domain.DocSalesOrder:    {Prefix: "SO", IncludeYear: true, Padding: 6, YearlyReset: true},
+	domain.DocPurchaseOrder: {Prefix: "PO", IncludeYear: true, Padding: 5, YearlyReset: true},
+	domain.DocAssembly:      {Prefix: "ASM", IncludeYear: true, Padding: 5, YearlyReset: true},
+	domain.DocDisassembly:   {Prefix: "DIS", IncludeYear: true, Padding: 5, YearlyReset: true},
+	domain.DocInvoice:       {Prefix: "INV", IncludeYear: true, Padding: 6, YearlyReset: true},
+	domain.DocReturn:        {Prefix: "RET", IncludeYear: true, Padding: 5, YearlyReset: true},
+	domain.DocTransfer:      {Prefix: "TRF", IncludeYear: true, IncludeLocation: true, Padding: 4, YearlyReset: true},
+}
+
+type NumberingServiceImpl struct {
+	db *gorm.DB
+}
+
+func NewNumberingService(db *gorm.DB) NumberingService {
+	return &NumberingServiceImpl{db: db}
+}
+
+// GetSeries lists every document type with its stored or default series.
+func (s *NumberingServiceImpl) GetSeries(ctx context.Context) ([]domain.DocumentSeries, error) {
+	var stored []domain.DocumentSeries
+	if err := s.db.WithContext(ctx).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	byType := make(map[domain.DocumentType]domain.DocumentSeries, len(stored))
+	for _, ds := range stored {
+		byType[ds.DocType] = ds
+	}
+
+	out := make([]domain.DocumentSeries, 0, len(defaultSeries))
+	for _, t := range documentTypes() {
+		if ds, ok := byType[t]; ok {
+			out = append(out, ds)
+			continue
+		}
+		out = append(out, seriesRow(t, defaultSeries[t]))
+	}
+	return out, nil
+}
+
+// UpdateSeries changes how future numbers look. Issued numbers are kept and
+// counters continue, so a changed prefix does not restart at 1.
+func (s *NumberingServiceImpl) UpdateSeries(ctx context.Context, ds *domain.DocumentSeries) error {
+	if _, ok := defaultSeries[ds.DocType]; !ok {
+		return fmt.Errorf("unknown document type %q", ds.DocType)
+	}
+	ds.Prefix = strings.ToUpper(strings.TrimSpace(ds.Prefix))
+	if err := seriesOf(ds).Validate(); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Select("*").Save(ds).Error
+}
+
+// nextDocumentNumber issues the next number of docType within tx, which must
+// be the transaction inserting the document. The counter row stays locked
+// until tx ends, so concurrent callers queue and a rollback frees the number.
+func nextDocumentNumber(tx *gorm.DB, docType domain.DocumentType, location string) (string, error) {
+	series, ok := defaultSeries[docType]
+	if !ok {
+		return "", fmt.Errorf("unknown document type %q", docType)
+	}
+	var stored domain.DocumentSeries
+	err := tx.Where("doc_type = ?", docType).First(&stored).Error
+	if err == nil {
+		series = seriesOf(&stored)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	year := time.Now().Year()
+	var seq int64
+	err = tx.Raw(`INSERT INTO document_counters (doc_type, scope, last_value, updated_at)
+		VALUES (?, ?, 1, NOW())
+		ON CONFLICT (doc_type, scope) DO UPDATE
+		SET last_value = document_counters.last_value + 1, updated_at = NOW()
+		RETURNING last_value`, docType, series.Scope(year, location)).Scan(&seq).Error
+	if err != nil {
+		return "", err
+	}
+	return series.Format(seq, year, location), nil
+}
+
+// locationCode looks up the code printed in location-scoped numbers.
+func locationCode(tx *gorm.DB, locationID int) (string, error) {
+	var code string
+	err := tx.Model(&domain.InventoryLocation{}).Where("id = ?", locationID).Pluck("code", &code).Error
+	return code, err
+}
+
+func documentTypes() []domain.DocumentType {
+	return []domain.DocumentType{
+		domain.DocSalesOrder, domain.DocPurchaseOrder, domain.DocAssembly, domain.DocDisassembly,
+		domain.DocInvoice, domain.DocReturn, domain.DocTransfer,
+	}
+}
+
+func seriesOf(ds *domain.DocumentSeries) numbering.Series {
+	return numbering.Series{
+		Prefix:          ds.Prefix,
+		IncludeYear:     ds.IncludeYear,
+		IncludeLocation: ds.IncludeLocation,
+		Padding:         ds.Padding,
+		YearlyReset:     ds.YearlyReset,
+	}
+}
+
+func seriesRow(t domain.DocumentType, s numbering.Series) domain.DocumentSeries {
+	return domain.DocumentSeries{
+		DocType:         t,
+		Prefix:          s.Prefix,
+		IncludeYear:     s.IncludeYear,
+		IncludeLocation: s.IncludeLocation,
+		Padding:         s.Padding,
+		YearlyReset:     s.YearlyReset,
+	}
+}
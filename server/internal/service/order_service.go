@@ -3,24 +3,33 @@ package service
 import (
 	"context"
 	"errors"
+	"math"
 	"server/internal/core/domain"
 	"server/internal/dto"
 	"server/internal/repository"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrOrderNotPayable is returned when payment arrives for a cancelled order.
+var ErrOrderNotPayable = errors.New("order is cancelled and cannot be paid")
+
 type OrderServiceImpl struct {
 	orderRepo        repository.OrderRepository
 	InventoryService InventoryService
 	db               *gorm.DB // <-- Perbaikan Arsitektur: Inject DB
+	reservationTTL   time.Duration
 }
 
-func NewOrderService(orderRepo repository.OrderRepository, inventoryService InventoryService, db *gorm.DB) OrderService {
+// NewOrderService holds stock for unpaid orders for reservationTTL.
+func NewOrderService(orderRepo repository.OrderRepository, inventoryService InventoryService, db *gorm.DB, reservationTTL time.Duration) OrderService {
 	return &OrderServiceImpl{
 		orderRepo:        orderRepo,
 		InventoryService: inventoryService,
 		db:               db,
+		reservationTTL:   reservationTTL,
 	}
 }
 
@@ -29,10 +38,204 @@ func (s *OrderServiceImpl) GetByPOSSession(ctx context.Context, sessionID int) (
 }
 
 func (s *OrderServiceImpl) PlaceOrder(ctx context.Context, order *domain.SalesOrder) error {
-	// Logic expansion: Here is where you should eventually put:
-	// 1. Validate Stock (call inventoryService)
-	// 2. Calculate Totals (call cartService)
-	return s.orderRepo.Create(ctx, order)
+	// Unpaid orders hold their stock until paid or expired; paid ones
+	// (POS) take it off hand right away. Callers may hold an order longer,
+	// as subscription runs do while payment is retried.
+	now := time.Now()
+	paid := order.PaymentStatus == domain.PaymentPaid
+	if !paid && (order.ExpiresAt == nil || order.ExpiresAt.Before(now)) {
+		expiresAt := now.Add(s.reservationTTL)
+		order.ExpiresAt = &expiresAt
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		number, err := nextDocumentNumber(tx, domain.DocSalesOrder, "")
+		if err != nil {
+			return err
+		}
+		order.OrderNumber = number
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		holdUntil := now
+		if order.ExpiresAt != nil {
+			holdUntil = *order.ExpiresAt
+		}
+		if err := reserveStockTx(tx, order, holdUntil); err != nil {
+			return err
+		}
+		if err := settleDepositTx(tx, order); err != nil {
+			return err
+		}
+		if err := holdSubscriptionRunTx(tx, order); err != nil {
+			return err
+		}
+		if paid {
+			if err := convertReservationsTx(tx, order.ID, order.CreatedBy); err != nil {
+				return err
+			}
+		}
+		if err := redeemOrderCoupons(tx, order); err != nil {
+			return err
+		}
+		return redeemOrderPointsTx(tx, order)
+	})
+}
+
+// ConfirmPayment marks an unpaid order paid and turns its reservations into
+// SALE movements. Confirming a paid order again does nothing.
+func (s *OrderServiceImpl) ConfirmPayment(ctx context.Context, orderID int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return confirmOrderPaymentTx(tx, orderID)
+	})
+}
+
+// confirmOrderPaymentTx is ConfirmPayment inside the caller's transaction,
+// for payment flows that record the Payment row in the same commit.
+func confirmOrderPaymentTx(tx *gorm.DB, orderID int) error {
+	var order domain.SalesOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if order.PaymentStatus == domain.PaymentPaid {
+		return nil
+	}
+	if order.Status == domain.OrderCancelled {
+		return ErrOrderNotPayable
+	}
+
+	if err := convertReservationsTx(tx, order.ID, nil); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"payment_status": domain.PaymentPaid,
+		"expires_at":     nil,
+		"updated_at":     time.Now(),
+	}
+	waiting, err := hasBackordersTx(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	if order.Channel == domain.ChannelPOS && !waiting {
+		// Counter sales leave with the customer once paid
+		updates["status"] = domain.OrderCompleted
+		updates["shipment_status"] = domain.ShipmentDelivered
+	} else if order.Status == domain.OrderDraft {
+		updates["status"] = domain.OrderConfirmed
+	}
+	if err := tx.Model(&order).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := earnOrderPointsTx(tx, &order); err != nil {
+		return err
+	}
+	if err := markRecoveredTx(tx, &order); err != nil {
+		return err
+	}
+	if err := completeSubscriptionRunTx(tx, &order); err != nil {
+		return err
+	}
+	return issueOrderGiftCardsTx(tx, &order)
+}
+
+// confirmDepositTx confirms a draft order once its deposit is paid: stock
+// held for it is taken off hand and it no longer expires. The order stays
+// partially paid until the balance comes in.
+func confirmDepositTx(tx *gorm.DB, orderID int) error {
+	var order domain.SalesOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if order.Status != domain.OrderDraft {
+		return nil
+	}
+	if err := convertReservationsTx(tx, order.ID, nil); err != nil {
+		return err
+	}
+	return tx.Model(&order).Updates(map[string]interface{}{
+		"status":     domain.OrderConfirmed,
+		"expires_at": nil,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// ExpireUnpaidOrders cancels unpaid orders past ExpiresAt, releasing their
+// reservations, coupon redemptions and redeemed points. Web orders paid only
+// in part with gift card or store credit are cancelled too and the stored
+// value refunded; anything paid through the gateway is left for staff.
+func (s *OrderServiceImpl) ExpireUnpaidOrders(ctx context.Context) (int, error) {
+	var ids []int
+	if err := expirableOrders(s.db.WithContext(ctx).Model(&domain.SalesOrder{})).
+		Where("expires_at < ?", time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Conditional update: a payment may have arrived meanwhile
+			res := expirableOrders(tx.Model(&domain.SalesOrder{})).
+				Where("id = ?", id).
+				Updates(map[string]interface{}{"status": domain.OrderCancelled, "updated_at": time.Now()})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			if err := releaseReservationsTx(tx, id); err != nil {
+				return err
+			}
+			if err := tx.Where("sales_order_id = ?", id).Delete(&domain.PromotionUsage{}).Error; err != nil {
+				return err
+			}
+			var order domain.SalesOrder
+			if err := tx.Select("id", "order_number", "customer_id", "points_redeemed").First(&order, id).Error; err != nil {
+				return err
+			}
+			if err := restoreOrderPointsTx(tx, &order); err != nil {
+				return err
+			}
+			// Gift card or store credit drawn towards a web order whose
+			// gateway part was never paid goes back onto its balance
+			if err := refundStoredValueTx(tx, &order, math.Inf(1)); err != nil {
+				return err
+			}
+			expired++
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// expirableOrders narrows q to orders that lapse at ExpiresAt: unpaid ones,
+// and web orders only partly paid with gift card or store credit. Orders
+// confirmed by a deposit and POS orders waiting at the till do not lapse.
+func expirableOrders(q *gorm.DB) *gorm.DB {
+	return q.Where("status NOT IN ?", []domain.OrderStatus{domain.OrderCancelled, domain.OrderConfirmed}).
+		Where("payment_status = ? OR (payment_status = ? AND channel <> ? AND NOT EXISTS ("+
+			"SELECT 1 FROM payments p WHERE p.sales_order_id = sales_orders.id AND p.type = ? AND p.status = ? AND UPPER(p.method) NOT IN ?))",
+			domain.PaymentUnpaid, domain.PaymentPartiallyPaid, domain.ChannelPOS,
+			domain.TransCredit, domain.PaymentPaid, []string{MethodGiftCard, MethodStoreCredit})
+}
+
+// redeemOrderCoupons records a PromotionUsage for every coupon on the order,
+// failing the whole placement if a limit was reached in the meantime.
+func redeemOrderCoupons(tx *gorm.DB, order *domain.SalesOrder) error {
+	shopper := Shopper{CustomerID: order.CustomerID, Email: derefString(order.GuestEmail)}
+	for _, p := range order.Promotions {
+		if _, isCoupon := p.MetaData["code"]; !isCoupon {
+			continue
+		}
+		if shopper.CustomerID == nil && shopper.Email == "" {
+			return errors.New("coupons require a customer account or email")
+		}
+		if err := redeemCouponTx(tx, p.PromotionID, shopper, order.ID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *OrderServiceImpl) GetOrder(ctx context.Context, orderNumber string) (*domain.SalesOrder, error) {
@@ -52,6 +255,9 @@ func (s *OrderServiceImpl) CancelOrder(ctx context.Context, orderID int, reason
 	if order.Status == domain.OrderShipped || order.Status == domain.OrderCompleted {
 		return errors.New("Order cannot be cancelled: Item has already been shipped or completed")
 	}
+	if order.Status == domain.OrderCancelled {
+		return errors.New("Order is already cancelled")
+	}
 
 	tx := s.db.WithContext(ctx).Begin()
 	if tx.Error != nil {
@@ -63,21 +269,40 @@ func (s *OrderServiceImpl) CancelOrder(ctx context.Context, orderID int, reason
 		}
 	}()
 
-	for _, item := range order.Items {
-		cmd := StockMoveCmd{
-			LocationID:    1, // TODO: Tentukan Lokasi Gudang
-			VariantID:     item.VariantID,
-			QtyChange:     item.Quantity, // Quantity positif = penambahan stok
-			Reason:        domain.ReasonReturn,
-			ReferenceID:   orderID,
-			ReferenceType: "sales_orders",
-			// UserID:        userID, // TODO: Dapatkan dari context/auth
-		}
+	// Held units go back to available stock; units already taken off hand
+	// return to the locations they were sold from
+	if err := releaseReservationsTx(tx, order.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := restockOrderTx(tx, order.ID, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		if err := s.InventoryService.ExecuteMovement(ctx, cmd); err != nil {
-			tx.Rollback()
-			return err
-		}
+	// Give coupon redemptions and spent points back to the customer, and
+	// take back the points the order earned
+	if err := tx.Where("sales_order_id = ?", order.ID).Delete(&domain.PromotionUsage{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := restoreOrderPointsTx(tx, order); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := clawbackOrderPointsTx(tx, order, 1); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// Gift card and store credit tenders go back onto their balances, and
+	// gift cards the order sold are withdrawn
+	if err := refundStoredValueTx(tx, order, math.Inf(1)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := disableOrderGiftCardsTx(tx, order.ID); err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	order.Status = domain.OrderCancelled
@@ -96,8 +321,49 @@ func (s *OrderServiceImpl) ProcessReturn(ctx context.Context, orderID int, items
 		return err
 	}
 
-	order.Status = domain.OrderReturned // Simplification
-	return s.orderRepo.Update(ctx, order)
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		refunded := 0.0
+		for i := range items {
+			if items[i].RefundAmount != nil {
+				refunded += *items[i].RefundAmount
+			}
+			number, err := nextDocumentNumber(tx, domain.DocReturn, "")
+			if err != nil {
+				return err
+			}
+			items[i].ID = 0
+			items[i].ReturnNumber = number
+			items[i].SalesOrderID = order.ID
+			if err := tx.Create(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		// Points follow the refund; a return without amounts takes them all
+		share := 1.0
+		if refunded > 0 && order.TotalAmount > 0 {
+			share = refunded / order.TotalAmount
+		}
+		if err := clawbackOrderPointsTx(tx, order, share); err != nil {
+			return err
+		}
+
+		// Stored-value tenders are refunded like the points; gateway
+		// payments go through Refund
+		limit := math.Inf(1)
+		if refunded > 0 {
+			limit = refunded
+		}
+		if err := refundStoredValueTx(tx, order, limit); err != nil {
+			return err
+		}
+		if err := disableOrderGiftCardsTx(tx, order.ID); err != nil {
+			return err
+		}
+
+		order.Status = domain.OrderReturned // Simplification
+		return tx.Model(order).Updates(map[string]interface{}{"status": order.Status, "updated_at": time.Now()}).Error
+	})
 }
 
 func (s *OrderServiceImpl) GetOrderList(ctx context.Context, filter dto.OrderFilterParams) ([]domain.SalesOrder, int64, error) {
@@ -0,0 +1,854 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/payment"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPaymentNotFound is returned for notifications about charges we never started.
+	ErrPaymentNotFound   = errors.New("payment not found")
+	ErrRefundExceedsPaid = errors.New("refund exceeds the amount paid")
+	// ErrRefundFailed is a gateway refund the provider did not carry out;
+	// the rest of the refund stands.
+	ErrRefundFailed = errors.New("refund failed at the payment provider")
+	// ErrInvalidTender wraps why a set of tenders cannot pay an order.
+	ErrInvalidTender = errors.New("invalid payment")
+	// ErrPaymentDeclined is a saved payment method the provider refused.
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrAmountMismatch is a paid notification for a different amount than
+	// the charge asked for; the charge is left unpaid.
+	ErrAmountMismatch = errors.New("paid amount does not match the charge")
+)
+
+type PaymentServiceImpl struct {
+	provider payment.Provider
+	db       *gorm.DB
+}
+
+func NewPaymentService(provider payment.Provider, db *gorm.DB) PaymentService {
+	return &PaymentServiceImpl{provider: provider, db: db}
+}
+
+func (s *PaymentServiceImpl) StartPayment(ctx context.Context, order *domain.SalesOrder, email string, splits []Tender) ([]dto.PaymentLink, error) {
+	due := amountDue(order)
+	if len(splits) == 0 {
+		if due == 0 {
+			// Nothing to charge, e.g. fully discounted
+			return nil, s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return settleOrderTx(tx, order)
+			})
+		}
+		splits = []Tender{{Method: order.PaymentMethod, Amount: due}}
+	}
+	if err := checkSplits(due, splits); err != nil {
+		return nil, err
+	}
+
+	// The provider is charged first, so a gateway failure leaves no gift card
+	// or store credit drawn; stored value is drawn once the charges exist
+	var charges, stored []Tender
+	for _, split := range splits {
+		if isStoredValue(split.Method) {
+			stored = append(stored, split)
+		} else {
+			charges = append(charges, split)
+		}
+	}
+
+	db := s.db.WithContext(ctx)
+	account, err := providerAccount(db, s.provider.Name())
+	if err != nil {
+		return nil, err
+	}
+	links := make([]dto.PaymentLink, 0, len(charges))
+	for _, split := range charges {
+		charge, err := s.provider.CreateCharge(ctx, payment.ChargeRequest{
+			OrderNumber: order.OrderNumber,
+			Amount:      split.Amount,
+			Currency:    "IDR",
+			Email:       email,
+			Method:      split.Method,
+		})
+		if err != nil {
+			return nil, err
+		}
+		method := split.Method
+		if method == "" {
+			method = s.provider.Name()
+		}
+		row := domain.Payment{
+			SalesOrderID:         &order.ID,
+			FinancialAccountID:   account.ID,
+			TransactionReference: &charge.ProviderRef,
+			Type:                 domain.TransCredit,
+			Amount:               split.Amount,
+			Currency:             "IDR",
+			Method:               method,
+			Status:               domain.PaymentUnpaid,
+			ExpiresAt:            charge.ExpiresAt,
+		}
+		if charge.RedirectURL != "" {
+			row.PaymentURL = &charge.RedirectURL
+		}
+		if err := db.Create(&row).Error; err != nil {
+			return nil, err
+		}
+		links = append(links, dto.PaymentLink{Method: method, Amount: split.Amount, PaymentURL: charge.RedirectURL})
+	}
+
+	if len(stored) > 0 {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var locked domain.SalesOrder
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, order.ID).Error; err != nil {
+				return err
+			}
+			for _, t := range stored {
+				if _, err := recordTenderTx(tx, &locked, plannedTender{Tender: t, Applied: roundMoney(t.Amount)}, nil); err != nil {
+					return err
+				}
+			}
+			return settleOrderTx(tx, &locked)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// ChargeSaved charges what the order owes to a payment method the customer
+// saved with the provider. The charge is recorded as pending before the
+// provider is called, so a crash during the call leaves a row that blocks
+// charging again rather than money taken with nothing recorded. A charge the
+// provider settles at once is marked paid and settles the order; a pending
+// one is left to the webhook, and a declined one is kept as failed.
+func (s *PaymentServiceImpl) ChargeSaved(ctx context.Context, order *domain.SalesOrder, email, token string) (bool, error) {
+	due := amountDue(order)
+	if due == 0 {
+		return true, s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return settleOrderTx(tx, order)
+		})
+	}
+	db := s.db.WithContext(ctx)
+	account, err := providerAccount(db, s.provider.Name())
+	if err != nil {
+		return false, err
+	}
+	method := order.PaymentMethod
+	if method == "" {
+		method = s.provider.Name()
+	}
+	row := domain.Payment{
+		SalesOrderID:       &order.ID,
+		FinancialAccountID: account.ID,
+		Type:               domain.TransCredit,
+		Amount:             due,
+		Currency:           "IDR",
+		Method:             method,
+		Status:             domain.PaymentUnpaid,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return false, err
+	}
+
+	charge, err := s.provider.CreateCharge(ctx, payment.ChargeRequest{
+		OrderNumber: order.OrderNumber,
+		Amount:      due,
+		Currency:    "IDR",
+		Email:       email,
+		Method:      order.PaymentMethod,
+		SavedToken:  token,
+	})
+	if err != nil {
+		if uerr := db.Model(&row).Update("status", domain.PaymentFailed).Error; uerr != nil {
+			log.Printf("payment %d: marking failed charge: %v", row.ID, uerr)
+		}
+		return false, err
+	}
+
+	updates := map[string]interface{}{"transaction_reference": charge.ProviderRef}
+	switch charge.Status {
+	case payment.StatusPaid:
+		now := time.Now()
+		row.Status = domain.PaymentPaid
+		updates["status"] = domain.PaymentPaid
+		updates["paid_at"] = now
+	case payment.StatusFailed, payment.StatusExpired:
+		row.Status = domain.PaymentFailed
+		updates["status"] = domain.PaymentFailed
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&row).Updates(updates).Error; err != nil {
+			return err
+		}
+		if row.Status != domain.PaymentPaid {
+			return nil
+		}
+		var locked domain.SalesOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, order.ID).Error; err != nil {
+			return err
+		}
+		return settleOrderTx(tx, &locked)
+	})
+	if err != nil {
+		return false, err
+	}
+	if row.Status == domain.PaymentFailed {
+		return false, ErrPaymentDeclined
+	}
+	return row.Status == domain.PaymentPaid, nil
+}
+
+func (s *PaymentServiceImpl) CheckTenders(ctx context.Context, order *domain.SalesOrder, tenders []Tender) error {
+	if order.Channel == domain.ChannelPOS {
+		if _, _, err := planTenders(roundMoney(order.TotalAmount), tenders); err != nil {
+			return err
+		}
+	} else if err := checkSplits(amountDue(order), tenders); err != nil {
+		return err
+	}
+	db := s.db.WithContext(ctx)
+	for _, t := range tenders {
+		if err := checkStoredValue(db, t, order.CustomerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PaymentServiceImpl) RecordTenders(ctx context.Context, orderID int, sessionID *int, tenders []Tender) (*dto.TenderResult, error) {
+	result := &dto.TenderResult{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order domain.SalesOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if order.Status == domain.OrderCancelled {
+			return ErrOrderNotPayable
+		}
+		paid, err := paidAmountTx(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		planned, change, err := planTenders(roundMoney(order.TotalAmount-paid), tenders)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range planned {
+			row, err := recordTenderTx(tx, &order, p, sessionID)
+			if err != nil {
+				return err
+			}
+			result.Payments = append(result.Payments, *row)
+		}
+		if err := settleOrderTx(tx, &order); err != nil {
+			return err
+		}
+
+		if err := tx.First(&order, order.ID).Error; err != nil {
+			return err
+		}
+		result.PaidAmount = order.PaidAmount
+		result.Outstanding = roundMoney(math.Max(order.TotalAmount-order.PaidAmount, 0))
+		result.Change = change
+		result.PaymentStatus = order.PaymentStatus
+		return tx.Where("sales_order_id = ?", order.ID).Order("id").Find(&result.GiftCards).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// HandleWebhook applies a provider notification to the charge it names.
+// Statuses only move forward, so redelivered notifications are no-ops.
+func (s *PaymentServiceImpl) HandleWebhook(ctx context.Context, body []byte) error {
+	event, err := s.provider.ParseWebhook(body)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var charge domain.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("transaction_reference = ? AND type = ?", event.ProviderRef, domain.TransCredit).
+			First(&charge).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var order domain.SalesOrder
+		if err := tx.First(&order, charge.SalesOrderID).Error; err != nil {
+			return err
+		}
+		if order.OrderNumber != event.OrderNumber {
+			return ErrPaymentNotFound
+		}
+
+		switch event.Status {
+		case payment.StatusPaid:
+			if charge.Status != domain.PaymentUnpaid && charge.Status != domain.PaymentFailed {
+				return nil
+			}
+			if roundMoney(event.Amount) != roundMoney(charge.Amount) {
+				// Settling on the provider's figure would rewrite what we
+				// charged; the charge stays unpaid for someone to look into
+				log.Printf("payment %s for order %s reported %.2f paid, %.2f was charged; left unpaid",
+					event.ProviderRef, order.OrderNumber, event.Amount, charge.Amount)
+				return ErrAmountMismatch
+			}
+			now := time.Now()
+			updates := map[string]interface{}{"status": domain.PaymentPaid, "paid_at": now}
+			if event.Method != "" {
+				updates["method"] = event.Method
+			}
+			if err := tx.Model(&charge).Updates(updates).Error; err != nil {
+				return err
+			}
+			err := settleOrderTx(tx, &order)
+			if errors.Is(err, ErrOrderNotPayable) {
+				// Money arrived after the order expired; keep the payment for a refund
+				log.Printf("payment %s received for cancelled order %s", event.ProviderRef, order.OrderNumber)
+				return nil
+			}
+			return err
+
+		case payment.StatusFailed, payment.StatusExpired:
+			if charge.Status != domain.PaymentUnpaid {
+				return nil
+			}
+			return tx.Model(&charge).Update("status", domain.PaymentFailed).Error
+
+		case payment.StatusRefunded:
+			// Refunded from the provider's dashboard: the whole charge is gone
+			if charge.Status != domain.PaymentPaid && charge.Status != domain.PaymentPartiallyRefunded {
+				return nil
+			}
+			refunded, err := refundedAmountTx(tx, charge.ID)
+			if err != nil {
+				return err
+			}
+			if remainder := roundMoney(charge.Amount - refunded); remainder > 0 {
+				if _, err := recordRefundTx(tx, &charge, charge.FinancialAccountID, charge.Method, event.ProviderRef, remainder); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&charge).Update("status", domain.PaymentRefunded).Error; err != nil {
+				return err
+			}
+			return updateOrderRefundStatusTx(tx, order.ID)
+		}
+		return nil
+	})
+}
+
+// Refund returns amount of an order's payments, oldest first. Gateway
+// charges are refunded through the provider and gift card or store credit
+// payments back onto their balance; cash and card-terminal payments are
+// refunded at the till. With toStoreCredit any payment qualifies and the
+// money goes to the customer's store credit instead.
+//
+// Gateway refunds are recorded as pending and committed before the provider
+// is called, so no row locks are held during the call and a concurrent
+// refund cannot take the same money; each is settled once the provider
+// answers.
+func (s *PaymentServiceImpl) Refund(ctx context.Context, orderID int, amount float64, toStoreCredit bool) ([]domain.Payment, error) {
+	amount = roundMoney(amount)
+	if amount <= 0 {
+		return nil, errors.New("refund amount must be positive")
+	}
+
+	var pending []pendingRefund
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order domain.SalesOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if toStoreCredit && order.CustomerID == nil {
+			return ErrNoCustomer
+		}
+		gateway, err := providerAccount(tx, s.provider.Name())
+		if err != nil {
+			return err
+		}
+		var paid []domain.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("sales_order_id = ? AND type = ? AND status IN ?",
+				orderID, domain.TransCredit, []domain.PaymentStatus{domain.PaymentPaid, domain.PaymentPartiallyRefunded}).
+			Order("id").Find(&paid).Error; err != nil {
+			return err
+		}
+
+		var charges []domain.Payment
+		var refundable []float64
+		total := 0.0
+		for _, p := range paid {
+			if !toStoreCredit && p.FinancialAccountID != gateway.ID && !isStoredValue(p.Method) {
+				continue
+			}
+			refunded, err := refundedAmountTx(tx, p.ID)
+			if err != nil {
+				return err
+			}
+			charges = append(charges, p)
+			refundable = append(refundable, roundMoney(p.Amount-refunded))
+			total += roundMoney(p.Amount - refunded)
+		}
+		if amount > roundMoney(total) {
+			return ErrRefundExceedsPaid
+		}
+
+		remaining := amount
+		for i := range charges {
+			if remaining <= 0 {
+				break
+			}
+			part := math.Min(remaining, refundable[i])
+			if part <= 0 {
+				continue
+			}
+			p, err := refundPartTx(tx, &order, &charges[i], part, toStoreCredit)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				pending = append(pending, *p)
+			}
+			remaining = roundMoney(remaining - part)
+		}
+		return updateOrderRefundStatusTx(tx, orderID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completeErr := s.completeRefunds(ctx, pending)
+	var refunds []domain.Payment
+	if err := s.db.WithContext(ctx).Where("sales_order_id = ? AND type = ?", orderID, domain.TransDebit).Order("id").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	return refunds, completeErr
+}
+
+// refundStoredValueTx puts up to limit of an order's gift card and store
+// credit payments back onto their balances, newest first. Gateway payments
+// are left to Refund, which has to call the provider.
+func refundStoredValueTx(tx *gorm.DB, order *domain.SalesOrder, limit float64) error {
+	var paid []domain.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("sales_order_id = ? AND type = ? AND status IN ?",
+			order.ID, domain.TransCredit, []domain.PaymentStatus{domain.PaymentPaid, domain.PaymentPartiallyRefunded}).
+		Order("id DESC").Find(&paid).Error; err != nil {
+		return err
+	}
+
+	remaining := roundMoney(limit)
+	refundedAny := false
+	for i := range paid {
+		if remaining <= 0 {
+			break
+		}
+		if !isStoredValue(paid[i].Method) {
+			continue
+		}
+		refunded, err := refundedAmountTx(tx, paid[i].ID)
+		if err != nil {
+			return err
+		}
+		part := math.Min(remaining, roundMoney(paid[i].Amount-refunded))
+		if part <= 0 {
+			continue
+		}
+		if _, err := refundPartTx(tx, order, &paid[i], part, false); err != nil {
+			return err
+		}
+		remaining = roundMoney(remaining - part)
+		refundedAny = true
+	}
+	if !refundedAny {
+		return nil
+	}
+	return updateOrderRefundStatusTx(tx, order.ID)
+}
+
+// pendingRefund is a gateway refund recorded but not yet sent to the provider.
+type pendingRefund struct {
+	Row    *domain.Payment
+	Charge domain.Payment
+}
+
+// refundPartTx refunds part of one charge and records the DEBIT row. Stored
+// value goes back onto its balance at once; a gateway refund is returned
+// pending, for completeRefunds once the transaction has committed.
+func refundPartTx(tx *gorm.DB, order *domain.SalesOrder, charge *domain.Payment, part float64, toStoreCredit bool) (*pendingRefund, error) {
+	ref := storedValueRef{OrderID: &order.ID, Note: "Refund of " + order.OrderNumber}
+	switch {
+	case toStoreCredit || isStoreCredit(charge.Method):
+		accountID, err := tenderAccount(tx, Tender{Method: MethodStoreCredit})
+		if err != nil {
+			return nil, err
+		}
+		row, err := recordRefundTx(tx, charge, accountID, MethodStoreCredit, "", part)
+		if err != nil {
+			return nil, err
+		}
+		ref.PaymentID = &row.ID
+		if _, err := moveStoreCreditTx(tx, *order.CustomerID, part, domain.StoredValueRefund, ref); err != nil {
+			return nil, err
+		}
+		return nil, markChargeRefundedTx(tx, charge)
+
+	case isGiftCard(charge.Method):
+		code := derefString(charge.TransactionReference)
+		row, err := recordRefundTx(tx, charge, charge.FinancialAccountID, charge.Method, code, part)
+		if err != nil {
+			return nil, err
+		}
+		ref.PaymentID = &row.ID
+		if _, err := moveGiftCardTx(tx, code, part, domain.StoredValueRefund, ref); err != nil {
+			return nil, err
+		}
+		return nil, markChargeRefundedTx(tx, charge)
+
+	default:
+		row := &domain.Payment{
+			SalesOrderID:       charge.SalesOrderID,
+			FinancialAccountID: charge.FinancialAccountID,
+			Type:               domain.TransDebit,
+			RefundOfID:         &charge.ID,
+			Amount:             part,
+			Currency:           charge.Currency,
+			Method:             charge.Method,
+			Status:             domain.PaymentRefundPending,
+		}
+		if err := tx.Create(row).Error; err != nil {
+			return nil, err
+		}
+		return &pendingRefund{Row: row, Charge: *charge}, nil
+	}
+}
+
+// completeRefunds sends pending gateway refunds to the provider and settles
+// each with the outcome. A declined refund is marked FAILED, which frees
+// the amount again; the first provider error is returned.
+func (s *PaymentServiceImpl) completeRefunds(ctx context.Context, pending []pendingRefund) error {
+	var firstErr error
+	for _, p := range pending {
+		res, callErr := s.provider.Refund(ctx, derefString(p.Charge.TransactionReference), p.Row.Amount)
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if callErr != nil {
+				return tx.Model(p.Row).Update("status", domain.PaymentFailed).Error
+			}
+			now := time.Now()
+			if err := tx.Model(p.Row).Updates(map[string]interface{}{
+				"status":                domain.PaymentRefunded,
+				"transaction_reference": res.ProviderRef,
+				"paid_at":               now,
+			}).Error; err != nil {
+				return err
+			}
+			if err := markChargeRefundedTx(tx, &p.Charge); err != nil {
+				return err
+			}
+			return updateOrderRefundStatusTx(tx, *p.Charge.SalesOrderID)
+		})
+		if callErr != nil {
+			err = fmt.Errorf("%w: payment %d: %v", ErrRefundFailed, p.Charge.ID, callErr)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// markChargeRefundedTx sets a charge to REFUNDED or PARTIALLY_REFUNDED from
+// its settled refunds.
+func markChargeRefundedTx(tx *gorm.DB, charge *domain.Payment) error {
+	var settled float64
+	if err := tx.Model(&domain.Payment{}).Where("refund_of_id = ? AND status = ?", charge.ID, domain.PaymentRefunded).
+		Select("COALESCE(SUM(amount), 0)").Scan(&settled).Error; err != nil {
+		return err
+	}
+	if settled <= 0 {
+		return nil
+	}
+	status := domain.PaymentPartiallyRefunded
+	if roundMoney(settled) >= roundMoney(charge.Amount) {
+		status = domain.PaymentRefunded
+	}
+	return tx.Model(&domain.Payment{}).Where("id = ?", charge.ID).Update("status", status).Error
+}
+
+func (s *PaymentServiceImpl) GetPayments(ctx context.Context, orderID int) ([]domain.Payment, error) {
+	var payments []domain.Payment
+	err := s.db.WithContext(ctx).Where("sales_order_id = ?", orderID).Order("id").Find(&payments).Error
+	return payments, err
+}
+
+// settleOrderTx records what the order's payments add up to, confirming it
+// once they cover the total and marking it partially paid before that. A
+// paid deposit confirms the order without completing its payment.
+func settleOrderTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.Status == domain.OrderCancelled {
+		return ErrOrderNotPayable
+	}
+	paid, err := paidAmountTx(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"paid_amount": paid, "updated_at": time.Now()}
+	if paid < roundMoney(order.TotalAmount) {
+		if paid > 0 {
+			updates["payment_status"] = domain.PaymentPartiallyPaid
+		}
+		if err := tx.Model(&domain.SalesOrder{}).Where("id = ?", order.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if order.DepositAmount > 0 && paid >= roundMoney(order.DepositAmount) {
+			return confirmDepositTx(tx, order.ID)
+		}
+		return nil
+	}
+	if err := tx.Model(&domain.SalesOrder{}).Where("id = ?", order.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return confirmOrderPaymentTx(tx, order.ID)
+}
+
+// amountDue is what an online payment charges now: the rest of the
+// deposit while it is not covered, the rest of the total after that.
+func amountDue(order *domain.SalesOrder) float64 {
+	if order.DepositAmount > 0 && order.PaidAmount < order.DepositAmount {
+		return roundMoney(order.DepositAmount - order.PaidAmount)
+	}
+	return roundMoney(math.Max(order.TotalAmount-order.PaidAmount, 0))
+}
+
+func paidAmountTx(tx *gorm.DB, orderID int) (float64, error) {
+	var paid float64
+	err := tx.Model(&domain.Payment{}).
+		Where("sales_order_id = ? AND type = ? AND status = ?", orderID, domain.TransCredit, domain.PaymentPaid).
+		Select("COALESCE(SUM(amount), 0)").Scan(&paid).Error
+	return roundMoney(paid), err
+}
+
+type plannedTender struct {
+	Tender
+	Applied float64 // Towards the order
+	Change  float64
+}
+
+// planTenders applies tenders to what is owed. Card and QR payments go
+// first since they are exact; cash covers the rest and any surplus on it is
+// change. Paying less than owed is allowed and leaves the order partially paid.
+func planTenders(owed float64, tenders []Tender) ([]plannedTender, float64, error) {
+	if owed <= 0 {
+		return nil, 0, fmt.Errorf("%w: nothing is owed on this order", ErrInvalidTender)
+	}
+	if len(tenders) == 0 {
+		return nil, 0, fmt.Errorf("%w: no payments given", ErrInvalidTender)
+	}
+	ordered := make([]Tender, 0, len(tenders))
+	for _, t := range tenders {
+		if t.Method == "" || t.Amount <= 0 {
+			return nil, 0, fmt.Errorf("%w: every payment needs a method and a positive amount", ErrInvalidTender)
+		}
+		if !isCash(t.Method) {
+			ordered = append(ordered, t)
+		}
+	}
+	for _, t := range tenders {
+		if isCash(t.Method) {
+			ordered = append(ordered, t)
+		}
+	}
+
+	remaining := owed
+	change := 0.0
+	planned := make([]plannedTender, 0, len(ordered))
+	for _, t := range ordered {
+		amount := roundMoney(t.Amount)
+		p := plannedTender{Tender: t, Applied: math.Min(amount, remaining)}
+		if amount > remaining {
+			if !isCash(t.Method) {
+				return nil, 0, fmt.Errorf("%w: %s payment of %.2f exceeds the %.2f owed", ErrInvalidTender, t.Method, amount, remaining)
+			}
+			if remaining <= 0 {
+				return nil, 0, fmt.Errorf("%w: the order is covered before the %s payment", ErrInvalidTender, t.Method)
+			}
+			p.Change = roundMoney(amount - remaining)
+			change += p.Change
+		}
+		remaining = roundMoney(remaining - p.Applied)
+		planned = append(planned, p)
+	}
+	return planned, roundMoney(change), nil
+}
+
+// checkSplits validates an online payment split: the parts must add up to
+// the amount due exactly and cannot include cash.
+func checkSplits(due float64, splits []Tender) error {
+	sum := 0.0
+	for _, split := range splits {
+		if split.Amount <= 0 {
+			return fmt.Errorf("%w: amounts must be positive", ErrInvalidTender)
+		}
+		if isCash(split.Method) {
+			return fmt.Errorf("%w: cash cannot be paid online", ErrInvalidTender)
+		}
+		sum += split.Amount
+	}
+	if roundMoney(sum) != roundMoney(due) {
+		return fmt.Errorf("%w: payments add up to %.2f, the amount due is %.2f", ErrInvalidTender, sum, due)
+	}
+	return nil
+}
+
+// recordTenderTx writes a settled tender as a PAID payment, drawing gift
+// card and store credit tenders from their balance.
+func recordTenderTx(tx *gorm.DB, order *domain.SalesOrder, p plannedTender, sessionID *int) (*domain.Payment, error) {
+	accountID, err := tenderAccount(tx, p.Tender)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	row := domain.Payment{
+		SalesOrderID:       &order.ID,
+		FinancialAccountID: accountID,
+		POSSessionID:       sessionID,
+		Type:               domain.TransCredit,
+		Amount:             p.Applied,
+		Currency:           "IDR",
+		Method:             strings.ToUpper(p.Method),
+		Status:             domain.PaymentPaid,
+		PaidAt:             &now,
+	}
+	if p.Reference != "" {
+		ref := p.Reference
+		if isGiftCard(p.Method) {
+			ref = normalizeGiftCardCode(ref)
+		}
+		row.TransactionReference = &ref
+	}
+	if p.Change > 0 {
+		row.TenderedAmount = &p.Amount
+		row.ChangeAmount = p.Change
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	if err := redeemStoredValueTx(tx, &row, p.Tender, order.CustomerID); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+func isCash(method string) bool {
+	return strings.EqualFold(method, "CASH")
+}
+
+func recordRefundTx(tx *gorm.DB, charge *domain.Payment, accountID int, method, ref string, amount float64) (*domain.Payment, error) {
+	now := time.Now()
+	row := &domain.Payment{
+		SalesOrderID:       charge.SalesOrderID,
+		FinancialAccountID: accountID,
+		Type:               domain.TransDebit,
+		RefundOfID:         &charge.ID,
+		Amount:             amount,
+		Currency:           charge.Currency,
+		Method:             method,
+		Status:             domain.PaymentRefunded,
+		PaidAt:             &now,
+	}
+	if ref != "" {
+		row.TransactionReference = &ref
+	}
+	return row, tx.Create(row).Error
+}
+
+// refundedAmountTx is what has been or is being refunded of a charge;
+// failed refunds do not count.
+func refundedAmountTx(tx *gorm.DB, chargeID int) (float64, error) {
+	var refunded float64
+	err := tx.Model(&domain.Payment{}).Where("refund_of_id = ? AND status <> ?", chargeID, domain.PaymentFailed).
+		Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error
+	return refunded, err
+}
+
+// updateOrderRefundStatusTx sets REFUNDED or PARTIALLY_REFUNDED from the
+// order's charges and refunds.
+func updateOrderRefundStatusTx(tx *gorm.DB, orderID int) error {
+	var sums struct {
+		Paid     float64
+		Refunded float64
+	}
+	if err := tx.Model(&domain.Payment{}).Where("sales_order_id = ?", orderID).
+		Select("COALESCE(SUM(CASE WHEN type = ? AND paid_at IS NOT NULL THEN amount END), 0) AS paid, "+
+			"COALESCE(SUM(CASE WHEN type = ? AND status = ? THEN amount END), 0) AS refunded",
+			domain.TransCredit, domain.TransDebit, domain.PaymentRefunded).
+		Scan(&sums).Error; err != nil {
+		return err
+	}
+	if sums.Refunded <= 0 {
+		return nil
+	}
+	status := domain.PaymentPartiallyRefunded
+	if roundMoney(sums.Refunded) >= roundMoney(sums.Paid) {
+		status = domain.PaymentRefunded
+	}
+	return tx.Model(&domain.SalesOrder{}).Where("id = ?", orderID).
+		Updates(map[string]interface{}{"payment_status": status, "updated_at": time.Now()}).Error
+}
+
+// providerAccount is the clearing account a provider's money lands in.
+func providerAccount(db *gorm.DB, provider string) (*domain.FinancialAccount, error) {
+	return paymentAccount(db, "PAY-"+provider, "Payment gateway ("+provider+")", "GATEWAY")
+}
+
+// tenderAccount is the account a POS tender lands in: the one given, or the
+// method's own account.
+func tenderAccount(db *gorm.DB, t Tender) (int, error) {
+	if t.FinancialAccountID != nil {
+		var account domain.FinancialAccount
+		err := db.Select("id").First(&account, *t.FinancialAccountID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("%w: financial account %d not found", ErrInvalidTender, *t.FinancialAccountID)
+		}
+		return account.ID, err
+	}
+	method := strings.ToUpper(t.Method)
+	accountType := "BANK"
+	if isCash(method) {
+		accountType = "CASH"
+	}
+	account, err := paymentAccount(db, "PAY-"+method, method, accountType)
+	if err != nil {
+		return 0, err
+	}
+	return account.ID, nil
+}
+
+// paymentAccount finds a FinancialAccount by code, creating it on first use.
+func paymentAccount(db *gorm.DB, code, name, accountType string) (*domain.FinancialAccount, error) {
+	account := domain.FinancialAccount{Code: &code}
+	err := db.Where(domain.FinancialAccount{Code: &code}).
+		Attrs(domain.FinancialAccount{Name: name, Type: accountType}).
+		FirstOrCreate(&account).Error
+	return &account, err
+}
@@ -3,20 +3,40 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"server/internal/barcode"
 	"server/internal/core/domain"
+	"server/internal/dto"
 	"server/internal/repository"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type POSServiceImpl struct {
 	sessionRepo  repository.Repository[domain.POSSession]
 	cashMoveRepo repository.Repository[domain.POSCashMove]
+	variantRepo  repository.VariantRepository
+	stockRepo    repository.InventoryRepository
+	taxService   TaxService
+	db           *gorm.DB
 }
 
-func NewPOSService(sessionRepo repository.Repository[domain.POSSession], cashMoveRepo repository.Repository[domain.POSCashMove]) POSService {
+func NewPOSService(
+	sessionRepo repository.Repository[domain.POSSession],
+	cashMoveRepo repository.Repository[domain.POSCashMove],
+	variantRepo repository.VariantRepository,
+	stockRepo repository.InventoryRepository,
+	taxService TaxService,
+	db *gorm.DB,
+) POSService {
 	return &POSServiceImpl{
 		sessionRepo:  sessionRepo,
 		cashMoveRepo: cashMoveRepo,
+		variantRepo:  variantRepo,
+		stockRepo:    stockRepo,
+		taxService:   taxService,
+		db:           db,
 	}
 }
 
@@ -39,17 +59,26 @@ func (s *POSServiceImpl) OpenSession(ctx context.Context, userID int, openingFlo
 	return session, nil
 }
 
+// CloseSession records the counted cash next to what the session's cash
+// tenders and cash moves say should be in the drawer.
 func (s *POSServiceImpl) CloseSession(ctx context.Context, sessionID int, closingCashActual float64, note string) error {
 	session, err := s.sessionRepo.FindByID(ctx, sessionID)
 	if err != nil {
 		return err
 	}
+	report, err := s.GetSessionDetails(ctx, sessionID)
+	if err != nil {
+		return err
+	}
 
 	session.ClosingCashActual = &closingCashActual
+	session.ClosingCashSystem = report.ExpectedCash
 	session.Status = domain.SessionClosed
 	now := time.Now()
 	session.ClosedAt = &now
-	// session.Note = &note // If field exists
+	if note != "" {
+		session.Note = &note
+	}
 
 	return s.sessionRepo.Update(ctx, session)
 }
@@ -71,22 +100,162 @@ func (s *POSServiceImpl) GetActiveSession(ctx context.Context, userID int) (*dom
 	return s.sessionRepo.FindOne(ctx, "user_id = ? AND status = ?", userID, domain.SessionOpened)
 }
 
-func (s *POSServiceImpl) GetSessionDetails(ctx context.Context, sessionID int) (*domain.POSSession, error) {
-	return nil, nil
+func (s *POSServiceImpl) GetSessionDetails(ctx context.Context, sessionID int) (*dto.POSSessionReport, error) {
+	session, err := s.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	db := s.db.WithContext(ctx)
+	report := &dto.POSSessionReport{
+		SessionID:   session.ID,
+		Status:      string(session.Status),
+		OpeningCash: session.OpeningCash,
+		ActualCash:  session.ClosingCashActual,
+	}
+
+	var sales struct {
+		Count int
+		Total float64
+	}
+	if err := db.Model(&domain.SalesOrder{}).
+		Where("pos_session_id = ? AND status <> ?", sessionID, domain.OrderCancelled).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_amount), 0) AS total").Scan(&sales).Error; err != nil {
+		return nil, err
+	}
+	report.OrderCount = sales.Count
+	report.SalesTotal = roundMoney(sales.Total)
+
+	// Every tender taken in this session, including ones settling older orders
+	if err := db.Model(&domain.Payment{}).
+		Where("pos_session_id = ? AND type = ? AND status = ?", sessionID, domain.TransCredit, domain.PaymentPaid).
+		Select("method, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount, " +
+			"COALESCE(SUM(COALESCE(tendered_amount, amount)), 0) AS tendered, COALESCE(SUM(change_amount), 0) AS change").
+		Group("method").Order("method").Scan(&report.Tenders).Error; err != nil {
+		return nil, err
+	}
+
+	var moves []domain.POSCashMove
+	if err := db.Where("pos_session_id = ?", sessionID).Find(&moves).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range moves {
+		if m.Type == domain.CashMoveAdd {
+			report.CashAdded += m.Amount
+		} else {
+			report.CashDropped += m.Amount
+		}
+	}
+
+	cash := 0.0
+	for _, t := range report.Tenders {
+		if isCash(t.Method) {
+			cash += t.Amount // Change already left the drawer
+		}
+	}
+	report.ExpectedCash = roundMoney(session.OpeningCash + cash + report.CashAdded - report.CashDropped)
+	return report, nil
 }
 
 func (s *POSServiceImpl) GetCashMoves(ctx context.Context, sessionID int) ([]domain.POSCashMove, error) {
 	return nil, nil
 }
 
-func (s *POSServiceImpl) ScanProduct(ctx context.Context, barcode string) (*domain.ProductVariant, int, error) {
-	return nil, 0, nil
+func (s *POSServiceImpl) ScanProduct(ctx context.Context, code string) (*domain.ProductVariant, int, error) {
+	code = barcode.Normalize(code)
+
+	// Variants the matrix generator switched off are not sold here either
+	variant, err := s.variantRepo.FindOne(ctx, "barcode = ? AND is_active = ? AND deleted_at IS NULL", code, true)
+	if err != nil && len(code) == 12 {
+		// UPC-A scanners drop the leading zero of the equivalent EAN-13
+		variant, err = s.variantRepo.FindOne(ctx, "barcode = ? AND is_active = ? AND deleted_at IS NULL", "0"+code, true)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stocks, err := s.stockRepo.Find(ctx, "variant_id = ?", variant.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := 0
+	for _, st := range stocks {
+		total += st.Quantity - st.Reserved
+	}
+	return variant, total, nil
 }
 
 func (s *POSServiceImpl) SearchCustomer(ctx context.Context, query string) ([]domain.User, error) {
 	return nil, nil
 }
 
+// PriceOrder fills a POS order's lines from the catalog and sets its totals,
+// including the per-line tax printed on the receipt.
+func (s *POSServiceImpl) PriceOrder(ctx context.Context, order *domain.SalesOrder) error {
+	ids := make([]int, len(order.Items))
+	for i, item := range order.Items {
+		ids[i] = item.VariantID
+	}
+	var variants []domain.ProductVariant
+	if err := s.db.WithContext(ctx).Preload("Product").Where("id IN ?", ids).Find(&variants).Error; err != nil {
+		return err
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	subtotal := 0.0
+	for i := range order.Items {
+		item := &order.Items[i]
+		v := byID[item.VariantID]
+		if v == nil || v.Product == nil {
+			return fmt.Errorf("variant %d not found", item.VariantID)
+		}
+		if !v.IsActive || v.DeletedAt != nil {
+			return fmt.Errorf("%s is no longer sold", v.SKU)
+		}
+		if item.Quantity < 1 {
+			return fmt.Errorf("quantity for %s must be at least 1", v.SKU)
+		}
+		item.ProductName = v.Product.Name
+		item.SKU = v.SKU
+		item.UnitPrice = variantPrice(v)
+		item.LineTotal = roundMoney(item.UnitPrice * float64(item.Quantity))
+		subtotal += item.LineTotal
+	}
+
+	taxAmount, err := s.taxService.ApplyToItems(ctx, order.Items, order.CustomerID, nil)
+	if err != nil {
+		return err
+	}
+	order.SubtotalAmount = roundMoney(subtotal)
+	order.TaxAmount = taxAmount
+	order.PricesIncludeTax = s.taxService.PricesIncludeTax()
+	order.TotalAmount = roundMoney(order.SubtotalAmount - order.DiscountAmount)
+	if !order.PricesIncludeTax {
+		order.TotalAmount = roundMoney(order.TotalAmount + taxAmount)
+	}
+
+	// PointsRedeemed is what the customer asked to spend; it is capped here
+	if order.PointsRedeemed > 0 {
+		points, discount, err := pointsDiscount(s.db.WithContext(ctx), order.CustomerID, order.PointsRedeemed, order.TotalAmount)
+		if err != nil {
+			return err
+		}
+		order.PointsRedeemed = points
+		order.PointsDiscount = discount
+		order.TotalAmount = roundMoney(order.TotalAmount - discount)
+	}
+
+	deposit, err := orderDeposit(s.db.WithContext(ctx), order.Items, order.TotalAmount, order.PricesIncludeTax)
+	if err != nil {
+		return err
+	}
+	order.DepositAmount = deposit
+	return nil
+}
+
 func (s *POSServiceImpl) OverridePrice(ctx context.Context, variantID int, newPrice float64, managerPIN string) error {
 	return nil
 }
@@ -5,28 +5,55 @@ import (
 	"errors"
 	"server/internal/core/domain"
 	"server/internal/repository"
+	"sync"
+
+	"gorm.io/gorm"
 )
 
 type ProcurementServiceImpl struct {
 	poRepo       repository.Repository[domain.PurchaseOrder]
 	supplierRepo repository.SupplierRepository
 	inventorySvc InventoryService
+	taxSvc       TaxService
+	db           *gorm.DB
+
+	mu               sync.RWMutex
+	receiptListeners []ReceiptListener
 }
 
-func NewProcurementService(poRepo repository.Repository[domain.PurchaseOrder], supplierRepo repository.SupplierRepository, inventorySvc InventoryService) ProcurementService {
+func NewProcurementService(poRepo repository.Repository[domain.PurchaseOrder], supplierRepo repository.SupplierRepository, inventorySvc InventoryService, taxSvc TaxService, db *gorm.DB) ProcurementService {
 	return &ProcurementServiceImpl{
 		poRepo:       poRepo,
 		supplierRepo: supplierRepo,
 		inventorySvc: inventorySvc,
+		taxSvc:       taxSvc,
+		db:           db,
 	}
 }
 
+func (s *ProcurementServiceImpl) OnReceive(listener ReceiptListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiptListeners = append(s.receiptListeners, listener)
+}
+
 func (s *ProcurementServiceImpl) GetPOs(ctx context.Context, page, limit int) ([]domain.PurchaseOrder, error) {
 	return s.poRepo.FindAll(ctx)
 }
 
+// CreatePO computes the line taxes and totals and numbers the PO before saving.
 func (s *ProcurementServiceImpl) CreatePO(ctx context.Context, po *domain.PurchaseOrder) error {
-	return s.poRepo.Create(ctx, po)
+	if err := s.taxSvc.ApplyToPurchaseOrder(ctx, po); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		number, err := nextDocumentNumber(tx, domain.DocPurchaseOrder, "")
+		if err != nil {
+			return err
+		}
+		po.PONumber = number
+		return tx.Create(po).Error
+	})
 }
 
 func (s *ProcurementServiceImpl) ReceivePO(ctx context.Context, poID int, receivedItems map[int]int) error {
@@ -40,9 +67,11 @@ func (s *ProcurementServiceImpl) ReceivePO(ctx context.Context, poID int, receiv
 	}
 
 	allReceived := true
+	var variantIDs []int
 	for i := range po.Items {
 		item := &po.Items[i]
 		if qty, ok := receivedItems[item.ID]; ok {
+			variantIDs = append(variantIDs, item.VariantID)
 			item.QuantityReceived += qty
 			if item.QuantityReceived < item.QuantityOrdered {
 				allReceived = false
@@ -71,7 +100,18 @@ func (s *ProcurementServiceImpl) ReceivePO(ctx context.Context, poID int, receiv
 		po.Status = domain.POPartiallyReceived
 	}
 
-	return s.poRepo.Update(ctx, po)
+	if err := s.poRepo.Update(ctx, po); err != nil {
+		return err
+	}
+
+	// Listeners run before returning so the receipt reflects allocations
+	s.mu.RLock()
+	listeners := s.receiptListeners
+	s.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(ctx, poID, variantIDs)
+	}
+	return nil
 }
 
 func (s *ProcurementServiceImpl) GetSuppliers(ctx context.Context) ([]domain.Supplier, error) {
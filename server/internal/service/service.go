@@ -4,6 +4,7 @@ import (
 	"context"
 	"server/internal/core/domain"
 	"server/internal/dto"
+	"time"
 )
 
 // ==========================================
@@ -26,6 +27,8 @@ type UserService interface {
 	// Profile Management
 	GetProfile(ctx context.Context, userID int) (*domain.User, error)
 	UpdateProfile(ctx context.Context, user *domain.User) error
+	// SetBirthDate records the customer's birthday for loyalty; it cannot be changed once set
+	SetBirthDate(ctx context.Context, userID int, birthDate time.Time) error
 
 	// Address Book
 	GetAddresses(ctx context.Context, userID int) ([]domain.Address, error)
@@ -38,6 +41,13 @@ type UserService interface {
 	GetWishlist(ctx context.Context, userID int) ([]domain.ProductVariant, error)
 	ToggleWishlist(ctx context.Context, userID, variantID int) (isAdded bool, err error)
 
+	// Back-in-stock ("notify me") subscriptions, only for out-of-stock variants
+	GetStockSubscriptions(ctx context.Context, userID int) ([]domain.StockSubscription, error)
+	SubscribeStock(ctx context.Context, userID, variantID int) (*domain.StockSubscription, error)
+	UnsubscribeStock(ctx context.Context, userID, variantID int) error
+	// NotifyRestocked sends queued notifications; registered as an InventoryService restock listener
+	NotifyRestocked(ctx context.Context, variantID, available int)
+
 	// HR / Admin User Management
 	GetUserList(ctx context.Context, filter UserFilterParams) ([]domain.User, int64, error)
 	GetUserDetail(ctx context.Context, targetUserID int) (*domain.User, error)
@@ -64,15 +74,23 @@ type UserFilterParams struct {
 
 type CatalogService interface {
 	// Browsing
+	// locale selects translated text; missing translations fall back to the default locale
 	GetProducts(ctx context.Context, filter dto.ProductFilterParams) ([]domain.Product, int64, error)
-	GetProductDetail(ctx context.Context, slug string) (*domain.Product, error)
-	GetCategories(ctx context.Context) ([]domain.Category, error)
+	GetProductDetail(ctx context.Context, slug string, locale string) (*domain.Product, error)
+	GetCategories(ctx context.Context, locale string) ([]domain.Category, error)
 	GetVariants(ctx context.Context, productID int) ([]domain.ProductVariant, error)
 
 	// Admin Management
 	CreateProduct(ctx context.Context, product *domain.Product) error
 	UpdateProduct(ctx context.Context, id int, req dto.UpdateProductRequest) error
 	UpdateVariants(ctx context.Context, productID int, variants []domain.ProductVariant) error
+	// Variant matrix: options are replaced wholesale; generation adds missing
+	// combinations and deactivates stale ones, never deleting variants
+	GetProductOptions(ctx context.Context, productID int) ([]domain.ProductOption, error)
+	SetProductOptions(ctx context.Context, productID int, options []domain.ProductOption) ([]domain.ProductOption, error)
+	GenerateVariants(ctx context.Context, productID int, req dto.GenerateVariantsRequest) (*dto.VariantMatrixResult, error)
+	// AssignBarcodes generates internal barcodes for variants that have none
+	AssignBarcodes(ctx context.Context, productID int, symbology domain.BarcodeSymbology) ([]domain.ProductVariant, error)
 	SoftDeleteProduct(ctx context.Context, id int) error
 	RestoreProduct(ctx context.Context, id int) error
 	ForceDeleteProduct(ctx context.Context, id int) error // Hard delete
@@ -81,22 +99,45 @@ type CatalogService interface {
 	RestoreVariant(ctx context.Context, id int) error
 	ForceDeleteVariant(ctx context.Context, id int) error
 
-	// Data Operations
-	ImportProducts(ctx context.Context, data []byte) error // Process CSV/JSON
-	ExportProducts(ctx context.Context) ([]byte, error)    // Return CSV/Excel bytes
+	// Data Operations (CSV with name[locale] / description[locale] columns)
+	ImportProducts(ctx context.Context, data []byte) (created int, updated int, err error)
+	ExportProducts(ctx context.Context) ([]byte, error)
 
 	// Tags
 	GetTags(ctx context.Context) ([]domain.Tag, error)
 	CreateTag(ctx context.Context, tag *domain.Tag) error
 	GetTagBySlug(ctx context.Context, slug string) (*domain.Tag, error)
 	UpdateProductTags(ctx context.Context, productID int, tagIDs []int) error
+
+	// Translations
+	GetProductTranslations(ctx context.Context, productID int) ([]domain.ProductTranslation, error)
+	SaveProductTranslation(ctx context.Context, t *domain.ProductTranslation) error
+	DeleteProductTranslation(ctx context.Context, productID int, locale string) error
+	GetCategoryTranslations(ctx context.Context, categoryID int) ([]domain.CategoryTranslation, error)
+	SaveCategoryTranslation(ctx context.Context, t *domain.CategoryTranslation) error
+	DeleteCategoryTranslation(ctx context.Context, categoryID int, locale string) error
+	GetTagTranslations(ctx context.Context, tagID int) ([]domain.TagTranslation, error)
+	SaveTagTranslation(ctx context.Context, t *domain.TagTranslation) error
+	DeleteTagTranslation(ctx context.Context, tagID int, locale string) error
 }
 
 type MediaService interface {
 	InitiateUpload(ctx context.Context, filename string, mimeType string, sizeBytes int64) (*domain.MediaAsset, string, error) // Returns asset and signed PUT URL
+	// CompleteUpload verifies size, checksum and sniffed type, then marks the asset READY
+	CompleteUpload(ctx context.Context, mediaID int, checksum string) (*domain.MediaAsset, error)
+	SweepOrphans(ctx context.Context, grace time.Duration) (deleted int, err error)
 	LinkMedia(ctx context.Context, mediaIDs []int, entityType string, entityID int, zone string) error
 	UnlinkMedia(ctx context.Context, mediaID int, entityType string, entityID int) error
+	ReorderMedia(ctx context.Context, entityType string, entityID int, zone string, mediaIDs []int) error
+	SetPrimaryMedia(ctx context.Context, mediaID int, entityType string, entityID int) error
+	UpdateAltText(ctx context.Context, mediaID int, altText *string) (*domain.MediaAsset, error)
 	GetSignedURL(ctx context.Context, mediaID int) (string, error) // For GET access
+
+	// ProcessPending decodes uploaded images: dimensions, blurhash, EXIF strip, renditions
+	ProcessPending(ctx context.Context, limit int) (processed int, err error)
+	// GetEntityMedia returns linked media with rendition URLs, keyed by entity ID
+	// and ordered by zone, primary first, then sort order
+	GetEntityMedia(ctx context.Context, entityType string, entityIDs []int) (map[int][]domain.MediaView, error)
 }
 
 // ==========================================
@@ -111,15 +152,74 @@ type CartCalculationResult struct {
 	TotalAmount    float64
 	Items          []domain.SalesOrderItem
 	CouponApplied  *string
+	FreeShipping   bool
+	// PricesIncludeTax means TaxAmount is part of the line totals rather
+	// than added to them
+	PricesIncludeTax bool
+	// ShippingOptions are quoted when the shopper's address is known;
+	// Shipping is the chosen one, priced into ShippingAmount
+	ShippingOptions []dto.ShippingOption
+	Shipping        *dto.ShippingOption
+	// Promotions become SalesOrderPromotion rows; coupon entries carry
+	// MetaData["code"] and are redeemed when the order is placed
+	Promotions []domain.SalesOrderPromotion
+	// PointsRedeemed loyalty points are worth PointsDiscount, already taken
+	// off TotalAmount; they are spent when the order is placed
+	PointsRedeemed int
+	PointsDiscount float64
+	// DepositAmount is due at checkout when pre-order lines take a deposit;
+	// 0 when the whole total is
+	DepositAmount float64
+}
+
+// Shopper identifies the buyer for per-customer coupon limits. Either field
+// may be empty during browsing; checkout requires one of them.
+type Shopper struct {
+	CustomerID *int
+	Email      string
+	// ShippingAddress is the destination, when known, for tax and shipping:
+	// an address-book entry or a guest's inline address
+	ShippingAddress *domain.Address
+	// ShippingMethod is the code chosen at checkout
+	ShippingMethod string
+	// RedeemPoints are the loyalty points the shopper wants to spend
+	RedeemPoints int
+	// Channel is where the order is placed; promotions can be limited to channels
+	Channel domain.OrderChannel
+}
+
+// CartRef identifies the cart of a request: the guest X-Cart-Token and/or the
+// logged-in user.
+type CartRef struct {
+	Token  string
+	UserID *int
 }
 
 type CartService interface {
-	CalculateCart(ctx context.Context, items []domain.SalesOrderItem, couponCode string) (*CartCalculationResult, error)
+	CalculateCart(ctx context.Context, items []domain.SalesOrderItem, couponCode string, shopper Shopper) (*CartCalculationResult, error)
+
+	// Checkout; prices, names and addresses come from the database, never the client
+	PriceItems(ctx context.Context, items []dto.CartItemRequest) ([]domain.SalesOrderItem, error)
+	// UserAddress loads an entry of the user's own address book
+	UserAddress(ctx context.Context, addressID, userID int) (*domain.Address, error)
+	AddressSnapshot(addr *domain.Address) map[string]interface{}
+
+	// Persistent carts; every read revalidates prices and stock
+	GetCart(ctx context.Context, ref CartRef) (*dto.CartResponse, error)
+	AddItem(ctx context.Context, ref CartRef, variantID, quantity int) (*dto.CartResponse, error)
+	UpdateItem(ctx context.Context, ref CartRef, variantID, quantity int) (*dto.CartResponse, error)
+	RemoveItem(ctx context.Context, ref CartRef, variantID int) (*dto.CartResponse, error)
+	ReplaceItems(ctx context.Context, ref CartRef, items []dto.CartItemRequest) (*dto.CartResponse, error)
+	ApplyCoupon(ctx context.Context, ref CartRef, code string) (*dto.CartResponse, error)
+	RemoveCoupon(ctx context.Context, ref CartRef) (*dto.CartResponse, error)
+	ExpireCarts(ctx context.Context) (expired int, err error)
 }
 
 type OrderService interface {
 	// Creation & Lifecycle
-	PlaceOrder(ctx context.Context, order *domain.SalesOrder) error
+	PlaceOrder(ctx context.Context, order *domain.SalesOrder) error // Reserves stock; paid orders are deducted at once
+	ConfirmPayment(ctx context.Context, orderID int) error
+	ExpireUnpaidOrders(ctx context.Context) (expired int, err error)
 	GetOrder(ctx context.Context, orderNumber string) (*domain.SalesOrder, error)
 	GetCustomerHistory(ctx context.Context, userID int, page, limit int) ([]domain.SalesOrder, error)
 
@@ -142,7 +242,7 @@ type POSService interface {
 	OpenSession(ctx context.Context, userID int, openingFloat float64) (*domain.POSSession, error)
 	CloseSession(ctx context.Context, sessionID int, closingCashActual float64, note string) error
 	GetActiveSession(ctx context.Context, userID int) (*domain.POSSession, error)
-	GetSessionDetails(ctx context.Context, sessionID int) (*domain.POSSession, error) // X-Report
+	GetSessionDetails(ctx context.Context, sessionID int) (*dto.POSSessionReport, error) // X-Report, with totals per tender
 
 	// Cash Management
 	RecordCashMove(ctx context.Context, sessionID int, amount float64, moveType domain.CashMoveType, reason string) error
@@ -152,6 +252,7 @@ type POSService interface {
 	ScanProduct(ctx context.Context, barcode string) (*domain.ProductVariant, int, error) // Returns stock level
 	SearchCustomer(ctx context.Context, query string) ([]domain.User, error)
 	OverridePrice(ctx context.Context, variantID int, newPrice float64, managerPIN string) error
+	PriceOrder(ctx context.Context, order *domain.SalesOrder) error
 	VoidOrder(ctx context.Context, orderID int, managerPIN string) error
 
 	// Utilities
@@ -172,14 +273,26 @@ type StockMoveCmd struct {
 	UserID        int
 }
 
+type LabelService interface {
+	// BuildLabels resolves the request into label data, assigning missing barcodes
+	BuildLabels(ctx context.Context, req dto.PrintLabelsRequest) ([]Label, error)
+	// RenderLabels returns a printable batch as PDF or ZPL (req.Format)
+	RenderLabels(ctx context.Context, req dto.PrintLabelsRequest) ([]byte, error)
+}
+
+// RestockListener is called (asynchronously, after commit) when a variant's
+// total on hand goes from zero to available.
+type RestockListener func(ctx context.Context, variantID, available int)
+
 type InventoryService interface {
 	// Core Ledger
 	ExecuteMovement(ctx context.Context, cmd StockMoveCmd) error
+	OnRestock(listener RestockListener)
 	GetStockLevel(ctx context.Context, variantID, locationID int) (int, error)
 	GetMovements(ctx context.Context, variantID, locationID, page, limit int) ([]domain.StockMovement, error)
 
 	// Operations
-	TransferStock(ctx context.Context, variantID, qty, fromLocID, toLocID, userID int) error
+	TransferStock(ctx context.Context, variantID, qty, fromLocID, toLocID, userID int) (*domain.StockTransfer, error)
 	BulkAdjustStock(ctx context.Context, cmds []StockMoveCmd) error
 
 	// Location Management
@@ -204,10 +317,15 @@ type AssemblyService interface {
 	GetAssemblyLogs(ctx context.Context, page, limit int) ([]domain.StockAssembly, error)
 }
 
+// ReceiptListener is called after goods received on a purchase order are
+// booked into stock.
+type ReceiptListener func(ctx context.Context, poID int, variantIDs []int)
+
 type ProcurementService interface {
 	GetPOs(ctx context.Context, page, limit int) ([]domain.PurchaseOrder, error)
 	CreatePO(ctx context.Context, po *domain.PurchaseOrder) error
 	ReceivePO(ctx context.Context, poID int, receivedItems map[int]int) error
+	OnReceive(listener ReceiptListener)
 
 	// Supplier Management
 	GetSuppliers(ctx context.Context) ([]domain.Supplier, error)
@@ -235,15 +353,200 @@ type MarketingService interface {
 	CreatePromotion(ctx context.Context, promo *domain.Promotion) error
 	UpdatePromotion(ctx context.Context, id int, req dto.UpdatePromotionRequest) error
 	DeletePromotion(ctx context.Context, id int) error // Soft delete
-	ApplyPromotion(ctx context.Context, promo *domain.Promotion, data map[string]interface{}) error
+	// SimulatePromotions evaluates saved (and optionally a draft) promotion
+	// against a hypothetical cart, explaining each outcome. Coupon limits are
+	// not checked.
+	SimulatePromotions(ctx context.Context, req dto.SimulatePromotionsRequest) (*dto.SimulatePromotionsResponse, error)
+	// GetActivePromotions returns promotions that are switched on and within their dates
+	GetActivePromotions(ctx context.Context) ([]domain.Promotion, error)
+
+	// Coupons. CheckCoupon returns a *CouponError when the code cannot be used;
+	// limits are enforced again, under lock, when the order is placed.
+	// Whether the cart qualifies is decided by the promotion engine.
+	CheckCoupon(ctx context.Context, code string, shopper Shopper) (*domain.Promotion, error)
+	// ShopperForUser resolves (creating if needed) the customer record of a logged-in user
+	ShopperForUser(ctx context.Context, userID int) (Shopper, error)
+	// SetMarketingConsent records whether an email address may receive marketing messages
+	SetMarketingConsent(ctx context.Context, email string, optedIn bool, source domain.ConsentSource) error
 
 	// CRM
 	GetSegments(ctx context.Context) ([]string, error) // e.g., "Big Spenders", "Inactive"
 	TriggerEmailCampaign(ctx context.Context, segment string, subject, body string) error
 }
 
+// Coupon rejection reasons returned to the storefront
+const (
+	CouponNotFound        = "NOT_FOUND"
+	CouponInactive        = "INACTIVE"
+	CouponNotStarted      = "NOT_STARTED"
+	CouponExpired         = "EXPIRED"
+	CouponUsedUp          = "USAGE_LIMIT_REACHED"
+	CouponCustomerLimit   = "CUSTOMER_LIMIT_REACHED"
+	CouponConditionsUnmet = "CONDITIONS_NOT_MET"
+	CouponNoDiscount      = "NO_DISCOUNT"
+	CouponNotCombinable   = "NOT_COMBINABLE"
+)
+
+type CouponError struct {
+	Reason  string
+	Message string
+}
+
+func (e *CouponError) Error() string {
+	return e.Message
+}
+
 type FinanceService interface {
 	GenerateInvoice(ctx context.Context, orderID int) (*domain.Invoice, error)
 	RecordPayment(ctx context.Context, invoiceID int, amount float64, method string) error
 	GetInvoicePDF(ctx context.Context, invoiceNumber string) (string, error) // Returns URL
 }
+
+// Tender is one part of a split payment.
+type Tender struct {
+	Method             string
+	Amount             float64 // For POS cash, what the customer handed over
+	FinancialAccountID *int    // Defaults to the method's account
+	Reference          string
+}
+
+// StoredValueService manages gift cards and store credit. They are spent
+// through PaymentService tenders with MethodGiftCard and MethodStoreCredit.
+type StoredValueService interface {
+	IssueGiftCard(ctx context.Context, req dto.IssueGiftCardRequest, userID int) (*domain.GiftCard, error)
+	GetGiftCards(ctx context.Context) ([]domain.GiftCard, error)
+	GetGiftCard(ctx context.Context, code string) (*domain.GiftCard, error) // With transactions
+	UpdateGiftCard(ctx context.Context, id int, req dto.UpdateGiftCardRequest) (*domain.GiftCard, error)
+	DeliverGiftCards(ctx context.Context) (sent int, err error)
+
+	GetStoreCredit(ctx context.Context, customerID int) (*dto.StoreCreditView, error)
+	GetStoreCreditForUser(ctx context.Context, userID int) (*dto.StoreCreditView, error)
+	AdjustStoreCredit(ctx context.Context, customerID int, amount float64, note string, userID int) (*domain.StoreCreditEntry, error)
+}
+
+// CartRecoveryService follows up idle carts and unpaid web orders by email,
+// only for shoppers who agreed to marketing messages. Orders paid after a
+// reminder are recorded as recovered.
+type CartRecoveryService interface {
+	SendReminders(ctx context.Context) (sent int, err error)
+	GetReminders(ctx context.Context, limit int) ([]domain.CartReminder, error) // Newest first
+	GetStats(ctx context.Context, from, to time.Time) (*dto.CartRecoveryStats, error)
+	// Unsubscribe withdraws consent through the signed link in a reminder
+	Unsubscribe(ctx context.Context, email, token string) error
+}
+
+// LoyaltyService manages the points program. Points are earned when orders
+// are paid and redeemed as a discount when they are placed; both happen in
+// the order flows.
+type LoyaltyService interface {
+	GetProgram(ctx context.Context) (*domain.LoyaltyProgram, error) // With category multipliers
+	UpdateProgram(ctx context.Context, req dto.UpdateLoyaltyProgramRequest) (*domain.LoyaltyProgram, error)
+	SetCategoryMultiplier(ctx context.Context, categoryID int, multiplier float64) error
+
+	GetPoints(ctx context.Context, customerID int) (*dto.LoyaltyView, error)
+	GetPointsForUser(ctx context.Context, userID int) (*dto.LoyaltyView, error)
+	AdjustPoints(ctx context.Context, customerID, points int, note string, userID int) (*domain.LoyaltyEntry, error)
+	ExpirePoints(ctx context.Context) (expired int, err error)
+}
+
+// BackorderService allocates stock that arrives to order lines waiting on
+// it. Lines go waiting when backorder and pre-order variants are short at
+// checkout.
+type BackorderService interface {
+	// AllocateReceipt is a ReceiptListener
+	AllocateReceipt(ctx context.Context, poID int, variantIDs []int)
+	// Allocate hands a variant's available stock to waiting lines and
+	// reports how many orders received some
+	Allocate(ctx context.Context, variantID int) (orders int, err error)
+	GetBackorders(ctx context.Context, variantID int) ([]dto.BackorderLine, error) // All variants when 0
+}
+
+// SubscriptionService runs standing orders on subscription plans. Each run
+// places a web order for the subscription's items and charges it, retrying
+// payment until it succeeds or the subscription falls past due.
+type SubscriptionService interface {
+	// Admin
+	GetPlans(ctx context.Context, activeOnly bool) ([]domain.SubscriptionPlan, error)
+	SavePlan(ctx context.Context, plan *domain.SubscriptionPlan) error // Replaces its items
+	DeletePlan(ctx context.Context, id int) error                      // Deactivates
+	GetSubscriptions(ctx context.Context, status domain.SubscriptionStatus, page, limit int) ([]domain.Subscription, error)
+
+	// Customers; other users' subscriptions are ErrSubscriptionNotFound
+	Subscribe(ctx context.Context, userID int, req dto.SubscribeRequest) (*domain.Subscription, error)
+	GetMySubscriptions(ctx context.Context, userID int) ([]domain.Subscription, error)
+	GetMySubscription(ctx context.Context, userID, id int) (*domain.Subscription, error)
+	UpdateSubscription(ctx context.Context, userID, id int, req dto.UpdateSubscriptionRequest) (*domain.Subscription, error)
+	SwapItems(ctx context.Context, userID, id int, items []dto.SubscriptionItemRequest) (*domain.Subscription, error)
+	Pause(ctx context.Context, userID, id int, until *time.Time) (*domain.Subscription, error) // Until resumed when nil
+	Resume(ctx context.Context, userID, id int) (*domain.Subscription, error)
+	Skip(ctx context.Context, userID, id int) (*domain.Subscription, error) // The next order
+	Cancel(ctx context.Context, userID, id int) (*domain.Subscription, error)
+
+	// RunDue places and charges the orders of due subscriptions and retries
+	// payments that failed
+	RunDue(ctx context.Context) (placed int, err error)
+}
+
+// PaymentService takes payments: online through the configured provider,
+// at the POS as settled tenders. An order is paid once its payments cover
+// the total and partially paid until then.
+type PaymentService interface {
+	// StartPayment opens a charge per split (one for the total when splits
+	// is empty) and returns where the shopper pays each.
+	StartPayment(ctx context.Context, order *domain.SalesOrder, email string, splits []Tender) ([]dto.PaymentLink, error)
+	// ChargeSaved charges what the order owes to a saved payment method
+	// without the shopper present. It reports whether the order is now paid;
+	// pending charges settle by webhook and declines are ErrPaymentDeclined.
+	ChargeSaved(ctx context.Context, order *domain.SalesOrder, email, token string) (bool, error)
+	// CheckTenders validates tenders for a priced order before it is placed:
+	// POS rules for POS orders, online splits otherwise, and stored-value balances.
+	CheckTenders(ctx context.Context, order *domain.SalesOrder, tenders []Tender) error
+	// RecordTenders takes POS tenders against an order. Cash beyond what is
+	// owed becomes change; other methods may not overpay.
+	RecordTenders(ctx context.Context, orderID int, sessionID *int, tenders []Tender) (*dto.TenderResult, error)
+	// HandleWebhook verifies a provider notification and applies it; paid
+	// orders are confirmed once their charges cover the total.
+	HandleWebhook(ctx context.Context, body []byte) error
+	// Refund gives amount back to the order's gateway, gift card and store
+	// credit payments, or all of it to the customer's store credit.
+	Refund(ctx context.Context, orderID int, amount float64, toStoreCredit bool) ([]domain.Payment, error) // Returns the order's refunds
+	GetPayments(ctx context.Context, orderID int) ([]domain.Payment, error)
+}
+
+type ShippingService interface {
+	// Admin. Saving a method replaces its rates.
+	GetShippingMethods(ctx context.Context) ([]domain.ShippingMethod, error)
+	SaveShippingMethod(ctx context.Context, method *domain.ShippingMethod) error
+	DeleteShippingMethod(ctx context.Context, id int) error // Deactivates
+	GetShippingZones(ctx context.Context) ([]domain.ShippingZone, error)
+	SaveShippingZone(ctx context.Context, zone *domain.ShippingZone) error
+	DeleteShippingZone(ctx context.Context, id int) error
+
+	// Options quotes every active method for the items sent to address;
+	// orderValue (after discounts) decides free-shipping thresholds.
+	// Methods that cannot deliver are returned with a reason.
+	Options(ctx context.Context, items []domain.SalesOrderItem, address *domain.Address, orderValue float64) ([]dto.ShippingOption, error)
+}
+
+type TaxService interface {
+	// Rules
+	GetTaxRules(ctx context.Context) ([]domain.TaxRule, error)
+	CreateTaxRule(ctx context.Context, rule *domain.TaxRule) error
+	UpdateTaxRule(ctx context.Context, id int, req dto.UpdateTaxRuleRequest) (*domain.TaxRule, error)
+	DeleteTaxRule(ctx context.Context, id int) error // Deactivates
+
+	// ApplyToItems sets TaxRuleID, TaxRate and TaxAmount on each line, taxing
+	// its LineTotal (after discounts), and returns the total tax. Whether
+	// that tax is inside LineTotal or on top of it is PricesIncludeTax.
+	ApplyToItems(ctx context.Context, items []domain.SalesOrderItem, customerID *int, address *domain.Address) (float64, error)
+	PricesIncludeTax() bool
+	// ApplyToPurchaseOrder taxes PO lines (costs are tax-exclusive) and sets the PO totals
+	ApplyToPurchaseOrder(ctx context.Context, po *domain.PurchaseOrder) error
+}
+
+// NumberingService configures document number series. Numbers themselves are
+// issued inside each document's insert transaction.
+type NumberingService interface {
+	GetSeries(ctx context.Context) ([]domain.DocumentSeries, error)
+	UpdateSeries(ctx context.Context, series *domain.DocumentSeries) error
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/shipping"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrShippingUnavailable is returned when the chosen method cannot deliver
+// the cart to its destination.
+var ErrShippingUnavailable = errors.New("shipping method is not available")
+
+type ShippingServiceImpl struct {
+	db *gorm.DB
+}
+
+func NewShippingService(db *gorm.DB) ShippingService {
+	return &ShippingServiceImpl{db: db}
+}
+
+func (s *ShippingServiceImpl) GetShippingMethods(ctx context.Context) ([]domain.ShippingMethod, error) {
+	var methods []domain.ShippingMethod
+	err := s.db.WithContext(ctx).Preload("Rates", func(db *gorm.DB) *gorm.DB {
+		return db.Where("retired_at IS NULL").Order("zone_id NULLS LAST, min_weight_kg")
+	}).Order("position, id").Find(&methods).Error
+	return methods, err
+}
+
+func (s *ShippingServiceImpl) SaveShippingMethod(ctx context.Context, method *domain.ShippingMethod) error {
+	method.Code = strings.ToUpper(strings.TrimSpace(method.Code))
+	if method.Code == "" || strings.TrimSpace(method.Name) == "" {
+		return errors.New("code and name are required")
+	}
+	if method.VolumetricDivisor <= 0 {
+		method.VolumetricDivisor = 6000
+	}
+	if method.EtaMinDays < 0 || method.EtaMaxDays < method.EtaMinDays {
+		return errors.New("eta_max_days must not be below eta_min_days")
+	}
+	for _, r := range method.Rates {
+		if r.MaxWeightKG != nil && *r.MaxWeightKG < r.MinWeightKG {
+			return errors.New("rate max_weight_kg must not be below min_weight_kg")
+		}
+		if r.BasePrice < 0 || r.PricePerKG < 0 {
+			return errors.New("rate prices cannot be negative")
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rates := method.Rates
+		method.Rates = nil
+		if method.ID == 0 {
+			for i := range rates {
+				rates[i].ID = 0
+			}
+			if err := tx.Create(method).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Select("*").Omit("created_at").Save(method).Error; err != nil {
+			return err
+		}
+		if err := saveShippingRatesTx(tx, method.ID, rates); err != nil {
+			return err
+		}
+		method.Rates = rates
+		return nil
+	})
+}
+
+// saveShippingRatesTx updates the method's rates in place, adds new ones and
+// removes the rest. Orders keep their ShippingRateID, so a removed rate they
+// refer to is retired instead of deleted.
+func saveShippingRatesTx(tx *gorm.DB, methodID int, rates []domain.ShippingRate) error {
+	var existing []domain.ShippingRate
+	if err := tx.Where("method_id = ? AND retired_at IS NULL", methodID).Find(&existing).Error; err != nil {
+		return err
+	}
+	kept := make(map[int]bool, len(rates))
+	for _, r := range existing {
+		kept[r.ID] = false
+	}
+
+	for i := range rates {
+		r := &rates[i]
+		r.MethodID = methodID
+		if r.ID == 0 {
+			if err := tx.Omit("Zone").Create(r).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := kept[r.ID]; !ok {
+			return fmt.Errorf("rate %d does not belong to this shipping method", r.ID)
+		}
+		kept[r.ID] = true
+		if err := tx.Select("*").Omit("Zone", "retired_at").Save(r).Error; err != nil {
+			return err
+		}
+	}
+
+	var removed []int
+	for id, keep := range kept {
+		if !keep {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	var used []int
+	if err := tx.Model(&domain.SalesOrder{}).Distinct("shipping_rate_id").
+		Where("shipping_rate_id IN ?", removed).Pluck("shipping_rate_id", &used).Error; err != nil {
+		return err
+	}
+	if len(used) > 0 {
+		if err := tx.Model(&domain.ShippingRate{}).Where("id IN ?", used).Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ? AND id NOT IN ?", removed, append(used, 0)).Delete(&domain.ShippingRate{}).Error
+}
+
+// DeleteShippingMethod deactivates the method; orders keep referring to it.
+func (s *ShippingServiceImpl) DeleteShippingMethod(ctx context.Context, id int) error {
+	res := s.db.WithContext(ctx).Model(&domain.ShippingMethod{}).Where("id = ?", id).Update("is_active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *ShippingServiceImpl) GetShippingZones(ctx context.Context) ([]domain.ShippingZone, error) {
+	var zones []domain.ShippingZone
+	err := s.db.WithContext(ctx).Order("name").Find(&zones).Error
+	return zones, err
+}
+
+func (s *ShippingServiceImpl) SaveShippingZone(ctx context.Context, zone *domain.ShippingZone) error {
+	if strings.TrimSpace(zone.Name) == "" {
+		return errors.New("name is required")
+	}
+	zone.PostalPrefixes = cleanList(zone.PostalPrefixes)
+	zone.Cities = cleanList(zone.Cities)
+	zone.Provinces = cleanList(zone.Provinces)
+	if len(zone.PostalPrefixes)+len(zone.Cities)+len(zone.Provinces) == 0 {
+		return errors.New("a zone needs at least one postal prefix, city or province")
+	}
+
+	if zone.ID == 0 {
+		return s.db.WithContext(ctx).Create(zone).Error
+	}
+	return s.db.WithContext(ctx).Select("*").Omit("created_at").Save(zone).Error
+}
+
+func (s *ShippingServiceImpl) DeleteShippingZone(ctx context.Context, id int) error {
+	var used int64
+	if err := s.db.WithContext(ctx).Model(&domain.ShippingRate{}).Where("zone_id = ?", id).Count(&used).Error; err != nil {
+		return err
+	}
+	if used > 0 {
+		return errors.New("zone is still used by shipping rates or by orders placed with them")
+	}
+	return s.db.WithContext(ctx).Delete(&domain.ShippingZone{}, id).Error
+}
+
+func (s *ShippingServiceImpl) Options(ctx context.Context, items []domain.SalesOrderItem, address *domain.Address, orderValue float64) ([]dto.ShippingOption, error) {
+	db := s.db.WithContext(ctx)
+	dest := shipping.Destination{PostalCode: derefString(address.PostalCode), City: address.City, Province: derefString(address.State)}
+
+	parcel, err := s.parcel(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []domain.ShippingMethod
+	if err := db.Preload("Rates", "retired_at IS NULL").Preload("Rates.Zone").Where("is_active = ?", true).Order("position, id").Find(&methods).Error; err != nil {
+		return nil, err
+	}
+
+	options := make([]dto.ShippingOption, 0, len(methods))
+	for i := range methods {
+		m := &methods[i]
+		opt := dto.ShippingOption{MethodID: m.ID, Code: m.Code, Name: m.Name, Carrier: m.Carrier}
+		quote, reason := shipping.QuoteMethod(m, parcel, dest, orderValue)
+		if quote == nil {
+			opt.Reason = reason
+		} else {
+			opt.Available = true
+			opt.Price = quote.Price
+			opt.WeightKG = quote.WeightKG
+			opt.EtaMinDays = quote.EtaMinDays
+			opt.EtaMaxDays = quote.EtaMaxDays
+			if quote.Rate != nil {
+				opt.RateID = &quote.Rate.ID
+			}
+		}
+		options = append(options, opt)
+	}
+	return options, nil
+}
+
+// parcel turns order lines into shipping items. Missing weights count as zero.
+func (s *ShippingServiceImpl) parcel(ctx context.Context, items []domain.SalesOrderItem) ([]shipping.Item, error) {
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.VariantID
+	}
+	var variants []domain.ProductVariant
+	if len(ids) > 0 {
+		if err := s.db.WithContext(ctx).Preload("Product").Where("id IN ?", ids).Find(&variants).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[int]*domain.ProductVariant, len(variants))
+	for i := range variants {
+		byID[variants[i].ID] = &variants[i]
+	}
+
+	parcel := make([]shipping.Item, 0, len(items))
+	for _, item := range items {
+		v := byID[item.VariantID]
+		if v == nil || v.Product == nil {
+			return nil, fmt.Errorf("variant %d not found", item.VariantID)
+		}
+		p := v.Product
+		parcel = append(parcel, shipping.Item{
+			WeightKG:  derefFloat(p.WeightKG),
+			HeightCM:  derefFloat(p.HeightCM),
+			WidthCM:   derefFloat(p.WidthCM),
+			DepthCM:   derefFloat(p.DepthCM),
+			Quantity:  item.Quantity,
+			LivePlant: p.IsLivePlant,
+		})
+	}
+	return parcel, nil
+}
+
+func derefFloat(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func cleanList(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
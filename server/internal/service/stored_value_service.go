@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/notify"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payment methods backed by stored value. Tenders using them are settled
+// immediately instead of through the payment provider.
+const (
+	MethodGiftCard    = "GIFT_CARD"    // Tender.Reference is the card code
+	MethodStoreCredit = "STORE_CREDIT" // Drawn from the order's customer
+)
+
+var (
+	ErrGiftCardNotFound    = errors.New("gift card not found")
+	ErrGiftCardUnusable    = errors.New("gift card is disabled or expired")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrNoCustomer          = errors.New("store credit needs a customer account")
+)
+
+type StoredValueServiceImpl struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+}
+
+func NewStoredValueService(db *gorm.DB, notifier notify.Notifier) StoredValueService {
+	return &StoredValueServiceImpl{db: db, notifier: notifier}
+}
+
+func (s *StoredValueServiceImpl) IssueGiftCard(ctx context.Context, req dto.IssueGiftCardRequest, userID int) (*domain.GiftCard, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	card := &domain.GiftCard{ExpiresAt: req.ExpiresAt, IssuedBy: &userID}
+	if req.RecipientEmail != "" {
+		card.RecipientEmail = &req.RecipientEmail
+	}
+	if req.Note != "" {
+		card.Note = &req.Note
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return issueGiftCardTx(tx, card, roundMoney(req.Amount))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+func (s *StoredValueServiceImpl) GetGiftCards(ctx context.Context) ([]domain.GiftCard, error) {
+	var cards []domain.GiftCard
+	err := s.db.WithContext(ctx).Order("created_at DESC").Find(&cards).Error
+	return cards, err
+}
+
+func (s *StoredValueServiceImpl) GetGiftCard(ctx context.Context, code string) (*domain.GiftCard, error) {
+	var card domain.GiftCard
+	err := s.db.WithContext(ctx).
+		Preload("Transactions", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("code = ?", normalizeGiftCardCode(code)).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (s *StoredValueServiceImpl) UpdateGiftCard(ctx context.Context, id int, req dto.UpdateGiftCardRequest) (*domain.GiftCard, error) {
+	var card domain.GiftCard
+	if err := s.db.WithContext(ctx).First(&card, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGiftCardNotFound
+		}
+		return nil, err
+	}
+	if req.Status != nil {
+		card.Status = domain.GiftCardStatus(*req.Status)
+	}
+	if req.ExpiresAt != nil {
+		card.ExpiresAt = req.ExpiresAt
+	}
+	if req.ClearExpiry {
+		card.ExpiresAt = nil
+	}
+	if err := s.db.WithContext(ctx).Model(&card).
+		Select("status", "expires_at", "updated_at").Updates(&card).Error; err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (s *StoredValueServiceImpl) GetStoreCredit(ctx context.Context, customerID int) (*dto.StoreCreditView, error) {
+	view := &dto.StoreCreditView{CustomerID: customerID}
+	db := s.db.WithContext(ctx)
+	if err := db.Where("customer_id = ?", customerID).Order("id DESC").Find(&view.Entries).Error; err != nil {
+		return nil, err
+	}
+	if len(view.Entries) > 0 {
+		view.Balance = view.Entries[0].BalanceAfter
+	}
+	return view, nil
+}
+
+func (s *StoredValueServiceImpl) GetStoreCreditForUser(ctx context.Context, userID int) (*dto.StoreCreditView, error) {
+	var customer domain.Customer
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&customer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Never shopped, so nothing was ever credited
+		return &dto.StoreCreditView{Entries: []domain.StoreCreditEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStoreCredit(ctx, customer.ID)
+}
+
+func (s *StoredValueServiceImpl) AdjustStoreCredit(ctx context.Context, customerID int, amount float64, note string, userID int) (*domain.StoreCreditEntry, error) {
+	var entry *domain.StoreCreditEntry
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = moveStoreCreditTx(tx, customerID, roundMoney(amount), domain.StoredValueAdjust, storedValueRef{Note: note, UserID: &userID})
+		return err
+	})
+	return entry, err
+}
+
+// DeliverGiftCards emails codes of cards that have a recipient and were not
+// delivered yet, e.g. cards bought in the web shop.
+func (s *StoredValueServiceImpl) DeliverGiftCards(ctx context.Context) (int, error) {
+	var cards []domain.GiftCard
+	if err := s.db.WithContext(ctx).
+		Where("delivered_at IS NULL AND recipient_email IS NOT NULL AND status = ?", domain.GiftCardActive).
+		Order("id").Limit(100).Find(&cards).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, card := range cards {
+		// Claim the card first so a parallel run cannot send it twice
+		claim := s.db.WithContext(ctx).Model(&domain.GiftCard{}).
+			Where("id = ? AND delivered_at IS NULL", card.ID).
+			Update("delivered_at", time.Now())
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		if err := s.notifier.Send(ctx, giftCardMessage(card)); err != nil {
+			s.db.WithContext(ctx).Model(&domain.GiftCard{}).Where("id = ?", card.ID).Update("delivered_at", nil)
+			log.Printf("gift card %d delivery: %v", card.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func giftCardMessage(card domain.GiftCard) notify.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You have received a gift card worth %s.\n\n", formatRupiah(card.Balance))
+	fmt.Fprintf(&b, "Code: %s\n", card.Code)
+	if card.ExpiresAt != nil {
+		fmt.Fprintf(&b, "Valid until: %s\n", card.ExpiresAt.Format("2 January 2006"))
+	}
+	b.WriteString("\nUse the code at checkout or show it at our store.\n")
+	return notify.Message{To: *card.RecipientEmail, Subject: "Your gift card", Body: b.String()}
+}
+
+// storedValueRef links a stored-value movement to what caused it.
+type storedValueRef struct {
+	OrderID   *int
+	PaymentID *int
+	UserID    *int
+	Note      string
+}
+
+// issueGiftCardTx creates card with a fresh code and its ISSUE transaction.
+func issueGiftCardTx(tx *gorm.DB, card *domain.GiftCard, amount float64) error {
+	code, err := newGiftCardCode()
+	if err != nil {
+		return err
+	}
+	card.Code = code
+	card.InitialAmount = amount
+	card.Balance = amount
+	card.Status = domain.GiftCardActive
+	if err := tx.Create(card).Error; err != nil {
+		return err
+	}
+	return tx.Create(&domain.GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         domain.StoredValueIssue,
+		Amount:       amount,
+		BalanceAfter: amount,
+		SalesOrderID: card.SalesOrderID,
+		Note:         card.Note,
+		CreatedBy:    card.IssuedBy,
+	}).Error
+}
+
+// issueOrderGiftCardsTx issues a card per unit of each gift card line of a
+// paid order. POS cards are handed over at the till; web cards are emailed
+// by DeliverGiftCards.
+func issueOrderGiftCardsTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	var items []domain.SalesOrderItem
+	if err := tx.Joins("JOIN product_variants ON product_variants.id = sales_order_items.variant_id").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Where("sales_order_items.sales_order_id = ? AND products.is_gift_card", order.ID).
+		Find(&items).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	email, err := orderEmail(tx, order)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		for i := 0; i < item.Quantity; i++ {
+			card := &domain.GiftCard{SalesOrderID: &order.ID, IssuedBy: order.CreatedBy}
+			if order.Channel == domain.ChannelPOS {
+				now := time.Now()
+				card.DeliveredAt = &now
+			} else if email != "" {
+				card.RecipientEmail = &email
+			}
+			if err := issueGiftCardTx(tx, card, item.UnitPrice); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// disableOrderGiftCardsTx disables the cards an order sold that have not been
+// spent from, when the order is cancelled or returned. Cards already used
+// stay active; their value has left the shop.
+func disableOrderGiftCardsTx(tx *gorm.DB, orderID int) error {
+	return tx.Model(&domain.GiftCard{}).
+		Where("sales_order_id = ? AND status = ? AND balance >= initial_amount", orderID, domain.GiftCardActive).
+		Updates(map[string]interface{}{"status": domain.GiftCardDisabled, "updated_at": time.Now()}).Error
+}
+
+// orderEmail is where order messages go: the guest email or the customer's login.
+func orderEmail(tx *gorm.DB, order *domain.SalesOrder) (string, error) {
+	if order.GuestEmail != nil {
+		return *order.GuestEmail, nil
+	}
+	if order.CustomerID == nil {
+		return "", nil
+	}
+	var email string
+	err := tx.Table("customers").Joins("JOIN users ON users.id = customers.user_id").
+		Where("customers.id = ?", *order.CustomerID).Pluck("users.email", &email).Error
+	return email, err
+}
+
+// moveGiftCardTx adds delta (negative to spend) to a card's balance. Only
+// spending checks the card is usable; refunds always go back on the card.
+func moveGiftCardTx(tx *gorm.DB, code string, delta float64, txType domain.StoredValueTxType, ref storedValueRef) (*domain.GiftCard, error) {
+	var card domain.GiftCard
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", normalizeGiftCardCode(code)).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if delta < 0 {
+		if err := giftCardUsable(&card, -delta); err != nil {
+			return nil, err
+		}
+	}
+
+	card.Balance = roundMoney(card.Balance + delta)
+	if err := tx.Model(&card).Updates(map[string]interface{}{"balance": card.Balance, "updated_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+	entry := domain.GiftCardTransaction{
+		GiftCardID:   card.ID,
+		Type:         txType,
+		Amount:       delta,
+		BalanceAfter: card.Balance,
+		SalesOrderID: ref.OrderID,
+		PaymentID:    ref.PaymentID,
+		CreatedBy:    ref.UserID,
+	}
+	if ref.Note != "" {
+		entry.Note = &ref.Note
+	}
+	return &card, tx.Create(&entry).Error
+}
+
+func giftCardUsable(card *domain.GiftCard, amount float64) error {
+	if card.Status != domain.GiftCardActive || (card.ExpiresAt != nil && time.Now().After(*card.ExpiresAt)) {
+		return ErrGiftCardUnusable
+	}
+	if roundMoney(amount) > card.Balance {
+		return fmt.Errorf("%w: gift card holds %.2f", ErrInsufficientBalance, card.Balance)
+	}
+	return nil
+}
+
+// moveStoreCreditTx appends a ledger entry for the customer. The customer row
+// is locked so concurrent entries see each other's balance.
+func moveStoreCreditTx(tx *gorm.DB, customerID int, delta float64, txType domain.StoredValueTxType, ref storedValueRef) (*domain.StoreCreditEntry, error) {
+	if delta == 0 {
+		return nil, errors.New("amount must not be zero")
+	}
+	var customer domain.Customer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&customer, customerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoCustomer
+	}
+	if err != nil {
+		return nil, err
+	}
+	balance, err := storeCreditBalance(tx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if delta < 0 && roundMoney(-delta) > balance {
+		return nil, fmt.Errorf("%w: store credit is %.2f", ErrInsufficientBalance, balance)
+	}
+
+	entry := &domain.StoreCreditEntry{
+		CustomerID:   customerID,
+		Type:         txType,
+		Amount:       delta,
+		BalanceAfter: roundMoney(balance + delta),
+		SalesOrderID: ref.OrderID,
+		PaymentID:    ref.PaymentID,
+		CreatedBy:    ref.UserID,
+	}
+	if ref.Note != "" {
+		entry.Note = &ref.Note
+	}
+	return entry, tx.Create(entry).Error
+}
+
+func storeCreditBalance(db *gorm.DB, customerID int) (float64, error) {
+	var last domain.StoreCreditEntry
+	err := db.Where("customer_id = ?", customerID).Order("id DESC").Limit(1).Find(&last).Error
+	return last.BalanceAfter, err
+}
+
+// checkStoredValue reports whether a gift card or store credit tender can be
+// drawn, without locking anything; redemption checks again.
+func checkStoredValue(db *gorm.DB, t Tender, customerID *int) error {
+	switch {
+	case isGiftCard(t.Method):
+		var card domain.GiftCard
+		err := db.Where("code = ?", normalizeGiftCardCode(t.Reference)).First(&card).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGiftCardNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return giftCardUsable(&card, t.Amount)
+	case isStoreCredit(t.Method):
+		if customerID == nil {
+			return ErrNoCustomer
+		}
+		balance, err := storeCreditBalance(db, *customerID)
+		if err != nil {
+			return err
+		}
+		if roundMoney(t.Amount) > balance {
+			return fmt.Errorf("%w: store credit is %.2f", ErrInsufficientBalance, balance)
+		}
+	}
+	return nil
+}
+
+// redeemStoredValueTx draws a stored-value tender recorded as payment p.
+func redeemStoredValueTx(tx *gorm.DB, p *domain.Payment, t Tender, customerID *int) error {
+	ref := storedValueRef{OrderID: p.SalesOrderID, PaymentID: &p.ID}
+	switch {
+	case isGiftCard(t.Method):
+		_, err := moveGiftCardTx(tx, t.Reference, -p.Amount, domain.StoredValueRedeem, ref)
+		return err
+	case isStoreCredit(t.Method):
+		if customerID == nil {
+			return ErrNoCustomer
+		}
+		_, err := moveStoreCreditTx(tx, *customerID, -p.Amount, domain.StoredValueRedeem, ref)
+		return err
+	}
+	return nil
+}
+
+func isGiftCard(method string) bool    { return strings.EqualFold(method, MethodGiftCard) }
+func isStoreCredit(method string) bool { return strings.EqualFold(method, MethodStoreCredit) }
+func isStoredValue(method string) bool { return isGiftCard(method) || isStoreCredit(method) }
+
+// Codes avoid characters that are easy to misread: 0/O, 1/I.
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newGiftCardCode returns a code like "K7QH-3MXA-PZ2D-9WTF" (80 random bits).
+func newGiftCardCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var code strings.Builder
+	for i, v := range b {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(giftCardAlphabet[int(v)%len(giftCardAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// normalizeGiftCardCode accepts codes typed in lower case or without dashes.
+func normalizeGiftCardCode(code string) string {
+	raw := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	var out strings.Builder
+	for i, r := range raw {
+		if i > 0 && i%4 == 0 {
+			out.WriteByte('-')
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
@@ -0,0 +1,927 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/notify"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrPlanUnavailable      = errors.New("subscription plan is not available")
+	// ErrInvalidSubscription wraps why a subscription or plan change is refused.
+	ErrInvalidSubscription = errors.New("invalid subscription")
+)
+
+// subscriptionBatch caps the subscriptions one run handles; the rest wait
+// for the next tick.
+const subscriptionBatch = 100
+
+// SubscriptionConfig tunes how subscription runs chase payment.
+type SubscriptionConfig struct {
+	RetryAfter  time.Duration // Between payment attempts on a run's order
+	MaxAttempts int           // Failed attempts before the subscription is past due
+}
+
+type SubscriptionServiceImpl struct {
+	db       *gorm.DB
+	carts    CartService
+	orders   OrderService
+	payments PaymentService
+	notifier notify.Notifier
+	cfg      SubscriptionConfig
+}
+
+func NewSubscriptionService(db *gorm.DB, carts CartService, orders OrderService, payments PaymentService, notifier notify.Notifier, cfg SubscriptionConfig) SubscriptionService {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	return &SubscriptionServiceImpl{db: db, carts: carts, orders: orders, payments: payments, notifier: notifier, cfg: cfg}
+}
+
+// Plans
+
+func (s *SubscriptionServiceImpl) GetPlans(ctx context.Context, activeOnly bool) ([]domain.SubscriptionPlan, error) {
+	var plans []domain.SubscriptionPlan
+	q := s.db.WithContext(ctx).Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Preload("Items.Variant")
+	if activeOnly {
+		q = q.Where("is_active = ?", true)
+	}
+	err := q.Order("name").Find(&plans).Error
+	return plans, err
+}
+
+func (s *SubscriptionServiceImpl) SavePlan(ctx context.Context, plan *domain.SubscriptionPlan) error {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSubscription)
+	}
+	if plan.IntervalUnit != domain.IntervalWeek && plan.IntervalUnit != domain.IntervalMonth {
+		return fmt.Errorf("%w: interval_unit must be WEEK or MONTH", ErrInvalidSubscription)
+	}
+	if plan.IntervalCount <= 0 {
+		plan.IntervalCount = 1
+	}
+	defaults := 0
+	seen := map[int]bool{}
+	variantIDs := make([]int, 0, len(plan.Items))
+	for i := range plan.Items {
+		item := &plan.Items[i]
+		if item.Quantity <= 0 {
+			item.Quantity = 1
+		}
+		if seen[item.VariantID] {
+			return fmt.Errorf("%w: variant %d is listed twice", ErrInvalidSubscription, item.VariantID)
+		}
+		seen[item.VariantID] = true
+		variantIDs = append(variantIDs, item.VariantID)
+		if item.IsDefault {
+			defaults++
+		}
+	}
+	if defaults == 0 {
+		return fmt.Errorf("%w: at least one item must be in the default box", ErrInvalidSubscription)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var found int64
+		if err := tx.Model(&domain.ProductVariant{}).Where("id IN ?", variantIDs).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(variantIDs) {
+			return fmt.Errorf("%w: unknown variant", ErrInvalidSubscription)
+		}
+
+		items := plan.Items
+		plan.Items = nil
+		if plan.ID == 0 {
+			if err := tx.Create(plan).Error; err != nil {
+				return err
+			}
+		} else {
+			res := tx.Select("*").Omit("created_at").Save(plan)
+			if res.Error != nil {
+				return res.Error
+			}
+			if err := tx.Where("plan_id = ?", plan.ID).Delete(&domain.SubscriptionPlanItem{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range items {
+			items[i].ID = 0
+			items[i].PlanID = plan.ID
+		}
+		if err := tx.Omit("Variant").Create(&items).Error; err != nil {
+			return err
+		}
+		plan.Items = items
+		return nil
+	})
+}
+
+// DeletePlan stops new subscriptions to the plan; running ones continue.
+func (s *SubscriptionServiceImpl) DeletePlan(ctx context.Context, id int) error {
+	return s.db.WithContext(ctx).Model(&domain.SubscriptionPlan{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()}).Error
+}
+
+func (s *SubscriptionServiceImpl) GetSubscriptions(ctx context.Context, status domain.SubscriptionStatus, page, limit int) ([]domain.Subscription, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var subs []domain.Subscription
+	q := s.db.WithContext(ctx).Preload("Items").Preload("Plan").Preload("Customer.User")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	err := q.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&subs).Error
+	return subs, err
+}
+
+// Customers
+
+func (s *SubscriptionServiceImpl) Subscribe(ctx context.Context, userID int, req dto.SubscribeRequest) (*domain.Subscription, error) {
+	db := s.db.WithContext(ctx)
+	var plan domain.SubscriptionPlan
+	err := db.Preload("Items").Where("id = ? AND is_active = ?", req.PlanID, true).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPlanUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := planItems(&plan, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkDelivery(ctx, userID, req.ShippingAddressID, req.ShippingMethod); err != nil {
+		return nil, err
+	}
+	first := time.Now()
+	if req.StartOn != "" {
+		start, err := time.ParseInLocation(time.DateOnly, req.StartOn, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: start_on must be YYYY-MM-DD", ErrInvalidSubscription)
+		}
+		if start.After(first) {
+			first = start
+		}
+	}
+
+	customer := domain.Customer{UserID: &userID}
+	if err := db.Where("user_id = ?", userID).FirstOrCreate(&customer).Error; err != nil {
+		return nil, err
+	}
+	sub := &domain.Subscription{
+		CustomerID:        customer.ID,
+		PlanID:            plan.ID,
+		Status:            domain.SubscriptionActive,
+		NextRunAt:         first,
+		ShippingAddressID: req.ShippingAddressID,
+		ShippingMethod:    strings.ToUpper(strings.TrimSpace(req.ShippingMethod)),
+		PaymentMethod:     req.PaymentMethod,
+		Items:             items,
+	}
+	if req.PaymentToken != "" {
+		sub.PaymentToken = &req.PaymentToken
+	}
+	if err := db.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, sub.ID)
+}
+
+func (s *SubscriptionServiceImpl) GetMySubscriptions(ctx context.Context, userID int) ([]domain.Subscription, error) {
+	var subs []domain.Subscription
+	err := s.mine(s.db.WithContext(ctx), userID).
+		Preload("Items.Variant").Preload("Plan").
+		Order("id DESC").Find(&subs).Error
+	return subs, err
+}
+
+func (s *SubscriptionServiceImpl) GetMySubscription(ctx context.Context, userID, id int) (*domain.Subscription, error) {
+	var sub domain.Subscription
+	err := s.mine(s.db.WithContext(ctx), userID).
+		Preload("Items.Variant").Preload("Plan.Items.Variant").
+		First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *SubscriptionServiceImpl) UpdateSubscription(ctx context.Context, userID, id int, req dto.UpdateSubscriptionRequest) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == domain.SubscriptionEnded {
+		return nil, fmt.Errorf("%w: it is cancelled", ErrInvalidSubscription)
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	address, method := sub.ShippingAddressID, sub.ShippingMethod
+	if req.ShippingAddressID > 0 {
+		address = req.ShippingAddressID
+	}
+	if req.ShippingMethod != "" {
+		method = strings.ToUpper(strings.TrimSpace(req.ShippingMethod))
+	}
+	if address != sub.ShippingAddressID || method != sub.ShippingMethod {
+		if err := s.checkDelivery(ctx, userID, address, method); err != nil {
+			return nil, err
+		}
+		updates["shipping_address_id"] = address
+		updates["shipping_method"] = method
+	}
+	if req.PaymentMethod != "" {
+		updates["payment_method"] = req.PaymentMethod
+	}
+	if req.PaymentToken != nil {
+		if *req.PaymentToken == "" {
+			updates["payment_token"] = nil
+		} else {
+			updates["payment_token"] = *req.PaymentToken
+		}
+	}
+	if req.NextRunOn != "" {
+		next, err := time.ParseInLocation(time.DateOnly, req.NextRunOn, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: next_run_on must be YYYY-MM-DD", ErrInvalidSubscription)
+		}
+		if !next.After(time.Now()) {
+			return nil, fmt.Errorf("%w: next_run_on must be in the future", ErrInvalidSubscription)
+		}
+		if sub.PendingOrderID != nil {
+			return nil, fmt.Errorf("%w: an order is waiting for payment; skip it instead", ErrInvalidSubscription)
+		}
+		updates["next_run_at"] = next
+	}
+
+	if err := s.db.WithContext(ctx).Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+// SwapItems replaces the items of the next orders with others the plan
+// offers.
+func (s *SubscriptionServiceImpl) SwapItems(ctx context.Context, userID, id int, reqItems []dto.SubscriptionItemRequest) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == domain.SubscriptionEnded {
+		return nil, fmt.Errorf("%w: it is cancelled", ErrInvalidSubscription)
+	}
+	if len(reqItems) == 0 {
+		return nil, fmt.Errorf("%w: choose at least one item", ErrInvalidSubscription)
+	}
+	items, err := planItems(sub.Plan, reqItems)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", sub.ID).Delete(&domain.SubscriptionItem{}).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].SubscriptionID = sub.ID
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Subscription{}).Where("id = ?", sub.ID).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+// Pause stops runs until resumed, or until the day given. An order waiting
+// for payment is cancelled.
+func (s *SubscriptionServiceImpl) Pause(ctx context.Context, userID, id int, until *time.Time) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != domain.SubscriptionActive {
+		return nil, fmt.Errorf("%w: only active subscriptions can be paused", ErrInvalidSubscription)
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidSubscription)
+	}
+	if err := s.cancelPending(ctx, sub, "Subscription paused"); err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"status":           domain.SubscriptionPaused,
+		"paused_until":     until,
+		"pending_order_id": nil,
+		"attempts":         0,
+		"retry_at":         nil,
+		"updated_at":       time.Now(),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+// Resume restarts a paused subscription on its schedule, or retries a past
+// due one at once (after the payment method is fixed, say).
+func (s *SubscriptionServiceImpl) Resume(ctx context.Context, userID, id int) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != domain.SubscriptionPaused && sub.Status != domain.SubscriptionPastDue {
+		return nil, fmt.Errorf("%w: only paused or past due subscriptions can be resumed", ErrInvalidSubscription)
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return resumeTx(tx, sub, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+// Skip moves the next run one interval on. An order waiting for payment is
+// the run being skipped, so it is cancelled.
+func (s *SubscriptionServiceImpl) Skip(ctx context.Context, userID, id int) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status != domain.SubscriptionActive && sub.Status != domain.SubscriptionPaused {
+		return nil, fmt.Errorf("%w: only active or paused subscriptions can skip an order", ErrInvalidSubscription)
+	}
+	if err := s.cancelPending(ctx, sub, "Skipped by the subscriber"); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	next := nextRunAfter(sub.Plan, nextRun(sub.Plan, sub.NextRunAt), now)
+	err = s.db.WithContext(ctx).Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"next_run_at":      next,
+		"pending_order_id": nil,
+		"attempts":         0,
+		"retry_at":         nil,
+		"last_error":       nil,
+		"updated_at":       now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+func (s *SubscriptionServiceImpl) Cancel(ctx context.Context, userID, id int) (*domain.Subscription, error) {
+	sub, err := s.GetMySubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == domain.SubscriptionEnded {
+		return sub, nil
+	}
+	if err := s.cancelPending(ctx, sub, "Subscription cancelled"); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.db.WithContext(ctx).Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"status":           domain.SubscriptionEnded,
+		"cancelled_at":     now,
+		"pending_order_id": nil,
+		"retry_at":         nil,
+		"updated_at":       now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMySubscription(ctx, userID, id)
+}
+
+// Runs
+
+// RunDue resumes pauses that have ended, then places and charges the orders
+// of due subscriptions and retries payment of the ones waiting. It returns
+// how many orders were placed.
+func (s *SubscriptionServiceImpl) RunDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	db := s.db.WithContext(ctx)
+
+	var lapsed []domain.Subscription
+	if err := db.Preload("Plan").
+		Where("status = ? AND paused_until IS NOT NULL AND paused_until <= ?", domain.SubscriptionPaused, now).
+		Limit(subscriptionBatch).Find(&lapsed).Error; err != nil {
+		return 0, err
+	}
+	for i := range lapsed {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return resumeTx(tx, &lapsed[i], now)
+		}); err != nil {
+			return 0, err
+		}
+	}
+
+	var ids []int
+	if err := db.Model(&domain.Subscription{}).
+		Where("status = ? AND next_run_at <= ? AND (retry_at IS NULL OR retry_at <= ?)", domain.SubscriptionActive, now, now).
+		Order("next_run_at").Limit(subscriptionBatch).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	placed := 0
+	for _, id := range ids {
+		ok, err := s.run(ctx, id)
+		if err != nil {
+			log.Printf("subscription %d run: %v", id, err)
+			continue
+		}
+		if ok {
+			placed++
+		}
+	}
+	return placed, nil
+}
+
+// run handles one due subscription: a payment retry when its order is
+// still waiting, a new order otherwise. It reports whether it placed one.
+func (s *SubscriptionServiceImpl) run(ctx context.Context, id int) (bool, error) {
+	db := s.db.WithContext(ctx)
+	var sub domain.Subscription
+	if err := db.Preload("Items").Preload("Plan").First(&sub, id).Error; err != nil {
+		return false, err
+	}
+
+	if sub.PendingOrderID != nil {
+		var order domain.SalesOrder
+		if err := db.First(&order, *sub.PendingOrderID).Error; err != nil {
+			return false, err
+		}
+		if order.Status != domain.OrderCancelled {
+			return false, s.charge(ctx, &sub, &order)
+		}
+		// Cancelled by the customer or staff: that run is skipped
+		return false, db.Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+			"next_run_at":      nextRunAfter(sub.Plan, nextRun(sub.Plan, sub.NextRunAt), time.Now()),
+			"pending_order_id": nil,
+			"attempts":         0,
+			"retry_at":         nil,
+			"last_error":       nil,
+			"updated_at":       time.Now(),
+		}).Error
+	}
+
+	order, err := s.placeOrder(ctx, &sub)
+	if err != nil {
+		// Nothing to pay yet, e.g. an item is out of stock; try again later
+		return false, s.failed(ctx, &sub, nil, err)
+	}
+	return true, s.charge(ctx, &sub, order)
+}
+
+// placeOrder places a web order for the subscription's items, priced like
+// a checkout. It is held open long enough for every payment attempt.
+func (s *SubscriptionServiceImpl) placeOrder(ctx context.Context, sub *domain.Subscription) (*domain.SalesOrder, error) {
+	var customer domain.Customer
+	if err := s.db.WithContext(ctx).Preload("User").First(&customer, sub.CustomerID).Error; err != nil {
+		return nil, err
+	}
+	if customer.User == nil || !customer.User.IsActive {
+		return nil, errors.New("the customer account is not active")
+	}
+	if customer.UserID == nil {
+		return nil, ErrAddressNotFound
+	}
+	address, err := s.carts.UserAddress(ctx, sub.ShippingAddressID, *customer.UserID)
+	if err != nil {
+		return nil, err
+	}
+	shopper := Shopper{
+		CustomerID:      &customer.ID,
+		Email:           customer.User.Email,
+		ShippingAddress: address,
+		ShippingMethod:  sub.ShippingMethod,
+		Channel:         domain.ChannelWeb,
+	}
+	reqItems := make([]dto.CartItemRequest, 0, len(sub.Items))
+	for _, item := range sub.Items {
+		reqItems = append(reqItems, dto.CartItemRequest{VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	items, err := s.carts.PriceItems(ctx, reqItems)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.carts.CalculateCart(ctx, items, "", shopper)
+	if err != nil {
+		return nil, err
+	}
+	if result.Shipping == nil {
+		return nil, fmt.Errorf("%w: %s", ErrShippingUnavailable, sub.ShippingMethod)
+	}
+
+	expiresAt := time.Now().Add(s.cfg.RetryAfter*time.Duration(s.cfg.MaxAttempts) + time.Hour)
+	order := &domain.SalesOrder{
+		CustomerID:              &customer.ID,
+		Channel:                 domain.ChannelWeb,
+		SubscriptionID:          &sub.ID,
+		ShippingAddressSnapshot: s.carts.AddressSnapshot(address),
+		BillingAddressSnapshot:  s.carts.AddressSnapshot(address),
+		ExpiresAt:               &expiresAt,
+
+		TotalAmount:    result.TotalAmount,
+		SubtotalAmount: result.Subtotal,
+		DiscountAmount: result.DiscountAmount,
+		TaxAmount:      result.TaxAmount,
+		ShippingAmount: result.ShippingAmount,
+
+		PricesIncludeTax: result.PricesIncludeTax,
+
+		ShippingMethodID: &result.Shipping.MethodID,
+		ShippingRateID:   result.Shipping.RateID,
+		ShippingWeightKG: &result.Shipping.WeightKG,
+		Carrier:          result.Shipping.Carrier,
+
+		Items:         result.Items,
+		Promotions:    result.Promotions,
+		PaymentMethod: sub.PaymentMethod,
+		Status:        domain.OrderDraft,
+	}
+	// PlaceOrder records it as the subscription's pending order
+	if err := s.orders.PlaceOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	sub.PendingOrderID = &order.ID
+	return order, nil
+}
+
+// charge attempts payment of a run's order: the saved payment method when
+// there is one, otherwise a payment link by email. Anything short of an
+// immediate payment counts as an attempt.
+func (s *SubscriptionServiceImpl) charge(ctx context.Context, sub *domain.Subscription, order *domain.SalesOrder) error {
+	db := s.db.WithContext(ctx)
+	email, err := orderEmail(db, order)
+	if err != nil {
+		return err
+	}
+
+	if sub.PaymentToken == nil {
+		// A link sent on an earlier attempt is sent again while it can still
+		// be paid; a second charge would leave both payable
+		url, err := openPaymentURL(db, order.ID)
+		if err != nil {
+			return err
+		}
+		if url != "" {
+			return s.awaitPayment(ctx, sub, order, email, url)
+		}
+		links, err := s.payments.StartPayment(ctx, order, email, nil)
+		if err != nil {
+			return s.failed(ctx, sub, order, err)
+		}
+		for _, link := range links {
+			if link.PaymentURL != "" {
+				url = link.PaymentURL
+				break
+			}
+		}
+		if url == "" {
+			// Nothing was owed, and the order is paid
+			return nil
+		}
+		return s.awaitPayment(ctx, sub, order, email, url)
+	}
+
+	// A charge still pending with the provider may yet be paid; charging
+	// again could take the money twice
+	var pending int64
+	if err := db.Model(&domain.Payment{}).
+		Where("sales_order_id = ? AND type = ? AND status = ?", order.ID, domain.TransCredit, domain.PaymentUnpaid).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return s.failed(ctx, sub, order, errors.New("the payment is still being processed"))
+	}
+
+	paid, err := s.payments.ChargeSaved(ctx, order, email, *sub.PaymentToken)
+	if err != nil {
+		return s.failed(ctx, sub, order, err)
+	}
+	if !paid {
+		return s.failed(ctx, sub, order, errors.New("the payment is being processed"))
+	}
+	// The payment moved the subscription on (completeSubscriptionRunTx)
+	return s.notifyPaid(ctx, sub, order, email)
+}
+
+// awaitPayment records a payment link sent for the run's order as an
+// attempt; the order is paid through the link or reminded about again.
+func (s *SubscriptionServiceImpl) awaitPayment(ctx context.Context, sub *domain.Subscription, order *domain.SalesOrder, email, url string) error {
+	last, retryAt, err := s.recordAttempt(ctx, sub, order, "awaiting payment")
+	if err != nil || last {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your %s order %s is ready.\n\n", sub.Plan.Name, order.OrderNumber)
+	fmt.Fprintf(&b, "Total: %s\n", formatRupiah(order.TotalAmount))
+	fmt.Fprintf(&b, "Pay here: %s\n\n", url)
+	fmt.Fprintf(&b, "We will hold it for you and remind you again on %s if it is still unpaid.\n", retryAt.Format("2 January 2006"))
+	return s.notifier.Send(ctx, notify.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Your %s order %s is ready for payment", sub.Plan.Name, order.OrderNumber),
+		Body:    b.String(),
+	})
+}
+
+// failed records a run that could not be paid, or not placed when order is
+// nil, and tells the customer when it will be tried again.
+func (s *SubscriptionServiceImpl) failed(ctx context.Context, sub *domain.Subscription, order *domain.SalesOrder, cause error) error {
+	last, retryAt, err := s.recordAttempt(ctx, sub, order, cause.Error())
+	if err != nil || last {
+		return err
+	}
+	email, err := s.customerEmail(ctx, sub)
+	if err != nil || email == "" {
+		return err
+	}
+
+	var b strings.Builder
+	if order != nil {
+		fmt.Fprintf(&b, "We could not take payment for your %s order %s: %s.\n\n", sub.Plan.Name, order.OrderNumber, cause)
+	} else {
+		fmt.Fprintf(&b, "We could not prepare your %s order: %s.\n\n", sub.Plan.Name, cause)
+	}
+	fmt.Fprintf(&b, "We will try again on %s. You can update your payment method, delivery details or items under My subscriptions.\n", retryAt.Format("2 January 2006"))
+	return s.notifier.Send(ctx, notify.Message{
+		To:      email,
+		Subject: fmt.Sprintf("A problem with your %s subscription", sub.Plan.Name),
+		Body:    b.String(),
+	})
+}
+
+// recordAttempt counts a failed attempt and schedules the next. The last
+// attempt cancels the order and leaves the subscription past due, telling
+// the customer; last reports that case.
+func (s *SubscriptionServiceImpl) recordAttempt(ctx context.Context, sub *domain.Subscription, order *domain.SalesOrder, reason string) (last bool, retryAt time.Time, err error) {
+	now := time.Now()
+	sub.Attempts++
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	db := s.db.WithContext(ctx)
+
+	if sub.Attempts < s.cfg.MaxAttempts {
+		retryAt = now.Add(s.cfg.RetryAfter)
+		err = db.Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+			"attempts":   sub.Attempts,
+			"retry_at":   retryAt,
+			"last_error": reason,
+			"updated_at": now,
+		}).Error
+		return false, retryAt, err
+	}
+
+	if order != nil {
+		if err := s.cancelPending(ctx, sub, "Subscription payment failed"); err != nil {
+			return true, retryAt, err
+		}
+	}
+	if err := db.Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"status":           domain.SubscriptionPastDue,
+		"attempts":         sub.Attempts,
+		"pending_order_id": nil,
+		"retry_at":         nil,
+		"last_error":       reason,
+		"updated_at":       now,
+	}).Error; err != nil {
+		return true, retryAt, err
+	}
+
+	email, err := s.customerEmail(ctx, sub)
+	if err != nil || email == "" {
+		return true, retryAt, err
+	}
+	var b strings.Builder
+	if order != nil {
+		fmt.Fprintf(&b, "After %d attempts we could not take payment for your %s order %s (%s), so it has been cancelled.\n\n", sub.Attempts, sub.Plan.Name, order.OrderNumber, reason)
+	} else {
+		fmt.Fprintf(&b, "After %d attempts we could not prepare your %s order (%s).\n\n", sub.Attempts, sub.Plan.Name, reason)
+	}
+	b.WriteString("Your subscription is on hold. Update your payment method under My subscriptions and resume it to receive your next order.\n")
+	return true, retryAt, s.notifier.Send(ctx, notify.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Your %s subscription is on hold", sub.Plan.Name),
+		Body:    b.String(),
+	})
+}
+
+func (s *SubscriptionServiceImpl) notifyPaid(ctx context.Context, sub *domain.Subscription, order *domain.SalesOrder, email string) error {
+	if email == "" {
+		return nil
+	}
+	var next time.Time
+	if err := s.db.WithContext(ctx).Model(&domain.Subscription{}).Where("id = ?", sub.ID).
+		Pluck("next_run_at", &next).Error; err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your %s order %s is paid and will be on its way soon.\n\n", sub.Plan.Name, order.OrderNumber)
+	fmt.Fprintf(&b, "We charged %s to your saved payment method.\n", formatRupiah(order.TotalAmount))
+	fmt.Fprintf(&b, "Your next order is planned for %s; you can skip it or swap items under My subscriptions.\n", next.Format("2 January 2006"))
+	return s.notifier.Send(ctx, notify.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Your %s order %s", sub.Plan.Name, order.OrderNumber),
+		Body:    b.String(),
+	})
+}
+
+// cancelPending cancels the run's order if it is still unpaid.
+func (s *SubscriptionServiceImpl) cancelPending(ctx context.Context, sub *domain.Subscription, reason string) error {
+	if sub.PendingOrderID == nil {
+		return nil
+	}
+	var order domain.SalesOrder
+	if err := s.db.WithContext(ctx).First(&order, *sub.PendingOrderID).Error; err != nil {
+		return err
+	}
+	if order.Status == domain.OrderCancelled || order.PaymentStatus != domain.PaymentUnpaid {
+		return nil
+	}
+	return s.orders.CancelOrder(ctx, order.ID, reason)
+}
+
+func (s *SubscriptionServiceImpl) customerEmail(ctx context.Context, sub *domain.Subscription) (string, error) {
+	return orderEmail(s.db.WithContext(ctx), &domain.SalesOrder{CustomerID: &sub.CustomerID})
+}
+
+// checkDelivery makes sure orders can go to the address with the method.
+func (s *SubscriptionServiceImpl) checkDelivery(ctx context.Context, userID, addressID int, method string) error {
+	if _, err := s.carts.UserAddress(ctx, addressID, userID); err != nil {
+		return err
+	}
+	var n int64
+	if err := s.db.WithContext(ctx).Model(&domain.ShippingMethod{}).
+		Where("code = ? AND is_active = ?", strings.ToUpper(strings.TrimSpace(method)), true).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: unknown method %s", ErrShippingUnavailable, method)
+	}
+	return nil
+}
+
+// mine scopes a query to the subscriptions of the user's customer record.
+func (s *SubscriptionServiceImpl) mine(db *gorm.DB, userID int) *gorm.DB {
+	return db.Where("customer_id IN (SELECT id FROM customers WHERE user_id = ?)", userID)
+}
+
+// planItems checks requested items against what the plan offers; without
+// any, the plan's default items are taken.
+func planItems(plan *domain.SubscriptionPlan, req []dto.SubscriptionItemRequest) ([]domain.SubscriptionItem, error) {
+	var items []domain.SubscriptionItem
+	if len(req) == 0 {
+		for _, pi := range plan.Items {
+			if pi.IsDefault {
+				items = append(items, domain.SubscriptionItem{VariantID: pi.VariantID, Quantity: pi.Quantity})
+			}
+		}
+		return items, nil
+	}
+
+	offered := make(map[int]bool, len(plan.Items))
+	for _, pi := range plan.Items {
+		offered[pi.VariantID] = true
+	}
+	index := map[int]int{}
+	for _, r := range req {
+		if !offered[r.VariantID] {
+			return nil, fmt.Errorf("%w: variant %d is not part of this plan", ErrInvalidSubscription, r.VariantID)
+		}
+		if r.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be at least 1", ErrInvalidSubscription)
+		}
+		if i, ok := index[r.VariantID]; ok {
+			items[i].Quantity += r.Quantity
+			continue
+		}
+		index[r.VariantID] = len(items)
+		items = append(items, domain.SubscriptionItem{VariantID: r.VariantID, Quantity: r.Quantity})
+	}
+	return items, nil
+}
+
+// nextRun is one plan interval after t. Monthly runs follow AddDate, so a
+// run on the 31st moves into the next month when the following one is shorter.
+func nextRun(plan *domain.SubscriptionPlan, t time.Time) time.Time {
+	n := max(plan.IntervalCount, 1)
+	if plan.IntervalUnit == domain.IntervalWeek {
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, n, 0)
+}
+
+// nextRunAfter steps t forward by the plan's interval until it is after now.
+func nextRunAfter(plan *domain.SubscriptionPlan, t, now time.Time) time.Time {
+	for !t.After(now) {
+		t = nextRun(plan, t)
+	}
+	return t
+}
+
+// resumeTx reactivates a subscription. Runs missed while paused are
+// skipped; a past due one runs again at once.
+func resumeTx(tx *gorm.DB, sub *domain.Subscription, now time.Time) error {
+	next := sub.NextRunAt
+	if sub.Status == domain.SubscriptionPaused {
+		next = nextRunAfter(sub.Plan, next, now)
+	}
+	return tx.Model(&domain.Subscription{}).Where("id = ? AND status = ?", sub.ID, sub.Status).Updates(map[string]interface{}{
+		"status":           domain.SubscriptionActive,
+		"paused_until":     nil,
+		"next_run_at":      next,
+		"pending_order_id": nil,
+		"attempts":         0,
+		"retry_at":         nil,
+		"last_error":       nil,
+		"updated_at":       now,
+	}).Error
+}
+
+// holdSubscriptionRunTx makes a run's order the subscription's pending one
+// in the transaction that places it, so a crash cannot leave the order
+// without the subscription knowing to retry or cancel it.
+func holdSubscriptionRunTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.SubscriptionID == nil {
+		return nil
+	}
+	return tx.Model(&domain.Subscription{}).Where("id = ?", *order.SubscriptionID).
+		Updates(map[string]interface{}{"pending_order_id": order.ID, "updated_at": time.Now()}).Error
+}
+
+// openPaymentURL returns the hosted page of the order's unpaid gateway
+// charge, or "" when there is none that can still be paid. Charges whose
+// page has expired are marked failed.
+func openPaymentURL(db *gorm.DB, orderID int) (string, error) {
+	var charges []domain.Payment
+	if err := db.Where("sales_order_id = ? AND type = ? AND status = ? AND payment_url IS NOT NULL", orderID, domain.TransCredit, domain.PaymentUnpaid).
+		Order("id DESC").Find(&charges).Error; err != nil {
+		return "", err
+	}
+	now := time.Now()
+	for _, charge := range charges {
+		if charge.ExpiresAt == nil || charge.ExpiresAt.After(now) {
+			return *charge.PaymentURL, nil
+		}
+		if err := db.Model(&charge).Update("status", domain.PaymentFailed).Error; err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// completeSubscriptionRunTx moves a subscription on once the order its
+// run placed is paid, from the webhook or a saved-method charge alike.
+func completeSubscriptionRunTx(tx *gorm.DB, order *domain.SalesOrder) error {
+	if order.SubscriptionID == nil {
+		return nil
+	}
+	var sub domain.Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Plan").First(&sub, *order.SubscriptionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if sub.PendingOrderID == nil || *sub.PendingOrderID != order.ID {
+		return nil
+	}
+	now := time.Now()
+	return tx.Model(&domain.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"next_run_at":      nextRunAfter(sub.Plan, nextRun(sub.Plan, sub.NextRunAt), now),
+		"pending_order_id": nil,
+		"last_order_id":    order.ID,
+		"attempts":         0,
+		"retry_at":         nil,
+		"last_error":       nil,
+		"updated_at":       now,
+	}).Error
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"server/internal/core/domain"
+	"server/internal/dto"
+	"server/internal/repository"
+	"server/internal/tax"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type TaxServiceImpl struct {
+	ruleRepo repository.Repository[domain.TaxRule]
+	db       *gorm.DB
+	cfg      tax.Config
+}
+
+func NewTaxService(ruleRepo repository.Repository[domain.TaxRule], db *gorm.DB, cfg tax.Config) TaxService {
+	return &TaxServiceImpl{
+		ruleRepo: ruleRepo,
+		db:       db,
+		cfg:      cfg,
+	}
+}
+
+func (s *TaxServiceImpl) GetTaxRules(ctx context.Context) ([]domain.TaxRule, error) {
+	return s.ruleRepo.FindAll(ctx)
+}
+
+func (s *TaxServiceImpl) CreateTaxRule(ctx context.Context, rule *domain.TaxRule) error {
+	if err := validateTaxRule(rule); err != nil {
+		return err
+	}
+	return s.ruleRepo.Create(ctx, rule)
+}
+
+func (s *TaxServiceImpl) UpdateTaxRule(ctx context.Context, id int, req dto.UpdateTaxRuleRequest) (*domain.TaxRule, error) {
+	rule, err := s.ruleRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.TaxClass != nil {
+		rule.TaxClass = emptyToNil(*req.TaxClass)
+	}
+	if req.CustomerType != nil {
+		if t := emptyToNil(*req.CustomerType); t != nil {
+			ct := domain.CustomerType(strings.ToUpper(*t))
+			rule.CustomerType = &ct
+		} else {
+			rule.CustomerType = nil
+		}
+	}
+	if req.Region != nil {
+		rule.Region = emptyToNil(*req.Region)
+	}
+	if req.Rate != nil {
+		rule.Rate = *req.Rate
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+
+	if err := validateTaxRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, s.ruleRepo.Update(ctx, rule)
+}
+
+// DeleteTaxRule deactivates the rule; past order lines keep referring to it.
+func (s *TaxServiceImpl) DeleteTaxRule(ctx context.Context, id int) error {
+	rule, err := s.ruleRepo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	rule.IsActive = false
+	return s.ruleRepo.Update(ctx, rule)
+}
+
+func (s *TaxServiceImpl) PricesIncludeTax() bool {
+	return s.cfg.PricesIncludeTax
+}
+
+func (s *TaxServiceImpl) ApplyToItems(ctx context.Context, items []domain.SalesOrderItem, customerID *int, address *domain.Address) (float64, error) {
+	rules, err := s.activeRules(ctx)
+	if err != nil {
+		return 0, err
+	}
+	buyer, err := s.buyer(ctx, customerID, address)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.VariantID
+	}
+	classes, err := s.taxClasses(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for i := range items {
+		items[i].TaxRuleID, items[i].TaxRate, items[i].TaxAmount = nil, 0, 0
+		rule := tax.Match(rules, classes[items[i].VariantID], buyer)
+		if rule == nil {
+			continue
+		}
+		line := s.cfg.Compute(items[i].LineTotal, rule.Rate)
+		items[i].TaxRuleID = &rule.ID
+		items[i].TaxRate = rule.Rate
+		items[i].TaxAmount = line.Tax
+		total += line.Tax
+	}
+	return roundMoney(total), nil
+}
+
+func (s *TaxServiceImpl) ApplyToPurchaseOrder(ctx context.Context, po *domain.PurchaseOrder) error {
+	rules, err := s.activeRules(ctx)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, len(po.Items))
+	for i, item := range po.Items {
+		ids[i] = item.VariantID
+	}
+	classes, err := s.taxClasses(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	// We are the buyer; supplier quotes are tax-exclusive
+	buyer := tax.Buyer{CustomerType: string(domain.CustomerBusiness)}
+	cfg := s.cfg.Exclusive()
+
+	po.SubtotalAmount, po.TaxAmount = 0, 0
+	for i := range po.Items {
+		item := &po.Items[i]
+		item.TaxRate, item.TaxAmount = 0, 0
+		if rule := tax.Match(rules, classes[item.VariantID], buyer); rule != nil {
+			item.TaxRate = rule.Rate
+			item.TaxAmount = cfg.Compute(item.LineTotal, rule.Rate).Tax
+		}
+		po.SubtotalAmount += item.LineTotal
+		po.TaxAmount += item.TaxAmount
+	}
+	po.SubtotalAmount = roundMoney(po.SubtotalAmount)
+	po.TaxAmount = roundMoney(po.TaxAmount)
+	po.TotalAmount = roundMoney(po.SubtotalAmount + po.TaxAmount + po.ShippingAmount)
+	return nil
+}
+
+func (s *TaxServiceImpl) activeRules(ctx context.Context) ([]tax.Rule, error) {
+	rows, err := s.ruleRepo.Find(ctx, "is_active = ?", true)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]tax.Rule, len(rows))
+	for i, r := range rows {
+		rules[i] = tax.Rule{
+			ID:       r.ID,
+			Name:     r.Name,
+			TaxClass: derefString(r.TaxClass),
+			Region:   derefString(r.Region),
+			Rate:     r.Rate,
+			Priority: r.Priority,
+		}
+		if r.CustomerType != nil {
+			rules[i].CustomerType = string(*r.CustomerType)
+		}
+	}
+	return rules, nil
+}
+
+// buyer resolves the customer type and destination. Without an address
+// (POS sales, carts before checkout) only region-less rules apply.
+func (s *TaxServiceImpl) buyer(ctx context.Context, customerID *int, address *domain.Address) (tax.Buyer, error) {
+	buyer := tax.Buyer{CustomerType: string(domain.CustomerIndividual)}
+	db := s.db.WithContext(ctx)
+
+	if customerID != nil {
+		var customer domain.Customer
+		if err := db.First(&customer, *customerID).Error; err != nil {
+			return buyer, err
+		}
+		if customer.Type != "" {
+			buyer.CustomerType = string(customer.Type)
+		}
+	}
+
+	if address != nil {
+		buyer.Province = derefString(address.State)
+		buyer.City = address.City
+	}
+	return buyer, nil
+}
+
+// taxClasses maps variant IDs to their product's tax class.
+func (s *TaxServiceImpl) taxClasses(ctx context.Context, variantIDs []int) (map[int]string, error) {
+	classes := make(map[int]string, len(variantIDs))
+	if len(variantIDs) == 0 {
+		return classes, nil
+	}
+	var rows []struct {
+		ID       int
+		TaxClass *string
+	}
+	err := s.db.WithContext(ctx).Table("product_variants").
+		Select("product_variants.id, products.tax_class").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Where("product_variants.id IN ?", variantIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		classes[r.ID] = derefString(r.TaxClass)
+	}
+	return classes, nil
+}
+
+func validateTaxRule(rule *domain.TaxRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("name is required")
+	}
+	if rule.Rate < 0 || rule.Rate >= 1 {
+		return errors.New("rate must be a fraction between 0 and 1, e.g. 0.11")
+	}
+	if rule.CustomerType != nil && *rule.CustomerType != domain.CustomerIndividual && *rule.CustomerType != domain.CustomerBusiness {
+		return errors.New("customer_type must be INDIVIDUAL or BUSINESS")
+	}
+	return nil
+}
+
+func emptyToNil(v string) *string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	return &v
+}
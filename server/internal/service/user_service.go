@@ -2,19 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"server/internal/core/domain"
+	"server/internal/notify"
 	"server/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type UserServiceImpl struct {
 	userRepo repository.UserRepository
 	addrRepo repository.Repository[domain.Address]
+	notifier notify.Notifier
+	db       *gorm.DB
 }
 
-func NewUserService(userRepo repository.UserRepository, addrRepo repository.Repository[domain.Address]) UserService {
+func NewUserService(userRepo repository.UserRepository, addrRepo repository.Repository[domain.Address], notifier notify.Notifier, db *gorm.DB) UserService {
 	return &UserServiceImpl{
 		userRepo: userRepo,
 		addrRepo: addrRepo,
+		notifier: notifier,
+		db:       db,
 	}
 }
 
@@ -34,12 +45,35 @@ func (s *UserServiceImpl) UpdateProfile(ctx context.Context, user *domain.User)
 	return s.userRepo.Update(ctx, user)
 }
 
+// ErrBirthDateSet is returned when a birthday already on file would change;
+// otherwise the birthday bonus could be claimed every month.
+var ErrBirthDateSet = errors.New("birth date is already set")
+
+func (s *UserServiceImpl) SetBirthDate(ctx context.Context, userID int, birthDate time.Time) error {
+	if birthDate.After(time.Now()) {
+		return errors.New("birth date is in the future")
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		customer := domain.Customer{UserID: &userID}
+		if err := tx.Where("user_id = ?", userID).FirstOrCreate(&customer).Error; err != nil {
+			return err
+		}
+		if customer.BirthDate != nil {
+			if customer.BirthDate.Format(time.DateOnly) == birthDate.Format(time.DateOnly) {
+				return nil
+			}
+			return ErrBirthDateSet
+		}
+		return tx.Model(&customer).Update("birth_date", birthDate).Error
+	})
+}
+
 func (s *UserServiceImpl) GetAddresses(ctx context.Context, userID int) ([]domain.Address, error) {
 	return s.addrRepo.Find(ctx, "user_id = ?", userID)
 }
 
 func (s *UserServiceImpl) AddAddress(ctx context.Context, userID int, addr *domain.Address) error {
-	// addr.UserID = userID // If field exists
+	addr.UserID = &userID
 	return s.addrRepo.Create(ctx, addr)
 }
 
@@ -57,13 +91,178 @@ func (s *UserServiceImpl) SetDefaultAddress(ctx context.Context, userID, address
 }
 
 func (s *UserServiceImpl) GetWishlist(ctx context.Context, userID int) ([]domain.ProductVariant, error) {
-	return nil, nil
+	var items []domain.WishlistItem
+	if err := s.db.WithContext(ctx).
+		Preload("Variant").
+		Preload("Variant.Product").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	variants := make([]domain.ProductVariant, 0, len(items))
+	for _, item := range items {
+		if item.Variant != nil {
+			variants = append(variants, *item.Variant)
+		}
+	}
+	return variants, nil
 }
 
 func (s *UserServiceImpl) ToggleWishlist(ctx context.Context, userID, variantID int) (bool, error) {
+	db := s.db.WithContext(ctx)
+
+	res := db.Where("user_id = ? AND variant_id = ?", userID, variantID).Delete(&domain.WishlistItem{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return false, nil
+	}
+
+	var variant domain.ProductVariant
+	if err := db.Where("id = ? AND deleted_at IS NULL", variantID).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, errors.New("variant not found")
+		}
+		return false, err
+	}
+
+	item := &domain.WishlistItem{UserID: userID, VariantID: variantID, CreatedAt: time.Now()}
+	if err := db.Create(item).Error; err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+func (s *UserServiceImpl) GetStockSubscriptions(ctx context.Context, userID int) ([]domain.StockSubscription, error) {
+	var subs []domain.StockSubscription
+	err := s.db.WithContext(ctx).
+		Preload("Variant").
+		Preload("Variant.Product").
+		Where("user_id = ? AND status = ?", userID, domain.SubscriptionPending).
+		Order("created_at DESC").
+		Find(&subs).Error
+	return subs, err
+}
+
+func (s *UserServiceImpl) SubscribeStock(ctx context.Context, userID, variantID int) (*domain.StockSubscription, error) {
+	db := s.db.WithContext(ctx)
+
+	var variant domain.ProductVariant
+	if err := db.Where("id = ? AND deleted_at IS NULL", variantID).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("variant not found")
+		}
+		return nil, err
+	}
+
+	available, err := totalAvailable(db, variantID)
+	if err != nil {
+		return nil, err
+	}
+	if available > 0 {
+		return nil, errors.New("variant is in stock")
+	}
+
+	var existing domain.StockSubscription
+	err = db.Where("user_id = ? AND variant_id = ? AND status = ?", userID, variantID, domain.SubscriptionPending).
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	sub := &domain.StockSubscription{
+		UserID:    userID,
+		VariantID: variantID,
+		Status:    domain.SubscriptionPending,
+	}
+	if err := db.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *UserServiceImpl) UnsubscribeStock(ctx context.Context, userID, variantID int) error {
+	return s.db.WithContext(ctx).Model(&domain.StockSubscription{}).
+		Where("user_id = ? AND variant_id = ? AND status = ?", userID, variantID, domain.SubscriptionPending).
+		Update("status", domain.SubscriptionCancelled).Error
+}
+
+func (s *UserServiceImpl) NotifyRestocked(ctx context.Context, variantID, available int) {
+	var subs []domain.StockSubscription
+	if err := s.db.WithContext(ctx).
+		Preload("User").
+		Preload("Variant").
+		Preload("Variant.Product").
+		Where("variant_id = ? AND status = ?", variantID, domain.SubscriptionPending).
+		Order("created_at").
+		Find(&subs).Error; err != nil {
+		log.Printf("restock notifications for variant %d: %v", variantID, err)
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.User == nil || sub.Variant == nil || !sub.User.IsActive {
+			continue
+		}
+
+		// Claim the row first so a concurrent restock cannot send it twice
+		now := time.Now()
+		claim := s.db.WithContext(ctx).Model(&domain.StockSubscription{}).
+			Where("id = ? AND status = ?", sub.ID, domain.SubscriptionPending).
+			Updates(map[string]interface{}{"status": domain.SubscriptionNotified, "notified_at": now})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		if err := s.notifier.Send(ctx, restockMessage(sub)); err != nil {
+			msg := err.Error()
+			if len(msg) > 255 {
+				msg = msg[:255]
+			}
+			// Back to the queue; the next restock retries it
+			s.db.WithContext(ctx).Model(&domain.StockSubscription{}).
+				Where("id = ?", sub.ID).
+				Updates(map[string]interface{}{"status": domain.SubscriptionPending, "notified_at": nil, "last_error": msg})
+			log.Printf("restock notification %d: %v", sub.ID, err)
+		}
+	}
+}
+
+func restockMessage(sub domain.StockSubscription) notify.Message {
+	name := sub.Variant.SKU
+	link := ""
+	if p := sub.Variant.Product; p != nil {
+		name = p.Name
+		link = productURL(p.Slug)
+	}
+	if sub.Variant.Name != nil && *sub.Variant.Name != "" {
+		name += " - " + *sub.Variant.Name
+	}
+
+	greeting := "Hi,"
+	if sub.User.FirstName != nil && *sub.User.FirstName != "" {
+		greeting = fmt.Sprintf("Hi %s,", *sub.User.FirstName)
+	}
+
+	body := fmt.Sprintf("%s\n\nGood news: %s is back in stock.\n", greeting, name)
+	if link != "" {
+		body += "\n" + link + "\n"
+	}
+	body += "\nYou are receiving this because you asked to be notified. Stock is limited and not reserved for you.\n"
+
+	return notify.Message{
+		To:      sub.User.Email,
+		Subject: name + " is back in stock",
+		Body:    body,
+	}
+}
+
 func (s *UserServiceImpl) GetUserList(ctx context.Context, filter UserFilterParams) ([]domain.User, int64, error) {
 	users, err := s.userRepo.FindAll(ctx)
 	if err != nil {
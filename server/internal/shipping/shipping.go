@@ -0,0 +1,141 @@
+// Package shipping quotes delivery methods for a parcel and destination.
+package shipping
+
+import (
+	"math"
+	"server/internal/core/domain"
+	"strings"
+)
+
+// Item is one cart line as a parcel component. Dimensions are per unit.
+type Item struct {
+	WeightKG  float64
+	HeightCM  float64
+	WidthCM   float64
+	DepthCM   float64
+	Quantity  int
+	LivePlant bool
+}
+
+type Destination struct {
+	PostalCode string
+	City       string
+	Province   string
+}
+
+// ChargeableWeight sums, per unit, the larger of actual and volumetric
+// weight (H×W×D / divisor).
+func ChargeableWeight(items []Item, divisor int) float64 {
+	if divisor <= 0 {
+		divisor = 6000
+	}
+	total := 0.0
+	for _, it := range items {
+		w := it.WeightKG
+		if vol := it.HeightCM * it.WidthCM * it.DepthCM / float64(divisor); vol > w {
+			w = vol
+		}
+		total += w * float64(it.Quantity)
+	}
+	return math.Round(total*1000) / 1000
+}
+
+// ZoneScore is how specifically zone covers dest: a postal prefix match
+// scores 100 plus its length, a city 50, a province 10; 0 means outside.
+func ZoneScore(zone *domain.ShippingZone, dest Destination) int {
+	best := 0
+	postal := strings.ReplaceAll(dest.PostalCode, " ", "")
+	for _, p := range zone.PostalPrefixes {
+		if p != "" && strings.HasPrefix(postal, p) && 100+len(p) > best {
+			best = 100 + len(p)
+		}
+	}
+	if best > 0 {
+		return best
+	}
+	for _, c := range zone.Cities {
+		if dest.City != "" && strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(dest.City)) {
+			return 50
+		}
+	}
+	for _, p := range zone.Provinces {
+		if dest.Province != "" && strings.EqualFold(strings.TrimSpace(p), strings.TrimSpace(dest.Province)) {
+			return 10
+		}
+	}
+	return 0
+}
+
+// Quote is the price of one method for a parcel.
+type Quote struct {
+	Rate       *domain.ShippingRate // nil for flat-priced methods
+	WeightKG   float64
+	Price      float64
+	Free       bool // FreeOver reached
+	EtaMinDays int
+	EtaMaxDays int
+}
+
+// QuoteMethod prices method m. Rates must have their Zone loaded. It returns a
+// reason instead of a quote when the method cannot take the parcel.
+func QuoteMethod(m *domain.ShippingMethod, items []Item, dest Destination, orderValue float64) (*Quote, string) {
+	for _, it := range items {
+		if it.LivePlant && !m.AllowsLivePlants {
+			return nil, "Live plants cannot be shipped with this method"
+		}
+	}
+
+	q := &Quote{
+		WeightKG:   ChargeableWeight(items, m.VolumetricDivisor),
+		Price:      m.FlatPrice,
+		EtaMinDays: m.EtaMinDays,
+		EtaMaxDays: m.EtaMaxDays,
+	}
+
+	if len(m.Rates) > 0 {
+		rate := pickRate(m.Rates, q.WeightKG, dest)
+		if rate == nil {
+			return nil, "Not available for this destination or weight"
+		}
+		q.Rate = rate
+		q.Price = rate.BasePrice + rate.PricePerKG*math.Ceil(math.Max(0, q.WeightKG-rate.MinWeightKG))
+		if rate.EtaMinDays != nil {
+			q.EtaMinDays = *rate.EtaMinDays
+		}
+		if rate.EtaMaxDays != nil {
+			q.EtaMaxDays = *rate.EtaMaxDays
+		}
+	}
+
+	if m.FreeOver != nil && orderValue >= *m.FreeOver {
+		q.Price, q.Free = 0, true
+	}
+	q.Price = math.Round(q.Price*100) / 100
+	return q, ""
+}
+
+// pickRate finds the rate of the most specific zone covering dest whose
+// weight bracket holds weight; zone-less rates are the fallback.
+func pickRate(rates []domain.ShippingRate, weight float64, dest Destination) *domain.ShippingRate {
+	var best *domain.ShippingRate
+	bestScore := -1
+	for i := range rates {
+		r := &rates[i]
+		if weight < r.MinWeightKG || (r.MaxWeightKG != nil && weight > *r.MaxWeightKG) {
+			continue
+		}
+		score := 0
+		if r.ZoneID != nil {
+			if r.Zone == nil {
+				continue
+			}
+			if score = ZoneScore(r.Zone, dest); score == 0 {
+				continue
+			}
+		}
+		if score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
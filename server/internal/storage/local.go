@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DiskLocal = "local"
+
+var ErrInvalidSignature = errors.New("storage: invalid or expired signature")
+
+// LocalDriver keeps objects on the local filesystem. Presigned URLs point back
+// at the API (see StorageHandler), signed with HMAC-SHA256 over method, path
+// and expiry, so clients use the same upload flow as with S3.
+type LocalDriver struct {
+	disk    string
+	root    string
+	baseURL string
+	key     []byte
+}
+
+func NewLocalDriver(disk, root, apiBaseURL string, signingKey []byte) (*LocalDriver, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root: %w", err)
+	}
+
+	return &LocalDriver{
+		disk:    disk,
+		root:    abs,
+		baseURL: strings.TrimRight(apiBaseURL, "/") + "/api/v1/storage/" + disk,
+		key:     signingKey,
+	}, nil
+}
+
+func (d *LocalDriver) PresignPut(ctx context.Context, objectPath, contentType string, expiry time.Duration) (string, error) {
+	return d.sign("PUT", objectPath, expiry)
+}
+
+func (d *LocalDriver) PresignGet(ctx context.Context, objectPath string, expiry time.Duration) (string, error) {
+	return d.sign("GET", objectPath, expiry)
+}
+
+func (d *LocalDriver) Stat(ctx context.Context, objectPath string) (*ObjectInfo, error) {
+	full, err := d.resolve(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(full)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	return &ObjectInfo{
+		Path:         objectPath,
+		Size:         fi.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(objectPath)),
+		ETag:         fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+func (d *LocalDriver) Get(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	return d.Open(objectPath)
+}
+
+func (d *LocalDriver) Put(ctx context.Context, objectPath string, r io.Reader, size int64, contentType string) error {
+	return d.Write(objectPath, r)
+}
+
+func (d *LocalDriver) Delete(ctx context.Context, objectPath string) error {
+	full, err := d.resolve(objectPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(full); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (d *LocalDriver) Copy(ctx context.Context, srcPath, dstPath string) error {
+	src, err := d.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return d.Write(dstPath, src)
+}
+
+func (d *LocalDriver) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	dir, err := d.resolve(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(dir, func(full string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Skip directories and half-written temp files from Write
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.root, full)
+		if err != nil {
+			return err
+		}
+		objectPath := filepath.ToSlash(rel)
+		objects = append(objects, ObjectInfo{
+			Path:         objectPath,
+			Size:         fi.Size(),
+			ContentType:  mime.TypeByExtension(path.Ext(objectPath)),
+			ETag:         fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()),
+			LastModified: fi.ModTime(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+// Open returns the object for reading; used by the API to serve signed GETs.
+func (d *LocalDriver) Open(objectPath string) (*os.File, error) {
+	full, err := d.resolve(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write stores the object atomically (temp file + rename).
+func (d *LocalDriver) Write(objectPath string, r io.Reader) error {
+	full, err := d.resolve(objectPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), full)
+}
+
+// Verify checks the expires/sig query parameters of a presigned URL.
+func (d *LocalDriver) Verify(method, objectPath, expires, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return ErrInvalidSignature
+	}
+
+	expected := d.signature(method, objectPath, exp)
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, given) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (d *LocalDriver) sign(method, objectPath string, expiry time.Duration) (string, error) {
+	if _, err := d.resolve(objectPath); err != nil {
+		return "", err
+	}
+
+	exp := time.Now().Add(expiry).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(exp, 10))
+	q.Set("sig", hex.EncodeToString(d.signature(method, objectPath, exp)))
+
+	return d.baseURL + "/" + (&url.URL{Path: objectPath}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+func (d *LocalDriver) signature(method, objectPath string, expires int64) []byte {
+	mac := hmac.New(sha256.New, d.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", method, d.disk, objectPath, expires)
+	return mac.Sum(nil)
+}
+
+// resolve maps an object path onto the filesystem, refusing anything that
+// would escape the disk root.
+func (d *LocalDriver) resolve(objectPath string) (string, error) {
+	clean := path.Clean("/" + objectPath)
+	if clean == "/" || strings.Contains(objectPath, "..") {
+		return "", fmt.Errorf("invalid object path %q", objectPath)
+	}
+	return filepath.Join(d.root, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const DiskS3Main = "s3_main"
+
+// S3Driver talks to MinIO or any S3-compatible store. The client connects
+// lazily, so an unreachable server only fails the requests that need it.
+type S3Driver struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+}
+
+func NewS3Driver(endpoint, accessKey, secretKey, bucket string, secure bool) (*S3Driver, error) {
+	if bucket == "" {
+		bucket = "media-assets"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
+	}
+
+	return &S3Driver{client: client, bucket: bucket}, nil
+}
+
+// SetPublicURL serves objects from baseURL (e.g. a CDN in front of a
+// public-read bucket) rather than presigned links. Empty disables it.
+func (d *S3Driver) SetPublicURL(baseURL string) {
+	d.publicURL = strings.TrimRight(baseURL, "/")
+}
+
+func (d *S3Driver) PublicURL(path string) (string, bool) {
+	if d.publicURL == "" {
+		return "", false
+	}
+	return d.publicURL + "/" + (&url.URL{Path: path}).EscapedPath(), true
+}
+
+func (d *S3Driver) PresignPut(ctx context.Context, path, contentType string, expiry time.Duration) (string, error) {
+	u, err := d.client.PresignedPutObject(ctx, d.bucket, path, expiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (d *S3Driver) PresignGet(ctx context.Context, path string, expiry time.Duration) (string, error) {
+	u, err := d.client.PresignedGetObject(ctx, d.bucket, path, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed GET URL: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (d *S3Driver) Stat(ctx context.Context, path string) (*ObjectInfo, error) {
+	info, err := d.client.StatObject(ctx, d.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Path:         path,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (d *S3Driver) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	obj, err := d.client.GetObject(ctx, d.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller reads
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (d *S3Driver) Put(ctx context.Context, path string, r io.Reader, size int64, contentType string) error {
+	_, err := d.client.PutObject(ctx, d.bucket, path, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (d *S3Driver) Delete(ctx context.Context, path string) error {
+	return d.client.RemoveObject(ctx, d.bucket, path, minio.RemoveObjectOptions{})
+}
+
+func (d *S3Driver) Copy(ctx context.Context, srcPath, dstPath string) error {
+	_, err := d.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: d.bucket, Object: dstPath},
+		minio.CopySrcOptions{Bucket: d.bucket, Object: srcPath},
+	)
+	return err
+}
+
+func (d *S3Driver) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range d.client.ListObjects(ctx, d.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Path:         obj.Key,
+			Size:         obj.Size,
+			ContentType:  obj.ContentType,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+	}
+	return objects, nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+var ErrNotFound = errors.New("storage: object not found")
+
+type ObjectInfo struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Driver is one storage backend. Paths are slash-separated keys relative to
+// the disk root (e.g. "uploads/2024/01/02/<uuid>.jpg").
+type Driver interface {
+	// PresignPut returns a URL the client can PUT the object body to directly
+	PresignPut(ctx context.Context, path, contentType string, expiry time.Duration) (string, error)
+	PresignGet(ctx context.Context, path string, expiry time.Duration) (string, error)
+	Stat(ctx context.Context, path string) (*ObjectInfo, error)
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+	Put(ctx context.Context, path string, r io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, path string) error
+	Copy(ctx context.Context, srcPath, dstPath string) error
+	// List returns every object whose path starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// PublicURLer is implemented by drivers that can serve objects from a public
+// base URL (CDN or public-read bucket) instead of signing every request.
+type PublicURLer interface {
+	// PublicURL returns false when no public base URL is configured
+	PublicURL(path string) (string, bool)
+}
+
+// Registry maps MediaAsset.Disk names to drivers.
+type Registry struct {
+	drivers     map[string]Driver
+	defaultDisk string
+}
+
+func NewRegistry(defaultDisk string) *Registry {
+	return &Registry{drivers: make(map[string]Driver), defaultDisk: defaultDisk}
+}
+
+func (r *Registry) Register(name string, driver Driver) {
+	r.drivers[name] = driver
+}
+
+func (r *Registry) Disk(name string) (Driver, error) {
+	d, ok := r.drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("storage disk %q is not configured", name)
+	}
+	return d, nil
+}
+
+// Default is the disk new uploads are written to.
+func (r *Registry) Default() string {
+	return r.defaultDisk
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.drivers))
+	for name := range r.drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRegistryFromEnv configures the disks:
+//   - "local" is always available (LOCAL_STORAGE_ROOT, served by the API at API_BASE_URL)
+//   - "s3_main" is added when MINIO_ENDPOINT is set; MINIO_PUBLIC_URL serves it unsigned
+//
+// MEDIA_DISK picks the default; otherwise s3_main when configured, else local.
+func NewRegistryFromEnv() (*Registry, error) {
+	signingKey := os.Getenv("STORAGE_SIGNING_KEY")
+	if signingKey == "" {
+		signingKey = os.Getenv("JWT_SECRET")
+	}
+	if signingKey == "" {
+		return nil, errors.New("STORAGE_SIGNING_KEY or JWT_SECRET must be set to sign local storage URLs")
+	}
+
+	root := os.Getenv("LOCAL_STORAGE_ROOT")
+	if root == "" {
+		root = "storage"
+	}
+	baseURL := os.Getenv("API_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	local, err := NewLocalDriver(DiskLocal, root, baseURL, []byte(signingKey))
+	if err != nil {
+		return nil, err
+	}
+
+	drivers := map[string]Driver{DiskLocal: local}
+	defaultDisk := DiskLocal
+
+	if endpoint := os.Getenv("MINIO_ENDPOINT"); endpoint != "" {
+		s3, err := NewS3Driver(
+			endpoint,
+			os.Getenv("MINIO_ACCESS_KEY"),
+			os.Getenv("MINIO_SECRET_KEY"),
+			os.Getenv("MINIO_BUCKET"),
+			os.Getenv("MINIO_SECURE") == "true",
+		)
+		if err != nil {
+			return nil, err
+		}
+		s3.SetPublicURL(os.Getenv("MINIO_PUBLIC_URL"))
+		drivers[DiskS3Main] = s3
+		defaultDisk = DiskS3Main
+	}
+
+	if disk := os.Getenv("MEDIA_DISK"); disk != "" {
+		if _, ok := drivers[disk]; !ok {
+			return nil, fmt.Errorf("MEDIA_DISK %q is not configured", disk)
+		}
+		defaultDisk = disk
+	}
+
+	registry := NewRegistry(defaultDisk)
+	for name, d := range drivers {
+		registry.Register(name, d)
+	}
+	return registry, nil
+}
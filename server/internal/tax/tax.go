@@ -0,0 +1,169 @@
+// Package tax computes per-line taxes (PPN) from tax rules keyed by tax class,
+// customer type and region.
+package tax
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultClass applies to products without a TaxClass.
+const DefaultClass = "STANDARD"
+
+type Rounding string
+
+const (
+	RoundHalfUp Rounding = "HALF_UP"
+	RoundUp     Rounding = "UP"
+	RoundDown   Rounding = "DOWN"
+)
+
+// Config decides how prices relate to tax. With PricesIncludeTax the tax is
+// carved out of the price; otherwise it is added on top. Tax is rounded per
+// line to Decimals places.
+type Config struct {
+	PricesIncludeTax bool
+	Rounding         Rounding
+	Decimals         int
+}
+
+// ConfigFromEnv reads TAX_PRICES_INCLUDE_TAX (default true), TAX_ROUNDING
+// (HALF_UP, UP or DOWN; default HALF_UP) and TAX_DECIMALS (default 0, whole
+// rupiah).
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{PricesIncludeTax: true, Rounding: RoundHalfUp}
+
+	if v := os.Getenv("TAX_PRICES_INCLUDE_TAX"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("TAX_PRICES_INCLUDE_TAX: %w", err)
+		}
+		cfg.PricesIncludeTax = b
+	}
+	if v := os.Getenv("TAX_ROUNDING"); v != "" {
+		cfg.Rounding = Rounding(strings.ToUpper(v))
+		switch cfg.Rounding {
+		case RoundHalfUp, RoundUp, RoundDown:
+		default:
+			return cfg, fmt.Errorf("TAX_ROUNDING: unknown mode %q", v)
+		}
+	}
+	if v := os.Getenv("TAX_DECIMALS"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 || d > 4 {
+			return cfg, fmt.Errorf("TAX_DECIMALS: must be 0-4")
+		}
+		cfg.Decimals = d
+	}
+	return cfg, nil
+}
+
+func (c Config) round(v float64) float64 {
+	scale := math.Pow(10, float64(c.Decimals))
+	// Nudge away from float noise so 0.5 boundaries round as written
+	x := v*scale + math.Copysign(1e-9, v)
+	switch c.Rounding {
+	case RoundUp:
+		x = math.Ceil(x - 2e-9)
+	case RoundDown:
+		x = math.Floor(x)
+	default:
+		x = math.Round(x)
+	}
+	return x / scale
+}
+
+// Rule is a tax rate for a combination of class, customer type and region.
+// Empty fields match anything.
+type Rule struct {
+	ID           int
+	Name         string
+	TaxClass     string
+	CustomerType string
+	Region       string
+	Rate         float64 // 0.11 for 11%
+	Priority     int
+}
+
+// Buyer is who the sale is taxed for. Region is matched against both the
+// province and the city of the destination.
+type Buyer struct {
+	CustomerType string
+	Province     string
+	City         string
+}
+
+// Match returns the most specific rule for a line, or nil when none applies
+// (the line is untaxed). Ties go to the higher priority, then the lower ID.
+func Match(rules []Rule, class string, buyer Buyer) *Rule {
+	if class == "" {
+		class = DefaultClass
+	}
+	var best *Rule
+	bestScore := -1
+	for i := range rules {
+		r := &rules[i]
+		score, ok := r.score(class, buyer)
+		if !ok {
+			continue
+		}
+		if score > bestScore ||
+			(score == bestScore && (r.Priority > best.Priority || (r.Priority == best.Priority && r.ID < best.ID))) {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
+
+func (r *Rule) score(class string, buyer Buyer) (int, bool) {
+	score := 0
+	if r.TaxClass != "" {
+		if !strings.EqualFold(r.TaxClass, class) {
+			return 0, false
+		}
+		score += 4
+	}
+	if r.CustomerType != "" {
+		if !strings.EqualFold(r.CustomerType, buyer.CustomerType) {
+			return 0, false
+		}
+		score += 2
+	}
+	if r.Region != "" {
+		if !strings.EqualFold(r.Region, buyer.Province) && !strings.EqualFold(r.Region, buyer.City) {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// Line is the tax on one line amount.
+type Line struct {
+	Rate  float64
+	Net   float64 // Amount before tax
+	Tax   float64
+	Gross float64 // Amount the buyer pays
+}
+
+// Compute taxes amount at rate under the configured pricing mode.
+func (c Config) Compute(amount, rate float64) Line {
+	if rate <= 0 || amount <= 0 {
+		return Line{Net: amount, Gross: amount}
+	}
+	if c.PricesIncludeTax {
+		t := c.round(amount * rate / (1 + rate))
+		return Line{Rate: rate, Net: amount - t, Tax: t, Gross: amount}
+	}
+	t := c.round(amount * rate)
+	return Line{Rate: rate, Net: amount, Tax: t, Gross: amount + t}
+}
+
+// Exclusive is c with prices treated as tax-exclusive, as on supplier quotes.
+func (c Config) Exclusive() Config {
+	c.PricesIncludeTax = false
+	return c
+}